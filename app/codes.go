@@ -0,0 +1,135 @@
+package app
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var (
+	ErrInvalidCodeConfig = errors.New("invalid session code configuration")
+	ErrCodesExhausted    = errors.New("could not find a free session code")
+)
+
+// CodeGenerator makes candidate session codes. Candidates need not be unique:
+// the database rejects codes a live session already uses and the caller asks
+// for another.
+type CodeGenerator interface {
+	Generate() (string, error)
+}
+
+const (
+	CodeStyleAlphanumeric = "alphanumeric"
+	CodeStyleWords        = "words"
+
+	DefaultCodeLength   = 6
+	DefaultCodeWords    = 2
+	DefaultCodeAttempts = 5
+)
+
+// NewCodeGenerator builds the generator for a style. length is the number of
+// characters for alphanumeric codes and the number of words for word codes;
+// zero picks the style's default.
+func NewCodeGenerator(style string, length int) (CodeGenerator, error) {
+	switch style {
+	case "", CodeStyleAlphanumeric:
+		if length == 0 {
+			length = DefaultCodeLength
+		}
+		if length < 4 || length > 32 {
+			return nil, fmt.Errorf("%w: alphanumeric codes need 4 to 32 characters, got %d", ErrInvalidCodeConfig, length)
+		}
+		return AlphanumericCodes{Length: length}, nil
+	case CodeStyleWords:
+		if length == 0 {
+			length = DefaultCodeWords
+		}
+		if length < 1 || length > 4 {
+			return nil, fmt.Errorf("%w: word codes need 1 to 4 words, got %d", ErrInvalidCodeConfig, length)
+		}
+		return WordCodes{Words: length}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown style %q", ErrInvalidCodeConfig, style)
+	}
+}
+
+// codeAlphabet leaves out characters that are easily confused when read
+// aloud or written down: 0/O, 1/I/L, and U/V.
+const codeAlphabet = "23456789ABCDEFGHJKMNPQRSTWXYZ"
+
+// AlphanumericCodes are short codes like "K7PX3M".
+type AlphanumericCodes struct {
+	Length int
+}
+
+func (g AlphanumericCodes) Generate() (string, error) {
+	var b strings.Builder
+	b.Grow(g.Length)
+	for range g.Length {
+		i, err := randomIndex(len(codeAlphabet))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(codeAlphabet[i])
+	}
+	return b.String(), nil
+}
+
+// WordCodes are codes like "brave-otter-42": Words-1 adjectives, an animal,
+// and a two-digit number.
+type WordCodes struct {
+	Words int
+}
+
+func (g WordCodes) Generate() (string, error) {
+	parts := make([]string, 0, g.Words+1)
+	for i := range g.Words {
+		list := codeAdjectives
+		if i == g.Words-1 {
+			list = codeAnimals
+		}
+		n, err := randomIndex(len(list))
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, list[n])
+	}
+	n, err := randomIndex(90)
+	if err != nil {
+		return "", err
+	}
+	parts = append(parts, fmt.Sprint(10+n))
+	return strings.Join(parts, "-"), nil
+}
+
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("read random: %w", err)
+	}
+	return int(i.Int64()), nil
+}
+
+var codeAdjectives = []string{
+	"able", "amber", "bold", "brave", "bright", "brisk", "calm", "clever",
+	"cosy", "crisp", "curly", "daring", "eager", "fancy", "fast", "fierce",
+	"fluffy", "gentle", "giddy", "glad", "golden", "grand", "happy", "hardy",
+	"honest", "jolly", "keen", "kind", "lively", "lucky", "merry", "mighty",
+	"misty", "modest", "noble", "odd", "plucky", "polite", "proud", "quick",
+	"quiet", "rapid", "rosy", "rusty", "shiny", "silly", "sleepy", "sly",
+	"smart", "snowy", "sunny", "swift", "tidy", "tiny", "vivid", "warm",
+	"wavy", "wild", "windy", "wise", "witty", "young", "zany", "zesty",
+}
+
+var codeAnimals = []string{
+	"badger", "bat", "bear", "beaver", "bison", "camel", "cat", "crab",
+	"crane", "crow", "deer", "dingo", "dog", "dove", "duck", "eagle",
+	"eel", "elk", "ferret", "finch", "fox", "frog", "gecko", "goat",
+	"goose", "hare", "hawk", "heron", "horse", "ibis", "koala", "lemur",
+	"lion", "llama", "lynx", "mole", "moose", "mouse", "newt", "otter",
+	"owl", "panda", "parrot", "puffin", "quail", "rabbit", "raven", "robin",
+	"seal", "shark", "sheep", "sloth", "snail", "squid", "stoat", "swan",
+	"tiger", "toad", "trout", "turtle", "walrus", "whale", "wolf", "yak",
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNewCodeGenerator(t *testing.T) {
+	tests := []struct {
+		name    string
+		style   string
+		length  int
+		pattern string
+		wantErr bool
+	}{
+		{name: "default", pattern: `^[23456789ABCDEFGHJKMNPQRSTWXYZ]{6}$`},
+		{name: "long alphanumeric", style: CodeStyleAlphanumeric, length: 10, pattern: `^[23456789ABCDEFGHJKMNPQRSTWXYZ]{10}$`},
+		{name: "default words", style: CodeStyleWords, pattern: `^[a-z]+-[a-z]+-[1-9][0-9]$`},
+		{name: "three words", style: CodeStyleWords, length: 3, pattern: `^[a-z]+-[a-z]+-[a-z]+-[1-9][0-9]$`},
+		{name: "too short", style: CodeStyleAlphanumeric, length: 3, wantErr: true},
+		{name: "too many words", style: CodeStyleWords, length: 5, wantErr: true},
+		{name: "unknown style", style: "emoji", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := NewCodeGenerator(tt.style, tt.length)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCodeConfig) {
+					t.Fatalf("want ErrInvalidCodeConfig, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("new generator: %v", err)
+			}
+			re := regexp.MustCompile(tt.pattern)
+			for range 200 {
+				code, err := gen.Generate()
+				if err != nil {
+					t.Fatalf("generate: %v", err)
+				}
+				if !re.MatchString(code) {
+					t.Fatalf("code %q does not match %s", code, tt.pattern)
+				}
+			}
+		})
+	}
+}
+
+func TestCodeAlphabetUnambiguous(t *testing.T) {
+	if strings.ContainsAny(codeAlphabet, "01ILOUV") {
+		t.Fatalf("alphabet %q contains ambiguous characters", codeAlphabet)
+	}
+}
+
+func TestWordListsUsable(t *testing.T) {
+	for name, list := range map[string][]string{"adjectives": codeAdjectives, "animals": codeAnimals} {
+		seen := make(map[string]bool, len(list))
+		for _, word := range list {
+			if seen[word] {
+				t.Errorf("%s: duplicate word %q", name, word)
+			}
+			seen[word] = true
+			if !regexp.MustCompile(`^[a-z]+$`).MatchString(word) {
+				t.Errorf("%s: word %q should be plain lowercase letters", name, word)
+			}
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package app
+
+import (
+	"context"
+	"log"
+
+	"github.com/Kam1217/optio/internal/events"
+	"github.com/google/uuid"
+)
+
+// publishEvent sends a session event if a publisher is configured. Failing to
+// notify listeners never fails the operation that triggered the event.
+func publishEvent(ctx context.Context, publisher events.Publisher, eventType events.Type, sessionID uuid.UUID, data any) {
+	if publisher == nil {
+		return
+	}
+	event, err := events.New(eventType, sessionID, data)
+	if err != nil {
+		log.Printf("build %s event for session %s: %v", eventType, sessionID, err)
+		return
+	}
+	if err := publisher.Publish(ctx, event); err != nil {
+		log.Printf("publish %s event for session %s: %v", eventType, sessionID, err)
+	}
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/Kam1217/optio/internal/events"
+	"github.com/google/uuid"
+)
+
+const maxDisplayNameLength = 30
+
+var ErrInvalidDisplayName = errors.New("display name must be 1 to 30 printable characters")
+
+// GuestJoin is what someone without an account brings to a session: the code
+// or an invite token, and the name to show the others.
+type GuestJoin struct {
+	Code        string
+	Invite      string
+	DisplayName string
+}
+
+// Guest is a user created to join one session. Their username is the display
+// name with a random suffix, since display names need not be unique.
+type Guest struct {
+	UserID      uuid.UUID
+	Username    string
+	DisplayName string
+}
+
+// JoinAsGuest creates a guest user and adds them to the session in one
+// transaction, so a join that fails leaves no guest behind. The usual join
+// rules apply: a code only works for open sessions, and an invite gives its
+// role.
+func (s *SessionService) JoinAsGuest(ctx context.Context, req GuestJoin) (*database.Session, *Guest, error) {
+	displayName, err := normalizeDisplayName(req.DisplayName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		session database.Session
+		invite  *database.SessionInvite
+		role    = RoleParticipant
+	)
+	if req.Invite != "" {
+		var inv database.SessionInvite
+		session, inv, err = s.inviteSession(ctx, req.Invite)
+		invite, role = &inv, Role(inv.Role)
+	} else {
+		session, err = s.sessionByCode(ctx, req.Code)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	username, err := guestUsername(displayName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	user, err := qtx.CreateGuestUser(ctx, username)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create guest user: %w", err)
+	}
+	if _, err := joinTx(ctx, qtx, session, user.ID, role, invite); err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("commit guest join: %w", err)
+	}
+
+	publishEvent(ctx, s.Events, events.ParticipantJoined, session.ID, events.ParticipantData{UserID: user.ID, Role: string(role)})
+
+	return &session, &Guest{UserID: user.ID, Username: user.Username, DisplayName: displayName}, nil
+}
+
+func normalizeDisplayName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxDisplayNameLength {
+		return "", ErrInvalidDisplayName
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return "", ErrInvalidDisplayName
+		}
+	}
+	return name, nil
+}
+
+// guestUsername makes a username like "Sam#K7PX3M" that leaves the display
+// name readable and stays within the users table's length check.
+func guestUsername(displayName string) (string, error) {
+	suffix, err := AlphanumericCodes{Length: 6}.Generate()
+	if err != nil {
+		return "", err
+	}
+	return displayName + "#" + suffix, nil
+}
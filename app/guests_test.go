@@ -0,0 +1,56 @@
+package app
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDisplayName(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", in: "Sam", want: "Sam"},
+		{name: "trimmed", in: "  Sam  ", want: "Sam"},
+		{name: "single character", in: "A", want: "A"},
+		{name: "unicode", in: "Zoë 🎲", want: "Zoë 🎲"},
+		{name: "longest", in: strings.Repeat("é", 30), want: strings.Repeat("é", 30)},
+		{name: "empty", in: "   ", wantErr: true},
+		{name: "too long", in: strings.Repeat("a", 31), wantErr: true},
+		{name: "trailing newline", in: "Sam\n", want: "Sam"},
+		{name: "embedded control character", in: "S\x00am", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeDisplayName(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidDisplayName) {
+					t.Fatalf("want ErrInvalidDisplayName, got %q, %v", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("want %q, got %q, %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestGuestUsername(t *testing.T) {
+	pattern := regexp.MustCompile(`^Sam#[` + codeAlphabet + `]{6}$`)
+	first, err := guestUsername("Sam")
+	if err != nil {
+		t.Fatalf("guestUsername: %v", err)
+	}
+	if !pattern.MatchString(first) {
+		t.Fatalf("username %q does not look like Sam#XXXXXX", first)
+	}
+	second, _ := guestUsername("Sam")
+	if first == second {
+		t.Fatalf("two guests called Sam got the same username %q", first)
+	}
+}
@@ -0,0 +1,219 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/secret"
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidInvite    = errors.New("invalid invite")
+	ErrInviteNotFound   = errors.New("invite not found")
+	ErrInviteExpired    = errors.New("invite has expired")
+	ErrInviteRevoked    = errors.New("invite has been revoked")
+	ErrInviteUsedUp     = errors.New("invite has no uses left")
+	ErrOpenJoinDisabled = errors.New("session can only be joined with an invite")
+)
+
+// InviteOptions describes an invite to mint. Zero values mean no limit.
+type InviteOptions struct {
+	// Role is what people joining with the invite become; participant when
+	// empty.
+	Role      Role
+	MaxUses   int
+	ExpiresAt time.Time
+}
+
+// MintedInvite is a newly created invite. The token is only known at this
+// point: the database keeps a hash of it, like refresh tokens.
+type MintedInvite struct {
+	Invite database.SessionInvite
+	Token  string
+	Link   string
+}
+
+func (s *SessionService) mintInvite(ctx context.Context, queries *database.Queries, sessionID, createdBy uuid.UUID, opts InviteOptions) (*MintedInvite, error) {
+	plain, hash, err := secret.New()
+	if err != nil {
+		return nil, err
+	}
+	invite, err := queries.CreateSessionInvite(ctx, database.CreateSessionInviteParams{
+		SessionID:       sessionID,
+		TokenHash:       hash,
+		Role:            string(opts.Role),
+		MaxUses:         sql.NullInt32{Int32: int32(opts.MaxUses), Valid: opts.MaxUses > 0},
+		ExpiresAt:       nullTime(opts.ExpiresAt),
+		CreatedByUserID: uuid.NullUUID{UUID: createdBy, Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create invite: %w", err)
+	}
+
+	link, err := s.generateInviteLink(plain)
+	if err != nil {
+		return nil, fmt.Errorf("error generating invite link: %w", err)
+	}
+	return &MintedInvite{Invite: invite, Token: plain, Link: link}, nil
+}
+
+// CreateInvite mints an invite to the session. Invites that make people
+// co-hosts can only come from the host.
+func (s *SessionService) CreateInvite(ctx context.Context, sessionID, actorID uuid.UUID, opts InviteOptions) (*MintedInvite, error) {
+	if opts.Role == "" {
+		opts.Role = RoleParticipant
+	}
+	if !opts.Role.Valid() || opts.Role == RoleHost {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRole, opts.Role)
+	}
+	if opts.MaxUses < 0 {
+		return nil, fmt.Errorf("%w: max uses cannot be negative", ErrInvalidInvite)
+	}
+	if !opts.ExpiresAt.IsZero() && !opts.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expiry must be in the future", ErrInvalidInvite)
+	}
+
+	actor, err := requirePermission(ctx, s.queries, sessionID, actorID, PermManageParticipants)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Role == RoleCoHost && !actor.Can(PermManageCoHosts) {
+		return nil, fmt.Errorf("%w: only the host can invite co-hosts", ErrPermissionDenied)
+	}
+
+	return s.mintInvite(ctx, s.queries, sessionID, actorID, opts)
+}
+
+func (s *SessionService) ListInvites(ctx context.Context, sessionID, actorID uuid.UUID) ([]database.SessionInvite, error) {
+	if _, err := requirePermission(ctx, s.queries, sessionID, actorID, PermManageParticipants); err != nil {
+		return nil, err
+	}
+	invites, err := s.queries.ListSessionInvites(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("list invites: %w", err)
+	}
+	return invites, nil
+}
+
+// RevokeInvite stops an invite from letting anyone else in. People who
+// already joined with it stay.
+func (s *SessionService) RevokeInvite(ctx context.Context, sessionID, actorID, inviteID uuid.UUID) error {
+	if _, err := requirePermission(ctx, s.queries, sessionID, actorID, PermManageParticipants); err != nil {
+		return err
+	}
+	if _, err := s.queries.RevokeSessionInvite(ctx, database.RevokeSessionInviteParams{
+		ID:        inviteID,
+		SessionID: sessionID,
+	}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInviteNotFound
+		}
+		return fmt.Errorf("revoke invite: %w", err)
+	}
+	return nil
+}
+
+// InviteLink returns the join link for the invite token, after checking the
+// token belongs to the session and still works. Without a token it returns
+// the plain code link, which only sessions open to anyone with the code have.
+func (s *SessionService) InviteLink(ctx context.Context, sessionID, actorID uuid.UUID, token string) (string, error) {
+	m, err := requirePermission(ctx, s.queries, sessionID, actorID, PermManageParticipants)
+	if err != nil {
+		return "", err
+	}
+
+	if token == "" {
+		if !m.Session.OpenJoin {
+			return "", fmt.Errorf("%w: an invite token is needed unless the session is open to join", ErrInvalidInvite)
+		}
+		return s.codeLink(m.Session.SessionCode)
+	}
+
+	invite, err := s.queries.GetSessionInviteByHash(ctx, secret.Hash(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrInviteNotFound
+		}
+		return "", fmt.Errorf("get invite: %w", err)
+	}
+	if invite.SessionID != sessionID {
+		return "", ErrInviteNotFound
+	}
+	if err := inviteUnusable(invite, time.Now()); err != nil {
+		return "", err
+	}
+	return s.generateInviteLink(token)
+}
+
+// JoinWithInvite adds the user to the invite's session with the invite's
+// role. A use is only taken when the user actually joins; opening the link
+// again as an existing participant costs nothing.
+func (s *SessionService) JoinWithInvite(ctx context.Context, token string, userID uuid.UUID) (*database.Session, error) {
+	session, invite, err := s.inviteSession(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.join(ctx, session, userID, Role(invite.Role), &invite)
+}
+
+// inviteSession looks up the invite for a token and the session it opens.
+func (s *SessionService) inviteSession(ctx context.Context, token string) (database.Session, database.SessionInvite, error) {
+	invite, err := s.queries.GetSessionInviteByHash(ctx, secret.Hash(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Session{}, database.SessionInvite{}, ErrInviteNotFound
+		}
+		return database.Session{}, database.SessionInvite{}, fmt.Errorf("get invite: %w", err)
+	}
+
+	session, err := s.queries.GetActiveSessionByID(ctx, invite.SessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Session{}, database.SessionInvite{}, ErrSessionNotFound
+		}
+		return database.Session{}, database.SessionInvite{}, fmt.Errorf("get session: %w", err)
+	}
+	return session, invite, nil
+}
+
+// consumeInvite takes one use from the invite, explaining why when it cannot.
+func consumeInvite(ctx context.Context, qtx *database.Queries, invite database.SessionInvite) error {
+	_, err := qtx.ConsumeSessionInvite(ctx, invite.ID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("consume invite: %w", err)
+	}
+
+	// Read it again: it may have been revoked or used up since the caller
+	// looked it up.
+	current, err := qtx.GetSessionInviteByHash(ctx, invite.TokenHash)
+	if err != nil {
+		return fmt.Errorf("get invite: %w", err)
+	}
+	if err := inviteUnusable(current, time.Now()); err != nil {
+		return err
+	}
+	return ErrInviteUsedUp
+}
+
+// inviteUnusable says why an invite can no longer be used, or returns nil if
+// it still can.
+func inviteUnusable(invite database.SessionInvite, now time.Time) error {
+	switch {
+	case invite.RevokedAt.Valid:
+		return ErrInviteRevoked
+	case invite.ExpiresAt.Valid && !invite.ExpiresAt.Time.After(now):
+		return ErrInviteExpired
+	case invite.MaxUses.Valid && invite.UseCount >= invite.MaxUses.Int32:
+		return ErrInviteUsedUp
+	}
+	return nil
+}
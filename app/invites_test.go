@@ -0,0 +1,41 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/optio/internal/database"
+)
+
+func TestInviteUnusable(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		invite database.SessionInvite
+		want   error
+	}{
+		{name: "unlimited", invite: database.SessionInvite{UseCount: 40}},
+		{name: "uses left", invite: database.SessionInvite{MaxUses: sql.NullInt32{Int32: 2, Valid: true}, UseCount: 1}},
+		{name: "used up", invite: database.SessionInvite{MaxUses: sql.NullInt32{Int32: 2, Valid: true}, UseCount: 2}, want: ErrInviteUsedUp},
+		{name: "not yet expired", invite: database.SessionInvite{ExpiresAt: sql.NullTime{Time: now.Add(time.Second), Valid: true}}},
+		{name: "expired", invite: database.SessionInvite{ExpiresAt: sql.NullTime{Time: now, Valid: true}}, want: ErrInviteExpired},
+		{name: "revoked", invite: database.SessionInvite{RevokedAt: sql.NullTime{Time: now, Valid: true}}, want: ErrInviteRevoked},
+		{
+			name: "revoked wins over expired",
+			invite: database.SessionInvite{
+				RevokedAt: sql.NullTime{Time: now, Valid: true},
+				ExpiresAt: sql.NullTime{Time: now.Add(-time.Hour), Valid: true},
+			},
+			want: ErrInviteRevoked,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := inviteUnusable(tt.invite, now); !errors.Is(err, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
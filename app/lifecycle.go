@@ -0,0 +1,209 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/Kam1217/optio/internal/events"
+	"github.com/google/uuid"
+)
+
+type SessionStatus string
+
+const (
+	SessionPending    SessionStatus = "pending"
+	SessionCollecting SessionStatus = "collecting"
+	SessionVoting     SessionStatus = "voting"
+	SessionDecided    SessionStatus = "decided"
+	SessionArchived   SessionStatus = "archived"
+	SessionCancelled  SessionStatus = "cancelled"
+)
+
+// sessionTransitions lists where a session can go from each status. Archived
+// is final; the database rejects statuses not listed here.
+var sessionTransitions = map[SessionStatus][]SessionStatus{
+	SessionPending:    {SessionCollecting, SessionCancelled},
+	SessionCollecting: {SessionVoting, SessionCancelled},
+	SessionVoting:     {SessionDecided, SessionCancelled},
+	SessionDecided:    {SessionArchived},
+	SessionCancelled:  {SessionArchived},
+	SessionArchived:   nil,
+}
+
+var (
+	ErrInvalidStatus     = errors.New("invalid session status")
+	ErrIllegalTransition = errors.New("illegal session status transition")
+	ErrItemsClosed       = errors.New("session is no longer accepting items")
+	ErrVotingClosed      = errors.New("session is not open for voting")
+)
+
+func (s SessionStatus) Valid() bool {
+	_, ok := sessionTransitions[s]
+	return ok
+}
+
+func (s SessionStatus) CanTransitionTo(to SessionStatus) bool {
+	return slices.Contains(sessionTransitions[s], to)
+}
+
+func (s SessionStatus) Joinable() bool {
+	return s == SessionPending || s == SessionCollecting
+}
+
+func (s SessionStatus) AcceptsItems() bool {
+	return s == SessionPending || s == SessionCollecting
+}
+
+func (s SessionStatus) AcceptsVotes() bool {
+	return s == SessionVoting
+}
+
+// TransitionSession moves the session to another status on behalf of a host
+// or co-host. Moving a ballot session to decided tallies the votes and
+// records the winner.
+func (s *SessionService) TransitionSession(ctx context.Context, sessionID, actorID uuid.UUID, to SessionStatus) (*database.Session, error) {
+	if !to.Valid() {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidStatus, to)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	m, err := requirePermission(ctx, qtx, sessionID, actorID, PermManageVoting)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := transitionSession(ctx, qtx, m.Session, to, uuid.NullUUID{UUID: actorID, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transition: %w", err)
+	}
+
+	publishTransition(ctx, s.Events, m.Session, updated)
+	return &updated, nil
+}
+
+func (s *SessionService) StatusHistory(ctx context.Context, sessionID uuid.UUID) ([]database.SessionStatusHistory, error) {
+	history, err := s.queries.ListSessionStatusHistory(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("list status history: %w", err)
+	}
+	return history, nil
+}
+
+// transitionSession moves the session within the caller's transaction and
+// records the move. actor is invalid when the server moves the session
+// itself. The update is conditional on the status the caller read, so a
+// concurrent move makes this one fail rather than skip a step.
+func transitionSession(ctx context.Context, qtx *database.Queries, session database.Session, to SessionStatus, actor uuid.NullUUID) (database.Session, error) {
+	if to == SessionDecided {
+		winner, err := sessionWinner(ctx, qtx, session)
+		if err != nil {
+			return database.Session{}, err
+		}
+		return decideSession(ctx, qtx, session, winner, actor)
+	}
+
+	from := SessionStatus(session.Status)
+	if !from.CanTransitionTo(to) {
+		return database.Session{}, fmt.Errorf("%w: %s to %s", ErrIllegalTransition, from, to)
+	}
+
+	updated, err := qtx.TransitionSessionStatus(ctx, database.TransitionSessionStatusParams{
+		ID:         session.ID,
+		FromStatus: string(from),
+		ToStatus:   string(to),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Session{}, fmt.Errorf("%w: session is no longer %s", ErrIllegalTransition, from)
+		}
+		return database.Session{}, fmt.Errorf("update session status: %w", err)
+	}
+
+	if err := recordTransition(ctx, qtx, session.ID, from, to, actor); err != nil {
+		return database.Session{}, err
+	}
+	return updated, nil
+}
+
+// decideSession closes voting with the given winner, which may be invalid
+// when nothing won.
+func decideSession(ctx context.Context, qtx *database.Queries, session database.Session, winner, actor uuid.NullUUID) (database.Session, error) {
+	from := SessionStatus(session.Status)
+	if !from.CanTransitionTo(SessionDecided) {
+		if from == SessionDecided {
+			return database.Session{}, ErrSessionDecided
+		}
+		return database.Session{}, fmt.Errorf("%w: %s to %s", ErrIllegalTransition, from, SessionDecided)
+	}
+
+	decided, err := qtx.RecordSessionDecision(ctx, database.RecordSessionDecisionParams{
+		ID:            session.ID,
+		WinningItemID: winner,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Session{}, ErrSessionDecided
+		}
+		return database.Session{}, fmt.Errorf("record decision: %w", err)
+	}
+
+	if err := recordTransition(ctx, qtx, session.ID, from, SessionDecided, actor); err != nil {
+		return database.Session{}, err
+	}
+	return decided, nil
+}
+
+// sessionWinner picks the winner when voting is closed by hand or by a
+// deadline. Swipe sessions that reach this point had no match.
+func sessionWinner(ctx context.Context, qtx *database.Queries, session database.Session) (uuid.NullUUID, error) {
+	if SessionMode(session.Mode) != ModeBallot {
+		return uuid.NullUUID{}, nil
+	}
+	result, err := tallySession(ctx, qtx, session)
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	if result.Winner == nil {
+		return uuid.NullUUID{}, nil
+	}
+	return uuid.NullUUID{UUID: *result.Winner, Valid: true}, nil
+}
+
+func recordTransition(ctx context.Context, qtx *database.Queries, sessionID uuid.UUID, from, to SessionStatus, actor uuid.NullUUID) error {
+	if _, err := qtx.CreateSessionStatusHistory(ctx, database.CreateSessionStatusHistoryParams{
+		SessionID:       sessionID,
+		FromStatus:      string(from),
+		ToStatus:        string(to),
+		ChangedByUserID: actor,
+	}); err != nil {
+		return fmt.Errorf("record status history: %w", err)
+	}
+	return nil
+}
+
+func publishTransition(ctx context.Context, publisher events.Publisher, before, after database.Session) {
+	publishEvent(ctx, publisher, events.StatusChanged, after.ID, events.StatusData{
+		From: before.Status,
+		To:   after.Status,
+	})
+	if SessionStatus(after.Status) == SessionDecided {
+		var winner *uuid.UUID
+		if after.WinningItemID.Valid {
+			winner = &after.WinningItemID.UUID
+		}
+		publishEvent(ctx, publisher, events.ResultDecided, after.ID, events.ResultData{WinningItemID: winner})
+	}
+}
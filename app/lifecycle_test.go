@@ -0,0 +1,64 @@
+package app
+
+import "testing"
+
+func TestSessionTransitions(t *testing.T) {
+	all := []SessionStatus{
+		SessionPending, SessionCollecting, SessionVoting,
+		SessionDecided, SessionArchived, SessionCancelled,
+	}
+	allowed := map[[2]SessionStatus]bool{
+		{SessionPending, SessionCollecting}:   true,
+		{SessionPending, SessionCancelled}:    true,
+		{SessionCollecting, SessionVoting}:    true,
+		{SessionCollecting, SessionCancelled}: true,
+		{SessionVoting, SessionDecided}:       true,
+		{SessionVoting, SessionCancelled}:     true,
+		{SessionDecided, SessionArchived}:     true,
+		{SessionCancelled, SessionArchived}:   true,
+	}
+	for _, from := range all {
+		for _, to := range all {
+			want := allowed[[2]SessionStatus{from, to}]
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s -> %s: want %v, got %v", from, to, want, got)
+			}
+		}
+	}
+
+	for _, s := range []SessionStatus{"matched", "", "paused"} {
+		if s.Valid() {
+			t.Errorf("%q should not be a valid status", s)
+		}
+		if s.CanTransitionTo(SessionCollecting) {
+			t.Errorf("%q should not transition anywhere", s)
+		}
+	}
+}
+
+func TestSessionPhases(t *testing.T) {
+	tests := []struct {
+		status                 SessionStatus
+		joinable, items, votes bool
+	}{
+		{status: SessionPending, joinable: true, items: true},
+		{status: SessionCollecting, joinable: true, items: true},
+		{status: SessionVoting, votes: true},
+		{status: SessionDecided},
+		{status: SessionArchived},
+		{status: SessionCancelled},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			if got := tt.status.Joinable(); got != tt.joinable {
+				t.Errorf("Joinable: want %v, got %v", tt.joinable, got)
+			}
+			if got := tt.status.AcceptsItems(); got != tt.items {
+				t.Errorf("AcceptsItems: want %v, got %v", tt.items, got)
+			}
+			if got := tt.status.AcceptsVotes(); got != tt.votes {
+				t.Errorf("AcceptsVotes: want %v, got %v", tt.votes, got)
+			}
+		})
+	}
+}
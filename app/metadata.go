@@ -0,0 +1,217 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/Kam1217/optio/internal/database"
+)
+
+var ErrInvalidMetadata = errors.New("invalid item metadata")
+
+// schemaVersionKey is stored alongside every item's metadata fields so that
+// metadata written by an older release can be upgraded when it is read.
+const schemaVersionKey = "schema_version"
+
+// Metadata is the typed, source-specific part of a session item.
+type Metadata interface {
+	Validate() error
+}
+
+type CustomMetadata struct {
+	Link string   `json:"link,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+const (
+	maxCustomTags  = 20
+	maxCustomTagLn = 50
+)
+
+func (m CustomMetadata) Validate() error {
+	if m.Link != "" {
+		u, err := url.Parse(m.Link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("link must be an http or https URL")
+		}
+	}
+	if len(m.Tags) > maxCustomTags {
+		return fmt.Errorf("at most %d tags are allowed", maxCustomTags)
+	}
+	for _, tag := range m.Tags {
+		if tag == "" || len(tag) > maxCustomTagLn {
+			return fmt.Errorf("tags must be between 1 and %d characters", maxCustomTagLn)
+		}
+	}
+	return nil
+}
+
+func (m SteamMetadata) Validate() error {
+	if m.AppID == 0 {
+		return fmt.Errorf("app_id is required")
+	}
+	if m.CurrentPlayers != nil && *m.CurrentPlayers < 0 {
+		return fmt.Errorf("current_players cannot be negative")
+	}
+	return nil
+}
+
+// metadataUpgrade rewrites the fields of one schema version into the next.
+type metadataUpgrade func(fields map[string]json.RawMessage) error
+
+type metadataSchema struct {
+	version int
+	// upgrades[i] turns version i+1 into version i+2.
+	upgrades []metadataUpgrade
+	decode   func(data []byte, strict bool) (Metadata, error)
+}
+
+func newMetadataSchema[T Metadata](upgrades ...metadataUpgrade) metadataSchema {
+	return metadataSchema{
+		version:  len(upgrades) + 1,
+		upgrades: upgrades,
+		decode: func(data []byte, strict bool) (Metadata, error) {
+			var m T
+			dec := json.NewDecoder(bytes.NewReader(data))
+			if strict {
+				dec.DisallowUnknownFields()
+			}
+			if err := dec.Decode(&m); err != nil {
+				return nil, err
+			}
+			return m, nil
+		},
+	}
+}
+
+// metadataSchemas lists the source types items may have. A change to a
+// metadata struct that old rows can't be decoded into needs an upgrade
+// appended here, which bumps that source's schema version.
+var metadataSchemas = map[SourceType]metadataSchema{
+	SourceCustom: newMetadataSchema[CustomMetadata](),
+	SourceSteam:  newMetadataSchema[SteamMetadata](),
+}
+
+func metadataSchemaFor(source SourceType) (metadataSchema, error) {
+	schema, ok := metadataSchemas[source]
+	if !ok {
+		return metadataSchema{}, fmt.Errorf("%w: %q", ErrUnsupportedSource, source)
+	}
+	return schema, nil
+}
+
+func splitSchemaVersion(raw json.RawMessage) (map[string]json.RawMessage, int, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil || fields == nil {
+		return nil, 0, fmt.Errorf("%w: must be a JSON object", ErrInvalidMetadata)
+	}
+	// Metadata stored before versioning was introduced counts as version 1.
+	version := 1
+	if v, ok := fields[schemaVersionKey]; ok {
+		if err := json.Unmarshal(v, &version); err != nil || version < 1 {
+			return nil, 0, fmt.Errorf("%w: %s must be a positive integer", ErrInvalidMetadata, schemaVersionKey)
+		}
+		delete(fields, schemaVersionKey)
+	}
+	return fields, version, nil
+}
+
+func encodeMetadata(source SourceType, m Metadata) (json.RawMessage, error) {
+	schema, err := metadataSchemaFor(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMetadata, err)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s metadata: %w", source, err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("encode %s metadata: %w", source, err)
+	}
+	fields[schemaVersionKey], _ = json.Marshal(schema.version)
+	return json.Marshal(fields)
+}
+
+// ParseMetadata validates metadata supplied by a client for the given source
+// and returns it in its stored form. Unknown fields are rejected, and so is
+// any schema version other than the current one. Empty metadata is allowed
+// and stored as NULL.
+func ParseMetadata(source SourceType, raw json.RawMessage) (json.RawMessage, error) {
+	schema, err := metadataSchemaFor(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(raw)) == 0 || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return nil, nil
+	}
+
+	fields, version, err := splitSchemaVersion(raw)
+	if err != nil {
+		return nil, err
+	}
+	if version != schema.version {
+		return nil, fmt.Errorf("%w: %s metadata is at schema version %d", ErrInvalidMetadata, source, schema.version)
+	}
+	data, _ := json.Marshal(fields)
+	m, err := schema.decode(data, true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMetadata, err)
+	}
+	return encodeMetadata(source, m)
+}
+
+// DecodeMetadata reads stored metadata into the source's typed struct,
+// upgrading it from an older schema version first if needed. It returns nil
+// when the item has no metadata.
+func DecodeMetadata(source SourceType, raw json.RawMessage) (Metadata, error) {
+	schema, err := metadataSchemaFor(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	fields, version, err := splitSchemaVersion(raw)
+	if err != nil {
+		return nil, err
+	}
+	if version > schema.version {
+		return nil, fmt.Errorf("%w: %s metadata version %d is newer than %d", ErrInvalidMetadata, source, version, schema.version)
+	}
+	for v := version; v < schema.version; v++ {
+		if err := schema.upgrades[v-1](fields); err != nil {
+			return nil, fmt.Errorf("%w: upgrade %s metadata from version %d: %v", ErrInvalidMetadata, source, v, err)
+		}
+	}
+
+	data, _ := json.Marshal(fields)
+	m, err := schema.decode(data, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMetadata, err)
+	}
+	return m, nil
+}
+
+// GetMetadata decodes an item's metadata as T, which must be the metadata
+// type registered for the item's source.
+func GetMetadata[T Metadata](item database.SessionItem) (T, error) {
+	var zero T
+	m, err := DecodeMetadata(SourceType(item.SourceType), item.Metadata.RawMessage)
+	if err != nil || m == nil {
+		return zero, err
+	}
+	typed, ok := m.(T)
+	if !ok {
+		return zero, fmt.Errorf("%w: %s metadata is %T", ErrInvalidMetadata, item.SourceType, m)
+	}
+	return typed, nil
+}
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/sqlc-dev/pqtype"
+)
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  SourceType
+		raw     string
+		want    string
+		wantErr error
+	}{
+		{name: "empty", source: SourceCustom, raw: ``, want: ``},
+		{name: "null", source: SourceCustom, raw: `null`, want: ``},
+		{
+			name:   "custom fields get a version",
+			source: SourceCustom,
+			raw:    `{"link":"https://example.com","tags":["co-op"]}`,
+			want:   `{"link":"https://example.com","schema_version":1,"tags":["co-op"]}`,
+		},
+		{
+			name:   "current version accepted",
+			source: SourceCustom,
+			raw:    `{"schema_version":1,"tags":["a"]}`,
+			want:   `{"schema_version":1,"tags":["a"]}`,
+		},
+		{name: "unknown source", source: "itch", raw: `{}`, wantErr: ErrUnsupportedSource},
+		{name: "unknown field", source: SourceCustom, raw: `{"foo":"bar"}`, wantErr: ErrInvalidMetadata},
+		{name: "not an object", source: SourceCustom, raw: `["a"]`, wantErr: ErrInvalidMetadata},
+		{name: "bad link", source: SourceCustom, raw: `{"link":"javascript:alert(1)"}`, wantErr: ErrInvalidMetadata},
+		{name: "empty tag", source: SourceCustom, raw: `{"tags":[""]}`, wantErr: ErrInvalidMetadata},
+		{name: "future version", source: SourceCustom, raw: `{"schema_version":2}`, wantErr: ErrInvalidMetadata},
+		{name: "bad version", source: SourceCustom, raw: `{"schema_version":"one"}`, wantErr: ErrInvalidMetadata},
+		{name: "steam without app id", source: SourceSteam, raw: `{"genres":["Action"]}`, wantErr: ErrInvalidMetadata},
+		{name: "steam wrong type", source: SourceSteam, raw: `{"app_id":"620"}`, wantErr: ErrInvalidMetadata},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMetadata(tt.source, json.RawMessage(tt.raw))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("want %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("want %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeMetadata(t *testing.T) {
+	players := 12
+	tests := []struct {
+		name    string
+		source  SourceType
+		raw     string
+		want    Metadata
+		wantErr error
+	}{
+		{name: "no metadata", source: SourceSteam, raw: ``, want: nil},
+		{
+			name:   "steam",
+			source: SourceSteam,
+			raw:    `{"schema_version":1,"app_id":620,"genres":["Action"],"current_players":12}`,
+			want:   SteamMetadata{AppID: 620, Genres: []string{"Action"}, CurrentPlayers: &players},
+		},
+		{
+			name:   "unversioned rows read as version 1",
+			source: SourceCustom,
+			raw:    `{"tags":["x"]}`,
+			want:   CustomMetadata{Tags: []string{"x"}},
+		},
+		{
+			name:   "unknown fields ignored on read",
+			source: SourceCustom,
+			raw:    `{"schema_version":1,"legacy":true}`,
+			want:   CustomMetadata{},
+		},
+		{name: "newer version", source: SourceCustom, raw: `{"schema_version":9}`, wantErr: ErrInvalidMetadata},
+		{name: "unknown source", source: "itch", raw: `{}`, wantErr: ErrUnsupportedSource},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeMetadata(tt.source, json.RawMessage(tt.raw))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("want %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("want %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMetadataUpgrades(t *testing.T) {
+	schema := newMetadataSchema[CustomMetadata](func(fields map[string]json.RawMessage) error {
+		fields["link"] = fields["url"]
+		delete(fields, "url")
+		return nil
+	})
+	metadataSchemas["test"] = schema
+	t.Cleanup(func() { delete(metadataSchemas, "test") })
+
+	got, err := DecodeMetadata("test", json.RawMessage(`{"schema_version":1,"url":"https://example.com"}`))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.(CustomMetadata).Link != "https://example.com" {
+		t.Fatalf("upgrade not applied: %#v", got)
+	}
+}
+
+func TestGetMetadata(t *testing.T) {
+	item := database.SessionItem{
+		SourceType: string(SourceSteam),
+		Metadata:   pqtype.NullRawMessage{RawMessage: json.RawMessage(`{"schema_version":1,"app_id":620}`), Valid: true},
+	}
+
+	steam, err := GetMetadata[SteamMetadata](item)
+	if err != nil || steam.AppID != 620 {
+		t.Fatalf("GetMetadata[SteamMetadata] = %+v, %v", steam, err)
+	}
+	if _, err := GetMetadata[CustomMetadata](item); !errors.Is(err, ErrInvalidMetadata) {
+		t.Fatalf("decoding steam metadata as custom: want ErrInvalidMetadata, got %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/Kam1217/optio/internal/events"
+	"github.com/google/uuid"
+)
+
+type Role string
+
+const (
+	RoleHost        Role = "host"
+	RoleCoHost      Role = "co_host"
+	RoleParticipant Role = "participant"
+	RoleSpectator   Role = "spectator"
+)
+
+type Permission string
+
+const (
+	PermView Permission = "view"
+	// PermAddItem covers adding items and editing or removing one's own.
+	PermAddItem Permission = "add_item"
+	PermVote    Permission = "vote"
+	// PermManageItems covers editing and removing anyone's items.
+	PermManageItems Permission = "manage_items"
+	// PermManageVoting covers opening and closing the session's phases.
+	PermManageVoting       Permission = "manage_voting"
+	PermChangeSettings     Permission = "change_settings"
+	PermManageParticipants Permission = "manage_participants"
+	PermManageCoHosts      Permission = "manage_co_hosts"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleHost: {
+		PermView, PermAddItem, PermVote, PermManageItems, PermManageVoting,
+		PermChangeSettings, PermManageParticipants, PermManageCoHosts,
+	},
+	RoleCoHost: {
+		PermView, PermAddItem, PermVote, PermManageItems, PermManageVoting,
+		PermChangeSettings, PermManageParticipants,
+	},
+	RoleParticipant: {PermView, PermAddItem, PermVote},
+	RoleSpectator:   {PermView},
+}
+
+// rank orders roles by seniority. A user may only kick, ban or change the
+// role of someone ranked below them.
+var rank = map[Role]int{
+	RoleHost:        3,
+	RoleCoHost:      2,
+	RoleParticipant: 1,
+	RoleSpectator:   1,
+}
+
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (m Membership) Role() Role {
+	return Role(m.Participant.Role)
+}
+
+func (m Membership) Can(p Permission) bool {
+	return m.Role().Can(p)
+}
+
+var (
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrHostMustTransfer   = errors.New("the host must hand over the session before leaving")
+	ErrBannedFromSession  = errors.New("user is banned from this session")
+	ErrCannotTargetSelf   = errors.New("cannot do this to yourself")
+	ErrParticipantMissing = errors.New("user is not an active participant of this session")
+)
+
+// requirePermission loads the user's membership and checks their role allows p.
+func requirePermission(ctx context.Context, queries *database.Queries, sessionID, userID uuid.UUID, p Permission) (Membership, error) {
+	m, err := membership(ctx, queries, sessionID, userID)
+	if err != nil {
+		return Membership{}, err
+	}
+	if !m.Can(p) {
+		return Membership{}, fmt.Errorf("%w: %s cannot %s", ErrPermissionDenied, m.Role(), p)
+	}
+	return m, nil
+}
+
+// target loads the participant an action is aimed at and checks the actor
+// outranks them.
+func target(ctx context.Context, queries *database.Queries, actor Membership, userID uuid.UUID) (database.SessionParticipant, error) {
+	if userID == actor.Participant.UserID {
+		return database.SessionParticipant{}, ErrCannotTargetSelf
+	}
+	participant, err := queries.GetSessionParticipant(ctx, database.GetSessionParticipantParams{
+		UserID:    userID,
+		SessionID: actor.Session.ID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.SessionParticipant{}, ErrParticipantMissing
+		}
+		return database.SessionParticipant{}, fmt.Errorf("get session participant: %w", err)
+	}
+	if ParticipantStatus(participant.Status.String) != ParticipantActive {
+		return database.SessionParticipant{}, ErrParticipantMissing
+	}
+	if rank[actor.Role()] <= rank[Role(participant.Role)] {
+		return database.SessionParticipant{}, fmt.Errorf("%w: cannot act on a %s", ErrPermissionDenied, participant.Role)
+	}
+	return participant, nil
+}
+
+// SetRole changes another participant's role. Co-hosts can move people
+// between participant and spectator; only the host can appoint or remove
+// co-hosts. The host role itself moves with TransferHost.
+func (s *SessionService) SetRole(ctx context.Context, sessionID, actorID, userID uuid.UUID, role Role) error {
+	if !role.Valid() || role == RoleHost {
+		return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+
+	actor, err := requirePermission(ctx, s.queries, sessionID, actorID, PermManageParticipants)
+	if err != nil {
+		return err
+	}
+	if role == RoleCoHost && !actor.Can(PermManageCoHosts) {
+		return fmt.Errorf("%w: only the host can appoint co-hosts", ErrPermissionDenied)
+	}
+	participant, err := target(ctx, s.queries, actor, userID)
+	if err != nil {
+		return err
+	}
+	if Role(participant.Role) == role {
+		return nil
+	}
+
+	if err := s.queries.UpdateSessionParticipantRole(ctx, database.UpdateSessionParticipantRoleParams{
+		UserID:    userID,
+		SessionID: sessionID,
+		Role:      string(role),
+	}); err != nil {
+		return fmt.Errorf("update participant role: %w", err)
+	}
+
+	publishEvent(ctx, s.Events, events.ParticipantRoleChanged, sessionID, events.ParticipantData{UserID: userID, Role: string(role)})
+	return nil
+}
+
+// TransferHost makes another active participant the host. The previous host
+// stays on as a co-host.
+func (s *SessionService) TransferHost(ctx context.Context, sessionID, hostID, userID uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	host, err := requirePermission(ctx, qtx, sessionID, hostID, PermManageCoHosts)
+	if err != nil {
+		return err
+	}
+	if _, err := target(ctx, qtx, host, userID); err != nil {
+		return err
+	}
+
+	// Demote first: only one host per session is allowed at any time.
+	if err := qtx.UpdateSessionParticipantRole(ctx, database.UpdateSessionParticipantRoleParams{
+		UserID:    hostID,
+		SessionID: sessionID,
+		Role:      string(RoleCoHost),
+	}); err != nil {
+		return fmt.Errorf("demote host: %w", err)
+	}
+	if err := qtx.UpdateSessionParticipantRole(ctx, database.UpdateSessionParticipantRoleParams{
+		UserID:    userID,
+		SessionID: sessionID,
+		Role:      string(RoleHost),
+	}); err != nil {
+		return fmt.Errorf("promote new host: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit host transfer: %w", err)
+	}
+
+	publishEvent(ctx, s.Events, events.ParticipantRoleChanged, sessionID, events.ParticipantData{UserID: hostID, Role: string(RoleCoHost)})
+	publishEvent(ctx, s.Events, events.ParticipantRoleChanged, sessionID, events.ParticipantData{UserID: userID, Role: string(RoleHost)})
+	return nil
+}
+
+// RemoveParticipant kicks a participant out of the session. A kicked user can
+// rejoin with the session code; a banned one cannot.
+func (s *SessionService) RemoveParticipant(ctx context.Context, sessionID, actorID, userID uuid.UUID, ban bool) error {
+	actor, err := requirePermission(ctx, s.queries, sessionID, actorID, PermManageParticipants)
+	if err != nil {
+		return err
+	}
+	if _, err := target(ctx, s.queries, actor, userID); err != nil {
+		return err
+	}
+
+	status := ParticipantKicked
+	if ban {
+		status = ParticipantBanned
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	if err := qtx.UpdateSessionParticipantStatus(ctx, database.UpdateSessionParticipantStatusParams{
+		UserID:    userID,
+		SessionID: sessionID,
+		Status:    sql.NullString{String: string(status), Valid: true},
+	}); err != nil {
+		return fmt.Errorf("remove participant: %w", err)
+	}
+	decided, matched, err := matchRemaining(ctx, qtx, actor.Session)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit remove participant: %w", err)
+	}
+
+	publishEvent(ctx, s.Events, events.ParticipantLeft, sessionID, events.ParticipantData{UserID: userID, Reason: string(status)})
+	if matched {
+		publishTransition(ctx, s.Events, actor.Session, decided)
+	}
+	return nil
+}
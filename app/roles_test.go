@@ -0,0 +1,50 @@
+package app
+
+import "testing"
+
+func TestRolePermissions(t *testing.T) {
+	all := []Permission{
+		PermView, PermAddItem, PermVote, PermManageItems, PermManageVoting,
+		PermChangeSettings, PermManageParticipants, PermManageCoHosts,
+	}
+	tests := []struct {
+		role Role
+		want []Permission
+	}{
+		{role: RoleHost, want: all},
+		{role: RoleCoHost, want: []Permission{
+			PermView, PermAddItem, PermVote, PermManageItems, PermManageVoting,
+			PermChangeSettings, PermManageParticipants,
+		}},
+		{role: RoleParticipant, want: []Permission{PermView, PermAddItem, PermVote}},
+		{role: RoleSpectator, want: []Permission{PermView}},
+		{role: "owner", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role), func(t *testing.T) {
+			granted := make(map[Permission]bool)
+			for _, p := range tt.want {
+				granted[p] = true
+			}
+			for _, p := range all {
+				if got := tt.role.Can(p); got != granted[p] {
+					t.Errorf("%s.Can(%s) = %v, want %v", tt.role, p, got, granted[p])
+				}
+			}
+		})
+	}
+}
+
+func TestRoleRank(t *testing.T) {
+	if rank[RoleHost] <= rank[RoleCoHost] || rank[RoleCoHost] <= rank[RoleParticipant] {
+		t.Fatalf("host must outrank co-host, who must outrank participants: %v", rank)
+	}
+	if rank[RoleParticipant] != rank[RoleSpectator] {
+		t.Fatalf("participants and spectators should rank equally: %v", rank)
+	}
+	for role := range rolePermissions {
+		if _, ok := rank[role]; !ok {
+			t.Errorf("role %s has no rank", role)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/Kam1217/optio/internal/events"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultSchedulerInterval = 15 * time.Second
+	// maxAdvancesPerTick bounds one tick so a backlog of overdue sessions
+	// cannot hold the loop up indefinitely; the rest wait for the next tick.
+	maxAdvancesPerTick = 100
+)
+
+// Scheduler moves sessions on when their deadlines pass: collect_until closes
+// item collection and opens voting, and vote_until closes voting with a
+// result. Every session is claimed with FOR UPDATE SKIP LOCKED, so each
+// replica can run its own scheduler against the same database.
+type Scheduler struct {
+	db       *sql.DB
+	queries  *database.Queries
+	Events   events.Publisher
+	Interval time.Duration
+	// Now is the scheduler's clock. Tests replace it to move time on.
+	Now func() time.Time
+}
+
+func NewScheduler(db *sql.DB, queries *database.Queries) *Scheduler {
+	return &Scheduler{
+		db:       db,
+		queries:  queries,
+		Interval: DefaultSchedulerInterval,
+		Now:      time.Now,
+	}
+}
+
+// Run advances due sessions every Interval until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultSchedulerInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Tick(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("advance due sessions: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick advances sessions whose deadlines have passed and reports how many it
+// moved. A session that fails to advance is logged and left for the next
+// tick, so one bad row cannot hold up every other due session.
+func (s *Scheduler) Tick(ctx context.Context) (int, error) {
+	advanced := 0
+	var failed []uuid.UUID
+	for advanced+len(failed) < maxAdvancesPerTick {
+		sessionID, err := s.advanceNext(ctx, failed)
+		if err != nil {
+			if sessionID == uuid.Nil || ctx.Err() != nil {
+				return advanced, err
+			}
+			log.Printf("advance due session %s: %v", sessionID, err)
+			failed = append(failed, sessionID)
+			continue
+		}
+		if sessionID == uuid.Nil {
+			break
+		}
+		advanced++
+	}
+	return advanced, nil
+}
+
+// advanceNext claims one due session, other than those in skip, and walks it
+// through every phase whose deadline has passed, in a single transaction. It
+// returns the session it claimed, or uuid.Nil when none are due; an error
+// with a session ID means that session could not be advanced.
+func (s *Scheduler) advanceNext(ctx context.Context, skip []uuid.UUID) (uuid.UUID, error) {
+	now := s.Now()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	session, err := qtx.ClaimDueSession(ctx, database.ClaimDueSessionParams{Now: now, Skip: skip})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, nil
+		}
+		return uuid.Nil, fmt.Errorf("claim due session: %w", err)
+	}
+
+	steps := duePhases(session, now)
+	if len(steps) == 0 {
+		return session.ID, fmt.Errorf("session is %s with no phase due", session.Status)
+	}
+	states := []database.Session{session}
+	for _, to := range steps {
+		next, err := transitionSession(ctx, qtx, states[len(states)-1], to, uuid.NullUUID{})
+		if err != nil {
+			return session.ID, fmt.Errorf("advance to %s: %w", to, err)
+		}
+		states = append(states, next)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return session.ID, fmt.Errorf("commit advance: %w", err)
+	}
+
+	for i := 1; i < len(states); i++ {
+		publishTransition(ctx, s.Events, states[i-1], states[i])
+	}
+	return session.ID, nil
+}
+
+// duePhases lists the statuses a session steps through once its deadlines are
+// measured against now. A pending session whose collection deadline passed
+// goes through collecting on its way to voting.
+func duePhases(session database.Session, now time.Time) []SessionStatus {
+	var steps []SessionStatus
+	status := SessionStatus(session.Status)
+	if status == SessionPending && passed(session.CollectUntil, now) {
+		status = SessionCollecting
+		steps = append(steps, status)
+	}
+	if status == SessionCollecting && passed(session.CollectUntil, now) {
+		status = SessionVoting
+		steps = append(steps, status)
+	}
+	if status == SessionVoting && passed(session.VoteUntil, now) {
+		steps = append(steps, SessionDecided)
+	}
+	return steps
+}
+
+func passed(deadline sql.NullTime, now time.Time) bool {
+	return deadline.Valid && !deadline.Time.After(now)
+}
+
+// validateDeadlines checks the deadlines a session would end up with. Only
+// deadlines being set now have to be in the future; ones set earlier may
+// already have passed.
+func validateDeadlines(collectUntil, voteUntil sql.NullTime, settingCollect, settingVote bool, now time.Time) error {
+	if settingCollect && collectUntil.Valid && !collectUntil.Time.After(now) {
+		return fmt.Errorf("%w: collect_until must be in the future", ErrInvalidSettings)
+	}
+	if settingVote && voteUntil.Valid && !voteUntil.Time.After(now) {
+		return fmt.Errorf("%w: vote_until must be in the future", ErrInvalidSettings)
+	}
+	if collectUntil.Valid && voteUntil.Valid && !voteUntil.Time.After(collectUntil.Time) {
+		return fmt.Errorf("%w: vote_until must be after collect_until", ErrInvalidSettings)
+	}
+	return nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
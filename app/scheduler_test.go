@@ -0,0 +1,77 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/optio/internal/database"
+)
+
+func TestDuePhases(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	past := sql.NullTime{Time: now.Add(-time.Minute), Valid: true}
+	future := sql.NullTime{Time: now.Add(time.Minute), Valid: true}
+	exact := sql.NullTime{Time: now, Valid: true}
+
+	tests := []struct {
+		name                    string
+		status                  SessionStatus
+		collectUntil, voteUntil sql.NullTime
+		want                    []SessionStatus
+	}{
+		{name: "no deadlines", status: SessionCollecting},
+		{name: "collection still open", status: SessionCollecting, collectUntil: future},
+		{name: "collection closed", status: SessionCollecting, collectUntil: past, want: []SessionStatus{SessionVoting}},
+		{name: "deadline is now", status: SessionCollecting, collectUntil: exact, want: []SessionStatus{SessionVoting}},
+		{name: "pending passes through collecting", status: SessionPending, collectUntil: past,
+			want: []SessionStatus{SessionCollecting, SessionVoting}},
+		{name: "both deadlines passed", status: SessionCollecting, collectUntil: past, voteUntil: past,
+			want: []SessionStatus{SessionVoting, SessionDecided}},
+		{name: "voting still open", status: SessionVoting, collectUntil: past, voteUntil: future},
+		{name: "voting closed", status: SessionVoting, voteUntil: past, want: []SessionStatus{SessionDecided}},
+		{name: "vote deadline ignored while collecting", status: SessionCollecting, voteUntil: past},
+		{name: "decided", status: SessionDecided, collectUntil: past, voteUntil: past},
+		{name: "cancelled", status: SessionCancelled, collectUntil: past, voteUntil: past},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := database.Session{Status: string(tt.status), CollectUntil: tt.collectUntil, VoteUntil: tt.voteUntil}
+			if got := duePhases(session, now); !slices.Equal(got, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateDeadlines(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(d), Valid: true} }
+
+	tests := []struct {
+		name                        string
+		collectUntil, voteUntil     sql.NullTime
+		settingCollect, settingVote bool
+		wantErr                     bool
+	}{
+		{name: "none"},
+		{name: "both in order", collectUntil: at(time.Hour), voteUntil: at(2 * time.Hour), settingCollect: true, settingVote: true},
+		{name: "new deadline in the past", collectUntil: at(-time.Hour), settingCollect: true, wantErr: true},
+		{name: "earlier deadline already passed", collectUntil: at(-time.Hour), voteUntil: at(time.Hour), settingVote: true},
+		{name: "voting closes before collection", collectUntil: at(2 * time.Hour), voteUntil: at(time.Hour), settingVote: true, wantErr: true},
+		{name: "same instant", collectUntil: at(time.Hour), voteUntil: at(time.Hour), settingCollect: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDeadlines(tt.collectUntil, tt.voteUntil, tt.settingCollect, tt.settingVote, now)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("want error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidSettings) {
+				t.Fatalf("want ErrInvalidSettings, got %v", err)
+			}
+		})
+	}
+}
@@ -2,51 +2,168 @@ package app
 
 import (
 	"context"
-	"crypto/rand"
 	"database/sql"
 	"errors"
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/Kam1217/optio/internal/database"
+	"github.com/Kam1217/optio/internal/events"
 	"github.com/google/uuid"
 )
 
 type SessionService struct {
+	db        *sql.DB
 	queries   *database.Queries
 	InviteURL string
+	Events    events.Publisher
+	// Codes makes session codes and CodeAttempts caps how many it may draw
+	// for one session before giving up.
+	Codes        CodeGenerator
+	CodeAttempts int
+	// RequireVerifiedCreators stops people who have not verified their email
+	// from creating sessions.
+	RequireVerifiedCreators bool
 }
 
-func NewSessionService(queries *database.Queries, inviteURL string) *SessionService {
-	return &SessionService{queries: queries, InviteURL: inviteURL}
+func NewSessionService(db *sql.DB, queries *database.Queries, inviteURL string) *SessionService {
+	return &SessionService{
+		db:           db,
+		queries:      queries,
+		InviteURL:    inviteURL,
+		Codes:        AlphanumericCodes{Length: DefaultCodeLength},
+		CodeAttempts: DefaultCodeAttempts,
+	}
+}
+
+type SessionMode string
+
+const (
+	ModeBallot SessionMode = "ballot"
+	ModeSwipe  SessionMode = "swipe"
+)
+
+type ParticipantStatus string
+
+const (
+	ParticipantActive ParticipantStatus = "active"
+	ParticipantLeft   ParticipantStatus = "left"
+	ParticipantKicked ParticipantStatus = "kicked"
+	ParticipantBanned ParticipantStatus = "banned"
+)
+
+var (
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrSessionNotJoinable = errors.New("session is not open for joining")
+	ErrNotParticipant     = errors.New("user is not a participant of this session")
+	ErrUnknownSessionMode = errors.New("unknown session mode")
+	ErrWrongSessionMode   = errors.New("not available in this session mode")
+	ErrSessionDecided     = errors.New("session has already been decided")
+	ErrEmailNotVerified   = errors.New("email address has not been verified")
+)
+
+// Membership is a user's standing in a session they have joined.
+type Membership struct {
+	Session     database.Session
+	Participant database.SessionParticipant
 }
 
-func (s *SessionService) CheckSessionCodeExists(ctx context.Context, code string) (bool, error) {
-	_, err := s.queries.GetActiveSessionByCode(ctx, code)
+// membership loads the session and confirms the user is an active
+// participant of it.
+func membership(ctx context.Context, queries *database.Queries, sessionID, userID uuid.UUID) (Membership, error) {
+	session, err := queries.GetActiveSessionByID(ctx, sessionID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return false, nil
+			return Membership{}, ErrSessionNotFound
 		}
-		return false, fmt.Errorf("database error checking session code: %w", err)
+		return Membership{}, fmt.Errorf("get session: %w", err)
 	}
 
-	return true, nil
+	participant, err := queries.GetSessionParticipant(ctx, database.GetSessionParticipantParams{
+		UserID:    userID,
+		SessionID: sessionID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Membership{}, ErrNotParticipant
+		}
+		return Membership{}, fmt.Errorf("get session participant: %w", err)
+	}
+	if ParticipantStatus(participant.Status.String) != ParticipantActive {
+		return Membership{}, ErrNotParticipant
+	}
+
+	return Membership{Session: session, Participant: participant}, nil
+}
+
+// participantSession loads the session and confirms the user has joined it.
+func participantSession(ctx context.Context, queries *database.Queries, sessionID, userID uuid.UUID) (database.Session, error) {
+	m, err := membership(ctx, queries, sessionID, userID)
+	if err != nil {
+		return database.Session{}, err
+	}
+	return m.Session, nil
 }
 
-func (s *SessionService) generateUniqueSessionCode(ctx context.Context) (string, error) {
-	for {
-		code := rand.Text()
-		exists, err := s.CheckSessionCodeExists(ctx, code)
+// Membership returns the user's membership of the session, or
+// ErrNotParticipant if they are not an active participant.
+func (s *SessionService) Membership(ctx context.Context, sessionID, userID uuid.UUID) (*Membership, error) {
+	m, err := membership(ctx, s.queries, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ItemMembership resolves the session an item belongs to and returns the
+// user's membership of it.
+func (s *SessionService) ItemMembership(ctx context.Context, itemID, userID uuid.UUID) (*Membership, error) {
+	item, err := s.queries.GetSessionItemByID(ctx, itemID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrItemNotFound
+		}
+		return nil, fmt.Errorf("get session item: %w", err)
+	}
+	return s.Membership(ctx, item.SessionID, userID)
+}
+
+// createWithFreeCode inserts the session under a fresh code, drawing another
+// whenever a live session already holds the one drawn. The unique index on
+// live codes decides, so two sessions created at once cannot end up sharing.
+func (s *SessionService) createWithFreeCode(ctx context.Context, qtx *database.Queries, params database.CreateSessionParams) (database.Session, error) {
+	attempts := s.CodeAttempts
+	if attempts <= 0 {
+		attempts = DefaultCodeAttempts
+	}
+	for range attempts {
+		code, err := s.Codes.Generate()
 		if err != nil {
-			return "", fmt.Errorf("error verifying if code exists: %w", err)
+			return database.Session{}, fmt.Errorf("generate session code: %w", err)
 		}
-		if !exists {
-			return code, nil
+		params.SessionCode = code
+		session, err := qtx.CreateSession(ctx, params)
+		if err == nil {
+			return session, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return database.Session{}, fmt.Errorf("failed to create session in db: %w", err)
 		}
 	}
+	return database.Session{}, fmt.Errorf("%w after %d attempts", ErrCodesExhausted, attempts)
+}
+
+func (s *SessionService) generateInviteLink(token string) (string, error) {
+	return s.joinLink("invite", token)
+}
+
+// codeLink is the join link for sessions open to anyone with the code.
+func (s *SessionService) codeLink(code string) (string, error) {
+	return s.joinLink("code", code)
 }
 
-func (s *SessionService) generateInviteLink(sessionCode string) (string, error) {
+func (s *SessionService) joinLink(key, value string) (string, error) {
 	if s.InviteURL == "" {
 		return "", fmt.Errorf("invite URL is not configured")
 	}
@@ -56,31 +173,387 @@ func (s *SessionService) generateInviteLink(sessionCode string) (string, error)
 	}
 
 	q := link.Query()
-	q.Set("code", sessionCode)
+	q.Set(key, value)
 	link.RawQuery = q.Encode()
 
 	return link.String(), nil
 }
 
-func (s *SessionService) CreateNewSession(ctx context.Context, sessionName string, creatorID uuid.UUID) (*database.Session, string, error) {
-	sessionCode, err := s.generateUniqueSessionCode(ctx)
+type SessionOptions struct {
+	VotingMethod VotingMethod
+	Mode         SessionMode
+	// MatchThreshold is the number of likes a swipe item needs to match.
+	// Zero means every active participant has to like it.
+	MatchThreshold int
+	// CollectUntil and VoteUntil are optional deadlines after which the
+	// scheduler closes item collection and voting. Zero means no deadline.
+	CollectUntil time.Time
+	VoteUntil    time.Time
+	// OpenJoin lets anyone with the session code join. Otherwise people need
+	// an invite.
+	OpenJoin bool
+	// RequireVerified only lets people with a verified email join, which
+	// leaves guests out.
+	RequireVerified bool
+}
+
+func (s *SessionService) CreateNewSession(ctx context.Context, sessionName string, creatorID uuid.UUID, opts SessionOptions) (*database.Session, string, error) {
+	if opts.VotingMethod == "" {
+		opts.VotingMethod = VotingPlurality
+	}
+	if _, err := TallierFor(opts.VotingMethod); err != nil {
+		return nil, "", err
+	}
+	if opts.Mode == "" {
+		opts.Mode = ModeBallot
+	}
+	if opts.Mode != ModeBallot && opts.Mode != ModeSwipe {
+		return nil, "", fmt.Errorf("%w: %q", ErrUnknownSessionMode, opts.Mode)
+	}
+	collectUntil, voteUntil := nullTime(opts.CollectUntil), nullTime(opts.VoteUntil)
+	if err := validateDeadlines(collectUntil, voteUntil, collectUntil.Valid, voteUntil.Valid, time.Now()); err != nil {
+		return nil, "", err
+	}
+	if s.RequireVerifiedCreators {
+		verified, err := emailVerified(ctx, s.queries, creatorID)
+		if err != nil {
+			return nil, "", err
+		}
+		if !verified {
+			return nil, "", ErrEmailNotVerified
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, "", fmt.Errorf("error generating session code: %w", err)
+		return nil, "", fmt.Errorf("begin tx: %w", err)
 	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
 
-	session, err := s.queries.CreateSession(ctx, database.CreateSessionParams{
-		SessionCode:   sessionCode,
+	session, err := s.createWithFreeCode(ctx, qtx, database.CreateSessionParams{
 		SessionName:   sessionName,
 		CreatorUserID: creatorID,
+		VotingMethod:  string(opts.VotingMethod),
+		Mode:          string(opts.Mode),
+		MatchThreshold: sql.NullInt32{
+			Int32: int32(opts.MatchThreshold),
+			Valid: opts.MatchThreshold > 0,
+		},
+		CollectUntil:    collectUntil,
+		VoteUntil:       voteUntil,
+		OpenJoin:        opts.OpenJoin,
+		RequireVerified: opts.RequireVerified,
 	})
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to create session in db: %w", err)
+		return nil, "", err
+	}
+
+	if _, err := qtx.CreateSessionParticipant(ctx, database.CreateSessionParticipantParams{
+		UserID:    creatorID,
+		SessionID: session.ID,
+		Status:    sql.NullString{String: string(ParticipantActive), Valid: true},
+		Role:      string(RoleHost),
+	}); err != nil {
+		return nil, "", fmt.Errorf("failed to add creator as participant: %w", err)
+	}
+
+	// Every session starts with an open-ended invite the host can share
+	// straight away, and revoke if it gets passed around too far.
+	invite, err := s.mintInvite(ctx, qtx, session.ID, creatorID, InviteOptions{Role: RoleParticipant})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("commit session: %w", err)
+	}
+
+	return &session, invite.Link, nil
+}
+
+// JoinSession adds the user to the session identified by code. Codes only
+// work for sessions the host has opened up; otherwise an invite is needed.
+// Joining a session the user is already part of is not an error and returns
+// the session unchanged.
+func (s *SessionService) JoinSession(ctx context.Context, code string, userID uuid.UUID) (*database.Session, error) {
+	session, err := s.sessionByCode(ctx, code)
+	if err != nil {
+		return nil, err
 	}
 
-	inviteLink, err := s.generateInviteLink(sessionCode)
+	return s.join(ctx, session, userID, RoleParticipant, nil)
+}
+
+func (s *SessionService) sessionByCode(ctx context.Context, code string) (database.Session, error) {
+	session, err := s.queries.GetActiveSessionByCode(ctx, code)
 	if err != nil {
-		return nil, "", fmt.Errorf("error generating invite link: %w", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Session{}, ErrSessionNotFound
+		}
+		return database.Session{}, fmt.Errorf("get session by code: %w", err)
 	}
+	return session, nil
+}
 
-	return &session, inviteLink, nil
+// join adds the user to the session with the given role. With an invite, a
+// use is taken from it in the same transaction; without one, the session must
+// be open to anyone with the code.
+func (s *SessionService) join(ctx context.Context, session database.Session, userID uuid.UUID, role Role, invite *database.SessionInvite) (*database.Session, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	joined, err := joinTx(ctx, qtx, session, userID, role, invite)
+	if err != nil {
+		return nil, err
+	}
+	if !joined {
+		return &session, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit join: %w", err)
+	}
+
+	publishEvent(ctx, s.Events, events.ParticipantJoined, session.ID, events.ParticipantData{UserID: userID, Role: string(role)})
+
+	return &session, nil
+}
+
+// joinTx does the work of join within the caller's transaction. It reports
+// false when the user was already an active participant, in which case there
+// is nothing to commit.
+func joinTx(ctx context.Context, qtx *database.Queries, session database.Session, userID uuid.UUID, role Role, invite *database.SessionInvite) (bool, error) {
+	participant, err := qtx.GetSessionParticipant(ctx, database.GetSessionParticipantParams{
+		UserID:    userID,
+		SessionID: session.ID,
+	})
+	if err == nil && ParticipantStatus(participant.Status.String) == ParticipantActive {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("get session participant: %w", err)
+	}
+	rejoining := err == nil
+	if rejoining && ParticipantStatus(participant.Status.String) == ParticipantBanned {
+		return false, ErrBannedFromSession
+	}
+
+	if !SessionStatus(session.Status).Joinable() {
+		return false, ErrSessionNotJoinable
+	}
+	if invite == nil && !session.OpenJoin {
+		return false, ErrOpenJoinDisabled
+	}
+	if session.RequireVerified {
+		verified, err := emailVerified(ctx, qtx, userID)
+		if err != nil {
+			return false, err
+		}
+		if !verified {
+			return false, ErrEmailNotVerified
+		}
+	}
+	if invite != nil {
+		if err := consumeInvite(ctx, qtx, *invite); err != nil {
+			return false, err
+		}
+	}
+
+	if rejoining {
+		// Whatever role they held before, people coming back get the role
+		// they are joining with now.
+		err = qtx.RejoinSessionParticipant(ctx, database.RejoinSessionParticipantParams{
+			UserID:    userID,
+			SessionID: session.ID,
+			Role:      string(role),
+		})
+		if err != nil {
+			return false, fmt.Errorf("reactivate session participant: %w", err)
+		}
+	} else {
+		_, err = qtx.CreateSessionParticipant(ctx, database.CreateSessionParticipantParams{
+			UserID:    userID,
+			SessionID: session.ID,
+			Status:    sql.NullString{String: string(ParticipantActive), Valid: true},
+			Role:      string(role),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// Another request joined the same user first; rolling back
+			// gives the invite its use back.
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("create session participant: %w", err)
+		}
+	}
+
+	return true, nil
+}
+
+func (s *SessionService) LeaveSession(ctx context.Context, sessionID, userID uuid.UUID) error {
+	m, err := membership(ctx, s.queries, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if m.Role() == RoleHost {
+		return ErrHostMustTransfer
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	err = qtx.UpdateSessionParticipantStatus(ctx, database.UpdateSessionParticipantStatusParams{
+		UserID:    userID,
+		SessionID: sessionID,
+		Status:    sql.NullString{String: string(ParticipantLeft), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("leave session: %w", err)
+	}
+	decided, matched, err := matchRemaining(ctx, qtx, m.Session)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit leave: %w", err)
+	}
+
+	publishEvent(ctx, s.Events, events.ParticipantLeft, sessionID, events.ParticipantData{UserID: userID})
+	if matched {
+		publishTransition(ctx, s.Events, m.Session, decided)
+	}
+
+	return nil
+}
+
+func (s *SessionService) GetSession(ctx context.Context, sessionID, userID uuid.UUID) (*database.Session, error) {
+	session, err := participantSession(ctx, s.queries, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// SessionSettings holds the settings to change; nil fields are left as they
+// are. A MatchThreshold of zero clears the threshold, and a zero time clears
+// a deadline.
+type SessionSettings struct {
+	Name            *string       `json:"session_name"`
+	VotingMethod    *VotingMethod `json:"voting_method"`
+	MatchThreshold  *int          `json:"match_threshold"`
+	CollectUntil    *time.Time    `json:"collect_until"`
+	VoteUntil       *time.Time    `json:"vote_until"`
+	OpenJoin        *bool         `json:"open_join"`
+	RequireVerified *bool         `json:"require_verified"`
+}
+
+var (
+	ErrInvalidSettings = errors.New("invalid session settings")
+	ErrSettingsLocked  = errors.New("voting method cannot change once ballots have been cast")
+)
+
+func (s *SessionService) UpdateSettings(ctx context.Context, sessionID, userID uuid.UUID, settings SessionSettings) (*database.Session, error) {
+	m, err := requirePermission(ctx, s.queries, sessionID, userID, PermChangeSettings)
+	if err != nil {
+		return nil, err
+	}
+	session := m.Session
+
+	params := database.UpdateSessionSettingsParams{
+		ID:              session.ID,
+		SessionName:     session.SessionName,
+		VotingMethod:    session.VotingMethod,
+		MatchThreshold:  session.MatchThreshold,
+		CollectUntil:    session.CollectUntil,
+		VoteUntil:       session.VoteUntil,
+		OpenJoin:        session.OpenJoin,
+		RequireVerified: session.RequireVerified,
+	}
+	if settings.Name != nil {
+		if *settings.Name == "" {
+			return nil, fmt.Errorf("%w: session name cannot be empty", ErrInvalidSettings)
+		}
+		params.SessionName = *settings.Name
+	}
+	if settings.MatchThreshold != nil {
+		if *settings.MatchThreshold < 0 {
+			return nil, fmt.Errorf("%w: match threshold cannot be negative", ErrInvalidSettings)
+		}
+		params.MatchThreshold = sql.NullInt32{Int32: int32(*settings.MatchThreshold), Valid: *settings.MatchThreshold > 0}
+	}
+	if settings.VotingMethod != nil && string(*settings.VotingMethod) != session.VotingMethod {
+		if _, err := TallierFor(*settings.VotingMethod); err != nil {
+			return nil, err
+		}
+		ballots, err := s.queries.CountSessionBallots(ctx, session.ID)
+		if err != nil {
+			return nil, fmt.Errorf("count ballots: %w", err)
+		}
+		if ballots > 0 {
+			return nil, ErrSettingsLocked
+		}
+		params.VotingMethod = string(*settings.VotingMethod)
+	}
+	if settings.OpenJoin != nil {
+		params.OpenJoin = *settings.OpenJoin
+	}
+	if settings.RequireVerified != nil {
+		params.RequireVerified = *settings.RequireVerified
+	}
+	if settings.CollectUntil != nil {
+		params.CollectUntil = nullTime(*settings.CollectUntil)
+	}
+	if settings.VoteUntil != nil {
+		params.VoteUntil = nullTime(*settings.VoteUntil)
+	}
+	if err := validateDeadlines(params.CollectUntil, params.VoteUntil,
+		settings.CollectUntil != nil, settings.VoteUntil != nil, time.Now()); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.queries.UpdateSessionSettings(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("update session settings: %w", err)
+	}
+
+	publishEvent(ctx, s.Events, events.SessionUpdated, sessionID, events.SessionData{
+		Name:            updated.SessionName,
+		VotingMethod:    updated.VotingMethod,
+		MatchThreshold:  int(updated.MatchThreshold.Int32),
+		CollectUntil:    timePtr(updated.CollectUntil),
+		VoteUntil:       timePtr(updated.VoteUntil),
+		OpenJoin:        updated.OpenJoin,
+		RequireVerified: updated.RequireVerified,
+	})
+	return &updated, nil
+}
+
+func (s *SessionService) ListParticipants(ctx context.Context, sessionID uuid.UUID) ([]database.SessionParticipant, error) {
+	participants, err := s.queries.ListSessionParticipants(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("list session participants: %w", err)
+	}
+
+	return participants, nil
+}
+
+// emailVerified reports whether the user has verified their email. Guests have
+// none, so they never have.
+func emailVerified(ctx context.Context, queries *database.Queries, userID uuid.UUID) (bool, error) {
+	user, err := queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("get user: %w", err)
+	}
+	return user.EmailVerifiedAt.Valid, nil
 }
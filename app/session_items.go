@@ -8,12 +8,17 @@ import (
 	"fmt"
 
 	"github.com/Kam1217/optio/internal/database"
+	"github.com/Kam1217/optio/internal/events"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/sqlc-dev/pqtype"
 )
 
 type SessionItemService struct {
-	queries *database.Queries
+	db        *sql.DB
+	queries   *database.Queries
+	providers map[SourceType]SourceProvider
+	Events    events.Publisher
 }
 
 type SourceType string
@@ -23,8 +28,6 @@ const (
 	SourceSteam  SourceType = "steam"
 )
 
-//ADD STEAM LATER
-
 type SessionItemInput struct {
 	Title         string          `json:"title"`
 	Description   string          `json:"description"`
@@ -32,78 +35,343 @@ type SessionItemInput struct {
 	SessionId     uuid.UUID       `json:"session_id"`
 	AddedByUserID uuid.UUID       `json:"added_by_user_id"`
 	SourceType    SourceType      `json:"source_type"`
+	SourceID      string          `json:"source_id"`
 	Metadata      json.RawMessage `json:"metadata"`
 }
 
-// type CustomMetadata struct {
-// 	Foo string
-// 	Bar string
-// }
+var (
+	ErrInvalidItem  = errors.New("invalid item")
+	ErrNotItemOwner = errors.New("only the user who added the item or the session host can change it")
+)
+
+const (
+	maxItemTitleLen    = 250
+	maxItemImageURLLen = 250
+	DefaultItemPage    = 20
+	MaxItemPage        = 100
+)
+
+// SessionItemUpdate holds the fields to change on an item; nil fields are
+// left as they are.
+type SessionItemUpdate struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	ImageURL    *string `json:"image_url"`
+}
 
-// type SteamMetadata struct {
-// 	Baz int
-// 	Yeet float32
-// }
+type SessionItemPage struct {
+	Items  []database.SessionItem
+	Total  int64
+	Limit  int32
+	Offset int32
+}
 
-// func GetMetadata[T any](rawMetadata json.RawMessage) (*T, error) {
-// 	var metadata *T
-// 	err := json.Unmarshal(rawMetadata, metadata)
-// 	return metadata, err
-// }
+func NewSessionItemService(db *sql.DB, queries *database.Queries) *SessionItemService {
+	return &SessionItemService{db: db, queries: queries, providers: make(map[SourceType]SourceProvider)}
+}
 
-// func example(sourceType SourceType, rawMetadata pqtype.NullRawMessage) {
-// 	switch sourceType {
-// 	case SourceCustom:
-// 		customMetadata, err := GetMetadata[CustomMetadata](rawMetadata)
-// 	case SourceSteam:
-// 		steamMetadata, err := GetMetadata[SteamMetadata](rawMetadata)
-// 	}
-// }
+func (si *SessionItemService) RegisterProvider(p SourceProvider) {
+	si.providers[p.Source()] = p
+}
 
-func NewSessionItemService(queries *database.Queries) *SessionItemService {
-	return &SessionItemService{queries: queries}
+func validateItemFields(title, imageURL string) error {
+	if title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalidItem)
+	}
+	if len(title) > maxItemTitleLen {
+		return fmt.Errorf("%w: title must be at most %d characters", ErrInvalidItem, maxItemTitleLen)
+	}
+	if len(imageURL) > maxItemImageURLLen {
+		return fmt.Errorf("%w: image_url must be at most %d characters", ErrInvalidItem, maxItemImageURLLen)
+	}
+	return nil
 }
 
-func (si *SessionItemService) CheckSessionItemExists(ctx context.Context, itemID uuid.UUID) (bool, error) {
-	_, err := si.queries.GetSessionItemByID(ctx, itemID)
+// checkTitleFree reports ErrDuplicateItem if another custom item in the
+// session already has the title, ignoring case. Items from a source are unique
+// by source ID instead, so titles only clash between custom items. excludeID is
+// the item being renamed, or uuid.Nil when creating one. The unique index on
+// custom item titles catches any that race past the check.
+func checkTitleFree(ctx context.Context, queries *database.Queries, sessionID uuid.UUID, title string, excludeID uuid.UUID) error {
+	exists, err := queries.SessionItemTitleExists(ctx, database.SessionItemTitleExistsParams{
+		SessionID: sessionID,
+		ItemTitle: title,
+		ExcludeID: excludeID,
+	})
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return false, nil
-		}
-		return false, fmt.Errorf("database error checking session item: %w", err)
+		return fmt.Errorf("check for duplicate item: %w", err)
+	}
+	if exists {
+		return ErrDuplicateItem
 	}
-	return true, nil
+	return nil
 }
 
+// CreateNewSessionItem adds an item to a session the user has joined. Custom
+// items must have a title no other item in the session uses; items from a
+// source are unique by their source ID.
 func (si *SessionItemService) CreateNewSessionItem(ctx context.Context, itemInput SessionItemInput) (*database.SessionItem, error) {
 	if itemInput.SessionId == uuid.Nil || itemInput.AddedByUserID == uuid.Nil {
-		return nil, fmt.Errorf("missing ID")
+		return nil, fmt.Errorf("%w: missing ID", ErrInvalidItem)
+	}
+	m, err := requirePermission(ctx, si.queries, itemInput.SessionId, itemInput.AddedByUserID, PermAddItem)
+	if err != nil {
+		return nil, err
+	}
+	if !SessionStatus(m.Session.Status).AcceptsItems() {
+		return nil, ErrItemsClosed
 	}
-	//Make switch statement once steam / other is added - //DEFAULT UNSUPORTED SOURCE TYPE
 
-	if itemInput.Title == "" {
-		return nil, fmt.Errorf("title is required")
+	params := database.CreateSessionItemParams{
+		SessionID:       itemInput.SessionId,
+		ItemTitle:       itemInput.Title,
+		ItemDescription: sql.NullString{String: itemInput.Description, Valid: true},
+		ImageUrl:        sql.NullString{String: itemInput.ImageURL, Valid: true},
+		SourceType:      string(SourceCustom),
+		SourceID:        sql.NullString{Valid: false},
+		AddedByUserID:   itemInput.AddedByUserID,
 	}
 
-	exists, err := si.CheckSessionItemExists(ctx, itemInput.SessionId)
-	if err != nil {
-		return nil, fmt.Errorf("error verifying if code exists: %w", err)
-	}
-	if !exists {
-		item, err := si.queries.CreateSessionItem(ctx, database.CreateSessionItemParams{
-			SessionID:       itemInput.SessionId,
-			ItemTitle:       itemInput.Title,
-			ItemDescription: sql.NullString{String: itemInput.Description, Valid: true},
-			ImageUrl:        sql.NullString{String: itemInput.ImageURL, Valid: true},
-			SourceType:      string(SourceCustom),
-			SourceID:        sql.NullString{Valid: false},
-			Metadata:        pqtype.NullRawMessage{RawMessage: itemInput.Metadata, Valid: true},
-			AddedByUserID:   itemInput.AddedByUserID,
-		})
+	switch itemInput.SourceType {
+	case "", SourceCustom:
+		if err := validateItemFields(itemInput.Title, itemInput.ImageURL); err != nil {
+			return nil, err
+		}
+		if err := checkTitleFree(ctx, si.queries, itemInput.SessionId, itemInput.Title, uuid.Nil); err != nil {
+			return nil, err
+		}
+
+		metadata, err := ParseMetadata(SourceCustom, itemInput.Metadata)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create session item: %w", err)
+			return nil, err
+		}
+		params.Metadata = pqtype.NullRawMessage{RawMessage: metadata, Valid: metadata != nil}
+	default:
+		provider, ok := si.providers[itemInput.SourceType]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnsupportedSource, itemInput.SourceType)
+		}
+		if err := si.fillFromSource(ctx, provider, itemInput, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	item, err := si.queries.CreateSessionItem(ctx, params)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrDuplicateItem
+		}
+		return nil, fmt.Errorf("failed to create session item: %w", err)
+	}
+	publishEvent(ctx, si.Events, events.ItemAdded, item.SessionID, itemEventData(item))
+	return &item, nil
+}
+
+// fillFromSource replaces the item's details with the provider's. Duplicates
+// are checked against the ID the provider returns, since that is the
+// normalised form; the unique index on source_id catches any that race past
+// the check.
+func (si *SessionItemService) fillFromSource(ctx context.Context, provider SourceProvider, itemInput SessionItemInput, params *database.CreateSessionItemParams) error {
+	if itemInput.SourceID == "" {
+		return fmt.Errorf("%w: source_id is required for %s items", ErrInvalidSourceID, provider.Source())
+	}
+
+	found, err := provider.Fetch(ctx, itemInput.SourceID)
+	if err != nil {
+		return err
+	}
+
+	_, err = si.queries.GetSessionItemBySource(ctx, database.GetSessionItemBySourceParams{
+		SessionID:  itemInput.SessionId,
+		SourceType: string(provider.Source()),
+		SourceID:   sql.NullString{String: found.SourceID, Valid: true},
+	})
+	if err == nil {
+		return ErrDuplicateItem
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("check for duplicate item: %w", err)
+	}
+
+	metadata, err := encodeMetadata(provider.Source(), found.Metadata)
+	if err != nil {
+		return err
+	}
+
+	params.ItemTitle = found.Title
+	params.ItemDescription = sql.NullString{String: found.Description, Valid: found.Description != ""}
+	params.ImageUrl = sql.NullString{String: found.ImageURL, Valid: found.ImageURL != ""}
+	params.SourceType = string(provider.Source())
+	params.SourceID = sql.NullString{String: found.SourceID, Valid: true}
+	params.Metadata = pqtype.NullRawMessage{RawMessage: metadata, Valid: true}
+	return nil
+}
+
+// GetItem returns an item of a session the user has joined.
+func (si *SessionItemService) GetItem(ctx context.Context, itemID, userID uuid.UUID) (*database.SessionItem, error) {
+	item, _, err := si.participantItem(ctx, si.queries, itemID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// ListItems pages through a session's items, newest first. A limit outside
+// 1..MaxItemPage falls back to DefaultItemPage.
+func (si *SessionItemService) ListItems(ctx context.Context, sessionID, userID uuid.UUID, limit, offset int32) (*SessionItemPage, error) {
+	if _, err := participantSession(ctx, si.queries, sessionID, userID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > MaxItemPage {
+		limit = DefaultItemPage
+	}
+	offset = max(offset, 0)
+
+	items, err := si.queries.ListSessionItems(ctx, database.ListSessionItemsParams{
+		SessionID: sessionID,
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list session items: %w", err)
+	}
+	total, err := si.queries.CountSessionItems(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("count session items: %w", err)
+	}
+
+	return &SessionItemPage{Items: items, Total: total, Limit: limit, Offset: offset}, nil
+}
+
+// UpdateItem applies the update for the user who added the item or the
+// session host.
+func (si *SessionItemService) UpdateItem(ctx context.Context, itemID, userID uuid.UUID, update SessionItemUpdate) (*database.SessionItem, error) {
+	tx, err := si.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := si.queries.WithTx(tx)
+
+	item, err := si.editableItem(ctx, qtx, itemID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	title, imageURL := item.ItemTitle, item.ImageUrl.String
+	if update.Title != nil {
+		title = *update.Title
+	}
+	if update.ImageURL != nil {
+		imageURL = *update.ImageURL
+	}
+	if err := validateItemFields(title, imageURL); err != nil {
+		return nil, err
+	}
+
+	if update.Title != nil && *update.Title != item.ItemTitle {
+		if SourceType(item.SourceType) == SourceCustom {
+			if err := checkTitleFree(ctx, qtx, item.SessionID, title, item.ID); err != nil {
+				return nil, err
+			}
+		}
+		if err := qtx.UpdateItemTitle(ctx, database.UpdateItemTitleParams{ID: item.ID, ItemTitle: title}); err != nil {
+			if isUniqueViolation(err) {
+				return nil, ErrDuplicateItem
+			}
+			return nil, fmt.Errorf("update item title: %w", err)
 		}
-		return &item, nil
 	}
-	return nil, fmt.Errorf("item already exists")
+	if update.Description != nil {
+		if err := qtx.UpdateItemDescription(ctx, database.UpdateItemDescriptionParams{
+			ID:              item.ID,
+			ItemDescription: sql.NullString{String: *update.Description, Valid: *update.Description != ""},
+		}); err != nil {
+			return nil, fmt.Errorf("update item description: %w", err)
+		}
+	}
+	if update.ImageURL != nil {
+		if err := qtx.UpdateItemImage(ctx, database.UpdateItemImageParams{
+			ID:       item.ID,
+			ImageUrl: sql.NullString{String: imageURL, Valid: imageURL != ""},
+		}); err != nil {
+			return nil, fmt.Errorf("update item image: %w", err)
+		}
+	}
+
+	updated, err := qtx.GetSessionItemByID(ctx, item.ID)
+	if err != nil {
+		return nil, fmt.Errorf("get session item: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	publishEvent(ctx, si.Events, events.ItemUpdated, updated.SessionID, itemEventData(updated))
+	return &updated, nil
+}
+
+// DeleteItem removes the item for the user who added it or the session host.
+func (si *SessionItemService) DeleteItem(ctx context.Context, itemID, userID uuid.UUID) error {
+	item, err := si.editableItem(ctx, si.queries, itemID, userID)
+	if err != nil {
+		return err
+	}
+	if err := si.queries.DeleteSessionItem(ctx, item.ID); err != nil {
+		return fmt.Errorf("delete session item: %w", err)
+	}
+
+	publishEvent(ctx, si.Events, events.ItemRemoved, item.SessionID, events.ItemData{ItemID: item.ID})
+	return nil
+}
+
+// participantItem loads an item and the user's membership of its session.
+func (si *SessionItemService) participantItem(ctx context.Context, queries *database.Queries, itemID, userID uuid.UUID) (database.SessionItem, Membership, error) {
+	item, err := queries.GetSessionItemByID(ctx, itemID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.SessionItem{}, Membership{}, ErrItemNotFound
+		}
+		return database.SessionItem{}, Membership{}, fmt.Errorf("get session item: %w", err)
+	}
+
+	m, err := membership(ctx, queries, item.SessionID, userID)
+	if err != nil {
+		// Don't reveal items of sessions the user can't see.
+		if errors.Is(err, ErrSessionNotFound) {
+			return database.SessionItem{}, Membership{}, ErrItemNotFound
+		}
+		return database.SessionItem{}, Membership{}, err
+	}
+	return item, m, nil
+}
+
+// editableItem loads an item the user may change: one they added, while
+// their role still lets them add items, or any item for hosts and co-hosts.
+func (si *SessionItemService) editableItem(ctx context.Context, queries *database.Queries, itemID, userID uuid.UUID) (database.SessionItem, error) {
+	item, m, err := si.participantItem(ctx, queries, itemID, userID)
+	if err != nil {
+		return database.SessionItem{}, err
+	}
+	ownItem := item.AddedByUserID == userID && m.Can(PermAddItem)
+	if !ownItem && !m.Can(PermManageItems) {
+		return database.SessionItem{}, ErrNotItemOwner
+	}
+	return item, nil
+}
+
+func itemEventData(item database.SessionItem) events.ItemData {
+	return events.ItemData{
+		ItemID:        item.ID,
+		Title:         item.ItemTitle,
+		Description:   item.ItemDescription.String,
+		ImageURL:      item.ImageUrl.String,
+		SourceType:    item.SourceType,
+		AddedByUserID: item.AddedByUserID,
+	}
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
 }
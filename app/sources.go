@@ -0,0 +1,30 @@
+package app
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrUnsupportedSource  = errors.New("unsupported source type")
+	ErrInvalidSourceID    = errors.New("invalid source id")
+	ErrSourceItemNotFound = errors.New("item not found at source")
+	ErrSourceUnavailable  = errors.New("source unavailable")
+	ErrDuplicateItem      = errors.New("item already exists in session")
+)
+
+// SourceItem is what a provider knows about an item in its catalogue.
+type SourceItem struct {
+	SourceID    string
+	Title       string
+	Description string
+	ImageURL    string
+	Metadata    Metadata
+}
+
+// SourceProvider looks up items in an external catalogue so they can be
+// added to a session by ID rather than typed in by hand.
+type SourceProvider interface {
+	Source() SourceType
+	Fetch(ctx context.Context, sourceID string) (*SourceItem, error)
+}
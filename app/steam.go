@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSteamStoreURL = "https://store.steampowered.com"
+	DefaultSteamAPIURL   = "https://api.steampowered.com"
+)
+
+type SteamMetadata struct {
+	AppID          uint32   `json:"app_id"`
+	Genres         []string `json:"genres,omitempty"`
+	Categories     []string `json:"categories,omitempty"`
+	CurrentPlayers *int     `json:"current_players,omitempty"`
+}
+
+// SteamProvider fetches games from the Steam store. StoreURL serves app
+// details and APIURL the Web API used for player counts; both can point at a
+// fake server in tests.
+type SteamProvider struct {
+	StoreURL string
+	APIURL   string
+	Client   *http.Client
+}
+
+func NewSteamProvider(storeURL, apiURL string) *SteamProvider {
+	if storeURL == "" {
+		storeURL = DefaultSteamStoreURL
+	}
+	if apiURL == "" {
+		apiURL = DefaultSteamAPIURL
+	}
+	return &SteamProvider{
+		StoreURL: strings.TrimRight(storeURL, "/"),
+		APIURL:   strings.TrimRight(apiURL, "/"),
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *SteamProvider) Source() SourceType {
+	return SourceSteam
+}
+
+type steamNamed struct {
+	Description string `json:"description"`
+}
+
+type steamAppDetails struct {
+	Success bool `json:"success"`
+	Data    struct {
+		Name             string       `json:"name"`
+		ShortDescription string       `json:"short_description"`
+		HeaderImage      string       `json:"header_image"`
+		Genres           []steamNamed `json:"genres"`
+		Categories       []steamNamed `json:"categories"`
+	} `json:"data"`
+}
+
+type steamPlayerCount struct {
+	Response struct {
+		PlayerCount int `json:"player_count"`
+		Result      int `json:"result"`
+	} `json:"response"`
+}
+
+// Fetch looks up a Steam app by its numeric app ID. The current player count
+// comes from a separate endpoint and is left out if that lookup fails.
+func (p *SteamProvider) Fetch(ctx context.Context, sourceID string) (*SourceItem, error) {
+	appID, err := strconv.ParseUint(strings.TrimSpace(sourceID), 10, 32)
+	if err != nil || appID == 0 {
+		return nil, fmt.Errorf("%w: steam app id must be a positive number", ErrInvalidSourceID)
+	}
+	id := strconv.FormatUint(appID, 10)
+
+	var details map[string]steamAppDetails
+	query := url.Values{"appids": {id}, "l": {"english"}}
+	if err := p.getJSON(ctx, p.StoreURL+"/api/appdetails?"+query.Encode(), &details); err != nil {
+		return nil, err
+	}
+	app, ok := details[id]
+	if !ok || !app.Success {
+		return nil, ErrSourceItemNotFound
+	}
+
+	metadata := SteamMetadata{AppID: uint32(appID)}
+	for _, g := range app.Data.Genres {
+		metadata.Genres = append(metadata.Genres, g.Description)
+	}
+	for _, c := range app.Data.Categories {
+		metadata.Categories = append(metadata.Categories, c.Description)
+	}
+
+	var players steamPlayerCount
+	query = url.Values{"appid": {id}}
+	if err := p.getJSON(ctx, p.APIURL+"/ISteamUserStats/GetNumberOfCurrentPlayers/v1/?"+query.Encode(), &players); err != nil {
+		log.Printf("steam player count for app %s: %v", id, err)
+	} else if players.Response.Result == 1 {
+		count := players.Response.PlayerCount
+		metadata.CurrentPlayers = &count
+	}
+
+	return &SourceItem{
+		SourceID:    id,
+		Title:       app.Data.Name,
+		Description: app.Data.ShortDescription,
+		ImageURL:    app.Data.HeaderImage,
+		Metadata:    metadata,
+	}, nil
+}
+
+func (p *SteamProvider) getJSON(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("build steam request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSourceUnavailable, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: steam returned %s", ErrSourceUnavailable, res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(dst); err != nil {
+		return fmt.Errorf("%w: decode steam response: %v", ErrSourceUnavailable, err)
+	}
+	return nil
+}
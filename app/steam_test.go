@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+const portalDetails = `{"620":{"success":true,"data":{
+	"name":"Portal 2",
+	"short_description":"The sequel to Portal.",
+	"header_image":"https://cdn.example/620/header.jpg",
+	"genres":[{"id":"1","description":"Action"},{"id":"25","description":"Adventure"}],
+	"categories":[{"id":2,"description":"Single-player"},{"id":9,"description":"Co-op"}]}}}`
+
+func fakeSteam(t *testing.T, players http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/appdetails", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("appids") {
+		case "620":
+			w.Write([]byte(portalDetails))
+		case "500":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{"` + r.URL.Query().Get("appids") + `":{"success":false}}`))
+		}
+	})
+	mux.HandleFunc("/ISteamUserStats/GetNumberOfCurrentPlayers/v1/", players)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSteamProviderFetch(t *testing.T) {
+	server := fakeSteam(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("appid") != "620" {
+			t.Errorf("player count requested for app %q", r.URL.Query().Get("appid"))
+		}
+		w.Write([]byte(`{"response":{"player_count":4321,"result":1}}`))
+	})
+	provider := NewSteamProvider(server.URL, server.URL+"/")
+
+	item, err := provider.Fetch(context.Background(), " 0620 ")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if item.SourceID != "620" || item.Title != "Portal 2" || item.Description != "The sequel to Portal." ||
+		item.ImageURL != "https://cdn.example/620/header.jpg" {
+		t.Fatalf("unexpected item: %+v", item)
+	}
+
+	metadata, ok := item.Metadata.(SteamMetadata)
+	if !ok {
+		t.Fatalf("metadata is %T, want SteamMetadata", item.Metadata)
+	}
+	if metadata.AppID != 620 ||
+		!slices.Equal(metadata.Genres, []string{"Action", "Adventure"}) ||
+		!slices.Equal(metadata.Categories, []string{"Single-player", "Co-op"}) {
+		t.Fatalf("unexpected metadata: %+v", metadata)
+	}
+	if metadata.CurrentPlayers == nil || *metadata.CurrentPlayers != 4321 {
+		t.Fatalf("unexpected player count: %v", metadata.CurrentPlayers)
+	}
+}
+
+func TestSteamProviderFetchWithoutPlayerCount(t *testing.T) {
+	server := fakeSteam(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	})
+	provider := NewSteamProvider(server.URL, server.URL)
+
+	item, err := provider.Fetch(context.Background(), "620")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if players := item.Metadata.(SteamMetadata).CurrentPlayers; players != nil {
+		t.Fatalf("want no player count, got %d", *players)
+	}
+}
+
+func TestSteamProviderFetchErrors(t *testing.T) {
+	server := fakeSteam(t, func(w http.ResponseWriter, r *http.Request) {})
+	provider := NewSteamProvider(server.URL, server.URL)
+
+	tests := []struct {
+		name    string
+		appID   string
+		wantErr error
+	}{
+		{name: "not numeric", appID: "portal", wantErr: ErrInvalidSourceID},
+		{name: "zero", appID: "0", wantErr: ErrInvalidSourceID},
+		{name: "empty", appID: "", wantErr: ErrInvalidSourceID},
+		{name: "unknown app", appID: "999999", wantErr: ErrSourceItemNotFound},
+		{name: "store error", appID: "500", wantErr: ErrSourceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.Fetch(context.Background(), tt.appID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSteamProviderUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	provider := NewSteamProvider(server.URL, server.URL)
+
+	if _, err := provider.Fetch(context.Background(), "620"); !errors.Is(err, ErrSourceUnavailable) {
+		t.Fatalf("want ErrSourceUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/Kam1217/optio/internal/events"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNoMoreItems  = errors.New("no items left to swipe")
+	ErrItemNotFound = errors.New("item not found")
+)
+
+type SwipeService struct {
+	db      *sql.DB
+	queries *database.Queries
+	Events  events.Publisher
+}
+
+func NewSwipeService(db *sql.DB, queries *database.Queries) *SwipeService {
+	return &SwipeService{db: db, queries: queries}
+}
+
+type SwipeResult struct {
+	Matched bool
+	Session database.Session
+}
+
+func swipeSession(ctx context.Context, queries *database.Queries, sessionID, userID uuid.UUID) (database.Session, error) {
+	m, err := requirePermission(ctx, queries, sessionID, userID, PermVote)
+	if err != nil {
+		return database.Session{}, err
+	}
+	session := m.Session
+	if SessionMode(session.Mode) != ModeSwipe {
+		return database.Session{}, ErrWrongSessionMode
+	}
+	return session, nil
+}
+
+// swipeOrder shuffles items for one participant. Each item's position comes
+// from a hash of the session, user and item, so the order is stable between
+// requests and items added later slot in without reshuffling the rest.
+func swipeOrder(items []database.SessionItem, sessionID, userID uuid.UUID) []database.SessionItem {
+	keys := make(map[uuid.UUID][]byte, len(items))
+	for _, item := range items {
+		h := sha256.New()
+		h.Write(sessionID[:])
+		h.Write(userID[:])
+		h.Write(item.ID[:])
+		keys[item.ID] = h.Sum(nil)
+	}
+
+	ordered := slices.Clone(items)
+	slices.SortFunc(ordered, func(a, b database.SessionItem) int {
+		return bytes.Compare(keys[a.ID], keys[b.ID])
+	})
+	return ordered
+}
+
+// matchThreshold is the number of likes needed for a match: the session's
+// configured threshold, or every active participant when none is set.
+func matchThreshold(configured sql.NullInt32, activeParticipants int64) int64 {
+	if configured.Valid && configured.Int32 > 0 {
+		return int64(configured.Int32)
+	}
+	return max(activeParticipants, 1)
+}
+
+func (s *SwipeService) NextItem(ctx context.Context, sessionID, userID uuid.UUID) (*database.SessionItem, error) {
+	if _, err := swipeSession(ctx, s.queries, sessionID, userID); err != nil {
+		return nil, err
+	}
+
+	items, err := s.queries.ListAllSessionItems(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("list session items: %w", err)
+	}
+	swiped, err := s.queries.ListSwipedItemIDs(ctx, database.ListSwipedItemIDsParams{
+		SessionID: sessionID,
+		UserID:    userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list swiped items: %w", err)
+	}
+
+	for _, item := range swipeOrder(items, sessionID, userID) {
+		if !slices.Contains(swiped, item.ID) {
+			return &item, nil
+		}
+	}
+
+	return nil, ErrNoMoreItems
+}
+
+// Swipe records a like or dislike. A like that brings the item up to the
+// match threshold decides the session; only the first item to get there is
+// recorded as the match. Participants leaving can lower the threshold too,
+// which matchRemaining checks for.
+func (s *SwipeService) Swipe(ctx context.Context, sessionID, userID, itemID uuid.UUID, liked bool) (*SwipeResult, error) {
+	session, err := swipeSession(ctx, s.queries, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	switch SessionStatus(session.Status) {
+	case SessionVoting:
+	case SessionDecided:
+		return nil, ErrSessionDecided
+	default:
+		return nil, ErrVotingClosed
+	}
+
+	item, err := s.queries.GetSessionItemByID(ctx, itemID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrItemNotFound
+		}
+		return nil, fmt.Errorf("get session item: %w", err)
+	}
+	if item.SessionID != sessionID {
+		return nil, ErrItemNotFound
+	}
+
+	if _, err := s.queries.UpsertSwipe(ctx, database.UpsertSwipeParams{
+		SessionID: sessionID,
+		ItemID:    itemID,
+		UserID:    userID,
+		Liked:     liked,
+	}); err != nil {
+		return nil, fmt.Errorf("record swipe: %w", err)
+	}
+
+	if !liked {
+		return &SwipeResult{Session: session}, nil
+	}
+
+	likes, err := s.queries.CountItemLikes(ctx, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("count item likes: %w", err)
+	}
+	active, err := s.queries.CountActiveSessionParticipants(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("count active participants: %w", err)
+	}
+	if likes < matchThreshold(session.MatchThreshold, active) {
+		return &SwipeResult{Session: session}, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	decided, err := decideSession(ctx, s.queries.WithTx(tx), session,
+		uuid.NullUUID{UUID: itemID, Valid: true}, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit match: %w", err)
+	}
+
+	publishTransition(ctx, s.Events, session, decided)
+	return &SwipeResult{Matched: true, Session: decided}, nil
+}
+
+// matchRemaining decides a swipe session in voting once an item has enough
+// likes from the participants still in it. Swipe only checks the item being
+// liked, so this runs when someone leaves or is removed, in the same
+// transaction, since that can bring the threshold down to an item's likes.
+// It reports whether the session was decided.
+func matchRemaining(ctx context.Context, qtx *database.Queries, session database.Session) (database.Session, bool, error) {
+	if SessionMode(session.Mode) != ModeSwipe || SessionStatus(session.Status) != SessionVoting {
+		return session, false, nil
+	}
+
+	top, err := qtx.MostLikedSessionItem(ctx, session.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return session, false, nil
+		}
+		return session, false, fmt.Errorf("get most liked item: %w", err)
+	}
+	active, err := qtx.CountActiveSessionParticipants(ctx, session.ID)
+	if err != nil {
+		return session, false, fmt.Errorf("count active participants: %w", err)
+	}
+	if top.Likes < matchThreshold(session.MatchThreshold, active) {
+		return session, false, nil
+	}
+
+	decided, err := decideSession(ctx, qtx, session, uuid.NullUUID{UUID: top.ItemID, Valid: true}, uuid.NullUUID{})
+	if err != nil {
+		if errors.Is(err, ErrSessionDecided) {
+			// A swipe got there first.
+			return session, false, nil
+		}
+		return session, false, err
+	}
+	return decided, true, nil
+}
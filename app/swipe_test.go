@@ -0,0 +1,85 @@
+package app
+
+import (
+	"database/sql"
+	"slices"
+	"testing"
+
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/google/uuid"
+)
+
+func itemIDs(items []database.SessionItem) []uuid.UUID {
+	ids := make([]uuid.UUID, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids
+}
+
+func TestSwipeOrder(t *testing.T) {
+	sessionID := uuid.New()
+	var items []database.SessionItem
+	for range 20 {
+		items = append(items, database.SessionItem{ID: uuid.New(), SessionID: sessionID})
+	}
+	alice, bob := uuid.New(), uuid.New()
+
+	t.Run("stable for the same participant", func(t *testing.T) {
+		first := itemIDs(swipeOrder(items, sessionID, alice))
+		second := itemIDs(swipeOrder(items, sessionID, alice))
+		if !slices.Equal(first, second) {
+			t.Fatalf("order changed between calls:\n%v\n%v", first, second)
+		}
+	})
+
+	t.Run("differs between participants", func(t *testing.T) {
+		a := itemIDs(swipeOrder(items, sessionID, alice))
+		b := itemIDs(swipeOrder(items, sessionID, bob))
+		if slices.Equal(a, b) {
+			t.Fatalf("expected different orders for different participants")
+		}
+	})
+
+	t.Run("keeps every item", func(t *testing.T) {
+		got := itemIDs(swipeOrder(items, sessionID, alice))
+		want := itemIDs(items)
+		slices.SortFunc(got, func(a, b uuid.UUID) int { return slices.Compare(a[:], b[:]) })
+		slices.SortFunc(want, func(a, b uuid.UUID) int { return slices.Compare(a[:], b[:]) })
+		if !slices.Equal(got, want) {
+			t.Fatalf("shuffled items do not match input")
+		}
+	})
+
+	t.Run("new items do not reorder existing ones", func(t *testing.T) {
+		before := itemIDs(swipeOrder(items, sessionID, alice))
+		extra := database.SessionItem{ID: uuid.New(), SessionID: sessionID}
+		after := itemIDs(swipeOrder(append(slices.Clone(items), extra), sessionID, alice))
+		after = slices.DeleteFunc(after, func(id uuid.UUID) bool { return id == extra.ID })
+		if !slices.Equal(before, after) {
+			t.Fatalf("adding an item reshuffled existing items")
+		}
+	})
+}
+
+func TestMatchThreshold(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured sql.NullInt32
+		active     int64
+		want       int64
+	}{
+		{name: "every active participant by default", active: 4, want: 4},
+		{name: "configured threshold", configured: sql.NullInt32{Int32: 2, Valid: true}, active: 4, want: 2},
+		{name: "configured threshold above participant count", configured: sql.NullInt32{Int32: 6, Valid: true}, active: 4, want: 6},
+		{name: "at least one like", active: 0, want: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := matchThreshold(test.configured, test.active); got != test.want {
+				t.Fatalf("matchThreshold() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// Ties are broken the same way by every method: items are passed to a
+// Tallier in the order they were added to the session, and when two items
+// have the same score the one added first ranks higher. Instant-runoff applies
+// the same rule in reverse when eliminating, so the most recently added of the
+// lowest-scoring items is dropped first.
+
+type VotingMethod string
+
+const (
+	VotingPlurality    VotingMethod = "plurality"
+	VotingApproval     VotingMethod = "approval"
+	VotingScore        VotingMethod = "score"
+	VotingBorda        VotingMethod = "borda"
+	VotingRankedChoice VotingMethod = "ranked_choice"
+)
+
+const (
+	MinScore = 0
+	MaxScore = 5
+)
+
+var (
+	ErrUnknownVotingMethod = errors.New("unknown voting method")
+	ErrInvalidBallot       = errors.New("invalid ballot")
+)
+
+type Vote struct {
+	ItemID uuid.UUID `json:"item_id"`
+	Value  int       `json:"value"`
+}
+
+type Ballot struct {
+	UserID uuid.UUID
+	Votes  []Vote
+}
+
+type ItemResult struct {
+	ItemID uuid.UUID `json:"item_id"`
+	Score  int       `json:"score"`
+	Rank   int       `json:"rank"`
+}
+
+type Round struct {
+	Counts     map[uuid.UUID]int `json:"counts"`
+	Eliminated *uuid.UUID        `json:"eliminated,omitempty"`
+}
+
+type Result struct {
+	Method      VotingMethod `json:"method"`
+	BallotCount int          `json:"ballot_count"`
+	Winner      *uuid.UUID   `json:"winner"`
+	Ranking     []ItemResult `json:"ranking"`
+	Rounds      []Round      `json:"rounds,omitempty"`
+}
+
+type Tallier interface {
+	Method() VotingMethod
+	ValidateBallot(items []uuid.UUID, votes []Vote) error
+	Tally(items []uuid.UUID, ballots []Ballot) Result
+}
+
+var talliers = map[VotingMethod]Tallier{
+	VotingPlurality:    pluralityTallier{},
+	VotingApproval:     approvalTallier{},
+	VotingScore:        scoreTallier{},
+	VotingBorda:        bordaTallier{},
+	VotingRankedChoice: rankedChoiceTallier{},
+}
+
+func TallierFor(method VotingMethod) (Tallier, error) {
+	t, ok := talliers[method]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownVotingMethod, method)
+	}
+	return t, nil
+}
+
+func ballotError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidBallot, fmt.Sprintf(format, args...))
+}
+
+// checkVoteItems rejects votes for items outside the session and repeated
+// votes for the same item.
+func checkVoteItems(items []uuid.UUID, votes []Vote) error {
+	known := make(map[uuid.UUID]bool, len(items))
+	for _, id := range items {
+		known[id] = true
+	}
+	seen := make(map[uuid.UUID]bool, len(votes))
+	for _, v := range votes {
+		if !known[v.ItemID] {
+			return ballotError("item %s is not part of this session", v.ItemID)
+		}
+		if seen[v.ItemID] {
+			return ballotError("item %s appears more than once", v.ItemID)
+		}
+		seen[v.ItemID] = true
+	}
+	return nil
+}
+
+// checkRanks requires values to be the ranks 1..len(votes) with no gaps or
+// repeats, so partial rankings are allowed but must start at first place.
+func checkRanks(votes []Vote) error {
+	if len(votes) == 0 {
+		return ballotError("at least one item must be ranked")
+	}
+	seen := make(map[int]bool, len(votes))
+	for _, v := range votes {
+		if v.Value < 1 || v.Value > len(votes) {
+			return ballotError("rank %d is out of range 1-%d", v.Value, len(votes))
+		}
+		if seen[v.Value] {
+			return ballotError("rank %d is used more than once", v.Value)
+		}
+		seen[v.Value] = true
+	}
+	return nil
+}
+
+// rankByScore orders items by descending score, keeping session order for
+// ties, and assigns competition ranks (1, 2, 2, 4). Only an item that scored
+// something can win, so ballots that support nothing decide nothing.
+func rankByScore(method VotingMethod, items []uuid.UUID, scores map[uuid.UUID]int, ballotCount int) Result {
+	ranking := make([]ItemResult, len(items))
+	for i, id := range items {
+		ranking[i] = ItemResult{ItemID: id, Score: scores[id]}
+	}
+	stableSortByScore(ranking)
+	for i := range ranking {
+		if i > 0 && ranking[i].Score == ranking[i-1].Score {
+			ranking[i].Rank = ranking[i-1].Rank
+		} else {
+			ranking[i].Rank = i + 1
+		}
+	}
+
+	result := Result{Method: method, BallotCount: ballotCount, Ranking: ranking}
+	if ballotCount > 0 && len(ranking) > 0 && ranking[0].Score > 0 {
+		winner := ranking[0].ItemID
+		result.Winner = &winner
+	}
+	return result
+}
+
+func stableSortByScore(ranking []ItemResult) {
+	slices.SortStableFunc(ranking, func(a, b ItemResult) int {
+		return b.Score - a.Score
+	})
+}
+
+// pluralityTallier gives each ballot a single vote for one item.
+type pluralityTallier struct{}
+
+func (pluralityTallier) Method() VotingMethod { return VotingPlurality }
+
+func (pluralityTallier) ValidateBallot(items []uuid.UUID, votes []Vote) error {
+	if len(votes) != 1 {
+		return ballotError("plurality ballots must choose exactly one item")
+	}
+	return checkVoteItems(items, votes)
+}
+
+func (pluralityTallier) Tally(items []uuid.UUID, ballots []Ballot) Result {
+	scores := make(map[uuid.UUID]int, len(items))
+	for _, b := range ballots {
+		for _, v := range b.Votes {
+			scores[v.ItemID]++
+		}
+	}
+	return rankByScore(VotingPlurality, items, scores, len(ballots))
+}
+
+// approvalTallier lets each ballot approve any number of items; value is
+// 1 for approved and 0 for not approved.
+type approvalTallier struct{}
+
+func (approvalTallier) Method() VotingMethod { return VotingApproval }
+
+func (approvalTallier) ValidateBallot(items []uuid.UUID, votes []Vote) error {
+	if len(votes) == 0 {
+		return ballotError("approval ballots must include at least one item")
+	}
+	for _, v := range votes {
+		if v.Value != 0 && v.Value != 1 {
+			return ballotError("approval values must be 0 or 1")
+		}
+	}
+	return checkVoteItems(items, votes)
+}
+
+func (approvalTallier) Tally(items []uuid.UUID, ballots []Ballot) Result {
+	scores := make(map[uuid.UUID]int, len(items))
+	for _, b := range ballots {
+		for _, v := range b.Votes {
+			scores[v.ItemID] += v.Value
+		}
+	}
+	return rankByScore(VotingApproval, items, scores, len(ballots))
+}
+
+// scoreTallier sums per-item scores between MinScore and MaxScore. Items a
+// ballot leaves out score MinScore.
+type scoreTallier struct{}
+
+func (scoreTallier) Method() VotingMethod { return VotingScore }
+
+func (scoreTallier) ValidateBallot(items []uuid.UUID, votes []Vote) error {
+	if len(votes) == 0 {
+		return ballotError("score ballots must include at least one item")
+	}
+	for _, v := range votes {
+		if v.Value < MinScore || v.Value > MaxScore {
+			return ballotError("scores must be between %d and %d", MinScore, MaxScore)
+		}
+	}
+	return checkVoteItems(items, votes)
+}
+
+func (scoreTallier) Tally(items []uuid.UUID, ballots []Ballot) Result {
+	scores := make(map[uuid.UUID]int, len(items))
+	for _, b := range ballots {
+		for _, v := range b.Votes {
+			scores[v.ItemID] += v.Value
+		}
+	}
+	return rankByScore(VotingScore, items, scores, len(ballots))
+}
+
+// bordaTallier awards n-r points to the item ranked r out of n session
+// items. Unranked items get no points.
+type bordaTallier struct{}
+
+func (bordaTallier) Method() VotingMethod { return VotingBorda }
+
+func (bordaTallier) ValidateBallot(items []uuid.UUID, votes []Vote) error {
+	if err := checkRanks(votes); err != nil {
+		return err
+	}
+	return checkVoteItems(items, votes)
+}
+
+func (bordaTallier) Tally(items []uuid.UUID, ballots []Ballot) Result {
+	scores := make(map[uuid.UUID]int, len(items))
+	for _, b := range ballots {
+		for _, v := range b.Votes {
+			scores[v.ItemID] += len(items) - v.Value
+		}
+	}
+	return rankByScore(VotingBorda, items, scores, len(ballots))
+}
+
+// rankedChoiceTallier runs instant-runoff: each round counts every ballot
+// for its highest ranked item still in the running, and eliminates the
+// weakest item until one has a majority of the ballots that are not exhausted.
+type rankedChoiceTallier struct{}
+
+func (rankedChoiceTallier) Method() VotingMethod { return VotingRankedChoice }
+
+func (rankedChoiceTallier) ValidateBallot(items []uuid.UUID, votes []Vote) error {
+	if err := checkRanks(votes); err != nil {
+		return err
+	}
+	return checkVoteItems(items, votes)
+}
+
+func (rankedChoiceTallier) Tally(items []uuid.UUID, ballots []Ballot) Result {
+	result := Result{Method: VotingRankedChoice, BallotCount: len(ballots)}
+	if len(items) == 0 {
+		result.Ranking = []ItemResult{}
+		return result
+	}
+
+	preferences := make([][]uuid.UUID, len(ballots))
+	for i, b := range ballots {
+		votes := slices.Clone(b.Votes)
+		slices.SortStableFunc(votes, func(a, b Vote) int { return a.Value - b.Value })
+		prefs := make([]uuid.UUID, len(votes))
+		for j, v := range votes {
+			prefs[j] = v.ItemID
+		}
+		preferences[i] = prefs
+	}
+
+	remaining := slices.Clone(items)
+	finalScores := make(map[uuid.UUID]int, len(items))
+	var eliminationOrder []uuid.UUID
+
+	for {
+		counts := make(map[uuid.UUID]int, len(remaining))
+		for _, id := range remaining {
+			counts[id] = 0
+		}
+		active := 0
+		for _, prefs := range preferences {
+			for _, id := range prefs {
+				if _, running := counts[id]; running {
+					counts[id]++
+					active++
+					break
+				}
+			}
+		}
+
+		round := Round{Counts: counts}
+		leader := remaining[0]
+		for _, id := range remaining[1:] {
+			if counts[id] > counts[leader] {
+				leader = id
+			}
+		}
+		if len(remaining) == 1 || counts[leader]*2 > active {
+			result.Rounds = append(result.Rounds, round)
+			for _, id := range remaining {
+				finalScores[id] = counts[id]
+			}
+			break
+		}
+
+		loser := remaining[len(remaining)-1]
+		for i := len(remaining) - 2; i >= 0; i-- {
+			if counts[remaining[i]] < counts[loser] {
+				loser = remaining[i]
+			}
+		}
+		round.Eliminated = &loser
+		result.Rounds = append(result.Rounds, round)
+
+		finalScores[loser] = counts[loser]
+		eliminationOrder = append(eliminationOrder, loser)
+		remaining = slices.DeleteFunc(remaining, func(id uuid.UUID) bool { return id == loser })
+	}
+
+	ranking := make([]ItemResult, 0, len(items))
+	for _, id := range remaining {
+		ranking = append(ranking, ItemResult{ItemID: id, Score: finalScores[id]})
+	}
+	stableSortByScore(ranking)
+	for i := len(eliminationOrder) - 1; i >= 0; i-- {
+		id := eliminationOrder[i]
+		ranking = append(ranking, ItemResult{ItemID: id, Score: finalScores[id]})
+	}
+	for i := range ranking {
+		ranking[i].Rank = i + 1
+	}
+	result.Ranking = ranking
+
+	if len(ballots) > 0 {
+		winner := ranking[0].ItemID
+		result.Winner = &winner
+	}
+	return result
+}
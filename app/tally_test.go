@@ -0,0 +1,251 @@
+package app
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+var (
+	itemA = uuid.MustParse("00000000-0000-0000-0000-00000000000a")
+	itemB = uuid.MustParse("00000000-0000-0000-0000-00000000000b")
+	itemC = uuid.MustParse("00000000-0000-0000-0000-00000000000c")
+	itemD = uuid.MustParse("00000000-0000-0000-0000-00000000000d")
+)
+
+func ballot(votes ...Vote) Ballot {
+	return Ballot{UserID: uuid.New(), Votes: votes}
+}
+
+func v(item uuid.UUID, value int) Vote {
+	return Vote{ItemID: item, Value: value}
+}
+
+func TestTally(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     VotingMethod
+		items      []uuid.UUID
+		ballots    []Ballot
+		wantWinner uuid.UUID
+		wantScores map[uuid.UUID]int
+		wantRanks  map[uuid.UUID]int
+		wantRounds int
+	}{
+		{
+			name:       "plurality majority",
+			method:     VotingPlurality,
+			items:      []uuid.UUID{itemA, itemB, itemC},
+			ballots:    []Ballot{ballot(v(itemA, 1)), ballot(v(itemA, 1)), ballot(v(itemB, 1))},
+			wantWinner: itemA,
+			wantScores: map[uuid.UUID]int{itemA: 2, itemB: 1, itemC: 0},
+			wantRanks:  map[uuid.UUID]int{itemA: 1, itemB: 2, itemC: 3},
+		},
+		{
+			name:       "plurality tie goes to earliest item",
+			method:     VotingPlurality,
+			items:      []uuid.UUID{itemA, itemB, itemC},
+			ballots:    []Ballot{ballot(v(itemB, 1)), ballot(v(itemA, 1))},
+			wantWinner: itemA,
+			wantScores: map[uuid.UUID]int{itemA: 1, itemB: 1, itemC: 0},
+			wantRanks:  map[uuid.UUID]int{itemA: 1, itemB: 1, itemC: 3},
+		},
+		{
+			name:       "plurality without ballots has no winner",
+			method:     VotingPlurality,
+			items:      []uuid.UUID{itemA, itemB},
+			wantScores: map[uuid.UUID]int{itemA: 0, itemB: 0},
+			wantRanks:  map[uuid.UUID]int{itemA: 1, itemB: 1},
+		},
+		{
+			name:   "approval counts every approved item",
+			method: VotingApproval,
+			items:  []uuid.UUID{itemA, itemB, itemC},
+			ballots: []Ballot{
+				ballot(v(itemA, 1), v(itemB, 1)),
+				ballot(v(itemB, 1)),
+				ballot(v(itemC, 1), v(itemA, 0)),
+			},
+			wantWinner: itemB,
+			wantScores: map[uuid.UUID]int{itemA: 1, itemB: 2, itemC: 1},
+			wantRanks:  map[uuid.UUID]int{itemB: 1, itemA: 2, itemC: 2},
+		},
+		{
+			name:       "approval with nothing approved has no winner",
+			method:     VotingApproval,
+			items:      []uuid.UUID{itemA, itemB},
+			ballots:    []Ballot{ballot(v(itemA, 0), v(itemB, 0)), ballot(v(itemB, 0))},
+			wantScores: map[uuid.UUID]int{itemA: 0, itemB: 0},
+			wantRanks:  map[uuid.UUID]int{itemA: 1, itemB: 1},
+		},
+		{
+			name:       "score with every rating at the minimum has no winner",
+			method:     VotingScore,
+			items:      []uuid.UUID{itemA, itemB},
+			ballots:    []Ballot{ballot(v(itemA, MinScore), v(itemB, MinScore)), ballot(v(itemA, MinScore))},
+			wantScores: map[uuid.UUID]int{itemA: 0, itemB: 0},
+			wantRanks:  map[uuid.UUID]int{itemA: 1, itemB: 1},
+		},
+		{
+			name:   "score sums ratings",
+			method: VotingScore,
+			items:  []uuid.UUID{itemA, itemB, itemC},
+			ballots: []Ballot{
+				ballot(v(itemA, 5), v(itemB, 3)),
+				ballot(v(itemA, 0), v(itemB, 5), v(itemC, 4)),
+			},
+			wantWinner: itemB,
+			wantScores: map[uuid.UUID]int{itemA: 5, itemB: 8, itemC: 4},
+			wantRanks:  map[uuid.UUID]int{itemB: 1, itemA: 2, itemC: 3},
+		},
+		{
+			name:   "borda awards points by rank",
+			method: VotingBorda,
+			items:  []uuid.UUID{itemA, itemB, itemC},
+			ballots: []Ballot{
+				ballot(v(itemA, 1), v(itemB, 2), v(itemC, 3)),
+				ballot(v(itemB, 1), v(itemA, 2), v(itemC, 3)),
+				ballot(v(itemA, 1), v(itemC, 2), v(itemB, 3)),
+			},
+			wantWinner: itemA,
+			wantScores: map[uuid.UUID]int{itemA: 5, itemB: 3, itemC: 1},
+			wantRanks:  map[uuid.UUID]int{itemA: 1, itemB: 2, itemC: 3},
+		},
+		{
+			name:   "borda three way tie goes to earliest item",
+			method: VotingBorda,
+			items:  []uuid.UUID{itemA, itemB, itemC},
+			ballots: []Ballot{
+				ballot(v(itemA, 1), v(itemB, 2), v(itemC, 3)),
+				ballot(v(itemB, 1), v(itemC, 2)),
+				ballot(v(itemC, 1), v(itemA, 2), v(itemB, 3)),
+			},
+			wantWinner: itemA,
+			wantScores: map[uuid.UUID]int{itemA: 3, itemB: 3, itemC: 3},
+			wantRanks:  map[uuid.UUID]int{itemA: 1, itemB: 1, itemC: 1},
+		},
+		{
+			name:   "ranked choice transfers votes until majority",
+			method: VotingRankedChoice,
+			items:  []uuid.UUID{itemA, itemB, itemC, itemD},
+			ballots: []Ballot{
+				ballot(v(itemA, 1), v(itemB, 2)),
+				ballot(v(itemA, 1), v(itemB, 2)),
+				ballot(v(itemB, 1), v(itemC, 2)),
+				ballot(v(itemC, 1), v(itemB, 2)),
+				ballot(v(itemD, 1), v(itemC, 2)),
+			},
+			wantWinner: itemC,
+			wantScores: map[uuid.UUID]int{itemC: 3, itemA: 2, itemB: 1, itemD: 1},
+			wantRanks:  map[uuid.UUID]int{itemC: 1, itemA: 2, itemB: 3, itemD: 4},
+			wantRounds: 3,
+		},
+		{
+			name:       "ranked choice first round majority",
+			method:     VotingRankedChoice,
+			items:      []uuid.UUID{itemA, itemB},
+			ballots:    []Ballot{ballot(v(itemB, 1)), ballot(v(itemB, 1), v(itemA, 2)), ballot(v(itemA, 1))},
+			wantWinner: itemB,
+			wantScores: map[uuid.UUID]int{itemB: 2, itemA: 1},
+			wantRanks:  map[uuid.UUID]int{itemB: 1, itemA: 2},
+			wantRounds: 1,
+		},
+		{
+			name:       "ranked choice eliminates latest item on tie",
+			method:     VotingRankedChoice,
+			items:      []uuid.UUID{itemA, itemB},
+			ballots:    []Ballot{ballot(v(itemA, 1)), ballot(v(itemB, 1))},
+			wantWinner: itemA,
+			wantScores: map[uuid.UUID]int{itemA: 1, itemB: 1},
+			wantRanks:  map[uuid.UUID]int{itemA: 1, itemB: 2},
+			wantRounds: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tallier, err := TallierFor(test.method)
+			if err != nil {
+				t.Fatalf("TallierFor(%q): %v", test.method, err)
+			}
+			for _, b := range test.ballots {
+				if err := tallier.ValidateBallot(test.items, b.Votes); err != nil {
+					t.Fatalf("test ballot %v rejected: %v", b.Votes, err)
+				}
+			}
+
+			result := tallier.Tally(test.items, test.ballots)
+
+			if result.Method != test.method {
+				t.Fatalf("method = %q, want %q", result.Method, test.method)
+			}
+			if result.BallotCount != len(test.ballots) {
+				t.Fatalf("ballot count = %d, want %d", result.BallotCount, len(test.ballots))
+			}
+			if test.wantWinner == uuid.Nil {
+				if result.Winner != nil {
+					t.Fatalf("winner = %v, want none", *result.Winner)
+				}
+			} else if result.Winner == nil || *result.Winner != test.wantWinner {
+				t.Fatalf("winner = %v, want %v", result.Winner, test.wantWinner)
+			}
+			if len(result.Ranking) != len(test.items) {
+				t.Fatalf("ranking has %d items, want %d", len(result.Ranking), len(test.items))
+			}
+			for _, r := range result.Ranking {
+				if r.Score != test.wantScores[r.ItemID] {
+					t.Fatalf("score for %v = %d, want %d", r.ItemID, r.Score, test.wantScores[r.ItemID])
+				}
+				if r.Rank != test.wantRanks[r.ItemID] {
+					t.Fatalf("rank for %v = %d, want %d", r.ItemID, r.Rank, test.wantRanks[r.ItemID])
+				}
+			}
+			if len(result.Rounds) != test.wantRounds {
+				t.Fatalf("rounds = %d, want %d", len(result.Rounds), test.wantRounds)
+			}
+		})
+	}
+}
+
+func TestValidateBallot(t *testing.T) {
+	items := []uuid.UUID{itemA, itemB, itemC}
+	unknown := uuid.MustParse("00000000-0000-0000-0000-0000000000ff")
+
+	tests := []struct {
+		name   string
+		method VotingMethod
+		votes  []Vote
+	}{
+		{name: "plurality with two choices", method: VotingPlurality, votes: []Vote{v(itemA, 1), v(itemB, 1)}},
+		{name: "plurality with no choice", method: VotingPlurality},
+		{name: "plurality for unknown item", method: VotingPlurality, votes: []Vote{v(unknown, 1)}},
+		{name: "approval value out of range", method: VotingApproval, votes: []Vote{v(itemA, 2)}},
+		{name: "approval duplicate item", method: VotingApproval, votes: []Vote{v(itemA, 1), v(itemA, 1)}},
+		{name: "score above maximum", method: VotingScore, votes: []Vote{v(itemA, MaxScore+1)}},
+		{name: "score below minimum", method: VotingScore, votes: []Vote{v(itemA, MinScore-1)}},
+		{name: "borda rank gap", method: VotingBorda, votes: []Vote{v(itemA, 1), v(itemB, 3)}},
+		{name: "borda duplicate rank", method: VotingBorda, votes: []Vote{v(itemA, 1), v(itemB, 1)}},
+		{name: "ranked choice empty", method: VotingRankedChoice},
+		{name: "ranked choice missing first place", method: VotingRankedChoice, votes: []Vote{v(itemA, 2)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tallier, err := TallierFor(test.method)
+			if err != nil {
+				t.Fatalf("TallierFor(%q): %v", test.method, err)
+			}
+			err = tallier.ValidateBallot(items, test.votes)
+			if !errors.Is(err, ErrInvalidBallot) {
+				t.Fatalf("ValidateBallot(%v) = %v, want ErrInvalidBallot", test.votes, err)
+			}
+		})
+	}
+}
+
+func TestTallierForUnknownMethod(t *testing.T) {
+	if _, err := TallierFor("coin_flip"); !errors.Is(err, ErrUnknownVotingMethod) {
+		t.Fatalf("want ErrUnknownVotingMethod, got %v", err)
+	}
+}
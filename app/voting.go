@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/Kam1217/optio/internal/events"
+	"github.com/google/uuid"
+)
+
+type VotingService struct {
+	db      *sql.DB
+	queries *database.Queries
+	Events  events.Publisher
+}
+
+func NewVotingService(db *sql.DB, queries *database.Queries) *VotingService {
+	return &VotingService{db: db, queries: queries}
+}
+
+func sessionItemIDs(ctx context.Context, queries *database.Queries, sessionID uuid.UUID) ([]uuid.UUID, error) {
+	items, err := queries.ListAllSessionItems(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("list session items: %w", err)
+	}
+	ids := make([]uuid.UUID, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids, nil
+}
+
+// CastBallot records the user's ballot, replacing any ballot they cast
+// earlier in the same session.
+func (v *VotingService) CastBallot(ctx context.Context, sessionID, userID uuid.UUID, votes []Vote) error {
+	m, err := requirePermission(ctx, v.queries, sessionID, userID, PermVote)
+	if err != nil {
+		return err
+	}
+	session := m.Session
+	if SessionMode(session.Mode) != ModeBallot {
+		return ErrWrongSessionMode
+	}
+	if !SessionStatus(session.Status).AcceptsVotes() {
+		return ErrVotingClosed
+	}
+
+	tallier, err := TallierFor(VotingMethod(session.VotingMethod))
+	if err != nil {
+		return err
+	}
+
+	items, err := sessionItemIDs(ctx, v.queries, sessionID)
+	if err != nil {
+		return err
+	}
+	if err := tallier.ValidateBallot(items, votes); err != nil {
+		return err
+	}
+
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := v.queries.WithTx(tx)
+
+	ballot, err := qtx.UpsertBallot(ctx, database.UpsertBallotParams{
+		SessionID: sessionID,
+		UserID:    userID,
+	})
+	if err != nil {
+		return fmt.Errorf("upsert ballot: %w", err)
+	}
+	if err := qtx.DeleteBallotVotes(ctx, ballot.ID); err != nil {
+		return fmt.Errorf("clear ballot votes: %w", err)
+	}
+	for _, vote := range votes {
+		if err := qtx.CreateVote(ctx, database.CreateVoteParams{
+			BallotID: ballot.ID,
+			ItemID:   vote.ItemID,
+			Value:    int32(vote.Value),
+		}); err != nil {
+			return fmt.Errorf("create vote: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit ballot: %w", err)
+	}
+
+	publishEvent(ctx, v.Events, events.VoteCast, sessionID, events.VoteData{UserID: userID})
+
+	return nil
+}
+
+func (v *VotingService) Results(ctx context.Context, sessionID, userID uuid.UUID) (*Result, error) {
+	session, err := participantSession(ctx, v.queries, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if SessionMode(session.Mode) != ModeBallot {
+		return nil, ErrWrongSessionMode
+	}
+	return tallySession(ctx, v.queries, session)
+}
+
+// tallySession counts the ballots cast so far in a ballot-mode session.
+func tallySession(ctx context.Context, queries *database.Queries, session database.Session) (*Result, error) {
+	tallier, err := TallierFor(VotingMethod(session.VotingMethod))
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := sessionItemIDs(ctx, queries, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := queries.ListSessionVotes(ctx, session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list session votes: %w", err)
+	}
+
+	var ballots []Ballot
+	for _, row := range rows {
+		if len(ballots) == 0 || ballots[len(ballots)-1].UserID != row.UserID {
+			ballots = append(ballots, Ballot{UserID: row.UserID})
+		}
+		b := &ballots[len(ballots)-1]
+		b.Votes = append(b.Votes, Vote{ItemID: row.ItemID, Value: int(row.Value)})
+	}
+
+	result := tallier.Tally(items, ballots)
+	return &result, nil
+}
@@ -8,11 +8,13 @@ import (
 	"time"
 
 	"github.com/Kam1217/optio/internal/database"
+	"github.com/Kam1217/optio/internal/events"
 )
 
 type DB struct {
 	*sql.DB
 	Queries *database.Queries
+	dsn     string
 }
 
 type Config struct {
@@ -29,15 +31,18 @@ type Config struct {
 	ConnMaxIdleTime time.Duration
 }
 
-func Connect(ctx context.Context, cfg Config) (*DB, error) {
+func (cfg Config) DSN() string {
 	if cfg.SSLMode == "" {
 		cfg.SSLMode = "disable"
 	}
 	if cfg.TimeZone == "" {
 		cfg.TimeZone = "UTC"
 	}
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s&TimeZone=%s", url.QueryEscape(cfg.User), url.QueryEscape(cfg.Password), cfg.Host, cfg.Port, cfg.DBName, cfg.SSLMode, cfg.TimeZone)
+}
 
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s&TimeZone=%s", url.QueryEscape(cfg.User), url.QueryEscape(cfg.Password), cfg.Host, cfg.Port, cfg.DBName, cfg.SSLMode, cfg.TimeZone)
+func Connect(ctx context.Context, cfg Config) (*DB, error) {
+	dsn := cfg.DSN()
 
 	dbConn, err := sql.Open("postgres", dsn)
 	if err != nil {
@@ -65,9 +70,16 @@ func Connect(ctx context.Context, cfg Config) (*DB, error) {
 	return &DB{
 		DB:      dbConn,
 		Queries: database.New(dbConn),
+		dsn:     dsn,
 	}, nil
 }
 
+// NewEventBus starts a Postgres event bus on this connection. The bus holds
+// its own dedicated connection for LISTEN and must be closed separately.
+func (db *DB) NewEventBus(cfg events.PostgresBusConfig) (*events.PostgresBus, error) {
+	return events.NewPostgresBus(db.DB, db.dsn, cfg)
+}
+
 func (db *DB) Close() error {
 	return db.DB.Close()
 }
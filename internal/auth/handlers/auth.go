@@ -1,23 +1,35 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/Kam1217/optio/internal/auth/middleware"
 	"github.com/Kam1217/optio/internal/auth/models"
+	"github.com/Kam1217/optio/internal/auth/oidc"
+	"github.com/Kam1217/optio/internal/auth/useragent"
 	"github.com/Kam1217/optio/internal/database"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
 type AuthHandler struct {
 	DB           *sql.DB
 	UserService  *models.UserService
 	Refresh      *models.RefreshService
+	Resets       *models.PasswordResetService
+	Verification *models.EmailVerificationService
+	MFA          *models.MFAService
+	Identities   *models.IdentityService
+	PATs         *models.PATService
+	// OIDC holds the configured sign-in providers by name.
+	OIDC         map[string]*oidc.Provider
 	JWT          *middleware.JWTManager
 	RefreshTTL   time.Duration
 	CookieDomain string
@@ -46,6 +58,7 @@ type UserResponse struct {
 	ID        uuid.UUID `json:"id"`
 	Username  string    `json:"username"`
 	Email     string    `json:"email"`
+	Verified  bool      `json:"verified"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -59,7 +72,8 @@ func (h *AuthHandler) toUserResponseFromCreate(u *database.CreateUserRow) UserRe
 	return UserResponse{
 		ID:        u.ID,
 		Username:  u.Username,
-		Email:     u.Email,
+		Email:     u.Email.String,
+		Verified:  u.EmailVerifiedAt.Valid,
 		CreatedAt: u.CreatedAt,
 		UpdatedAt: u.UpdatedAt,
 	}
@@ -69,7 +83,8 @@ func (h *AuthHandler) toUserFromLogin(user *database.GetUserForLoginRow) UserRes
 	return UserResponse{
 		ID:       user.ID,
 		Username: user.Username,
-		Email:    user.Email,
+		Email:    user.Email.String,
+		Verified: user.EmailVerifiedAt.Valid,
 	}
 }
 
@@ -77,7 +92,8 @@ func (h *AuthHandler) toUserGetUserByIDRow(user *database.GetUserByIDRow) UserRe
 	return UserResponse{
 		ID:       user.ID,
 		Username: user.Username,
-		Email:    user.Email,
+		Email:    user.Email.String,
+		Verified: user.EmailVerifiedAt.Valid,
 	}
 }
 
@@ -110,16 +126,17 @@ func (h *AuthHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error creating user", http.StatusInternalServerError)
 		return
 	}
+	h.sendVerification(ctx, user.ID)
 
-	token, err := h.JWT.GenerateJWT(user.ID, user.Username)
+	rtPlain, rt, err := h.Refresh.IssueRefreshToken(ctx, user.ID, r.UserAgent(), clientIP(r))
 	if err != nil {
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		http.Error(w, "Error issuing refresh", http.StatusInternalServerError)
 		return
 	}
 
-	rtPlain, err := h.Refresh.IssueRefreshToken(ctx, user.ID, r.UserAgent(), clientIP(r))
+	token, err := h.JWT.GenerateDeviceJWT(user.ID, user.Username, user.TokenVersion, rt.FamilyID)
 	if err != nil {
-		http.Error(w, "Error issuing refresh", http.StatusInternalServerError)
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 	setRefreshCookie(w, rtPlain, h.RefreshTTL, h.CookieDomain)
@@ -156,17 +173,36 @@ func (h *AuthHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.JWT.GenerateJWT(user.ID, user.Username)
+	mfa, err := h.MFA.Enabled(ctx, user.ID)
 	if err != nil {
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if mfa {
+		challenge, err := h.JWT.GenerateMFAChallenge(user.ID, user.Username, user.TokenVersion)
+		if err != nil {
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+		h.respondWithJSON(w, MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    challenge,
+			ExpiresIn:   int(h.JWT.MFAExpiresIn.Seconds()),
+		}, http.StatusOK)
 		return
 	}
 
-	rtPlain, err := h.Refresh.IssueRefreshToken(ctx, user.ID, r.UserAgent(), clientIP(r))
+	rtPlain, rt, err := h.Refresh.IssueRefreshToken(ctx, user.ID, r.UserAgent(), clientIP(r))
 	if err != nil {
 		http.Error(w, "Error issuing refresh", http.StatusInternalServerError)
 		return
 	}
+
+	token, err := h.JWT.GenerateDeviceJWT(user.ID, user.Username, user.TokenVersion, rt.FamilyID)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
 	setRefreshCookie(w, rtPlain, h.RefreshTTL, h.CookieDomain)
 
 	response := AuthResponse{
@@ -177,6 +213,78 @@ func (h *AuthHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 	h.respondWithJSON(w, response, http.StatusOK)
 }
 
+// UpgradeGuest turns the guest behind the token into a full account. It is the
+// one route outside their session that guests may use; the account keeps the
+// guest's ID, so their items and votes carry over.
+func (h *AuthHandler) UpgradeGuest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := middleware.UserIDFromCtx(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Username == "" || req.Password == "" || req.Email == "" {
+		http.Error(w, "Username, password and email cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	exists, err := h.UserService.UserExists(ctx, req.Username, req.Email)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		http.Error(w, "User with this email or username already exists", http.StatusConflict)
+		return
+	}
+
+	user, err := h.UserService.UpgradeGuest(ctx, userID, req.Username, req.Email, req.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrNotGuest) {
+			http.Error(w, "Account is already registered", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error upgrading account", http.StatusInternalServerError)
+		return
+	}
+	h.sendVerification(ctx, user.ID)
+
+	rtPlain, rt, err := h.Refresh.IssueRefreshToken(ctx, user.ID, r.UserAgent(), clientIP(r))
+	if err != nil {
+		http.Error(w, "Error issuing refresh", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := h.JWT.GenerateDeviceJWT(user.ID, user.Username, user.TokenVersion, rt.FamilyID)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	setRefreshCookie(w, rtPlain, h.RefreshTTL, h.CookieDomain)
+
+	response := AuthResponse{
+		Token: token,
+		User: UserResponse{
+			ID:        user.ID,
+			Username:  user.Username,
+			Email:     user.Email.String,
+			Verified:  user.EmailVerifiedAt.Valid,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+		},
+	}
+
+	h.respondWithJSON(w, response, http.StatusOK)
+}
+
 func (h *AuthHandler) Profile(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -207,19 +315,22 @@ func (h *AuthHandler) RefreshSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newPlain, userID, err := h.Refresh.RotateRefreshToken(ctx, c.Value, nil, r.UserAgent(), clientIP(r))
+	newPlain, rt, err := h.Refresh.RotateRefreshToken(ctx, c.Value, r.UserAgent(), clientIP(r))
 	if err != nil {
+		if errors.Is(err, models.ErrRefreshTokenReused) {
+			clearRefreshCookie(w, h.CookieDomain)
+		}
 		http.Error(w, "Invalid refresh", http.StatusUnauthorized)
 		return
 	}
 
-	user, err := h.UserService.GetUserByID(ctx, userID)
+	user, err := h.UserService.GetUserByID(ctx, rt.UserID)
 	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
-	token, err := h.JWT.GenerateJWT(user.ID, user.Username)
+	token, err := h.JWT.GenerateDeviceJWT(user.ID, user.Username, user.TokenVersion, rt.FamilyID)
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
@@ -235,12 +346,392 @@ func (h *AuthHandler) RefreshSession(w http.ResponseWriter, r *http.Request) {
 
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	if c, err := r.Cookie("refresh_token"); err == nil && c.Value != "" {
-		_, _, _ = h.Refresh.RotateRefreshToken(r.Context(), c.Value, nil, r.UserAgent(), clientIP(r))
+		_ = h.Refresh.RevokeRefreshToken(r.Context(), c.Value)
+	}
+	clearRefreshCookie(w, h.CookieDomain)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// ForgotPassword starts a password reset. It answers the same way whether or
+// not the email belongs to an account.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
 	}
+	if req.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	// The answer must not wait on the lookup or the email, or its timing
+	// would give away whether the account exists.
+	h.Resets.RequestResetInBackground(req.Email)
+
+	h.respondWithJSON(w, MessageResponse{
+		Message: "If an account uses that email, a link to reset its password is on its way.",
+	}, http.StatusAccepted)
+}
+
+// ResetPassword sets a new password with the token from a reset email and
+// signs the account out everywhere.
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" || req.Password == "" {
+		http.Error(w, "token and password are required", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := h.Resets.ConfirmReset(r.Context(), req.Token, req.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidResetToken) {
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+	h.JWT.Versions.Invalidate(userID)
+
 	clearRefreshCookie(w, h.CookieDomain)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePassword sets a new password and signs the user out everywhere else.
+// This device gets a fresh device session, since its old tokens are revoked
+// along with the rest.
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := middleware.UserIDFromCtx(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, "current_password and new_password are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.UserService.ChangePassword(ctx, userID, req.CurrentPassword, req.NewPassword); err != nil {
+		if errors.Is(err, models.ErrInvalidCredentails) {
+			http.Error(w, "Current password is incorrect", http.StatusForbidden)
+			return
+		}
+		http.Error(w, "Error changing password", http.StatusInternalServerError)
+		return
+	}
+	h.JWT.Versions.Invalidate(userID)
+
+	user, err := h.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rtPlain, rt, err := h.Refresh.IssueRefreshToken(ctx, user.ID, r.UserAgent(), clientIP(r))
+	if err != nil {
+		http.Error(w, "Error issuing refresh", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := h.JWT.GenerateDeviceJWT(user.ID, user.Username, user.TokenVersion, rt.FamilyID)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	setRefreshCookie(w, rtPlain, h.RefreshTTL, h.CookieDomain)
+
+	response := AuthResponse{
+		Token: token,
+		User:  h.toUserGetUserByIDRow(user),
+	}
+
+	h.respondWithJSON(w, response, http.StatusOK)
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// UpdateEmailRequest needs the current password, and a two-factor code when
+// two-factor is on, since the new address can be used to reset the password.
+type UpdateEmailRequest struct {
+	Email           string `json:"email"`
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"`
+}
+
+// sendVerification mails a verification link. The account works without one,
+// so a failure is only logged and the user can ask for another link.
+func (h *AuthHandler) sendVerification(ctx context.Context, userID uuid.UUID) {
+	if err := h.Verification.SendVerification(ctx, userID); err != nil {
+		log.Printf("send verification email: %v", err)
+	}
+}
+
+// VerifyEmail confirms an email with the token from a verification link. The
+// token is the proof, so no access token is needed.
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Verification.Verify(r.Context(), req.Token); err != nil {
+		if errors.Is(err, models.ErrInvalidVerificationToken) {
+			http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Error verifying email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerification mails a new verification link to the user's email.
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Verification.SendVerification(r.Context(), userID); err != nil {
+		if errors.Is(err, models.ErrEmailAlreadyVerified) {
+			http.Error(w, "Email is already verified", http.StatusConflict)
+			return
+		}
+		log.Printf("send verification email: %v", err)
+		http.Error(w, "Error sending verification email", http.StatusInternalServerError)
+		return
+	}
+
+	h.respondWithJSON(w, MessageResponse{
+		Message: "A verification link is on its way.",
+	}, http.StatusAccepted)
+}
+
+// UpdateEmail changes the user's email. An access token alone is not enough:
+// it takes the current password and, with two-factor on, a code. The new
+// address starts unverified and gets a verification link of its own, and the
+// old one is told about the change.
+func (h *AuthHandler) UpdateEmail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := middleware.UserIDFromCtx(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req UpdateEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	mfaEnabled, err := h.MFA.Enabled(ctx, userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if mfaEnabled {
+		if req.Code == "" {
+			http.Error(w, "Two-factor code is required", http.StatusForbidden)
+			return
+		}
+		if err := h.MFA.VerifyCode(ctx, userID, req.Code, r.UserAgent(), clientIP(r)); err != nil {
+			h.writeMFAError(w, err, "Error checking two-factor code")
+			return
+		}
+	}
+
+	user, err := h.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !strings.EqualFold(user.Email.String, req.Email) {
+		oldEmail, err := h.UserService.UpdateEmail(ctx, userID, req.CurrentPassword, req.Email)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrInvalidCredentails):
+				http.Error(w, "Current password is incorrect", http.StatusForbidden)
+			case errors.Is(err, models.ErrEmailInUse):
+				http.Error(w, "User with this email already exists", http.StatusConflict)
+			default:
+				http.Error(w, "Error updating email", http.StatusInternalServerError)
+			}
+			return
+		}
+		if oldEmail != "" {
+			if err := h.Verification.NotifyEmailChanged(ctx, user.Username, oldEmail, req.Email); err != nil {
+				log.Printf("send email change notice: %v", err)
+			}
+		}
+		h.sendVerification(ctx, userID)
+
+		if user, err = h.UserService.GetUserByID(ctx, userID); err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.respondWithJSON(w, h.toUserGetUserByIDRow(user), http.StatusOK)
+}
+
+type DeviceSessionResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	IssuedAt   time.Time  `json:"issued_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Current    bool       `json:"current"`
+}
+
+// ListSessions shows the devices the user is signed in on. Each device session
+// is a refresh token family, so its ID survives token rotation.
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := middleware.UserIDFromCtx(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	current, hasCurrent := middleware.DeviceSessionFromCtx(ctx)
+
+	tokens, err := h.Refresh.ListDeviceSessions(ctx, userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]DeviceSessionResponse, len(tokens))
+	for i, t := range tokens {
+		response[i] = DeviceSessionResponse{
+			ID:        t.FamilyID,
+			Device:    useragent.Describe(t.UserAgent),
+			UserAgent: t.UserAgent,
+			IP:        t.Ip,
+			IssuedAt:  t.LoginAt,
+			ExpiresAt: t.ExpiresAt,
+			Current:   hasCurrent && t.FamilyID == current,
+		}
+		if t.LastUsedAt.Valid {
+			response[i].LastUsedAt = &t.LastUsedAt.Time
+		}
+	}
+
+	h.respondWithJSON(w, response, http.StatusOK)
+}
+
+// RevokeSession signs one device out. Signing out the current device also
+// clears its refresh cookie.
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := middleware.UserIDFromCtx(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	familyID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Refresh.RevokeDeviceSession(ctx, userID, familyID); err != nil {
+		if errors.Is(err, models.ErrDeviceSessionNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if current, ok := middleware.DeviceSessionFromCtx(ctx); ok && current == familyID {
+		clearRefreshCookie(w, h.CookieDomain)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll signs the user out of every device, this one included, and
+// revokes their personal access tokens.
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := middleware.UserIDFromCtx(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Refresh.RevokeAllDeviceSessions(ctx, userID); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.PATs.RevokeAll(ctx, userID); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	clearRefreshCookie(w, h.CookieDomain)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JWKS publishes the public keys access tokens are signed with, so other
+// services can check them. Keys come and go slowly, so clients may cache the
+// set for a while.
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	h.respondWithJSON(w, h.JWT.Keys.JWKS(), http.StatusOK)
+}
+
 func setRefreshCookie(w http.ResponseWriter, val string, ttl time.Duration, domain string) {
 	c := &http.Cookie{
 		Name:     "refresh_token",
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Kam1217/optio/internal/auth/middleware"
+	"github.com/Kam1217/optio/internal/auth/models"
+	"github.com/google/uuid"
+)
+
+// MFAChallengeResponse is what LoginUser returns instead of tokens when the
+// account has two-factor on. The MFA token goes to LoginMFA with a code.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// LoginMFA finishes a two-factor login: it trades the challenge from LoginUser
+// and a code from the authenticator app, or a recovery code, for tokens. A
+// challenge finishes one login and takes only a few wrong codes.
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req LoginMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.MFAToken == "" || req.Code == "" {
+		http.Error(w, "mfa_token and code are required", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := h.JWT.ValidateMFAChallenge(req.MFAToken)
+	if err != nil {
+		http.Error(w, "Invalid or expired two-factor challenge", http.StatusUnauthorized)
+		return
+	}
+	challengeID, err := uuid.Parse(claims.ID)
+	if err != nil || claims.ExpiresAt == nil {
+		http.Error(w, "Invalid or expired two-factor challenge", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.UserService.GetUserByID(ctx, claims.UserID)
+	if err != nil || user.TokenVersion != claims.TokenVersion {
+		http.Error(w, "Invalid or expired two-factor challenge", http.StatusUnauthorized)
+		return
+	}
+
+	challenge := models.MFAChallenge{ID: challengeID, ExpiresAt: claims.ExpiresAt.Time}
+	if err := h.MFA.VerifyLogin(ctx, user.ID, challenge, req.Code, r.UserAgent(), clientIP(r)); err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidMFACode), errors.Is(err, models.ErrMFANotEnabled):
+			http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		case errors.Is(err, models.ErrMFAChallengeSpent):
+			http.Error(w, "Invalid or expired two-factor challenge", http.StatusUnauthorized)
+		case errors.Is(err, models.ErrMFALocked):
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		default:
+			http.Error(w, "Error checking two-factor code", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rtPlain, rt, err := h.Refresh.IssueRefreshToken(ctx, user.ID, r.UserAgent(), clientIP(r))
+	if err != nil {
+		http.Error(w, "Error issuing refresh", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := h.JWT.GenerateDeviceJWT(user.ID, user.Username, user.TokenVersion, rt.FamilyID)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	setRefreshCookie(w, rtPlain, h.RefreshTTL, h.CookieDomain)
+
+	response := AuthResponse{
+		Token: token,
+		User:  h.toUserGetUserByIDRow(user),
+	}
+
+	h.respondWithJSON(w, response, http.StatusOK)
+}
+
+// BeginTOTP starts adding an authenticator app. Two-factor stays off until
+// ConfirmTOTP gets a code from it.
+func (h *AuthHandler) BeginTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := h.MFA.BeginTOTPEnrollment(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, models.ErrMFAAlreadyEnabled) {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error starting two-factor enrolment", http.StatusInternalServerError)
+		return
+	}
+
+	h.respondWithJSON(w, TOTPEnrollmentResponse{
+		Secret:     enrollment.Secret,
+		OTPAuthURI: enrollment.URI,
+	}, http.StatusOK)
+}
+
+// ConfirmTOTP turns two-factor on and hands out the recovery codes, which are
+// never shown again.
+func (h *AuthHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.MFA.ConfirmTOTPEnrollment(r.Context(), userID, req.Code)
+	if err != nil {
+		h.writeMFAError(w, err, "Error confirming two-factor enrolment")
+		return
+	}
+
+	h.respondWithJSON(w, RecoveryCodesResponse{RecoveryCodes: codes}, http.StatusOK)
+}
+
+// DisableTOTP turns two-factor off. It takes a current code or a recovery
+// code.
+func (h *AuthHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.MFA.DisableTOTP(r.Context(), userID, req.Code, r.UserAgent(), clientIP(r)); err != nil {
+		h.writeMFAError(w, err, "Error disabling two-factor authentication")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes swaps the user's recovery codes for a new set.
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.MFA.RegenerateRecoveryCodes(r.Context(), userID, req.Code, r.UserAgent(), clientIP(r))
+	if err != nil {
+		h.writeMFAError(w, err, "Error regenerating recovery codes")
+		return
+	}
+
+	h.respondWithJSON(w, RecoveryCodesResponse{RecoveryCodes: codes}, http.StatusOK)
+}
+
+func (h *AuthHandler) writeMFAError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidMFACode):
+		http.Error(w, "Invalid two-factor code", http.StatusForbidden)
+	case errors.Is(err, models.ErrMFALocked):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, models.ErrMFAAlreadyEnabled):
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+	case errors.Is(err, models.ErrMFANotEnabled), errors.Is(err, models.ErrMFANotEnrolling):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
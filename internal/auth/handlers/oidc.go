@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/middleware"
+	"github.com/Kam1217/optio/internal/auth/models"
+	"github.com/Kam1217/optio/internal/auth/oidc"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// oidcStateCookie ties a login at a provider to the browser that started it,
+// so nobody can send a victim the tail end of their own login.
+const oidcStateCookie = "oidc_state"
+
+type OIDCLinkResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+type IdentityResponse struct {
+	ID          uuid.UUID `json:"id"`
+	Provider    string    `json:"provider"`
+	Email       string    `json:"email,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// StartOIDCLogin sends the browser to the provider to sign in.
+func (h *AuthHandler) StartOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	authURL, ok := h.startOIDC(w, r, provider, uuid.NullUUID{})
+	if !ok {
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// StartOIDCLink begins adding a provider account to the signed-in user. The
+// app sends the browser to the returned URL; it comes back to the callback.
+func (h *AuthHandler) StartOIDCLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	provider, ok := h.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	authURL, ok := h.startOIDC(w, r, provider, uuid.NullUUID{UUID: userID, Valid: true})
+	if !ok {
+		return
+	}
+	h.respondWithJSON(w, OIDCLinkResponse{AuthorizationURL: authURL}, http.StatusOK)
+}
+
+func (h *AuthHandler) startOIDC(w http.ResponseWriter, r *http.Request, provider *oidc.Provider, linkUserID uuid.NullUUID) (string, bool) {
+	ctx := r.Context()
+
+	login, err := h.Identities.StartLogin(ctx, provider.Name, linkUserID)
+	if err != nil {
+		http.Error(w, "Error starting sign-in", http.StatusInternalServerError)
+		return "", false
+	}
+	authURL, err := provider.AuthCodeURL(ctx, login.State, login.Nonce, oidc.PKCEChallenge(login.CodeVerifier))
+	if err != nil {
+		log.Printf("oidc %s: %v", provider.Name, err)
+		http.Error(w, "Sign-in provider unavailable", http.StatusBadGateway)
+		return "", false
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    login.State,
+		Path:     "/api/auth/oidc",
+		HttpOnly: true,
+		Secure:   true,
+		// Lax, so the cookie comes along on the provider's redirect back.
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(h.Identities.StateTTL.Seconds()),
+	})
+	return authURL, true
+}
+
+// OIDCCallback is where the provider sends the browser back. It signs the
+// user in, creating an account the first time, or finishes linking the
+// provider account to the user who started the link.
+func (h *AuthHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	provider, ok := h.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    "",
+		Path:     "/api/auth/oidc",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		http.Error(w, "Sign-in was not completed: "+e, http.StatusUnauthorized)
+		return
+	}
+	state, code := q.Get("state"), q.Get("code")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if state == "" || code == "" || err != nil ||
+		subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		http.Error(w, "Invalid or expired sign-in", http.StatusBadRequest)
+		return
+	}
+
+	login, err := h.Identities.FinishLogin(ctx, provider.Name, state)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidOIDCState) {
+			http.Error(w, "Invalid or expired sign-in", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	claims, err := provider.Exchange(ctx, code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("oidc %s: %v", provider.Name, err)
+		if errors.Is(err, oidc.ErrExchangeFailed) || errors.Is(err, oidc.ErrInvalidIDToken) {
+			http.Error(w, "Sign-in with provider failed", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Sign-in provider unavailable", http.StatusBadGateway)
+		return
+	}
+	ident := models.ExternalIdentity{
+		Provider:          provider.Name,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     bool(claims.EmailVerified),
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}
+
+	if login.LinkUserID.Valid {
+		h.finishOIDCLink(w, r, login.LinkUserID.UUID, ident)
+		return
+	}
+
+	userID, created, err := h.Identities.SignIn(ctx, ident)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEmailInUse):
+			http.Error(w, "An account with this email already exists. Log in to it and link this provider instead.", http.StatusConflict)
+		case errors.Is(err, models.ErrIdentityNoEmail):
+			http.Error(w, "The provider did not share an email address", http.StatusBadRequest)
+		case errors.Is(err, models.ErrIdentityTaken):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+	user, err := h.UserService.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Account not found", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if created && !user.EmailVerifiedAt.Valid {
+		h.sendVerification(ctx, userID)
+	}
+
+	// A provider login stands in for the password, not the second factor.
+	mfa, err := h.MFA.Enabled(ctx, user.ID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if mfa {
+		challenge, err := h.JWT.GenerateMFAChallenge(user.ID, user.Username, user.TokenVersion)
+		if err != nil {
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+		h.respondWithJSON(w, MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    challenge,
+			ExpiresIn:   int(h.JWT.MFAExpiresIn.Seconds()),
+		}, http.StatusOK)
+		return
+	}
+
+	rtPlain, rt, err := h.Refresh.IssueRefreshToken(ctx, user.ID, r.UserAgent(), clientIP(r))
+	if err != nil {
+		http.Error(w, "Error issuing refresh", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := h.JWT.GenerateDeviceJWT(user.ID, user.Username, user.TokenVersion, rt.FamilyID)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	setRefreshCookie(w, rtPlain, h.RefreshTTL, h.CookieDomain)
+
+	response := AuthResponse{
+		Token: token,
+		User:  h.toUserGetUserByIDRow(user),
+	}
+
+	h.respondWithJSON(w, response, http.StatusOK)
+}
+
+func (h *AuthHandler) finishOIDCLink(w http.ResponseWriter, r *http.Request, userID uuid.UUID, ident models.ExternalIdentity) {
+	identity, err := h.Identities.Link(r.Context(), userID, ident)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrIdentityTaken), errors.Is(err, models.ErrProviderAlreadyLinked):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.respondWithJSON(w, IdentityResponse{
+		ID:          identity.ID,
+		Provider:    identity.Provider,
+		Email:       identity.Email.String,
+		CreatedAt:   identity.CreatedAt,
+		LastLoginAt: identity.LastLoginAt,
+	}, http.StatusOK)
+}
+
+// ListIdentities shows the provider accounts the user can sign in with.
+func (h *AuthHandler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	identities, err := h.Identities.List(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]IdentityResponse, len(identities))
+	for i, identity := range identities {
+		response[i] = IdentityResponse{
+			ID:          identity.ID,
+			Provider:    identity.Provider,
+			Email:       identity.Email.String,
+			CreatedAt:   identity.CreatedAt,
+			LastLoginAt: identity.LastLoginAt,
+		}
+	}
+
+	h.respondWithJSON(w, response, http.StatusOK)
+}
+
+// UnlinkIdentity removes a provider account from the user. Users without a
+// password have to keep at least one.
+func (h *AuthHandler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	identityID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid identity ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Identities.Unlink(r.Context(), userID, identityID); err != nil {
+		switch {
+		case errors.Is(err, models.ErrIdentityNotFound):
+			http.Error(w, "Identity not found", http.StatusNotFound)
+		case errors.Is(err, models.ErrLastSignInMethod):
+			http.Error(w, "Set a password before removing your only sign-in provider", http.StatusConflict)
+		default:
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) oidcProvider(w http.ResponseWriter, r *http.Request) (*oidc.Provider, bool) {
+	provider, ok := h.OIDC[mux.Vars(r)["provider"]]
+	if !ok {
+		http.Error(w, "Unknown sign-in provider", http.StatusNotFound)
+		return nil, false
+	}
+	return provider, true
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/middleware"
+	"github.com/Kam1217/optio/internal/auth/models"
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type CreatePATRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresAt is optional; tokens without one last until revoked.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type PATResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreatePATResponse struct {
+	// Token is shown this once; only its hash is kept.
+	Token string `json:"token"`
+	PATResponse
+}
+
+func toPATResponse(t database.PersonalAccessToken) PATResponse {
+	response := PATResponse{
+		ID:        t.ID,
+		Name:      t.Name,
+		Hint:      t.TokenHint,
+		Scopes:    t.Scopes,
+		CreatedAt: t.CreatedAt,
+	}
+	if t.ExpiresAt.Valid {
+		response.ExpiresAt = &t.ExpiresAt.Time
+	}
+	if t.LastUsedAt.Valid {
+		response.LastUsedAt = &t.LastUsedAt.Time
+	}
+	return response
+}
+
+// CreatePAT makes a personal access token for scripts and bots to call the API
+// as the user.
+func (h *AuthHandler) CreatePAT(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req CreatePATRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	var expiresAt time.Time
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+
+	plain, token, err := h.PATs.Create(r.Context(), userID, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidPATName),
+			errors.Is(err, models.ErrInvalidPATScopes),
+			errors.Is(err, models.ErrInvalidPATExpiry):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.respondWithJSON(w, CreatePATResponse{Token: plain, PATResponse: toPATResponse(token)}, http.StatusCreated)
+}
+
+// ListPATs shows the user's personal access tokens, without the tokens
+// themselves.
+func (h *AuthHandler) ListPATs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := h.PATs.List(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]PATResponse, len(tokens))
+	for i, t := range tokens {
+		response[i] = toPATResponse(t)
+	}
+
+	h.respondWithJSON(w, response, http.StatusOK)
+}
+
+// RevokePAT stops one of the user's personal access tokens working.
+func (h *AuthHandler) RevokePAT(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokenID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.PATs.Revoke(r.Context(), userID, tokenID); err != nil {
+		if errors.Is(err, models.ErrPATNotFound) {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
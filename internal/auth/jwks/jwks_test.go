@@ -0,0 +1,142 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type equaler interface {
+	Equal(crypto.PublicKey) bool
+}
+
+func TestKeyRoundTrip(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name string
+		alg  string
+		pub  crypto.PublicKey
+	}{
+		{"rsa", "RS256", &rsaKey.PublicKey},
+		{"ec", "ES256", &ecKey.PublicKey},
+		{"ed25519", "EdDSA", edPub},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwk, err := FromPublicKey(tt.name, tt.alg, tt.pub)
+			if err != nil {
+				t.Fatalf("FromPublicKey: %v", err)
+			}
+			// Go through JSON, as keys do in practice.
+			data, _ := json.Marshal(Set{Keys: []Key{jwk}})
+			var set Set
+			if err := json.Unmarshal(data, &set); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			got, ok := set.Lookup(tt.name)
+			if !ok || got.Alg != tt.alg || got.Use != "sig" {
+				t.Fatalf("Lookup = %+v, %v", got, ok)
+			}
+			pub, err := got.PublicKey()
+			if err != nil {
+				t.Fatalf("PublicKey: %v", err)
+			}
+			if !tt.pub.(equaler).Equal(pub) {
+				t.Fatalf("round trip changed the key")
+			}
+		})
+	}
+}
+
+func TestKeyRejectsBadInput(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	good, _ := FromPublicKey("ec", "ES256", &ecKey.PublicKey)
+	offCurve := good
+	offCurve.Y = good.X
+
+	tests := []struct {
+		name string
+		key  Key
+	}{
+		{"unknown type", Key{Kty: "oct"}},
+		{"unknown curve", Key{Kty: "EC", Crv: "P-192"}},
+		{"point off the curve", offCurve},
+		{"short Ed25519 key", Key{Kty: "OKP", Crv: "Ed25519", X: "AAAA"}},
+		{"X25519 is not for signing", Key{Kty: "OKP", Crv: "X25519", X: good.X}},
+		{"empty RSA modulus", Key{Kty: "RSA", E: "AQAB"}},
+		{"tiny RSA exponent", Key{Kty: "RSA", N: good.X, E: "AQ"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.key.PublicKey(); err == nil {
+				t.Fatalf("want an error")
+			}
+		})
+	}
+}
+
+func TestFetcherRefetchesForUnknownKeys(t *testing.T) {
+	first, _, _ := ed25519.GenerateKey(rand.Reader)
+	second, _, _ := ed25519.GenerateKey(rand.Reader)
+	k1, _ := FromPublicKey("k1", "EdDSA", first)
+	k2, _ := FromPublicKey("k2", "EdDSA", second)
+
+	var fetches atomic.Int32
+	var published atomic.Value
+	published.Store(Set{Keys: []Key{k1}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(published.Load())
+	}))
+	defer srv.Close()
+
+	f := NewFetcher(srv.URL, srv.Client())
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := f.PublicKey(ctx, "k1"); err != nil {
+			t.Fatalf("k1: %v", err)
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Fatalf("want one fetch for a known key, got %d", fetches.Load())
+	}
+
+	// The provider rotates, but a fetch just happened, so the new key is not
+	// looked for yet.
+	published.Store(Set{Keys: []Key{k1, k2}})
+	if _, err := f.PublicKey(ctx, "k2"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("within MinRefresh: want ErrKeyNotFound, got %v", err)
+	}
+
+	f.MinRefresh = 0
+	pub, err := f.PublicKey(ctx, "k2")
+	if err != nil || !second.Equal(pub) {
+		t.Fatalf("after rotation: got %v, %v", pub, err)
+	}
+	if fetches.Load() != 2 {
+		t.Fatalf("want two fetches, got %d", fetches.Load())
+	}
+
+	f.MinRefresh = time.Hour
+	if _, err := f.PublicKey(ctx, "made-up"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("unknown key: want ErrKeyNotFound, got %v", err)
+	}
+	if fetches.Load() != 2 {
+		t.Fatalf("unknown key refetched within MinRefresh: %d fetches", fetches.Load())
+	}
+}
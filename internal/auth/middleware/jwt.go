@@ -2,8 +2,9 @@ package middleware
 
 import (
 	"context"
-
+	"database/sql"
 	"errors"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -12,56 +13,168 @@ import (
 	"github.com/google/uuid"
 )
 
+// DefaultGuestTokenTTL is how long a guest's token lasts. Guests get no
+// refresh token, so this covers a whole session.
+const DefaultGuestTokenTTL = 4 * time.Hour
+
+// DefaultMFAChallengeTTL is how long someone has to enter their second factor
+// after giving their password.
+const DefaultMFAChallengeTTL = 5 * time.Minute
+
+var (
+	ErrGuestToken   = errors.New("guest tokens can only be used within their session")
+	ErrMFAChallenge = errors.New("two-factor challenge tokens are not access tokens")
+)
+
 type JWTManager struct {
-	secret    []byte
+	// Keys signs and checks the tokens.
+	Keys      *Keyring
 	issuer    string
 	audience  string
 	expiresIn time.Duration
+	// GuestExpiresIn is the lifetime of guest tokens.
+	GuestExpiresIn time.Duration
+	// MFAExpiresIn is the lifetime of two-factor challenge tokens.
+	MFAExpiresIn time.Duration
+	// Versions, when set, turns away access tokens issued under an older
+	// token version than the user's, such as before a password change.
+	Versions *TokenVersionCache
+	// PATs, when set, lets personal access tokens through on routes that
+	// name a scope.
+	PATs PersonalAccessTokenSource
 }
 
+// NewJWTManager signs tokens with HS256 and the shared secret.
 func NewJWTManager(secret, issuer, audience string, expiresIn time.Duration) *JWTManager {
+	keys := NewKeyring()
+	// Neither can fail on a new, empty ring.
+	_ = keys.Add(NewHMACKey("", []byte(secret)))
+	_ = keys.SetActive("")
+	return NewJWTManagerWithKeys(keys, issuer, audience, expiresIn)
+}
+
+// NewJWTManagerWithKeys signs tokens with the keyring's active key.
+func NewJWTManagerWithKeys(keys *Keyring, issuer, audience string, expiresIn time.Duration) *JWTManager {
 	return &JWTManager{
-		secret:    []byte(secret),
-		issuer:    issuer,
-		audience:  audience,
-		expiresIn: expiresIn,
+		Keys:           keys,
+		issuer:         issuer,
+		audience:       audience,
+		expiresIn:      expiresIn,
+		GuestExpiresIn: DefaultGuestTokenTTL,
+		MFAExpiresIn:   DefaultMFAChallengeTTL,
 	}
 }
 
 type Claims struct {
 	UserID   uuid.UUID `json:"user_id"`
 	Username string    `json:"username"`
+	// GuestSession is only set on guest tokens, which are good for nothing
+	// but that one session.
+	GuestSession *uuid.UUID `json:"guest_session,omitempty"`
+	// DeviceSession is the refresh token family the access token was issued
+	// with, so the device it came from can be told apart from the others.
+	DeviceSession *uuid.UUID `json:"sid,omitempty"`
+	// TokenVersion is the user's token version when the token was issued.
+	TokenVersion int32 `json:"ver,omitempty"`
+	// MFAChallenge marks a token that only proves the password was right.
+	// It is traded for an access token along with a second factor.
+	MFAChallenge bool `json:"mfa,omitempty"`
 	jwt.RegisteredClaims
 }
 
 func (m *JWTManager) GenerateJWT(userID uuid.UUID, username string) (string, error) {
+	return m.sign(Claims{UserID: userID, Username: username}, m.expiresIn)
+}
+
+// GenerateDeviceJWT issues an access token tied to the device session, the
+// refresh token family, it was issued with.
+func (m *JWTManager) GenerateDeviceJWT(userID uuid.UUID, username string, tokenVersion int32, deviceSession uuid.UUID) (string, error) {
+	return m.sign(Claims{
+		UserID:        userID,
+		Username:      username,
+		DeviceSession: &deviceSession,
+		TokenVersion:  tokenVersion,
+	}, m.expiresIn)
+}
+
+// GenerateGuestJWT issues a token that only works for the given session.
+func (m *JWTManager) GenerateGuestJWT(userID uuid.UUID, username string, sessionID uuid.UUID) (string, error) {
+	return m.sign(Claims{UserID: userID, Username: username, GuestSession: &sessionID}, m.GuestExpiresIn)
+}
+
+// GenerateMFAChallenge issues a token saying the user got their password right
+// and still has to give their second factor. It carries the token version, so
+// a password change in between voids it.
+func (m *JWTManager) GenerateMFAChallenge(userID uuid.UUID, username string, tokenVersion int32) (string, error) {
+	return m.sign(Claims{
+		UserID:       userID,
+		Username:     username,
+		TokenVersion: tokenVersion,
+		MFAChallenge: true,
+	}, m.MFAExpiresIn)
+}
+
+func (m *JWTManager) sign(claims Claims, expiresIn time.Duration) (string, error) {
 	now := time.Now()
-	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    m.issuer,
-			Subject:   userID.String(),
-			Audience:  []string{m.audience},
-			ExpiresAt: jwt.NewNumericDate(now.Add(m.expiresIn)),
-			NotBefore: jwt.NewNumericDate(now),
-			IssuedAt:  jwt.NewNumericDate(now),
-			ID:        uuid.NewString(),
-		},
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    m.issuer,
+		Subject:   claims.UserID.String(),
+		Audience:  []string{m.audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        uuid.NewString(),
+	}
+	key, err := m.Keys.Active()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.Method, &claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	return token.SignedString(m.secret)
+	return token.SignedString(key.sign)
 }
 
+// ValidateJWT checks an access token. Two-factor challenge tokens are refused.
 func (m *JWTManager) ValidateJWT(tokenstring string) (*Claims, error) {
+	claims, err := m.parse(tokenstring)
+	if err != nil {
+		return nil, err
+	}
+	if claims.MFAChallenge {
+		return nil, ErrMFAChallenge
+	}
+	return claims, nil
+}
+
+// ValidateMFAChallenge checks a token from GenerateMFAChallenge. Access
+// tokens are refused.
+func (m *JWTManager) ValidateMFAChallenge(tokenstring string) (*Claims, error) {
+	claims, err := m.parse(tokenstring)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.MFAChallenge {
+		return nil, errors.New("not a two-factor challenge token")
+	}
+	return claims, nil
+}
+
+func (m *JWTManager) parse(tokenstring string) (*Claims, error) {
 	var claims Claims
 	token, err := jwt.ParseWithClaims(tokenstring, &claims, func(token *jwt.Token) (any, error) {
-		if token.Method != jwt.SigningMethodHS256 {
+		// Tokens without a kid are from the HS256 secret.
+		kid, _ := token.Header["kid"].(string)
+		key, ok := m.Keys.Verifier(kid)
+		// Each key checks only its own algorithm, so an RSA public key can
+		// never be passed off as an HMAC secret.
+		if !ok || token.Method.Alg() != key.Method.Alg() {
 			return nil, jwt.ErrTokenUnverifiable
 		}
 
-		return m.secret, nil
+		return key.verify, nil
 	})
 	if err != nil || !token.Valid {
 		return nil, errors.New("invalid token")
@@ -86,6 +199,9 @@ type ctxKey int
 const (
 	ctxUserIDKey ctxKey = iota
 	ctxUsernameKey
+	ctxGuestSessionKey
+	ctxDeviceSessionKey
+	ctxTokenExpiryKey
 )
 
 func UserIDFromCtx(ctx context.Context) (uuid.UUID, bool) {
@@ -101,7 +217,55 @@ func UsernameFromCtx(ctx context.Context) (string, bool) {
 	return s, ok
 }
 
+// GuestSessionFromCtx returns the session a guest token is limited to. It
+// reports false for full accounts.
+func GuestSessionFromCtx(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(ctxGuestSessionKey).(uuid.UUID)
+	return id, ok
+}
+
+// DeviceSessionFromCtx returns the device session the access token was issued
+// with. Guest tokens and tokens from GenerateJWT have none.
+func DeviceSessionFromCtx(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(ctxDeviceSessionKey).(uuid.UUID)
+	return id, ok
+}
+
+// TokenExpiryFromCtx returns when the access token the request came with
+// expires. Connections that outlive the request, such as event streams, use
+// it to end when the token does.
+func TokenExpiryFromCtx(ctx context.Context) (time.Time, bool) {
+	t, ok := ctx.Value(ctxTokenExpiryKey).(time.Time)
+	return t, ok
+}
+
+// JWTMiddleware authenticates the request and turns guest tokens away, so
+// every route is closed to guests unless it opts in with GuestJWTMiddleware.
+// Personal access tokens are turned away too; see ScopedJWTMiddleware.
 func (m *JWTManager) JWTMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return m.authenticate(false, "", next)
+}
+
+// GuestJWTMiddleware is JWTMiddleware for routes guests may use as well.
+// Those routes must keep guests to their session, which the session
+// authorizer does.
+func (m *JWTManager) GuestJWTMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return m.authenticate(true, "", next)
+}
+
+// ScopedJWTMiddleware is JWTMiddleware for routes personal access tokens with
+// the scope may use as well.
+func (m *JWTManager) ScopedJWTMiddleware(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return m.authenticate(false, scope, next)
+}
+
+// ScopedGuestJWTMiddleware is GuestJWTMiddleware for routes personal access
+// tokens with the scope may use as well.
+func (m *JWTManager) ScopedGuestJWTMiddleware(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return m.authenticate(true, scope, next)
+}
+
+func (m *JWTManager) authenticate(allowGuests bool, scope string, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		auth := r.Header.Get("Authorization")
 		if !strings.HasPrefix(strings.ToLower(auth), "bearer ") {
@@ -109,13 +273,83 @@ func (m *JWTManager) JWTMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 		token := strings.TrimSpace(auth[len("Bearer "):])
+		if strings.HasPrefix(token, PATPrefix) {
+			m.authenticatePAT(w, r, token, scope, next)
+			return
+		}
+		claims, err := m.ValidateJWT(token)
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		if claims.GuestSession != nil && !allowGuests {
+			http.Error(w, ErrGuestToken.Error(), http.StatusForbidden)
+			return
+		}
+		if !m.checkTokenVersion(w, r, claims) {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(contextWithClaims(r.Context(), claims)))
+	})
+}
+
+// WebSocketMiddleware authenticates like GuestJWTMiddleware but also accepts
+// the token in the access_token query parameter, since browsers cannot set
+// headers on WebSocket handshakes.
+func (m *JWTManager) WebSocketMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			m.GuestJWTMiddleware(next).ServeHTTP(w, r)
+			return
+		}
+		token := r.URL.Query().Get("access_token")
+		if token == "" {
+			http.Error(w, "missing access token", http.StatusUnauthorized)
+			return
+		}
 		claims, err := m.ValidateJWT(token)
 		if err != nil {
 			http.Error(w, "invalid token", http.StatusUnauthorized)
 			return
 		}
-		ctx := context.WithValue(r.Context(), ctxUserIDKey, claims.UserID)
-		ctx = context.WithValue(ctx, ctxUsernameKey, claims.Username)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		if !m.checkTokenVersion(w, r, claims) {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(contextWithClaims(r.Context(), claims)))
 	})
 }
+
+// checkTokenVersion turns away tokens issued under an older token version
+// than the user's, and tokens of users who no longer exist. Guest tokens die
+// with their session instead, so they are not checked.
+func (m *JWTManager) checkTokenVersion(w http.ResponseWriter, r *http.Request, claims *Claims) bool {
+	if m.Versions == nil || claims.GuestSession != nil {
+		return true
+	}
+	version, err := m.Versions.TokenVersion(r.Context(), claims.UserID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && version != claims.TokenVersion) {
+		http.Error(w, "token has been revoked", http.StatusUnauthorized)
+		return false
+	}
+	if err != nil {
+		log.Printf("check token version: %v", err)
+		http.Error(w, "could not check token", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func contextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	ctx = context.WithValue(ctx, ctxUserIDKey, claims.UserID)
+	ctx = context.WithValue(ctx, ctxUsernameKey, claims.Username)
+	if claims.GuestSession != nil {
+		ctx = context.WithValue(ctx, ctxGuestSessionKey, *claims.GuestSession)
+	}
+	if claims.DeviceSession != nil {
+		ctx = context.WithValue(ctx, ctxDeviceSessionKey, *claims.DeviceSession)
+	}
+	if claims.ExpiresAt != nil {
+		ctx = context.WithValue(ctx, ctxTokenExpiryKey, claims.ExpiresAt.Time)
+	}
+	return ctx
+}
@@ -112,7 +112,7 @@ func TestValidateJWT_fail(t *testing.T) {
 			},
 		}
 		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		signed, err := token.SignedString(m.secret)
+		signed, err := token.SignedString([]byte("supersecret"))
 		if err != nil {
 			t.Fatalf("sign: %v", err)
 		}
@@ -219,3 +219,187 @@ func TestJwtMiddleware(t *testing.T) {
 		}
 	})
 }
+
+func TestWebSocketMiddleware(t *testing.T) {
+	m := newMgr()
+	uid := uuid.New()
+	token, err := m.GenerateJWT(uid, "username")
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+
+	var gotID uuid.UUID
+	handler := m.WebSocketMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		gotID, _ = UserIDFromCtx(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	t.Run("token in query parameter", func(t *testing.T) {
+		gotID = uuid.Nil
+		req := httptest.NewRequest(http.MethodGet, "/?access_token="+token, nil)
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || gotID != uid {
+			t.Fatalf("status = %d id = %v, want 200 and %v", w.Code, gotID, uid)
+		}
+	})
+
+	t.Run("token in authorization header", func(t *testing.T) {
+		gotID = uuid.Nil
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || gotID != uid {
+			t.Fatalf("status = %d id = %v, want 200 and %v", w.Code, gotID, uid)
+		}
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("want 401, got %v", w.Code)
+		}
+	})
+
+	t.Run("invalid query token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?access_token=invalid", nil)
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("want 401, got %v", w.Code)
+		}
+	})
+}
+
+func TestGuestTokens(t *testing.T) {
+	m := newMgr()
+	uid := uuid.New()
+	sessionID := uuid.New()
+	token, err := m.GenerateGuestJWT(uid, "Sam#K7PX3M", sessionID)
+	if err != nil {
+		t.Fatalf("GenerateGuestJWT: %v", err)
+	}
+
+	claims, err := m.ValidateJWT(token)
+	if err != nil {
+		t.Fatalf("validate guest JWT: %v", err)
+	}
+	if claims.GuestSession == nil || *claims.GuestSession != sessionID {
+		t.Fatalf("guest session = %v, want %v", claims.GuestSession, sessionID)
+	}
+	if claims.ExpiresAt.Sub(claims.IssuedAt.Time) != DefaultGuestTokenTTL {
+		t.Fatalf("guest token lifetime = %v, want %v", claims.ExpiresAt.Sub(claims.IssuedAt.Time), DefaultGuestTokenTTL)
+	}
+
+	var gotSession uuid.UUID
+	var isGuest bool
+	next := func(w http.ResponseWriter, r *http.Request) {
+		gotSession, isGuest = GuestSessionFromCtx(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}
+
+	t.Run("rejected by default", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+
+		m.JWTMiddleware(next).ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("want 403, got %v", w.Code)
+		}
+	})
+
+	t.Run("accepted where guests are allowed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+
+		m.GuestJWTMiddleware(next).ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || !isGuest || gotSession != sessionID {
+			t.Fatalf("status = %d guest = %v session = %v, want 200 and %v", w.Code, isGuest, gotSession, sessionID)
+		}
+	})
+
+	t.Run("accepted on websockets", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?access_token="+token, nil)
+		w := httptest.NewRecorder()
+
+		m.WebSocketMiddleware(next).ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || gotSession != sessionID {
+			t.Fatalf("status = %d session = %v, want 200 and %v", w.Code, gotSession, sessionID)
+		}
+	})
+
+	t.Run("full accounts are not guests", func(t *testing.T) {
+		full, err := m.GenerateJWT(uid, "username")
+		if err != nil {
+			t.Fatalf("GenerateJWT: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+full)
+		w := httptest.NewRecorder()
+
+		m.GuestJWTMiddleware(next).ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || isGuest {
+			t.Fatalf("status = %d guest = %v, want 200 and not a guest", w.Code, isGuest)
+		}
+	})
+}
+
+func TestMFAChallengeTokens(t *testing.T) {
+	m := newMgr()
+	uid := uuid.New()
+	challenge, err := m.GenerateMFAChallenge(uid, "username", 3)
+	if err != nil {
+		t.Fatalf("GenerateMFAChallenge: %v", err)
+	}
+
+	claims, err := m.ValidateMFAChallenge(challenge)
+	if err != nil {
+		t.Fatalf("validate challenge: %v", err)
+	}
+	if claims.UserID != uid || !claims.MFAChallenge || claims.TokenVersion != 3 {
+		t.Fatalf("unexpected challenge claims: %+v", claims)
+	}
+	if claims.ExpiresAt.Sub(claims.IssuedAt.Time) != DefaultMFAChallengeTTL {
+		t.Fatalf("challenge lifetime = %v, want %v", claims.ExpiresAt.Sub(claims.IssuedAt.Time), DefaultMFAChallengeTTL)
+	}
+
+	if _, err := m.ValidateJWT(challenge); err != ErrMFAChallenge {
+		t.Fatalf("challenge as access token: want ErrMFAChallenge, got %v", err)
+	}
+	access, _ := m.GenerateJWT(uid, "username")
+	if _, err := m.ValidateMFAChallenge(access); err == nil {
+		t.Fatalf("access token accepted as a challenge")
+	}
+
+	next := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	for name, mw := range map[string]func(http.HandlerFunc) http.HandlerFunc{
+		"jwt":       m.JWTMiddleware,
+		"guest":     m.GuestJWTMiddleware,
+		"websocket": m.WebSocketMiddleware,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+challenge)
+		w := httptest.NewRecorder()
+		mw(next).ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("%s middleware: want 401 for a challenge token, got %d", name, w.Code)
+		}
+	}
+}
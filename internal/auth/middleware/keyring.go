@@ -0,0 +1,251 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Kam1217/optio/internal/auth/jwks"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MinRSAKeyBits is the smallest RSA key accepted for signing tokens.
+const MinRSAKeyBits = 2048
+
+var (
+	ErrNoActiveKey   = errors.New("no active signing key")
+	ErrUnknownKey    = errors.New("unknown signing key")
+	ErrKeyCannotSign = errors.New("key has no private part to sign with")
+)
+
+// SigningKey is one key tokens are signed or checked with. The key ID goes in
+// the kid header of the tokens it signs; the HS256 secret from JWT_SECRET has
+// an empty ID, as tokens signed before key IDs existed carry none.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// sign is nil for keys that only check tokens.
+	sign   any
+	verify any
+}
+
+// NewHMACKey makes an HS256 key from a shared secret.
+func NewHMACKey(id string, secret []byte) *SigningKey {
+	return &SigningKey{ID: id, Method: jwt.SigningMethodHS256, sign: secret, verify: secret}
+}
+
+// NewAsymmetricKey makes a key from an Ed25519 or RSA private key, or from a
+// public key alone to only check tokens with it. Ed25519 keys sign with
+// EdDSA and RSA keys with RS256.
+func NewAsymmetricKey(id string, key any) (*SigningKey, error) {
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, sign: key, verify: key.Public()}, nil
+	case ed25519.PublicKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, verify: key}, nil
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < MinRSAKeyBits {
+			return nil, fmt.Errorf("key %q: RSA keys need at least %d bits", id, MinRSAKeyBits)
+		}
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, sign: key, verify: &key.PublicKey}, nil
+	case *rsa.PublicKey:
+		if key.N.BitLen() < MinRSAKeyBits {
+			return nil, fmt.Errorf("key %q: RSA keys need at least %d bits", id, MinRSAKeyBits)
+		}
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, verify: key}, nil
+	default:
+		return nil, fmt.Errorf("key %q: unsupported key type %T", id, key)
+	}
+}
+
+// ParseKeyPEM reads a PEM private key (PKCS #8, or PKCS #1 for RSA) or
+// public key (PKIX, or PKCS #1 for RSA).
+func ParseKeyPEM(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %q: no PEM block", id)
+	}
+
+	var (
+		key any
+		err error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %q: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", id, err)
+	}
+	return NewAsymmetricKey(id, key)
+}
+
+// CanSign reports whether the key has a private part.
+func (k *SigningKey) CanSign() bool {
+	return k.sign != nil
+}
+
+// PublicJWK is the key as others need it to check tokens. Shared secrets are
+// never published, so HMAC keys have none.
+func (k *SigningKey) PublicJWK() (jwks.Key, bool) {
+	if k.Method == jwt.SigningMethodHS256 {
+		return jwks.Key{}, false
+	}
+	key, err := jwks.FromPublicKey(k.ID, k.Method.Alg(), k.verify.(crypto.PublicKey))
+	return key, err == nil
+}
+
+// Keyring holds the keys tokens are signed and checked with. Tokens are signed
+// with the active key and accepted if signed by any key not retired, so a new
+// key can take over while tokens from the old one run out.
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    []*SigningKey
+	active  *SigningKey
+	retired map[string]bool
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{retired: map[string]bool{}}
+}
+
+// Add puts a key on the ring. Key IDs must be unique.
+func (k *Keyring) Add(key *SigningKey) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, existing := range k.keys {
+		if existing.ID == key.ID {
+			return fmt.Errorf("duplicate key ID %q", key.ID)
+		}
+	}
+	k.keys = append(k.keys, key)
+	return nil
+}
+
+// LoadDir adds every *.pem file in dir, named by the file name without the
+// extension: keys/2025-06.pem becomes key 2025-06.
+func (k *Keyring) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no .pem keys in %s", dir)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read key: %w", err)
+		}
+		key, err := ParseKeyPEM(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+		if err != nil {
+			return err
+		}
+		if err := k.Add(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetActive makes new tokens be signed with the key.
+func (k *Keyring) SetActive(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key := k.find(id)
+	switch {
+	case key == nil:
+		return fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	case !key.CanSign():
+		return fmt.Errorf("%w: %q", ErrKeyCannotSign, id)
+	case k.retired[id]:
+		return fmt.Errorf("key %q is retired", id)
+	}
+	k.active = key
+	return nil
+}
+
+// Retire stops tokens signed with the key being accepted. The active key
+// cannot be retired.
+func (k *Keyring) Retire(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.find(id) == nil {
+		return fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	if k.active != nil && k.active.ID == id {
+		return fmt.Errorf("key %q is active", id)
+	}
+	k.retired[id] = true
+	return nil
+}
+
+// Active is the key new tokens are signed with.
+func (k *Keyring) Active() (*SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.active == nil {
+		return nil, ErrNoActiveKey
+	}
+	return k.active, nil
+}
+
+// Verifier is the key a token with the key ID is checked with. Retired keys
+// are not handed out.
+func (k *Keyring) Verifier(id string) (*SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key := k.find(id)
+	if key == nil || k.retired[id] {
+		return nil, false
+	}
+	return key, true
+}
+
+// JWKS lists the public keys tokens may be signed with, for other services to
+// check Optio's tokens without sharing a secret.
+func (k *Keyring) JWKS() jwks.Set {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := jwks.Set{Keys: []jwks.Key{}}
+	for _, key := range k.keys {
+		if k.retired[key.ID] {
+			continue
+		}
+		if jwk, ok := key.PublicJWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func (k *Keyring) find(id string) *SigningKey {
+	for _, key := range k.keys {
+		if key.ID == id {
+			return key
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newEd25519Key(t *testing.T, id string) *SigningKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	key, err := NewAsymmetricKey(id, priv)
+	if err != nil {
+		t.Fatalf("NewAsymmetricKey: %v", err)
+	}
+	return key
+}
+
+func newKeyedMgr(t *testing.T, keys ...*SigningKey) *JWTManager {
+	t.Helper()
+	ring := NewKeyring()
+	for _, k := range keys {
+		if err := ring.Add(k); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if err := ring.SetActive(keys[0].ID); err != nil {
+		t.Fatalf("SetActive: %v", err)
+	}
+	return NewJWTManagerWithKeys(ring, "tester", "client", 15*time.Minute)
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rs256, err := NewAsymmetricKey("rsa-1", rsaKey)
+	if err != nil {
+		t.Fatalf("NewAsymmetricKey: %v", err)
+	}
+
+	for _, key := range []*SigningKey{newEd25519Key(t, "ed-1"), rs256} {
+		t.Run(key.Method.Alg(), func(t *testing.T) {
+			m := newKeyedMgr(t, key)
+			uid := uuid.New()
+			signed, err := m.GenerateJWT(uid, "username")
+			if err != nil {
+				t.Fatalf("GenerateJWT: %v", err)
+			}
+
+			token, _, err := jwt.NewParser().ParseUnverified(signed, &Claims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified: %v", err)
+			}
+			if token.Header["kid"] != key.ID || token.Header["alg"] != key.Method.Alg() {
+				t.Fatalf("header = %v, want kid %q alg %q", token.Header, key.ID, key.Method.Alg())
+			}
+
+			claims, err := m.ValidateJWT(signed)
+			if err != nil || claims.UserID != uid {
+				t.Fatalf("ValidateJWT = %+v, %v", claims, err)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, newKey := newEd25519Key(t, "2025-01"), newEd25519Key(t, "2025-06")
+	m := newKeyedMgr(t, oldKey, newKey)
+	uid := uuid.New()
+
+	before, _ := m.GenerateJWT(uid, "username")
+	if err := m.Keys.SetActive("2025-06"); err != nil {
+		t.Fatalf("SetActive: %v", err)
+	}
+	after, _ := m.GenerateJWT(uid, "username")
+
+	if _, err := m.ValidateJWT(before); err != nil {
+		t.Fatalf("token from the previous key: %v", err)
+	}
+	if _, err := m.ValidateJWT(after); err != nil {
+		t.Fatalf("token from the active key: %v", err)
+	}
+
+	if err := m.Keys.Retire("2025-06"); err == nil {
+		t.Fatalf("retired the active key")
+	}
+	if err := m.Keys.Retire("2025-01"); err != nil {
+		t.Fatalf("Retire: %v", err)
+	}
+	if _, err := m.ValidateJWT(before); err == nil {
+		t.Fatalf("token from a retired key was accepted")
+	}
+	if _, err := m.ValidateJWT(after); err != nil {
+		t.Fatalf("token from the active key after retiring the old one: %v", err)
+	}
+	if err := m.Keys.SetActive("2025-01"); err == nil {
+		t.Fatalf("activated a retired key")
+	}
+
+	set := m.Keys.JWKS()
+	if len(set.Keys) != 1 || set.Keys[0].Kid != "2025-06" {
+		t.Fatalf("JWKS = %+v, want only the active key", set)
+	}
+}
+
+func TestLegacyHMACTokens(t *testing.T) {
+	legacy := newMgr()
+	uid := uuid.New()
+	old, _ := legacy.GenerateJWT(uid, "username")
+
+	// Moving to asymmetric keys with the secret still on the ring keeps
+	// tokens signed with it working.
+	m := newKeyedMgr(t, newEd25519Key(t, "ed-1"), NewHMACKey("", []byte("supersecret")))
+	if _, err := m.ValidateJWT(old); err != nil {
+		t.Fatalf("HS256 token without a kid: %v", err)
+	}
+	if set := m.Keys.JWKS(); len(set.Keys) != 1 || set.Keys[0].Kty != "OKP" {
+		t.Fatalf("the shared secret must not be published: %+v", set)
+	}
+
+	if _, err := newKeyedMgr(t, newEd25519Key(t, "ed-1")).ValidateJWT(old); err == nil {
+		t.Fatalf("HS256 token accepted without the secret on the ring")
+	}
+}
+
+func TestAlgorithmConfusion(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key, _ := NewAsymmetricKey("rsa-1", rsaKey)
+	m := newKeyedMgr(t, key)
+
+	// An attacker who knows the public key signs an HS256 token with it and
+	// names the RSA key.
+	uid := uuid.New()
+	pub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: mustPKIX(t, &rsaKey.PublicKey)})
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		UserID: uid,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	forged.Header["kid"] = "rsa-1"
+	signed, _ := forged.SignedString(pub)
+
+	if _, err := m.ValidateJWT(signed); err == nil {
+		t.Fatalf("HS256 token accepted for an RSA key")
+	}
+}
+
+func TestKeyringRules(t *testing.T) {
+	ring := NewKeyring()
+	if _, err := ring.Active(); !errors.Is(err, ErrNoActiveKey) {
+		t.Fatalf("empty ring: want ErrNoActiveKey, got %v", err)
+	}
+
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	verifyOnly, _ := NewAsymmetricKey("public", priv.Public())
+	if err := ring.Add(verifyOnly); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := ring.Add(verifyOnly); err == nil {
+		t.Fatalf("added a duplicate key ID")
+	}
+	if err := ring.SetActive("public"); !errors.Is(err, ErrKeyCannotSign) {
+		t.Fatalf("activate a public key: want ErrKeyCannotSign, got %v", err)
+	}
+	if err := ring.SetActive("missing"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("activate a missing key: want ErrUnknownKey, got %v", err)
+	}
+
+	small, _ := rsa.GenerateKey(rand.Reader, 1024)
+	if _, err := NewAsymmetricKey("small", small); err == nil {
+		t.Fatalf("accepted a 1024-bit RSA key")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(edPriv)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	files := map[string]*pem.Block{
+		"ed.pem":         {Type: "PRIVATE KEY", Bytes: pkcs8},
+		"rsa.pem":        {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+		"rsa-public.pem": {Type: "PUBLIC KEY", Bytes: mustPKIX(t, &rsaKey.PublicKey)},
+	}
+	for name, block := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "README"), []byte("not a key"), 0o600)
+
+	ring := NewKeyring()
+	if err := ring.LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir: %v", err)
+	}
+	for id, alg := range map[string]string{"ed": "EdDSA", "rsa": "RS256", "rsa-public": "RS256"} {
+		key, ok := ring.Verifier(id)
+		if !ok || key.Method.Alg() != alg {
+			t.Fatalf("key %q = %+v, %v; want %s", id, key, ok, alg)
+		}
+	}
+	if err := ring.SetActive("ed"); err != nil {
+		t.Fatalf("SetActive: %v", err)
+	}
+	if len(ring.JWKS().Keys) != 3 {
+		t.Fatalf("JWKS = %+v, want 3 keys", ring.JWKS())
+	}
+
+	if err := NewKeyring().LoadDir(t.TempDir()); err == nil {
+		t.Fatalf("want an error for a directory without keys")
+	}
+}
+
+func mustPKIX(t *testing.T, pub any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	return der
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type fakePATs struct {
+	tokens map[string][]string
+	userID uuid.UUID
+	err    error
+}
+
+func (f *fakePATs) AuthenticatePAT(_ context.Context, token string) (uuid.UUID, string, []string, error) {
+	if f.err != nil {
+		return uuid.Nil, "", nil, f.err
+	}
+	scopes, ok := f.tokens[token]
+	if !ok {
+		return uuid.Nil, "", nil, sql.ErrNoRows
+	}
+	return f.userID, "bot", scopes, nil
+}
+
+func TestPersonalAccessTokens(t *testing.T) {
+	uid := uuid.New()
+	pats := &fakePATs{
+		tokens: map[string][]string{PATPrefix + "reader": {"sessions:read"}},
+		userID: uid,
+	}
+	m := newMgr()
+	m.PATs = pats
+
+	var gotUser uuid.UUID
+	next := func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _ = UserIDFromCtx(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}
+	call := func(handler http.HandlerFunc, token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		token   string
+		want    int
+	}{
+		{"scope granted", m.ScopedJWTMiddleware("sessions:read", next), PATPrefix + "reader", http.StatusOK},
+		{"guest route scope granted", m.ScopedGuestJWTMiddleware("sessions:read", next), PATPrefix + "reader", http.StatusOK},
+		{"scope missing", m.ScopedJWTMiddleware("sessions:write", next), PATPrefix + "reader", http.StatusForbidden},
+		{"route without a scope", m.JWTMiddleware(next), PATPrefix + "reader", http.StatusForbidden},
+		{"guest route without a scope", m.GuestJWTMiddleware(next), PATPrefix + "reader", http.StatusForbidden},
+		{"unknown token", m.ScopedJWTMiddleware("sessions:read", next), PATPrefix + "nope", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser = uuid.Nil
+			if code := call(tt.handler, tt.token); code != tt.want {
+				t.Fatalf("want %d, got %d", tt.want, code)
+			}
+			if tt.want == http.StatusOK && gotUser != uid {
+				t.Fatalf("user in context = %s, want %s", gotUser, uid)
+			}
+		})
+	}
+
+	t.Run("JWTs still work on scoped routes", func(t *testing.T) {
+		token, _ := m.GenerateJWT(uid, "username")
+		if code := call(m.ScopedJWTMiddleware("sessions:write", next), token); code != http.StatusOK {
+			t.Fatalf("want 200, got %d", code)
+		}
+	})
+
+	t.Run("lookup fails", func(t *testing.T) {
+		pats.err = errors.New("database down")
+		defer func() { pats.err = nil }()
+		if code := call(m.ScopedJWTMiddleware("sessions:read", next), PATPrefix+"reader"); code != http.StatusInternalServerError {
+			t.Fatalf("want 500, got %d", code)
+		}
+	})
+
+	t.Run("no token source", func(t *testing.T) {
+		if code := call(newMgr().ScopedJWTMiddleware("sessions:read", next), PATPrefix+"reader"); code != http.StatusUnauthorized {
+			t.Fatalf("want 401, got %d", code)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultTokenVersionTTL bounds how long another replica may keep
+	// accepting access tokens after a password change.
+	DefaultTokenVersionTTL = 30 * time.Second
+	maxCachedTokenVersions = 10000
+)
+
+// TokenVersionSource looks up the token version a user's access tokens must
+// carry.
+type TokenVersionSource interface {
+	TokenVersion(ctx context.Context, userID uuid.UUID) (int32, error)
+}
+
+type cachedTokenVersion struct {
+	version   int32
+	fetchedAt time.Time
+}
+
+// TokenVersionCache remembers token versions for a short while, so checking
+// them does not cost a database query on every request.
+type TokenVersionCache struct {
+	source TokenVersionSource
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	versions map[uuid.UUID]cachedTokenVersion
+}
+
+func NewTokenVersionCache(source TokenVersionSource, ttl time.Duration) *TokenVersionCache {
+	return &TokenVersionCache{
+		source:   source,
+		ttl:      ttl,
+		now:      time.Now,
+		versions: make(map[uuid.UUID]cachedTokenVersion),
+	}
+}
+
+func (c *TokenVersionCache) TokenVersion(ctx context.Context, userID uuid.UUID) (int32, error) {
+	c.mu.Lock()
+	cached, ok := c.versions[userID]
+	c.mu.Unlock()
+	if ok && c.now().Sub(cached.fetchedAt) < c.ttl {
+		return cached.version, nil
+	}
+
+	version, err := c.source.TokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.versions) >= maxCachedTokenVersions {
+		c.evictExpired()
+	}
+	c.versions[userID] = cachedTokenVersion{version: version, fetchedAt: c.now()}
+	return version, nil
+}
+
+// Invalidate drops the user's cached version, for use right after this
+// replica changes it. A nil cache does nothing.
+func (c *TokenVersionCache) Invalidate(userID uuid.UUID) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.versions, userID)
+}
+
+// evictExpired makes room in a full cache. If every entry is still fresh it
+// starts over rather than growing without bound.
+func (c *TokenVersionCache) evictExpired() {
+	now := c.now()
+	for id, cached := range c.versions {
+		if now.Sub(cached.fetchedAt) >= c.ttl {
+			delete(c.versions, id)
+		}
+	}
+	if len(c.versions) >= maxCachedTokenVersions {
+		clear(c.versions)
+	}
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type fakeVersions struct {
+	versions map[uuid.UUID]int32
+	err      error
+	calls    int
+}
+
+func (f *fakeVersions) TokenVersion(_ context.Context, userID uuid.UUID) (int32, error) {
+	f.calls++
+	if f.err != nil {
+		return 0, f.err
+	}
+	version, ok := f.versions[userID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return version, nil
+}
+
+func TestTokenVersionCache(t *testing.T) {
+	uid := uuid.New()
+	source := &fakeVersions{versions: map[uuid.UUID]int32{uid: 1}}
+	cache := NewTokenVersionCache(source, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	for range 3 {
+		if v, err := cache.TokenVersion(context.Background(), uid); err != nil || v != 1 {
+			t.Fatalf("TokenVersion = %d, %v; want 1", v, err)
+		}
+	}
+	if source.calls != 1 {
+		t.Fatalf("want one lookup while cached, got %d", source.calls)
+	}
+
+	source.versions[uid] = 2
+	cache.Invalidate(uid)
+	if v, _ := cache.TokenVersion(context.Background(), uid); v != 2 {
+		t.Fatalf("after Invalidate: got version %d, want 2", v)
+	}
+
+	source.versions[uid] = 3
+	now = now.Add(time.Minute)
+	if v, _ := cache.TokenVersion(context.Background(), uid); v != 3 {
+		t.Fatalf("after TTL: got version %d, want 3", v)
+	}
+	if source.calls != 3 {
+		t.Fatalf("want three lookups, got %d", source.calls)
+	}
+
+	source.err = errors.New("db down")
+	cache.Invalidate(uid)
+	if _, err := cache.TokenVersion(context.Background(), uid); err == nil {
+		t.Fatalf("want source error to be returned")
+	}
+
+	var nilCache *TokenVersionCache
+	nilCache.Invalidate(uid)
+}
+
+func TestJWTMiddleware_TokenVersion(t *testing.T) {
+	uid := uuid.New()
+	source := &fakeVersions{versions: map[uuid.UUID]int32{uid: 2}}
+	m := newMgr()
+	m.Versions = NewTokenVersionCache(source, time.Minute)
+
+	handler := m.JWTMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	call := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	current, _ := m.GenerateDeviceJWT(uid, "username", 2, uuid.New())
+	if code := call(current); code != http.StatusOK {
+		t.Fatalf("current version: want 200, got %d", code)
+	}
+	stale, _ := m.GenerateDeviceJWT(uid, "username", 1, uuid.New())
+	if code := call(stale); code != http.StatusUnauthorized {
+		t.Fatalf("stale version: want 401, got %d", code)
+	}
+	deleted, _ := m.GenerateDeviceJWT(uuid.New(), "gone", 0, uuid.New())
+	if code := call(deleted); code != http.StatusUnauthorized {
+		t.Fatalf("unknown user: want 401, got %d", code)
+	}
+
+	source.err = errors.New("db down")
+	m.Versions.Invalidate(uid)
+	if code := call(current); code != http.StatusInternalServerError {
+		t.Fatalf("lookup failure: want 500, got %d", code)
+	}
+}
@@ -0,0 +1,335 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/oidc"
+	"github.com/Kam1217/optio/internal/auth/secret"
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// DefaultOIDCStateTTL is how long a user has to finish signing in at the
+// provider.
+const DefaultOIDCStateTTL = 10 * time.Minute
+
+var (
+	ErrInvalidOIDCState      = errors.New("invalid or expired login state")
+	ErrIdentityTaken         = errors.New("this provider account is linked to another user")
+	ErrProviderAlreadyLinked = errors.New("an account from this provider is already linked")
+	ErrEmailInUse            = errors.New("an account with this email already exists")
+	ErrIdentityNoEmail       = errors.New("the provider did not share an email")
+	ErrIdentityNotFound      = errors.New("identity not found")
+	ErrLastSignInMethod      = errors.New("cannot remove the only way to sign in")
+)
+
+// IdentityService links accounts at OpenID providers to users, so people can
+// sign up and log in with them instead of a password.
+type IdentityService struct {
+	db       *sql.DB
+	queries  *database.Queries
+	StateTTL time.Duration
+}
+
+func NewIdentityService(db *sql.DB, queries *database.Queries) *IdentityService {
+	return &IdentityService{db: db, queries: queries, StateTTL: DefaultOIDCStateTTL}
+}
+
+// OIDCLogin is a login in flight at a provider. The state goes in a cookie
+// and through the provider; the nonce and verifier stay here until the user
+// comes back.
+type OIDCLogin struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	// LinkUserID is set when a signed-in user is adding the identity to their
+	// account rather than signing in with it.
+	LinkUserID uuid.NullUUID
+}
+
+// StartLogin records a new login with the provider.
+func (s *IdentityService) StartLogin(ctx context.Context, provider string, linkUserID uuid.NullUUID) (*OIDCLogin, error) {
+	login := &OIDCLogin{LinkUserID: linkUserID}
+	for _, v := range []*string{&login.State, &login.Nonce, &login.CodeVerifier} {
+		var err error
+		if *v, err = oidc.RandomString(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Logins people gave up on are cleared out as new ones start.
+	if err := s.queries.DeleteExpiredOIDCLoginStates(ctx); err != nil {
+		return nil, fmt.Errorf("delete expired oidc login states: %w", err)
+	}
+	if err := s.queries.CreateOIDCLoginState(ctx, database.CreateOIDCLoginStateParams{
+		StateHash:    secret.Hash(login.State),
+		Provider:     provider,
+		Nonce:        login.Nonce,
+		CodeVerifier: login.CodeVerifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(s.StateTTL),
+	}); err != nil {
+		return nil, fmt.Errorf("create oidc login state: %w", err)
+	}
+	return login, nil
+}
+
+// FinishLogin looks up the login the state belongs to. Each state works once.
+func (s *IdentityService) FinishLogin(ctx context.Context, provider, state string) (*OIDCLogin, error) {
+	row, err := s.queries.ConsumeOIDCLoginState(ctx, database.ConsumeOIDCLoginStateParams{
+		StateHash: secret.Hash(state),
+		Provider:  provider,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, fmt.Errorf("consume oidc login state: %w", err)
+	}
+	return &OIDCLogin{
+		State:        state,
+		Nonce:        row.Nonce,
+		CodeVerifier: row.CodeVerifier,
+		LinkUserID:   row.LinkUserID,
+	}, nil
+}
+
+// ExternalIdentity is who the provider says signed in.
+type ExternalIdentity struct {
+	Provider          string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// SignIn returns the user the identity belongs to, creating one if it is new.
+// It never signs someone into an existing account just because the provider
+// reports the same email: the account owner has to log in and link the
+// identity themselves.
+func (s *IdentityService) SignIn(ctx context.Context, ident ExternalIdentity) (userID uuid.UUID, created bool, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	existing, err := qtx.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Provider: ident.Provider,
+		Subject:  ident.Subject,
+	})
+	switch {
+	case err == nil:
+		if err := qtx.TouchUserIdentity(ctx, database.TouchUserIdentityParams{
+			ID:    existing.ID,
+			Email: optionalString(ident.Email),
+		}); err != nil {
+			return uuid.Nil, false, fmt.Errorf("touch user identity: %w", err)
+		}
+		userID = existing.UserID
+	case errors.Is(err, sql.ErrNoRows):
+		userID, err = s.createUser(ctx, qtx, ident)
+		if err != nil {
+			return uuid.Nil, false, err
+		}
+		created = true
+	default:
+		return uuid.Nil, false, fmt.Errorf("get user identity: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, false, fmt.Errorf("commit oidc sign in: %w", err)
+	}
+	return userID, created, nil
+}
+
+func (s *IdentityService) createUser(ctx context.Context, qtx *database.Queries, ident ExternalIdentity) (uuid.UUID, error) {
+	if ident.Email == "" {
+		return uuid.Nil, ErrIdentityNoEmail
+	}
+	if _, err := qtx.GetUserByEmail(ctx, nullString(ident.Email)); err == nil {
+		return uuid.Nil, ErrEmailInUse
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, fmt.Errorf("get user by email: %w", err)
+	}
+
+	username, err := s.freeUsername(ctx, qtx, ident)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	var verifiedAt sql.NullTime
+	if ident.EmailVerified {
+		verifiedAt = nullTime(time.Now())
+	}
+	user, err := qtx.CreateOIDCUser(ctx, database.CreateOIDCUserParams{
+		Username:        username,
+		Email:           nullString(ident.Email),
+		EmailVerifiedAt: verifiedAt,
+	})
+	if err != nil {
+		// Deleted accounts keep their email.
+		if uniqueViolation(err) == "users_email_key" {
+			return uuid.Nil, ErrEmailInUse
+		}
+		return uuid.Nil, fmt.Errorf("create oidc user: %w", err)
+	}
+
+	if _, err := qtx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:   user.ID,
+		Provider: ident.Provider,
+		Subject:  ident.Subject,
+		Email:    optionalString(ident.Email),
+	}); err != nil {
+		if uniqueViolation(err) != "" {
+			return uuid.Nil, ErrIdentityTaken
+		}
+		return uuid.Nil, fmt.Errorf("create user identity: %w", err)
+	}
+	return user.ID, nil
+}
+
+var usernameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// freeUsername picks a username from what the provider shares, adding a
+// number if it is taken.
+func (s *IdentityService) freeUsername(ctx context.Context, qtx *database.Queries, ident ExternalIdentity) (string, error) {
+	base := ""
+	for _, candidate := range []string{ident.PreferredUsername, ident.Name, strings.Split(ident.Email, "@")[0]} {
+		base = strings.Trim(usernameInvalid.ReplaceAllString(candidate, "_"), "_")
+		if len(base) >= 3 {
+			break
+		}
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	for i := 0; i < 20; i++ {
+		username := base
+		if i > 0 {
+			username = fmt.Sprintf("%s%d", base, i+1)
+		}
+		if i >= 10 {
+			suffix, err := oidc.RandomString()
+			if err != nil {
+				return "", err
+			}
+			username = base + "_" + strings.ToLower(suffix[:6])
+		}
+		exists, err := qtx.UsernameExists(ctx, username)
+		if err != nil {
+			return "", fmt.Errorf("username exists: %w", err)
+		}
+		if !exists {
+			return username, nil
+		}
+	}
+	return "", fmt.Errorf("no free username for %q", base)
+}
+
+// Link adds the identity to a signed-in user's account.
+func (s *IdentityService) Link(ctx context.Context, userID uuid.UUID, ident ExternalIdentity) (*database.UserIdentity, error) {
+	existing, err := s.queries.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Provider: ident.Provider,
+		Subject:  ident.Subject,
+	})
+	if err == nil {
+		if existing.UserID != userID {
+			return nil, ErrIdentityTaken
+		}
+		return &existing, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("get user identity: %w", err)
+	}
+
+	identity, err := s.queries.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:   userID,
+		Provider: ident.Provider,
+		Subject:  ident.Subject,
+		Email:    optionalString(ident.Email),
+	})
+	if err != nil {
+		switch uniqueViolation(err) {
+		case "":
+			return nil, fmt.Errorf("create user identity: %w", err)
+		case "user_identity_user_id_provider_key":
+			return nil, ErrProviderAlreadyLinked
+		default:
+			return nil, ErrIdentityTaken
+		}
+	}
+	return &identity, nil
+}
+
+func (s *IdentityService) List(ctx context.Context, userID uuid.UUID) ([]database.UserIdentity, error) {
+	identities, err := s.queries.ListUserIdentities(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list user identities: %w", err)
+	}
+	return identities, nil
+}
+
+// Unlink removes an identity from the user's account, unless it is the only
+// way they have to sign in.
+func (s *IdentityService) Unlink(ctx context.Context, userID, identityID uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	hasPassword, err := qtx.GetUserSignInMethodsForUpdate(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("get user sign in methods: %w", err)
+	}
+	count, err := qtx.CountUserIdentities(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("count user identities: %w", err)
+	}
+
+	rows, err := qtx.DeleteUserIdentity(ctx, database.DeleteUserIdentityParams{
+		ID:     identityID,
+		UserID: userID,
+	})
+	if err != nil {
+		return fmt.Errorf("delete user identity: %w", err)
+	}
+	if rows == 0 {
+		return ErrIdentityNotFound
+	}
+	if !hasPassword && count <= 1 {
+		return ErrLastSignInMethod
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit unlink identity: %w", err)
+	}
+	return nil
+}
+
+func optionalString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// uniqueViolation names the unique constraint err broke, if it broke one.
+func uniqueViolation(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return pqErr.Constraint
+	}
+	return ""
+}
@@ -0,0 +1,411 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/secret"
+	"github.com/Kam1217/optio/internal/auth/totp"
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/google/uuid"
+)
+
+// RecoveryCodeCount is how many recovery codes a user gets at a time.
+const RecoveryCodeCount = 10
+
+const (
+	// DefaultMFAMaxFailures is how many wrong codes in a row lock two-factor.
+	DefaultMFAMaxFailures = 10
+	// DefaultMFALockout is how long two-factor stays locked.
+	DefaultMFALockout = 15 * time.Minute
+	// DefaultMFAChallengeAttempts is how many wrong codes one login
+	// challenge takes before it is spent.
+	DefaultMFAChallengeAttempts = 5
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFANotEnrolling   = errors.New("no two-factor enrolment to confirm")
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+	ErrMFALocked         = errors.New("too many wrong two-factor codes, try again later")
+	ErrMFAChallengeSpent = errors.New("two-factor challenge already used")
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFAService runs TOTP two-factor authentication: enrolling an authenticator
+// app, checking its codes at login, and the recovery codes that stand in for
+// it when it is lost.
+type MFAService struct {
+	db      *sql.DB
+	queries *database.Queries
+	// Issuer names the account in authenticator apps.
+	Issuer string
+	TOTP   totp.Config
+	Now    func() time.Time
+	// MaxFailures wrong codes in a row lock two-factor for Lockout, whether
+	// they come from logins or from signed-in users.
+	MaxFailures int
+	Lockout     time.Duration
+	// ChallengeAttempts is how many wrong codes a login challenge takes.
+	ChallengeAttempts int
+}
+
+func NewMFAService(db *sql.DB, queries *database.Queries, issuer string) *MFAService {
+	return &MFAService{
+		db:      db,
+		queries: queries,
+		Issuer:  issuer,
+		TOTP:    totp.Default,
+		Now:     time.Now,
+
+		MaxFailures:       DefaultMFAMaxFailures,
+		Lockout:           DefaultMFALockout,
+		ChallengeAttempts: DefaultMFAChallengeAttempts,
+	}
+}
+
+// TOTPEnrollment is what the user needs to add the account to their
+// authenticator app: the secret to type in, or the URI to scan.
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// BeginTOTPEnrollment makes a new secret for the user. Two-factor stays off
+// until ConfirmTOTPEnrollment gets a code made with it, so an enrolment that
+// is abandoned halfway locks nobody out.
+func (s *MFAService) BeginTOTPEnrollment(ctx context.Context, userID uuid.UUID) (*TOTPEnrollment, error) {
+	user, err := s.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get user by id: %w", err)
+	}
+	account := user.Username
+	if user.Email.Valid {
+		account = user.Email.String
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.queries.StartTOTPEnrollment(ctx, database.StartTOTPEnrollmentParams{
+		UserID: userID,
+		Secret: secret,
+	}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFAAlreadyEnabled
+		}
+		return nil, fmt.Errorf("start totp enrolment: %w", err)
+	}
+
+	return &TOTPEnrollment{Secret: secret, URI: s.TOTP.URI(s.Issuer, account, secret)}, nil
+}
+
+// ConfirmTOTPEnrollment turns two-factor on once the user shows a code from
+// their app, and returns their recovery codes. This is the only time the
+// codes are shown.
+func (s *MFAService) ConfirmTOTPEnrollment(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	enrolment, err := qtx.GetUserTOTPForUpdate(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFANotEnrolling
+		}
+		return nil, fmt.Errorf("get totp: %w", err)
+	}
+	if enrolment.ConfirmedAt.Valid {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	key, err := totp.DecodeSecret(enrolment.Secret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := s.TOTP.Validate(key, code, s.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	if err := qtx.ConfirmTOTPEnrollment(ctx, database.ConfirmTOTPEnrollmentParams{
+		UserID:       userID,
+		LastUsedStep: sql.NullInt64{Int64: step, Valid: true},
+	}); err != nil {
+		return nil, fmt.Errorf("confirm totp enrolment: %w", err)
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, qtx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit totp enrolment: %w", err)
+	}
+	return codes, nil
+}
+
+// Enabled reports whether the user has to give a second factor to log in.
+func (s *MFAService) Enabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	enrolment, err := s.queries.GetUserTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("get totp: %w", err)
+	}
+	return enrolment.ConfirmedAt.Valid, nil
+}
+
+// MFAChallenge is the challenge token a login is being finished with.
+type MFAChallenge struct {
+	// ID is the token's jti.
+	ID        uuid.UUID
+	ExpiresAt time.Time
+}
+
+// VerifyLogin checks the code that finishes a two-factor login: one from the
+// user's authenticator app, or one of their recovery codes. Either can only be
+// used once. So can the challenge, which is also spent after
+// ChallengeAttempts wrong codes.
+func (s *MFAService) VerifyLogin(ctx context.Context, userID uuid.UUID, challenge MFAChallenge, code, ua, ip string) error {
+	return s.inTx(ctx, func(qtx *database.Queries) error {
+		// Challenges from logins long over are cleared out as new ones come.
+		if err := qtx.DeleteExpiredMFAChallenges(ctx); err != nil {
+			return fmt.Errorf("delete expired mfa challenges: %w", err)
+		}
+		if err := qtx.ClaimMFAChallenge(ctx, database.ClaimMFAChallengeParams{
+			ChallengeID: challenge.ID,
+			UserID:      userID,
+			ExpiresAt:   challenge.ExpiresAt,
+		}); err != nil {
+			return fmt.Errorf("claim mfa challenge: %w", err)
+		}
+		row, err := qtx.GetMFAChallengeForUpdate(ctx, database.GetMFAChallengeForUpdateParams{
+			ChallengeID: challenge.ID,
+			UserID:      userID,
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrMFAChallengeSpent
+			}
+			return fmt.Errorf("get mfa challenge: %w", err)
+		}
+		if row.SpentAt.Valid {
+			return ErrMFAChallengeSpent
+		}
+
+		err = s.verify(ctx, qtx, userID, code, ua, ip)
+		if errors.Is(err, ErrInvalidMFACode) {
+			failures, ferr := qtx.RecordMFAChallengeFailure(ctx, challenge.ID)
+			if ferr != nil {
+				return fmt.Errorf("record mfa challenge failure: %w", ferr)
+			}
+			if int(failures) < s.ChallengeAttempts {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		if serr := qtx.SpendMFAChallenge(ctx, challenge.ID); serr != nil {
+			return fmt.Errorf("spend mfa challenge: %w", serr)
+		}
+		return err
+	})
+}
+
+// DisableTOTP turns two-factor off and throws away the recovery codes. It
+// takes a current code, so a stolen access token alone cannot do it.
+func (s *MFAService) DisableTOTP(ctx context.Context, userID uuid.UUID, code, ua, ip string) error {
+	return s.inTx(ctx, func(qtx *database.Queries) error {
+		if err := s.verify(ctx, qtx, userID, code, ua, ip); err != nil {
+			return err
+		}
+		if err := qtx.DeleteUserTOTP(ctx, userID); err != nil {
+			return fmt.Errorf("delete totp: %w", err)
+		}
+		if err := qtx.DeleteRecoveryCodes(ctx, userID); err != nil {
+			return fmt.Errorf("delete recovery codes: %w", err)
+		}
+		return nil
+	})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, used or not,
+// with a fresh set. Like disabling, it takes a current code.
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code, ua, ip string) ([]string, error) {
+	var codes []string
+	err := s.inTx(ctx, func(qtx *database.Queries) error {
+		if err := s.verify(ctx, qtx, userID, code, ua, ip); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(ctx, qtx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// VerifyCode checks a current code or a recovery code before a change that
+// needs more than an access token, such as a new email.
+func (s *MFAService) VerifyCode(ctx context.Context, userID uuid.UUID, code, ua, ip string) error {
+	return s.inTx(ctx, func(qtx *database.Queries) error {
+		return s.verify(ctx, qtx, userID, code, ua, ip)
+	})
+}
+
+// inTx runs fn in a transaction. A wrong code is committed like a success, so
+// the failure it counted sticks.
+func (s *MFAService) inTx(ctx context.Context, fn func(qtx *database.Queries) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(s.queries.WithTx(tx)); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			if cerr := tx.Commit(); cerr != nil {
+				return fmt.Errorf("commit: %w", cerr)
+			}
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// verify locks the user's TOTP row, so two requests racing with the same code
+// cannot both get in, and guesses are counted one at a time. While two-factor
+// is locked no code is checked at all.
+func (s *MFAService) verify(ctx context.Context, qtx *database.Queries, userID uuid.UUID, code, ua, ip string) error {
+	enrolment, err := qtx.GetUserTOTPForUpdate(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrMFANotEnabled
+		}
+		return fmt.Errorf("get totp: %w", err)
+	}
+	if !enrolment.ConfirmedAt.Valid {
+		return ErrMFANotEnabled
+	}
+	if enrolment.LockedUntil.Valid && s.Now().Before(enrolment.LockedUntil.Time) {
+		return ErrMFALocked
+	}
+
+	key, err := totp.DecodeSecret(enrolment.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := s.TOTP.Validate(key, code, s.Now())
+	if ok && (!enrolment.LastUsedStep.Valid || step > enrolment.LastUsedStep.Int64) {
+		if err := qtx.SetTOTPLastUsedStep(ctx, database.SetTOTPLastUsedStepParams{
+			UserID:       userID,
+			LastUsedStep: sql.NullInt64{Int64: step, Valid: true},
+		}); err != nil {
+			return fmt.Errorf("set totp last used step: %w", err)
+		}
+		return s.resetFailures(ctx, qtx, enrolment)
+	}
+
+	rows, err := qtx.ConsumeRecoveryCode(ctx, database.ConsumeRecoveryCodeParams{
+		UserID:   userID,
+		CodeHash: secret.Hash(normalizeRecoveryCode(code)),
+	})
+	if err != nil {
+		return fmt.Errorf("consume recovery code: %w", err)
+	}
+	if rows == 0 {
+		return s.recordFailure(ctx, qtx, userID, ua, ip)
+	}
+	return s.resetFailures(ctx, qtx, enrolment)
+}
+
+// recordFailure counts a wrong code, locking two-factor once there have been
+// MaxFailures in a row. It always returns ErrInvalidMFACode.
+func (s *MFAService) recordFailure(ctx context.Context, qtx *database.Queries, userID uuid.UUID, ua, ip string) error {
+	failures, err := qtx.RecordTOTPFailure(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("record totp failure: %w", err)
+	}
+	event := SecurityEvent{UserID: userID, Type: SecurityEventMFAFailure, UserAgent: ua, IP: ip}
+	if err := recordSecurityEvent(ctx, qtx, event); err != nil {
+		return err
+	}
+	if int(failures) >= s.MaxFailures {
+		if err := qtx.LockTOTP(ctx, database.LockTOTPParams{
+			UserID:      userID,
+			LockedUntil: sql.NullTime{Time: s.Now().Add(s.Lockout), Valid: true},
+		}); err != nil {
+			return fmt.Errorf("lock totp: %w", err)
+		}
+		event.Type = SecurityEventMFALockout
+		if err := recordSecurityEvent(ctx, qtx, event); err != nil {
+			return err
+		}
+	}
+	return ErrInvalidMFACode
+}
+
+func (s *MFAService) resetFailures(ctx context.Context, qtx *database.Queries, enrolment database.UserTotp) error {
+	if enrolment.FailedAttempts == 0 && !enrolment.LockedUntil.Valid {
+		return nil
+	}
+	if err := qtx.ResetTOTPFailures(ctx, enrolment.UserID); err != nil {
+		return fmt.Errorf("reset totp failures: %w", err)
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, qtx *database.Queries, userID uuid.UUID) ([]string, error) {
+	if err := qtx.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return nil, fmt.Errorf("delete recovery codes: %w", err)
+	}
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		if err := qtx.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: secret.Hash(normalizeRecoveryCode(code)),
+		}); err != nil {
+			return nil, fmt.Errorf("create recovery code: %w", err)
+		}
+		codes[i] = code
+	}
+	return codes, nil
+}
+
+// newRecoveryCode makes a code like "k7pxm-3qa2b": 50 random bits, easy to
+// read out and type.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate recovery code: %w", err)
+	}
+	s := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+	return s[:5] + "-" + s[5:], nil
+}
+
+// normalizeRecoveryCode ignores case, dashes and spaces, which people get
+// wrong when copying codes.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
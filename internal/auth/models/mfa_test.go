@@ -0,0 +1,33 @@
+package models
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+	seen := make(map[string]bool)
+	for range 50 {
+		code, err := newRecoveryCode()
+		if err != nil {
+			t.Fatalf("newRecoveryCode: %v", err)
+		}
+		if !format.MatchString(code) {
+			t.Fatalf("recovery code %q does not look like xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Fatalf("recovery code %q came up twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	want := normalizeRecoveryCode("k7pxm-3qa2b")
+	for _, typed := range []string{"K7PXM-3QA2B", "k7pxm3qa2b", " k7pxm 3qa2b ", "k7p-xm3-qa2b"} {
+		if got := normalizeRecoveryCode(typed); got != want {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", typed, got, want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/middleware"
+	"github.com/Kam1217/optio/internal/auth/secret"
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/google/uuid"
+)
+
+// Scopes a personal access token can be given. Each is checked on its own:
+// a token that writes items does not read them unless it has items:read too.
+const (
+	ScopeSessionsRead  = "sessions:read"
+	ScopeSessionsWrite = "sessions:write"
+	ScopeItemsRead     = "items:read"
+	ScopeItemsWrite    = "items:write"
+	ScopeVotesWrite    = "votes:write"
+)
+
+// Scopes lists every scope a token can be given.
+var Scopes = []string{ScopeSessionsRead, ScopeSessionsWrite, ScopeItemsRead, ScopeItemsWrite, ScopeVotesWrite}
+
+// MaxPATNameLength bounds the name people give a token.
+const MaxPATNameLength = 100
+
+// patTouchInterval is how stale last_used_at may get, so a busy script does
+// not write to the database on every request.
+const patTouchInterval = time.Minute
+
+var (
+	ErrInvalidPATName   = errors.New("token name must be 1 to 100 characters")
+	ErrInvalidPATScopes = errors.New("token needs at least one known scope")
+	ErrInvalidPATExpiry = errors.New("token expiry must be in the future")
+	ErrPATNotFound      = errors.New("personal access token not found")
+)
+
+// PATService manages personal access tokens, which let scripts and bots call
+// the API as a user, limited to the scopes the token was given.
+type PATService struct {
+	db      *sql.DB
+	queries *database.Queries
+}
+
+func NewPATService(db *sql.DB, queries *database.Queries) *PATService {
+	return &PATService{db: db, queries: queries}
+}
+
+// Create makes a token for the user. The plain token is only ever returned
+// here; the database keeps its hash. A zero expiresAt means it never expires.
+func (s *PATService) Create(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresAt time.Time) (plain string, token database.PersonalAccessToken, err error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > MaxPATNameLength {
+		return "", database.PersonalAccessToken{}, ErrInvalidPATName
+	}
+	scopes, err = normalizeScopes(scopes)
+	if err != nil {
+		return "", database.PersonalAccessToken{}, err
+	}
+	if !expiresAt.IsZero() && !expiresAt.After(time.Now()) {
+		return "", database.PersonalAccessToken{}, ErrInvalidPATExpiry
+	}
+
+	raw, _, err := secret.New()
+	if err != nil {
+		return "", database.PersonalAccessToken{}, err
+	}
+	plain = middleware.PATPrefix + raw
+	token, err = s.queries.CreatePersonalAccessToken(ctx, database.CreatePersonalAccessTokenParams{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: secret.Hash(plain),
+		TokenHint: plain[len(plain)-4:],
+		Scopes:    scopes,
+		ExpiresAt: sql.NullTime{Time: expiresAt, Valid: !expiresAt.IsZero()},
+	})
+	if err != nil {
+		return "", database.PersonalAccessToken{}, fmt.Errorf("create personal access token: %w", err)
+	}
+	return plain, token, nil
+}
+
+// List returns the user's tokens that have not been revoked, newest first.
+func (s *PATService) List(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error) {
+	tokens, err := s.queries.ListPersonalAccessTokens(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list personal access tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// Revoke stops one of the user's tokens working.
+func (s *PATService) Revoke(ctx context.Context, userID, tokenID uuid.UUID) error {
+	n, err := s.queries.RevokePersonalAccessToken(ctx, database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		return fmt.Errorf("revoke personal access token: %w", err)
+	}
+	if n == 0 {
+		return ErrPATNotFound
+	}
+	return nil
+}
+
+// RevokeAll stops every one of the user's tokens working.
+func (s *PATService) RevokeAll(ctx context.Context, userID uuid.UUID) error {
+	if err := s.queries.RevokeAllPersonalAccessTokensForUser(ctx, userID); err != nil {
+		return fmt.Errorf("revoke all personal access tokens: %w", err)
+	}
+	return nil
+}
+
+// AuthenticatePAT looks up who a token belongs to and what it may do, and
+// notes that it was used. Tokens that are unknown, revoked, expired or belong
+// to a deleted user give an error wrapping sql.ErrNoRows.
+func (s *PATService) AuthenticatePAT(ctx context.Context, token string) (userID uuid.UUID, username string, scopes []string, err error) {
+	row, err := s.queries.AuthenticatePersonalAccessToken(ctx, secret.Hash(token))
+	if err != nil {
+		return uuid.Nil, "", nil, fmt.Errorf("authenticate personal access token: %w", err)
+	}
+	if !row.LastUsedAt.Valid || time.Since(row.LastUsedAt.Time) >= patTouchInterval {
+		if err := s.queries.TouchPersonalAccessToken(ctx, row.ID); err != nil {
+			return uuid.Nil, "", nil, fmt.Errorf("touch personal access token: %w", err)
+		}
+	}
+	return row.UserID, row.Username, row.Scopes, nil
+}
+
+// normalizeScopes checks every scope is known and drops duplicates.
+func normalizeScopes(scopes []string) ([]string, error) {
+	var out []string
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidPATScopes, scope)
+		}
+		if !slices.Contains(out, scope) {
+			out = append(out, scope)
+		}
+	}
+	if len(out) == 0 {
+		return nil, ErrInvalidPATScopes
+	}
+	return out, nil
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	got, err := normalizeScopes([]string{ScopeItemsWrite, ScopeSessionsRead, ScopeItemsWrite})
+	if err != nil || !slices.Equal(got, []string{ScopeItemsWrite, ScopeSessionsRead}) {
+		t.Fatalf("normalizeScopes = %v, %v", got, err)
+	}
+	for _, scopes := range [][]string{nil, {}, {"admin"}, {ScopeItemsRead, "items:*"}} {
+		if _, err := normalizeScopes(scopes); !errors.Is(err, ErrInvalidPATScopes) {
+			t.Fatalf("normalizeScopes(%q): want ErrInvalidPATScopes, got %v", scopes, err)
+		}
+	}
+}
+
+func TestCreatePATValidation(t *testing.T) {
+	// Bad requests are turned away before the database is touched.
+	s := NewPATService(nil, nil)
+	ctx := context.Background()
+	scopes := []string{ScopeSessionsRead}
+
+	tests := []struct {
+		name      string
+		tokenName string
+		scopes    []string
+		expiresAt time.Time
+		want      error
+	}{
+		{"blank name", "  ", scopes, time.Time{}, ErrInvalidPATName},
+		{"long name", string(make([]rune, MaxPATNameLength+1)), scopes, time.Time{}, ErrInvalidPATName},
+		{"no scopes", "bot", nil, time.Time{}, ErrInvalidPATScopes},
+		{"expired", "bot", scopes, time.Now().Add(-time.Minute), ErrInvalidPATExpiry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := s.Create(ctx, uuid.New(), tt.tokenName, tt.scopes, tt.expiresAt); !errors.Is(err, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -2,85 +2,203 @@ package models
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/base64"
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/Kam1217/optio/internal/auth/secret"
 	"github.com/Kam1217/optio/internal/database"
 	"github.com/google/uuid"
 )
 
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused means a token that had already been rotated was
+	// presented again, so someone else may hold a copy. Its whole family has
+	// been revoked.
+	ErrRefreshTokenReused    = errors.New("refresh token reused")
+	ErrDeviceSessionNotFound = errors.New("device session not found")
+)
+
 type RefreshService struct {
+	db      *sql.DB
 	queries *database.Queries
 	ttl     time.Duration
 }
 
-func NewRefreshService(q *database.Queries, ttl time.Duration) *RefreshService {
-	return &RefreshService{queries: q, ttl: ttl}
+func NewRefreshService(db *sql.DB, q *database.Queries, ttl time.Duration) *RefreshService {
+	return &RefreshService{db: db, queries: q, ttl: ttl}
 }
 
-func (r *RefreshService) IssueRefreshToken(ctx context.Context, userID uuid.UUID, ua, ip string) (plain string, err error) {
-	plain, tokenHash := MakeRefreshToken()
-
+// IssueRefreshToken starts a new token family, as happens on every login. The
+// family is the device session the user sees and can sign out of.
+func (r *RefreshService) IssueRefreshToken(ctx context.Context, userID uuid.UUID, ua, ip string) (plain string, token database.RefreshToken, err error) {
 	now := time.Now()
-	_, err = r.queries.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+	return r.issue(ctx, r.queries, database.CreateRefreshTokenParams{
 		UserID:    userID,
-		TokenHash: tokenHash,
 		IssuedAt:  now,
-		ExpiresAt: now.Add(r.ttl),
 		UserAgent: ua,
 		Ip:        ip,
+		FamilyID:  uuid.New(),
+		LoginAt:   now,
 	})
+}
+
+// issue creates a token from params, filling in the hash and expiry.
+func (r *RefreshService) issue(ctx context.Context, queries *database.Queries, params database.CreateRefreshTokenParams) (string, database.RefreshToken, error) {
+	plain, tokenHash, err := secret.New()
 	if err != nil {
-		return "", err
+		return "", database.RefreshToken{}, err
 	}
-	return plain, nil
+	params.TokenHash = tokenHash
+	params.ExpiresAt = params.IssuedAt.Add(r.ttl)
+
+	token, err := queries.CreateRefreshToken(ctx, params)
+	if err != nil {
+		return "", database.RefreshToken{}, fmt.Errorf("create refresh token: %w", err)
+	}
+	return plain, token, nil
 }
 
-func (r *RefreshService) RotateRefreshToken(ctx context.Context, oldPlain string, userPasswordChangedAt *time.Time, ua, ip string) (newPlain string, userID uuid.UUID, err error) {
-	hash := hashRefresh(oldPlain)
-	now := time.Now()
-	_ = hashRefresh(oldPlain)
-	refreshToken, err := r.queries.GetActiveRefreshTokenByHash(ctx, hash)
+// RotateRefreshToken swaps a live token for a new one in the same family. The
+// old token is locked, replaced and revoked in one transaction, so a crash
+// cannot leave the user without a token, and two requests racing with the
+// same token cannot both win. A token that was already replaced is treated as
+// stolen: the whole family is revoked and a security event is recorded. So is
+// a family whose login predates the user's last password change.
+func (r *RefreshService) RotateRefreshToken(ctx context.Context, oldPlain, ua, ip string) (newPlain string, token database.RefreshToken, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", database.RefreshToken{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := r.queries.WithTx(tx)
+
+	refreshToken, err := qtx.GetRefreshTokenByHashForUpdate(ctx, secret.Hash(oldPlain))
 	if err != nil {
-		return "", uuid.Nil, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", database.RefreshToken{}, ErrInvalidRefreshToken
+		}
+		return "", database.RefreshToken{}, fmt.Errorf("get refresh token: %w", err)
 	}
 
-	if userPasswordChangedAt != nil && userPasswordChangedAt.After(refreshToken.IssuedAt) {
-		_ = r.queries.RevokeRefreshTokenByID(ctx, refreshToken.ID)
-		return "", uuid.Nil, fmt.Errorf("invalid refresh token")
+	if refreshToken.ReplacedByID.Valid {
+		if err := revokeFamily(ctx, qtx, refreshToken, ua, ip); err != nil {
+			return "", database.RefreshToken{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return "", database.RefreshToken{}, fmt.Errorf("commit family revocation: %w", err)
+		}
+		return "", database.RefreshToken{}, ErrRefreshTokenReused
+	}
+	if refreshToken.RevokedAt.Valid || !refreshToken.ExpiresAt.After(time.Now()) {
+		return "", database.RefreshToken{}, ErrInvalidRefreshToken
 	}
 
-	_ = r.queries.RevokeRefreshTokenByID(ctx, refreshToken.ID)
-	newPlain, newHash := MakeRefreshToken()
+	user, err := qtx.GetUserByID(ctx, refreshToken.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", database.RefreshToken{}, ErrInvalidRefreshToken
+		}
+		return "", database.RefreshToken{}, fmt.Errorf("get user: %w", err)
+	}
+	if user.PasswordChangedAt.Valid && user.PasswordChangedAt.Time.After(refreshToken.LoginAt) {
+		if _, err := qtx.RevokeRefreshTokenFamily(ctx, refreshToken.FamilyID); err != nil {
+			return "", database.RefreshToken{}, fmt.Errorf("revoke refresh token family: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return "", database.RefreshToken{}, fmt.Errorf("commit revocation: %w", err)
+		}
+		return "", database.RefreshToken{}, ErrInvalidRefreshToken
+	}
 
-	_, err = r.queries.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
-		UserID:    refreshToken.UserID,
-		TokenHash: newHash,
-		IssuedAt:  now,
-		ExpiresAt: now.Add(r.ttl),
-		UserAgent: ua,
-		Ip:        ip,
+	now := time.Now()
+	newPlain, replacement, err := r.issue(ctx, qtx, database.CreateRefreshTokenParams{
+		UserID:     refreshToken.UserID,
+		IssuedAt:   now,
+		UserAgent:  ua,
+		Ip:         ip,
+		FamilyID:   refreshToken.FamilyID,
+		LoginAt:    refreshToken.LoginAt,
+		LastUsedAt: sql.NullTime{Time: now, Valid: true},
 	})
 	if err != nil {
-		return "", uuid.Nil, err
+		return "", database.RefreshToken{}, err
 	}
-	return newPlain, refreshToken.UserID, nil
+	if err := qtx.ReplaceRefreshToken(ctx, database.ReplaceRefreshTokenParams{
+		ID:           refreshToken.ID,
+		ReplacedByID: uuid.NullUUID{UUID: replacement.ID, Valid: true},
+	}); err != nil {
+		return "", database.RefreshToken{}, fmt.Errorf("replace refresh token: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", database.RefreshToken{}, fmt.Errorf("commit rotation: %w", err)
+	}
+	return newPlain, replacement, nil
+}
+
+// RevokeRefreshToken ends the login the token belongs to by revoking its whole
+// family. Unknown tokens are ignored.
+func (r *RefreshService) RevokeRefreshToken(ctx context.Context, plain string) error {
+	refreshToken, err := r.queries.GetRefreshTokenByHash(ctx, secret.Hash(plain))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("get refresh token: %w", err)
+	}
+	if _, err := r.queries.RevokeRefreshTokenFamily(ctx, refreshToken.FamilyID); err != nil {
+		return fmt.Errorf("revoke refresh token family: %w", err)
+	}
+	return nil
+}
+
+// ListDeviceSessions returns the user's active refresh tokens, one per device
+// session, most recently used first.
+func (r *RefreshService) ListDeviceSessions(ctx context.Context, userID uuid.UUID) ([]database.ListActiveTokensForUserRow, error) {
+	tokens, err := r.queries.ListActiveTokensForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list active refresh tokens: %w", err)
+	}
+	return tokens, nil
 }
 
-func MakeRefreshToken() (plain, hash string) {
-	token := make([]byte, 32)
-	rand.Read(token)
-	plain = base64.RawURLEncoding.EncodeToString(token)
+// RevokeDeviceSession signs the user out of one device session.
+func (r *RefreshService) RevokeDeviceSession(ctx context.Context, userID, familyID uuid.UUID) error {
+	n, err := r.queries.RevokeUserRefreshTokenFamily(ctx, database.RevokeUserRefreshTokenFamilyParams{
+		UserID:   userID,
+		FamilyID: familyID,
+	})
+	if err != nil {
+		return fmt.Errorf("revoke device session: %w", err)
+	}
+	if n == 0 {
+		return ErrDeviceSessionNotFound
+	}
+	return nil
+}
 
-	sum := sha256.Sum256([]byte(plain))
-	hash = base64.RawURLEncoding.EncodeToString(sum[:])
-	return
+// RevokeAllDeviceSessions signs the user out everywhere. Access tokens already
+// handed out keep working until they expire.
+func (r *RefreshService) RevokeAllDeviceSessions(ctx context.Context, userID uuid.UUID) error {
+	if err := r.queries.RevokeAllRefreshTokensForUser(ctx, userID); err != nil {
+		return fmt.Errorf("revoke all refresh tokens: %w", err)
+	}
+	return nil
 }
 
-func hashRefresh(plain string) string {
-	sum := sha256.Sum256([]byte(plain))
-	return base64.RawURLEncoding.EncodeToString(sum[:])
+// revokeFamily shuts down every token descended from the same login as a
+// reused token and records why.
+func revokeFamily(ctx context.Context, qtx *database.Queries, reused database.RefreshToken, ua, ip string) error {
+	if _, err := qtx.RevokeRefreshTokenFamily(ctx, reused.FamilyID); err != nil {
+		return fmt.Errorf("revoke refresh token family: %w", err)
+	}
+	return recordSecurityEvent(ctx, qtx, SecurityEvent{
+		UserID:    reused.UserID,
+		Type:      SecurityEventRefreshReuse,
+		FamilyID:  uuid.NullUUID{UUID: reused.FamilyID, Valid: true},
+		UserAgent: ua,
+		IP:        ip,
+	})
 }
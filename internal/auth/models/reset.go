@@ -0,0 +1,183 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/secret"
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/Kam1217/optio/internal/mail"
+	"github.com/google/uuid"
+)
+
+const DefaultPasswordResetTTL = time.Hour
+
+const (
+	// DefaultResetMailTimeout bounds how long one background reset request,
+	// lookup and email included, may take.
+	DefaultResetMailTimeout = 30 * time.Second
+	// maxPendingResets caps the reset requests running in the background, so
+	// a flood of them cannot pile up goroutines and SMTP connections.
+	maxPendingResets = 32
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// PasswordResetService lets people who forgot their password set a new one
+// through a link sent to their email. Reset tokens are stored hashed, like
+// refresh tokens, and each works once.
+type PasswordResetService struct {
+	db       *sql.DB
+	queries  *database.Queries
+	mailer   mail.Mailer
+	resetURL string
+	TTL      time.Duration
+	// MailTimeout bounds each request made with RequestResetInBackground.
+	MailTimeout time.Duration
+
+	slots chan struct{}
+}
+
+// NewPasswordResetService sends reset links pointing at resetURL, with the
+// token in the token query parameter.
+func NewPasswordResetService(db *sql.DB, queries *database.Queries, mailer mail.Mailer, resetURL string) *PasswordResetService {
+	return &PasswordResetService{
+		db:          db,
+		queries:     queries,
+		mailer:      mailer,
+		resetURL:    resetURL,
+		TTL:         DefaultPasswordResetTTL,
+		MailTimeout: DefaultResetMailTimeout,
+		slots:       make(chan struct{}, maxPendingResets),
+	}
+}
+
+// RequestResetInBackground runs RequestReset off the request path. Looking up
+// the account and emailing it takes far longer than finding no account, so
+// answering only after RequestReset would let response times tell who has an
+// account. Errors are logged.
+func (s *PasswordResetService) RequestResetInBackground(email string) {
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		log.Printf("request password reset: too many pending, dropped")
+		return
+	}
+	go func() {
+		defer func() { <-s.slots }()
+		ctx, cancel := context.WithTimeout(context.Background(), s.MailTimeout)
+		defer cancel()
+		if err := s.RequestReset(ctx, email); err != nil {
+			log.Printf("request password reset: %v", err)
+		}
+	}()
+}
+
+// RequestReset emails a reset link to the account with this email. Nothing
+// happens for unknown emails, and the caller cannot tell the difference, so
+// the endpoint cannot be used to find out who has an account. Callers
+// answering the request should use RequestResetInBackground.
+func (s *PasswordResetService) RequestReset(ctx context.Context, email string) error {
+	user, err := s.queries.GetUserByEmail(ctx, nullString(email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("get user by email: %w", err)
+	}
+
+	plain, hash, err := secret.New()
+	if err != nil {
+		return err
+	}
+	if _, err := s.queries.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.TTL),
+	}); err != nil {
+		return fmt.Errorf("create password reset token: %w", err)
+	}
+
+	link, err := tokenLink(s.resetURL, plain)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"Someone asked to reset the password for your Optio account. "+
+		"To choose a new one, open this link within %d minutes:\n\n%s\n\n"+
+		"If it wasn't you, you can ignore this email; your password stays the same.\n",
+		user.Username, int(s.TTL.Minutes()), link)
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      user.Email.String,
+		Subject: "Reset your Optio password",
+		Body:    body,
+	}); err != nil {
+		return fmt.Errorf("send password reset email: %w", err)
+	}
+	return nil
+}
+
+// ConfirmReset sets a new password using a reset token and returns whose it
+// was. The token and any other outstanding ones are used up, and every access,
+// refresh and personal access token is revoked so whoever might have had the
+// old password is signed out and left with no way back in.
+func (s *PasswordResetService) ConfirmReset(ctx context.Context, token, newPassword string) (uuid.UUID, error) {
+	passwordHash, err := hashPassword(newPassword)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	reset, err := qtx.ConsumePasswordResetToken(ctx, secret.Hash(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, ErrInvalidResetToken
+		}
+		return uuid.Nil, fmt.Errorf("consume password reset token: %w", err)
+	}
+
+	if err := qtx.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:                reset.UserID,
+		PasswordHash:      nullString(passwordHash),
+		PasswordChangedAt: nullTime(time.Now()),
+	}); err != nil {
+		return uuid.Nil, fmt.Errorf("update user password: %w", err)
+	}
+	if err := qtx.InvalidatePasswordResetTokensForUser(ctx, reset.UserID); err != nil {
+		return uuid.Nil, fmt.Errorf("invalidate password reset tokens: %w", err)
+	}
+	if err := qtx.RevokeAllRefreshTokensForUser(ctx, reset.UserID); err != nil {
+		return uuid.Nil, fmt.Errorf("revoke refresh tokens: %w", err)
+	}
+	if err := qtx.RevokeAllPersonalAccessTokensForUser(ctx, reset.UserID); err != nil {
+		return uuid.Nil, fmt.Errorf("revoke personal access tokens: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, fmt.Errorf("commit password reset: %w", err)
+	}
+	return reset.UserID, nil
+}
+
+// tokenLink adds the token to base as its token query parameter.
+func tokenLink(base, token string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("parse link URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// SecurityEventRefreshReuse records a rotated refresh token being
+	// presented again, which revokes its family.
+	SecurityEventRefreshReuse = "refresh_token_reuse"
+	// SecurityEventMFAFailure records a wrong two-factor code.
+	SecurityEventMFAFailure = "mfa_failure"
+	// SecurityEventMFALockout records two-factor being locked after too
+	// many wrong codes.
+	SecurityEventMFALockout = "mfa_lockout"
+)
+
+// SecurityEvent is something worth telling a user about or investigating
+// later, such as signs that a token was stolen.
+type SecurityEvent struct {
+	UserID    uuid.UUID
+	Type      string
+	FamilyID  uuid.NullUUID
+	UserAgent string
+	IP        string
+}
+
+func recordSecurityEvent(ctx context.Context, queries *database.Queries, event SecurityEvent) error {
+	if _, err := queries.CreateSecurityEvent(ctx, database.CreateSecurityEventParams{
+		UserID:    event.UserID,
+		EventType: event.Type,
+		FamilyID:  event.FamilyID,
+		UserAgent: event.UserAgent,
+		Ip:        event.IP,
+	}); err != nil {
+		return fmt.Errorf("record security event: %w", err)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Kam1217/optio/internal/database"
 	"github.com/google/uuid"
@@ -12,14 +13,18 @@ import (
 )
 
 type UserService struct {
+	db      *sql.DB
 	queries *database.Queries
 }
 
-func NewUserService(queries *database.Queries) *UserService {
-	return &UserService{queries: queries}
+func NewUserService(db *sql.DB, queries *database.Queries) *UserService {
+	return &UserService{db: db, queries: queries}
 }
 
-var ErrInvalidCredentails = errors.New("invalid credentials")
+var (
+	ErrInvalidCredentails = errors.New("invalid credentials")
+	ErrNotGuest           = errors.New("user is not a guest")
+)
 
 func hashPassword(password string) (string, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -34,10 +39,21 @@ func checkPassword(hashedPassword, password string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) == nil
 }
 
+// nullTime stamps a password change, which always has a time.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: true}
+}
+
+// nullString wraps a value for a nullable column. Only guests leave email and
+// password hash empty, and they never go through these paths.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: true}
+}
+
 func (s *UserService) UserExists(ctx context.Context, username, email string) (bool, error) {
 	exists, err := s.queries.UserExistsByUsernameOrEmail(ctx, database.UserExistsByUsernameOrEmailParams{
 		Username: username,
-		Email:    email,
+		Email:    nullString(email),
 	})
 	if err != nil {
 		return false, fmt.Errorf("users exists: %w", err)
@@ -53,8 +69,8 @@ func (s *UserService) CreateUser(ctx context.Context, username, email, password
 	}
 	user, err := s.queries.CreateUser(ctx, database.CreateUserParams{
 		Username:     username,
-		Email:        email,
-		PasswordHash: passwordHash,
+		Email:        nullString(email),
+		PasswordHash: nullString(passwordHash),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("create user: %w", err)
@@ -63,6 +79,31 @@ func (s *UserService) CreateUser(ctx context.Context, username, email, password
 	return &user, nil
 }
 
+// UpgradeGuest turns a guest into a full account with a username, email and
+// password. The user keeps their ID, so their participation, items and votes
+// stay theirs.
+func (s *UserService) UpgradeGuest(ctx context.Context, userID uuid.UUID, username, email, password string) (*database.UpgradeGuestUserRow, error) {
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.queries.UpgradeGuestUser(ctx, database.UpgradeGuestUserParams{
+		ID:                userID,
+		Username:          username,
+		Email:             nullString(email),
+		PasswordHash:      nullString(passwordHash),
+		PasswordChangedAt: nullTime(time.Now()),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotGuest
+		}
+		return nil, fmt.Errorf("upgrade guest: %w", err)
+	}
+
+	return &user, nil
+}
+
 func (s *UserService) GetUserByID(ctx context.Context, userID uuid.UUID) (*database.GetUserByIDRow, error) {
 	user, err := s.queries.GetUserByID(ctx, userID)
 	if err != nil {
@@ -82,7 +123,7 @@ func (s *UserService) GetUserByUsername(ctx context.Context, username string) (*
 }
 
 func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*database.GetUserByEmailRow, error) {
-	user, err := s.queries.GetUserByEmail(ctx, email)
+	user, err := s.queries.GetUserByEmail(ctx, nullString(email))
 	if err != nil {
 		return nil, fmt.Errorf("get user by email: %w", err)
 	}
@@ -98,7 +139,7 @@ func (s *UserService) ValidateUserCredentials(ctx context.Context, identifier, p
 		}
 		return nil, fmt.Errorf("get user for login: %w", err)
 	}
-	if !checkPassword(user.PasswordHash, password) {
+	if !checkPassword(user.PasswordHash.String, password) {
 		return nil, ErrInvalidCredentails
 	}
 
@@ -123,15 +164,77 @@ func (s *UserService) UpdateUserPassword(ctx context.Context, userID uuid.UUID,
 		return err
 	}
 	if err := s.queries.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
-		ID:           userID,
-		PasswordHash: passwordHash,
+		ID:                userID,
+		PasswordHash:      nullString(passwordHash),
+		PasswordChangedAt: nullTime(time.Now()),
+	}); err != nil {
+		return fmt.Errorf("update user password: %w", err)
+	}
+
+	return nil
+}
+
+// ChangePassword replaces the password after checking the current one. Access
+// tokens, refresh tokens, personal access tokens and reset links from before
+// the change all stop working, so the caller has to sign the user in again on
+// this device, and whoever had the old password keeps no way in.
+func (s *UserService) ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string) error {
+	passwordHash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	currentHash, err := qtx.GetUserPasswordHash(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidCredentails
+		}
+		return fmt.Errorf("get password hash: %w", err)
+	}
+	if !checkPassword(currentHash.String, currentPassword) {
+		return ErrInvalidCredentails
+	}
+
+	if err := qtx.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:                userID,
+		PasswordHash:      nullString(passwordHash),
+		PasswordChangedAt: nullTime(time.Now()),
 	}); err != nil {
 		return fmt.Errorf("update user password: %w", err)
 	}
+	if err := qtx.InvalidatePasswordResetTokensForUser(ctx, userID); err != nil {
+		return fmt.Errorf("invalidate password reset tokens: %w", err)
+	}
+	if err := qtx.RevokeAllRefreshTokensForUser(ctx, userID); err != nil {
+		return fmt.Errorf("revoke refresh tokens: %w", err)
+	}
+	if err := qtx.RevokeAllPersonalAccessTokensForUser(ctx, userID); err != nil {
+		return fmt.Errorf("revoke personal access tokens: %w", err)
+	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit password change: %w", err)
+	}
 	return nil
 }
 
+// TokenVersion returns the version the user's access tokens must carry.
+func (s *UserService) TokenVersion(ctx context.Context, userID uuid.UUID) (int32, error) {
+	version, err := s.queries.GetUserTokenVersion(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("get token version: %w", err)
+	}
+
+	return version, nil
+}
+
 func (s *UserService) UpdateUsername(ctx context.Context, userID uuid.UUID, username string) error {
 	if err := s.queries.UpdateUsername(ctx, database.UpdateUsernameParams{
 		ID:       userID,
@@ -143,15 +246,46 @@ func (s *UserService) UpdateUsername(ctx context.Context, userID uuid.UUID, user
 	return nil
 }
 
-func (s *UserService) UpdateEmail(ctx context.Context, userID uuid.UUID, email string) error {
-	if err := s.queries.UpdateEmail(ctx, database.UpdateEmailParams{
+// UpdateEmail changes the user's email after checking their current password,
+// since whoever controls the email can reset the password. It returns the
+// address the account had before, so the owner can be told.
+func (s *UserService) UpdateEmail(ctx context.Context, userID uuid.UUID, currentPassword, email string) (oldEmail string, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	user, err := qtx.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrInvalidCredentails
+		}
+		return "", fmt.Errorf("get user by id: %w", err)
+	}
+	currentHash, err := qtx.GetUserPasswordHash(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("get password hash: %w", err)
+	}
+	if !checkPassword(currentHash.String, currentPassword) {
+		return "", ErrInvalidCredentails
+	}
+
+	if err := qtx.UpdateEmail(ctx, database.UpdateEmailParams{
 		ID:    userID,
-		Email: email,
+		Email: nullString(email),
 	}); err != nil {
-		return fmt.Errorf("update email: %w", err)
+		if uniqueViolation(err) == "users_email_key" {
+			return "", ErrEmailInUse
+		}
+		return "", fmt.Errorf("update email: %w", err)
 	}
 
-	return nil
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("commit email change: %w", err)
+	}
+	return user.Email.String, nil
 }
 
 func (s *UserService) DeleteUser(ctx context.Context, userID uuid.UUID) error {
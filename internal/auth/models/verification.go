@@ -0,0 +1,146 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/secret"
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/Kam1217/optio/internal/mail"
+	"github.com/google/uuid"
+)
+
+const DefaultEmailVerificationTTL = 24 * time.Hour
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+	ErrEmailAlreadyVerified     = errors.New("email is already verified")
+	ErrNoEmail                  = errors.New("account has no email")
+)
+
+// EmailVerificationService confirms that people own the email on their
+// account by mailing them a link. Like reset tokens, verification tokens are
+// stored hashed and each works once.
+type EmailVerificationService struct {
+	db        *sql.DB
+	queries   *database.Queries
+	mailer    mail.Mailer
+	verifyURL string
+	TTL       time.Duration
+}
+
+// NewEmailVerificationService sends links pointing at verifyURL, with the
+// token in the token query parameter.
+func NewEmailVerificationService(db *sql.DB, queries *database.Queries, mailer mail.Mailer, verifyURL string) *EmailVerificationService {
+	return &EmailVerificationService{
+		db:        db,
+		queries:   queries,
+		mailer:    mailer,
+		verifyURL: verifyURL,
+		TTL:       DefaultEmailVerificationTTL,
+	}
+}
+
+// SendVerification mails a verification link to the user's current email.
+// Earlier links keep working until they expire, as long as the email has not
+// changed.
+func (s *EmailVerificationService) SendVerification(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("get user by id: %w", err)
+	}
+	if !user.Email.Valid {
+		return ErrNoEmail
+	}
+	if user.EmailVerifiedAt.Valid {
+		return ErrEmailAlreadyVerified
+	}
+
+	plain, hash, err := secret.New()
+	if err != nil {
+		return err
+	}
+	if _, err := s.queries.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		UserID:    user.ID,
+		Email:     user.Email.String,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.TTL),
+	}); err != nil {
+		return fmt.Errorf("create email verification token: %w", err)
+	}
+
+	link, err := tokenLink(s.verifyURL, plain)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"Please confirm this is your email address by opening this link within %d hours:\n\n%s\n\n"+
+		"If you didn't sign up for Optio, you can ignore this email.\n",
+		user.Username, int(s.TTL.Hours()), link)
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      user.Email.String,
+		Subject: "Verify your Optio email",
+		Body:    body,
+	}); err != nil {
+		return fmt.Errorf("send verification email: %w", err)
+	}
+	return nil
+}
+
+// Verify marks the email the token was sent to as verified. Tokens sent to an
+// address the user no longer has are rejected.
+func (s *EmailVerificationService) Verify(ctx context.Context, token string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	verification, err := qtx.ConsumeEmailVerificationToken(ctx, secret.Hash(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidVerificationToken
+		}
+		return fmt.Errorf("consume email verification token: %w", err)
+	}
+
+	rows, err := qtx.MarkEmailVerified(ctx, database.MarkEmailVerifiedParams{
+		ID:    verification.UserID,
+		Email: nullString(verification.Email),
+	})
+	if err != nil {
+		return fmt.Errorf("mark email verified: %w", err)
+	}
+	if rows == 0 {
+		return ErrInvalidVerificationToken
+	}
+	if err := qtx.InvalidateEmailVerificationTokensForUser(ctx, verification.UserID); err != nil {
+		return fmt.Errorf("invalidate email verification tokens: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit email verification: %w", err)
+	}
+	return nil
+}
+
+// NotifyEmailChanged tells the address an account used to have that it has
+// been replaced, so an owner who did not make the change finds out.
+func (s *EmailVerificationService) NotifyEmailChanged(ctx context.Context, username, oldEmail, newEmail string) error {
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"The email address on your Optio account was changed to %s.\n\n"+
+		"If you didn't make this change, sign in and change your password straight away.\n",
+		username, newEmail)
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      oldEmail,
+		Subject: "Your Optio email was changed",
+		Body:    body,
+	}); err != nil {
+		return fmt.Errorf("send email change notice: %w", err)
+	}
+	return nil
+}
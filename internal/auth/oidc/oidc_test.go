@@ -0,0 +1,204 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/oidc"
+	"github.com/Kam1217/optio/internal/auth/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const redirectURL = "https://optio.test/api/auth/oidc/fake/callback"
+
+func newProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+	srv := oidctest.NewServer()
+	t.Cleanup(srv.Close)
+	p := oidc.NewProvider(oidc.Config{
+		Name:         "fake",
+		Issuer:       srv.Issuer(),
+		ClientID:     srv.ClientID,
+		ClientSecret: srv.ClientSecret,
+		RedirectURL:  redirectURL,
+	}, srv.Client())
+	return srv, p
+}
+
+// authorize follows the authorization URL to the fake provider and returns
+// the code and state it sends back to the redirect URL.
+func authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: want 302, got %d", resp.StatusCode)
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("parse redirect: %v", err)
+	}
+	if got := loc.Scheme + "://" + loc.Host + loc.Path; got != redirectURL {
+		t.Fatalf("redirected to %q, want %q", got, redirectURL)
+	}
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestLoginFlow(t *testing.T) {
+	srv, p := newProvider(t)
+	ctx := context.Background()
+	srv.SetUser(oidctest.User{Subject: "abc", Email: "ada@example.com", EmailVerified: true, Name: "Ada"})
+
+	state, _ := oidc.RandomString()
+	nonce, _ := oidc.RandomString()
+	verifier, _ := oidc.RandomString()
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, oidc.PKCEChallenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	code, gotState := authorize(t, authURL)
+	if gotState != state {
+		t.Fatalf("state = %q, want %q", gotState, state)
+	}
+
+	claims, err := p.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "abc" || claims.Email != "ada@example.com" || !bool(claims.EmailVerified) || claims.Name != "Ada" {
+		t.Fatalf("claims = %+v", claims)
+	}
+
+	if _, err := p.Exchange(ctx, code, verifier, nonce); !errors.Is(err, oidc.ErrExchangeFailed) {
+		t.Fatalf("reused code: want ErrExchangeFailed, got %v", err)
+	}
+}
+
+func TestExchangeChecksPKCEAndNonce(t *testing.T) {
+	_, p := newProvider(t)
+	ctx := context.Background()
+
+	start := func() (string, string) {
+		verifier, _ := oidc.RandomString()
+		authURL, err := p.AuthCodeURL(ctx, "state", "nonce", oidc.PKCEChallenge(verifier))
+		if err != nil {
+			t.Fatalf("AuthCodeURL: %v", err)
+		}
+		code, _ := authorize(t, authURL)
+		return code, verifier
+	}
+
+	code, _ := start()
+	if _, err := p.Exchange(ctx, code, "wrong-verifier", "nonce"); !errors.Is(err, oidc.ErrExchangeFailed) {
+		t.Fatalf("wrong verifier: want ErrExchangeFailed, got %v", err)
+	}
+
+	code, verifier := start()
+	if _, err := p.Exchange(ctx, code, verifier, "other-nonce"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("wrong nonce: want ErrInvalidIDToken, got %v", err)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	srv, p := newProvider(t)
+	ctx := context.Background()
+	user := oidctest.User{Subject: "abc", Email: "ada@example.com"}
+
+	valid := func() jwt.MapClaims { return srv.IDTokenClaims(user, "n") }
+	if _, err := p.VerifyIDToken(ctx, srv.Sign(valid()), "n"); err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(jwt.MapClaims)
+	}{
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.test" }},
+		{"other audience", func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }},
+		{"no nonce", func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{"several audiences without azp", func(c jwt.MapClaims) { c["aud"] = []string{srv.ClientID, "other"} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.change(claims)
+			if _, err := p.VerifyIDToken(ctx, srv.Sign(claims), "n"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Fatalf("want ErrInvalidIDToken, got %v", err)
+			}
+		})
+	}
+
+	t.Run("several audiences with azp", func(t *testing.T) {
+		claims := valid()
+		claims["aud"] = []string{srv.ClientID, "other"}
+		claims["azp"] = srv.ClientID
+		if _, err := p.VerifyIDToken(ctx, srv.Sign(claims), "n"); err != nil {
+			t.Fatalf("want valid, got %v", err)
+		}
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		raw, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if _, err := p.VerifyIDToken(ctx, raw, "n"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+			t.Fatalf("want ErrInvalidIDToken, got %v", err)
+		}
+	})
+
+	t.Run("string email_verified", func(t *testing.T) {
+		claims := valid()
+		claims["email_verified"] = "true"
+		got, err := p.VerifyIDToken(ctx, srv.Sign(claims), "n")
+		if err != nil || !bool(got.EmailVerified) {
+			t.Fatalf("got %+v, %v", got, err)
+		}
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	srv, p := newProvider(t)
+	p.MinKeyRefresh = 0
+	ctx := context.Background()
+	user := oidctest.User{Subject: "abc"}
+
+	before := srv.Sign(srv.IDTokenClaims(user, "n"))
+	if _, err := p.VerifyIDToken(ctx, before, "n"); err != nil {
+		t.Fatalf("before rotation: %v", err)
+	}
+
+	srv.RotateKey()
+	after := srv.Sign(srv.IDTokenClaims(user, "n"))
+	if _, err := p.VerifyIDToken(ctx, after, "n"); err != nil {
+		t.Fatalf("after rotation: %v", err)
+	}
+	if _, err := p.VerifyIDToken(ctx, before, "n"); err != nil {
+		t.Fatalf("old key after rotation: %v", err)
+	}
+}
+
+func TestDiscoveryChecksIssuer(t *testing.T) {
+	srv := oidctest.NewServer()
+	defer srv.Close()
+	p := oidc.NewProvider(oidc.Config{
+		Name:     "fake",
+		Issuer:   srv.Issuer() + "/",
+		ClientID: srv.ClientID,
+	}, srv.Client())
+
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "c"); err == nil {
+		t.Fatalf("want an error for a mismatched issuer")
+	}
+}
@@ -0,0 +1,28 @@
+// Package secret makes the random tokens handed out as bearer credentials,
+// such as refresh tokens, emailed links and session invites. The database
+// only ever keeps their hashes.
+package secret
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// New returns a random token and the hash to store for it.
+func New() (plain, hash string, err error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", "", fmt.Errorf("generate token: %w", err)
+	}
+	plain = base64.RawURLEncoding.EncodeToString(token)
+	return plain, Hash(plain), nil
+}
+
+// Hash is what the database stores in place of a secret, and what a secret
+// presented later is looked up by.
+func Hash(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,20 @@
+package secret
+
+import "testing"
+
+func TestNew(t *testing.T) {
+	plain, hash, err := New()
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	other, _, err := New()
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if plain == other {
+		t.Fatal("tokens should be random")
+	}
+	if hash == plain || Hash(plain) != hash {
+		t.Fatalf("hash %q does not match token %q", hash, plain)
+	}
+}
@@ -0,0 +1,144 @@
+// Package totp implements time-based one-time passwords (RFC 6238) on top of
+// HOTP (RFC 4226), as used by authenticator apps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Algorithm string
+
+const (
+	SHA1   Algorithm = "SHA1"
+	SHA256 Algorithm = "SHA256"
+	SHA512 Algorithm = "SHA512"
+)
+
+// SecretSize is the length of generated secrets in bytes, the 160 bits RFC
+// 4226 recommends.
+const SecretSize = 20
+
+var ErrInvalidSecret = errors.New("invalid TOTP secret")
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Config describes how codes are made. Authenticator apps mostly only
+// support the defaults, so change them with care.
+type Config struct {
+	Digits    int
+	Period    time.Duration
+	Algorithm Algorithm
+	// Skew is how many periods before and after the current one are also
+	// accepted, for clocks that drift and people who type slowly.
+	Skew int
+}
+
+var Default = Config{Digits: 6, Period: 30 * time.Second, Algorithm: SHA1, Skew: 1}
+
+// GenerateSecret returns a random secret, base32 encoded the way otpauth
+// URIs and authenticator apps expect.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("generate TOTP secret: %w", err)
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+// DecodeSecret reads a base32 secret. Case, spaces and padding are ignored,
+// since people copy secrets by hand.
+func DecodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := encoding.DecodeString(strings.TrimRight(secret, "="))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return key, nil
+}
+
+// HOTP computes the RFC 4226 code for the counter.
+func HOTP(key []byte, counter uint64, digits int, alg Algorithm) string {
+	mac := hmac.New(alg.hash(), key)
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range digits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+func (a Algorithm) hash() func() hash.Hash {
+	switch a {
+	case SHA256:
+		return sha256.New
+	case SHA512:
+		return sha512.New
+	default:
+		return sha1.New
+	}
+}
+
+// Step returns the time step t falls in, the counter HOTP is run with.
+func (c Config) Step(t time.Time) int64 {
+	return t.Unix() / int64(c.Period/time.Second)
+}
+
+// Code returns the code for time t.
+func (c Config) Code(key []byte, t time.Time) string {
+	return HOTP(key, uint64(c.Step(t)), c.Digits, c.Algorithm)
+}
+
+// Validate checks a code against the steps around t and returns the step it
+// matched. Callers should remember the step and refuse it, and any before
+// it, next time, so a code cannot be used twice.
+func (c Config) Validate(key []byte, code string, t time.Time) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != c.Digits {
+		return 0, false
+	}
+	now := c.Step(t)
+	for step := now - int64(c.Skew); step <= now+int64(c.Skew); step++ {
+		if step < 0 {
+			continue
+		}
+		want := HOTP(key, uint64(step), c.Digits, c.Algorithm)
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// URI returns the otpauth:// URI authenticator apps read, usually from a QR
+// code, to set up the account.
+func (c Config) URI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", string(c.Algorithm))
+	q.Set("digits", strconv.Itoa(c.Digits))
+	q.Set("period", strconv.Itoa(int(c.Period/time.Second)))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
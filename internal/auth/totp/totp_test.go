@@ -0,0 +1,150 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 4226 appendix D.
+func TestHOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	for counter, code := range want {
+		if got := HOTP(key, uint64(counter), 6, SHA1); got != code {
+			t.Errorf("HOTP(counter=%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+// Test vectors from RFC 6238 appendix B. Each algorithm uses the ASCII seed
+// repeated to the length of its digest.
+func TestCodeRFC6238(t *testing.T) {
+	seeds := map[Algorithm][]byte{
+		SHA1:   []byte("12345678901234567890"),
+		SHA256: []byte("12345678901234567890123456789012"),
+		SHA512: []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	tests := []struct {
+		unix int64
+		alg  Algorithm
+		want string
+	}{
+		{59, SHA1, "94287082"},
+		{59, SHA256, "46119246"},
+		{59, SHA512, "90693936"},
+		{1111111109, SHA1, "07081804"},
+		{1111111109, SHA256, "68084774"},
+		{1111111109, SHA512, "25091201"},
+		{1111111111, SHA1, "14050471"},
+		{1111111111, SHA256, "67062674"},
+		{1111111111, SHA512, "99943326"},
+		{1234567890, SHA1, "89005924"},
+		{1234567890, SHA256, "91819424"},
+		{1234567890, SHA512, "93441116"},
+		{2000000000, SHA1, "69279037"},
+		{2000000000, SHA256, "90698825"},
+		{2000000000, SHA512, "38618901"},
+		{20000000000, SHA1, "65353130"},
+		{20000000000, SHA256, "77737706"},
+		{20000000000, SHA512, "47863826"},
+	}
+	for _, tt := range tests {
+		cfg := Config{Digits: 8, Period: 30 * time.Second, Algorithm: tt.alg}
+		if got := cfg.Code(seeds[tt.alg], time.Unix(tt.unix, 0)); got != tt.want {
+			t.Errorf("%s at %d = %s, want %s", tt.alg, tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	key := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+	step := Default.Step(now)
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current period", now, step, true},
+		{"previous period", now.Add(-30 * time.Second), step - 1, true},
+		{"next period", now.Add(30 * time.Second), step + 1, true},
+		{"too old", now.Add(-60 * time.Second), 0, false},
+		{"too new", now.Add(60 * time.Second), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := Default.Code(key, tt.at)
+			got, ok := Default.Validate(key, code, now)
+			if ok != tt.wantOK || got != tt.wantStep {
+				t.Fatalf("Validate = %d, %v; want %d, %v", got, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+
+	code := Default.Code(key, now)
+	if _, ok := Default.Validate(key, code[:3]+" "+code[3:], now); !ok {
+		t.Fatalf("spaces inside the code should be ignored")
+	}
+	if _, ok := Default.Validate(key, code[:5], now); ok {
+		t.Fatalf("short code accepted")
+	}
+	if _, ok := Default.Validate([]byte("another key entirely"), code, now); ok {
+		t.Fatalf("code accepted for the wrong key")
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	if len(secret) != 32 || strings.Contains(secret, "=") {
+		t.Fatalf("want 32 base32 characters without padding, got %q", secret)
+	}
+	other, _ := GenerateSecret()
+	if other == secret {
+		t.Fatalf("two secrets were the same")
+	}
+
+	key, err := DecodeSecret(strings.ToLower(secret[:4]) + " " + secret[4:])
+	if err != nil || len(key) != SecretSize {
+		t.Fatalf("DecodeSecret = %d bytes, %v", len(key), err)
+	}
+	if _, err := DecodeSecret("not base32!"); err != ErrInvalidSecret {
+		t.Fatalf("want ErrInvalidSecret, got %v", err)
+	}
+	if _, err := DecodeSecret(""); err != ErrInvalidSecret {
+		t.Fatalf("empty secret: want ErrInvalidSecret, got %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := Default.URI("Optio", "sam@example.com", "JBSWY3DPEHPK3PXP")
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("parse %q: %v", uri, err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Optio:sam@example.com" {
+		t.Fatalf("unexpected URI %q", uri)
+	}
+	q := u.Query()
+	want := map[string]string{
+		"secret":    "JBSWY3DPEHPK3PXP",
+		"issuer":    "Optio",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Package useragent turns User-Agent headers into short descriptions people
+// can recognise their devices by, such as "Firefox on Windows".
+package useragent
+
+import "strings"
+
+// Unknown is what Describe returns for empty or unrecognised user agents.
+const Unknown = "Unknown device"
+
+type rule struct {
+	token string
+	name  string
+}
+
+// Order matters: many browsers also claim to be the ones they are built on,
+// so Edge and Opera must be checked before Chrome, and Chrome before Safari.
+var browsers = []rule{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+}
+
+// iPhone and iPad come before Mac OS X, which iOS user agents also mention,
+// and Android before Linux.
+var systems = []rule{
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"CrOS", "ChromeOS"},
+	{"Macintosh", "macOS"},
+	{"Mac OS X", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// clients are non-browser user agents, recognised by their prefix.
+var clients = []rule{
+	{"curl/", "curl"},
+	{"Wget/", "Wget"},
+	{"PostmanRuntime/", "Postman"},
+	{"okhttp/", "Android app"},
+	{"Go-http-client/", "Go HTTP client"},
+	{"python-requests/", "Python requests"},
+}
+
+// Describe names the browser and operating system in a User-Agent header.
+// When only one of them is recognised it is returned alone.
+func Describe(ua string) string {
+	ua = strings.TrimSpace(ua)
+	if ua == "" {
+		return Unknown
+	}
+	for _, c := range clients {
+		if strings.HasPrefix(ua, c.token) {
+			return c.name
+		}
+	}
+
+	browser := match(ua, browsers)
+	system := match(ua, systems)
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return Unknown
+	}
+}
+
+func match(ua string, rules []rule) string {
+	for _, r := range rules {
+		if strings.Contains(ua, r.token) {
+			return r.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: ballot.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const countSessionBallots = `-- name: CountSessionBallots :one
+SELECT COUNT(*)
+FROM ballot
+WHERE session_id = $1
+`
+
+func (q *Queries) CountSessionBallots(ctx context.Context, sessionID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countSessionBallots, sessionID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createVote = `-- name: CreateVote :exec
+INSERT INTO vote (ballot_id, item_id, value)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+`
+
+type CreateVoteParams struct {
+	BallotID uuid.UUID
+	ItemID   uuid.UUID
+	Value    int32
+}
+
+func (q *Queries) CreateVote(ctx context.Context, arg CreateVoteParams) error {
+	_, err := q.db.ExecContext(ctx, createVote, arg.BallotID, arg.ItemID, arg.Value)
+	return err
+}
+
+const deleteBallotVotes = `-- name: DeleteBallotVotes :exec
+DELETE FROM vote
+WHERE ballot_id = $1
+`
+
+func (q *Queries) DeleteBallotVotes(ctx context.Context, ballotID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteBallotVotes, ballotID)
+	return err
+}
+
+const listSessionVotes = `-- name: ListSessionVotes :many
+SELECT ballot.user_id, vote.item_id, vote.value
+FROM vote
+JOIN ballot ON ballot.id = vote.ballot_id
+WHERE ballot.session_id = $1
+ORDER BY ballot.user_id, vote.value, vote.item_id
+`
+
+type ListSessionVotesRow struct {
+	UserID uuid.UUID
+	ItemID uuid.UUID
+	Value  int32
+}
+
+func (q *Queries) ListSessionVotes(ctx context.Context, sessionID uuid.UUID) ([]ListSessionVotesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSessionVotes, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSessionVotesRow
+	for rows.Next() {
+		var i ListSessionVotesRow
+		if err := rows.Scan(&i.UserID, &i.ItemID, &i.Value); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertBallot = `-- name: UpsertBallot :one
+INSERT INTO ballot (session_id, user_id)
+VALUES (
+    $1,
+    $2
+)
+ON CONFLICT (session_id, user_id) DO UPDATE SET updated_at = NOW()
+RETURNING id, session_id, user_id, created_at, updated_at
+`
+
+type UpsertBallotParams struct {
+	SessionID uuid.UUID
+	UserID    uuid.UUID
+}
+
+func (q *Queries) UpsertBallot(ctx context.Context, arg UpsertBallotParams) (Ballot, error) {
+	row := q.db.QueryRowContext(ctx, upsertBallot, arg.SessionID, arg.UserID)
+	var i Ballot
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
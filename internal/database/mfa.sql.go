@@ -0,0 +1,307 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: mfa.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const claimMFAChallenge = `-- name: ClaimMFAChallenge :exec
+INSERT INTO mfa_challenge (challenge_id, user_id, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (challenge_id) DO NOTHING
+`
+
+type ClaimMFAChallengeParams struct {
+	ChallengeID uuid.UUID
+	UserID      uuid.UUID
+	ExpiresAt   time.Time
+}
+
+func (q *Queries) ClaimMFAChallenge(ctx context.Context, arg ClaimMFAChallengeParams) error {
+	_, err := q.db.ExecContext(ctx, claimMFAChallenge, arg.ChallengeID, arg.UserID, arg.ExpiresAt)
+	return err
+}
+
+const confirmTOTPEnrollment = `-- name: ConfirmTOTPEnrollment :exec
+UPDATE user_totp
+SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1
+`
+
+type ConfirmTOTPEnrollmentParams struct {
+	UserID       uuid.UUID
+	LastUsedStep sql.NullInt64
+}
+
+func (q *Queries) ConfirmTOTPEnrollment(ctx context.Context, arg ConfirmTOTPEnrollmentParams) error {
+	_, err := q.db.ExecContext(ctx, confirmTOTPEnrollment, arg.UserID, arg.LastUsedStep)
+	return err
+}
+
+const consumeRecoveryCode = `-- name: ConsumeRecoveryCode :execrows
+UPDATE mfa_recovery_code
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+`
+
+type ConsumeRecoveryCodeParams struct {
+	UserID   uuid.UUID
+	CodeHash string
+}
+
+func (q *Queries) ConsumeRecoveryCode(ctx context.Context, arg ConsumeRecoveryCodeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, consumeRecoveryCode, arg.UserID, arg.CodeHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const countUnusedRecoveryCodes = `-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*)
+FROM mfa_recovery_code
+WHERE user_id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) CountUnusedRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUnusedRecoveryCodes, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createRecoveryCode = `-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_code (user_id, code_hash)
+VALUES ($1, $2)
+`
+
+type CreateRecoveryCodeParams struct {
+	UserID   uuid.UUID
+	CodeHash string
+}
+
+func (q *Queries) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error {
+	_, err := q.db.ExecContext(ctx, createRecoveryCode, arg.UserID, arg.CodeHash)
+	return err
+}
+
+const deleteExpiredMFAChallenges = `-- name: DeleteExpiredMFAChallenges :exec
+DELETE FROM mfa_challenge
+WHERE expires_at < NOW() - INTERVAL '5 minutes'
+`
+
+// Kept a little past expiry, as tokens are accepted with some leeway.
+func (q *Queries) DeleteExpiredMFAChallenges(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredMFAChallenges)
+	return err
+}
+
+const deleteRecoveryCodes = `-- name: DeleteRecoveryCodes :exec
+DELETE FROM mfa_recovery_code
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteRecoveryCodes, userID)
+	return err
+}
+
+const deleteUserTOTP = `-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserTOTP(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteUserTOTP, userID)
+	return err
+}
+
+const getMFAChallengeForUpdate = `-- name: GetMFAChallengeForUpdate :one
+SELECT challenge_id, user_id, failed_attempts, spent_at, expires_at, created_at
+FROM mfa_challenge
+WHERE challenge_id = $1 AND user_id = $2
+FOR UPDATE
+`
+
+type GetMFAChallengeForUpdateParams struct {
+	ChallengeID uuid.UUID
+	UserID      uuid.UUID
+}
+
+func (q *Queries) GetMFAChallengeForUpdate(ctx context.Context, arg GetMFAChallengeForUpdateParams) (MfaChallenge, error) {
+	row := q.db.QueryRowContext(ctx, getMFAChallengeForUpdate, arg.ChallengeID, arg.UserID)
+	var i MfaChallenge
+	err := row.Scan(
+		&i.ChallengeID,
+		&i.UserID,
+		&i.FailedAttempts,
+		&i.SpentAt,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getUserTOTP = `-- name: GetUserTOTP :one
+SELECT user_id, secret, confirmed_at, last_used_step, created_at, failed_attempts, locked_until
+FROM user_totp
+WHERE user_id = $1
+`
+
+func (q *Queries) GetUserTOTP(ctx context.Context, userID uuid.UUID) (UserTotp, error) {
+	row := q.db.QueryRowContext(ctx, getUserTOTP, userID)
+	var i UserTotp
+	err := row.Scan(
+		&i.UserID,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const getUserTOTPForUpdate = `-- name: GetUserTOTPForUpdate :one
+SELECT user_id, secret, confirmed_at, last_used_step, created_at, failed_attempts, locked_until
+FROM user_totp
+WHERE user_id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetUserTOTPForUpdate(ctx context.Context, userID uuid.UUID) (UserTotp, error) {
+	row := q.db.QueryRowContext(ctx, getUserTOTPForUpdate, userID)
+	var i UserTotp
+	err := row.Scan(
+		&i.UserID,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const lockTOTP = `-- name: LockTOTP :exec
+UPDATE user_totp
+SET failed_attempts = 0, locked_until = $2
+WHERE user_id = $1
+`
+
+type LockTOTPParams struct {
+	UserID      uuid.UUID
+	LockedUntil sql.NullTime
+}
+
+func (q *Queries) LockTOTP(ctx context.Context, arg LockTOTPParams) error {
+	_, err := q.db.ExecContext(ctx, lockTOTP, arg.UserID, arg.LockedUntil)
+	return err
+}
+
+const recordMFAChallengeFailure = `-- name: RecordMFAChallengeFailure :one
+UPDATE mfa_challenge
+SET failed_attempts = failed_attempts + 1
+WHERE challenge_id = $1
+RETURNING failed_attempts
+`
+
+func (q *Queries) RecordMFAChallengeFailure(ctx context.Context, challengeID uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, recordMFAChallengeFailure, challengeID)
+	var failed_attempts int32
+	err := row.Scan(&failed_attempts)
+	return failed_attempts, err
+}
+
+const recordTOTPFailure = `-- name: RecordTOTPFailure :one
+UPDATE user_totp
+SET failed_attempts = failed_attempts + 1
+WHERE user_id = $1
+RETURNING failed_attempts
+`
+
+func (q *Queries) RecordTOTPFailure(ctx context.Context, userID uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, recordTOTPFailure, userID)
+	var failed_attempts int32
+	err := row.Scan(&failed_attempts)
+	return failed_attempts, err
+}
+
+const resetTOTPFailures = `-- name: ResetTOTPFailures :exec
+UPDATE user_totp
+SET failed_attempts = 0, locked_until = NULL
+WHERE user_id = $1
+`
+
+func (q *Queries) ResetTOTPFailures(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, resetTOTPFailures, userID)
+	return err
+}
+
+const setTOTPLastUsedStep = `-- name: SetTOTPLastUsedStep :exec
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1
+`
+
+type SetTOTPLastUsedStepParams struct {
+	UserID       uuid.UUID
+	LastUsedStep sql.NullInt64
+}
+
+func (q *Queries) SetTOTPLastUsedStep(ctx context.Context, arg SetTOTPLastUsedStepParams) error {
+	_, err := q.db.ExecContext(ctx, setTOTPLastUsedStep, arg.UserID, arg.LastUsedStep)
+	return err
+}
+
+const spendMFAChallenge = `-- name: SpendMFAChallenge :exec
+UPDATE mfa_challenge
+SET spent_at = NOW()
+WHERE challenge_id = $1
+`
+
+func (q *Queries) SpendMFAChallenge(ctx context.Context, challengeID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, spendMFAChallenge, challengeID)
+	return err
+}
+
+const startTOTPEnrollment = `-- name: StartTOTPEnrollment :one
+INSERT INTO user_totp (user_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_used_step = NULL, created_at = NOW()
+WHERE user_totp.confirmed_at IS NULL
+RETURNING user_id, secret, confirmed_at, last_used_step, created_at, failed_attempts, locked_until
+`
+
+type StartTOTPEnrollmentParams struct {
+	UserID uuid.UUID
+	Secret string
+}
+
+// Starts or restarts an enrolment. Nothing happens once two-factor is on;
+// it has to be disabled first.
+func (q *Queries) StartTOTPEnrollment(ctx context.Context, arg StartTOTPEnrollmentParams) (UserTotp, error) {
+	row := q.db.QueryRowContext(ctx, startTOTPEnrollment, arg.UserID, arg.Secret)
+	var i UserTotp
+	err := row.Scan(
+		&i.UserID,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+	)
+	return i, err
+}
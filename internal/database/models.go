@@ -12,25 +12,135 @@ import (
 	"github.com/sqlc-dev/pqtype"
 )
 
-type RefreshToken struct {
+type Ballot struct {
 	ID        uuid.UUID
+	SessionID uuid.UUID
 	UserID    uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type EmailVerificationToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Email     string
 	TokenHash string
-	IssuedAt  time.Time
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+type EventPayload struct {
+	ID        uuid.UUID
+	SessionID uuid.UUID
+	Payload   string
+	CreatedAt time.Time
+}
+
+type MfaChallenge struct {
+	ChallengeID    uuid.UUID
+	UserID         uuid.UUID
+	FailedAttempts int32
+	SpentAt        sql.NullTime
+	ExpiresAt      time.Time
+	CreatedAt      time.Time
+}
+
+type MfaRecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+type OidcLoginState struct {
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	LinkUserID   uuid.NullUUID
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+type PasswordResetToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	TokenHint  string
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+	CreatedAt  time.Time
+}
+
+type RefreshToken struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	TokenHash    string
+	IssuedAt     time.Time
+	ExpiresAt    time.Time
+	RevokedAt    sql.NullTime
+	UserAgent    string
+	Ip           string
+	FamilyID     uuid.UUID
+	ReplacedByID uuid.NullUUID
+	LoginAt      time.Time
+	LastUsedAt   sql.NullTime
+}
+
+type SecurityEvent struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	EventType string
+	FamilyID  uuid.NullUUID
 	UserAgent string
 	Ip        string
+	CreatedAt time.Time
 }
 
 type Session struct {
-	ID            uuid.UUID
-	SessionCode   string
-	SessionName   string
-	CreatorUserID uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Status        sql.NullString
+	ID              uuid.UUID
+	SessionCode     string
+	SessionName     string
+	CreatorUserID   uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Status          string
+	VotingMethod    string
+	Mode            string
+	MatchThreshold  sql.NullInt32
+	WinningItemID   uuid.NullUUID
+	DecidedAt       sql.NullTime
+	CollectUntil    sql.NullTime
+	VoteUntil       sql.NullTime
+	OpenJoin        bool
+	RequireVerified bool
+}
+
+type SessionInvite struct {
+	ID              uuid.UUID
+	SessionID       uuid.UUID
+	TokenHash       string
+	Role            string
+	MaxUses         sql.NullInt32
+	UseCount        int32
+	ExpiresAt       sql.NullTime
+	RevokedAt       sql.NullTime
+	CreatedByUserID uuid.NullUUID
+	CreatedAt       time.Time
 }
 
 type SessionItem struct {
@@ -52,15 +162,62 @@ type SessionParticipant struct {
 	SessionID uuid.UUID
 	JoinedAt  time.Time
 	Status    sql.NullString
+	Role      string
+}
+
+type SessionStatusHistory struct {
+	ID              int64
+	SessionID       uuid.UUID
+	FromStatus      string
+	ToStatus        string
+	ChangedByUserID uuid.NullUUID
+	ChangedAt       time.Time
+}
+
+type Swipe struct {
+	SessionID uuid.UUID
+	ItemID    uuid.UUID
+	UserID    uuid.UUID
+	Liked     bool
+	CreatedAt time.Time
 }
 
 type User struct {
 	ID                uuid.UUID
 	Username          string
-	Email             string
-	PasswordHash      string
+	Email             sql.NullString
+	PasswordHash      sql.NullString
 	PasswordChangedAt sql.NullTime
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
 	DeletedAt         sql.NullTime
+	IsGuest           bool
+	EmailVerifiedAt   sql.NullTime
+	TokenVersion      int32
+}
+
+type UserIdentity struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Provider    string
+	Subject     string
+	Email       sql.NullString
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+type UserTotp struct {
+	UserID         uuid.UUID
+	Secret         string
+	ConfirmedAt    sql.NullTime
+	LastUsedStep   sql.NullInt64
+	CreatedAt      time.Time
+	FailedAttempts int32
+	LockedUntil    sql.NullTime
+}
+
+type Vote struct {
+	BallotID uuid.UUID
+	ItemID   uuid.UUID
+	Value    int32
 }
@@ -14,38 +14,34 @@ import (
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_token(user_id, token_hash, issued_at, expires_at, user_agent, ip)
+INSERT INTO refresh_token(user_id, token_hash, issued_at, expires_at, user_agent, ip, family_id, login_at, last_used_at)
 VALUES(
      $1,
      $2,
      $3,
      $4,
      $5,
-     $6
+     $6,
+     $7,
+     $8,
+     $9
 )
-RETURNING user_id, token_hash, issued_at, expires_at, revoked_at, user_agent, ip
+RETURNING id, user_id, token_hash, issued_at, expires_at, revoked_at, user_agent, ip, family_id, replaced_by_id, login_at, last_used_at
 `
 
 type CreateRefreshTokenParams struct {
-	UserID    uuid.UUID
-	TokenHash string
-	IssuedAt  time.Time
-	ExpiresAt time.Time
-	UserAgent string
-	Ip        string
+	UserID     uuid.UUID
+	TokenHash  string
+	IssuedAt   time.Time
+	ExpiresAt  time.Time
+	UserAgent  string
+	Ip         string
+	FamilyID   uuid.UUID
+	LoginAt    time.Time
+	LastUsedAt sql.NullTime
 }
 
-type CreateRefreshTokenRow struct {
-	UserID    uuid.UUID
-	TokenHash string
-	IssuedAt  time.Time
-	ExpiresAt time.Time
-	RevokedAt sql.NullTime
-	UserAgent string
-	Ip        string
-}
-
-func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (CreateRefreshTokenRow, error) {
+func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
 	row := q.db.QueryRowContext(ctx, createRefreshToken,
 		arg.UserID,
 		arg.TokenHash,
@@ -53,9 +49,13 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 		arg.ExpiresAt,
 		arg.UserAgent,
 		arg.Ip,
+		arg.FamilyID,
+		arg.LoginAt,
+		arg.LastUsedAt,
 	)
-	var i CreateRefreshTokenRow
+	var i RefreshToken
 	err := row.Scan(
+		&i.ID,
 		&i.UserID,
 		&i.TokenHash,
 		&i.IssuedAt,
@@ -63,6 +63,10 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 		&i.RevokedAt,
 		&i.UserAgent,
 		&i.Ip,
+		&i.FamilyID,
+		&i.ReplacedByID,
+		&i.LoginAt,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
@@ -78,7 +82,7 @@ func (q *Queries) DeleteExpiredRefreshTokens(ctx context.Context) error {
 }
 
 const getActiveRefreshTokenByHash = `-- name: GetActiveRefreshTokenByHash :one
-SELECT id, user_id, token_hash, issued_at, expires_at, revoked_at, user_agent, ip
+SELECT id, user_id, token_hash, issued_at, expires_at, revoked_at, user_agent, ip, family_id, replaced_by_id, login_at, last_used_at
 FROM refresh_token
 WHERE token_hash = $1
 AND revoked_at IS NULL
@@ -97,12 +101,16 @@ func (q *Queries) GetActiveRefreshTokenByHash(ctx context.Context, tokenHash str
 		&i.RevokedAt,
 		&i.UserAgent,
 		&i.Ip,
+		&i.FamilyID,
+		&i.ReplacedByID,
+		&i.LoginAt,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
 
 const getRefreshTokenByHash = `-- name: GetRefreshTokenByHash :one
-SELECT id, user_id, token_hash, issued_at, expires_at, revoked_at, user_agent, ip
+SELECT id, user_id, token_hash, issued_at, expires_at, revoked_at, user_agent, ip, family_id, replaced_by_id, login_at, last_used_at
 FROM refresh_token
 WHERE token_hash = $1
 `
@@ -119,24 +127,58 @@ func (q *Queries) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (
 		&i.RevokedAt,
 		&i.UserAgent,
 		&i.Ip,
+		&i.FamilyID,
+		&i.ReplacedByID,
+		&i.LoginAt,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const getRefreshTokenByHashForUpdate = `-- name: GetRefreshTokenByHashForUpdate :one
+SELECT id, user_id, token_hash, issued_at, expires_at, revoked_at, user_agent, ip, family_id, replaced_by_id, login_at, last_used_at
+FROM refresh_token
+WHERE token_hash = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetRefreshTokenByHashForUpdate(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshTokenByHashForUpdate, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TokenHash,
+		&i.IssuedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.UserAgent,
+		&i.Ip,
+		&i.FamilyID,
+		&i.ReplacedByID,
+		&i.LoginAt,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
 
 const listActiveTokensForUser = `-- name: ListActiveTokensForUser :many
-SELECT id, user_id, issued_at, expires_at, user_agent, ip
+SELECT id, user_id, issued_at, expires_at, user_agent, ip, family_id, login_at, last_used_at
 FROM refresh_token
 WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
-ORDER BY issued_at DESC
+ORDER BY COALESCE(last_used_at, login_at) DESC
 `
 
 type ListActiveTokensForUserRow struct {
-	ID        uuid.UUID
-	UserID    uuid.UUID
-	IssuedAt  time.Time
-	ExpiresAt time.Time
-	UserAgent string
-	Ip        string
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	IssuedAt   time.Time
+	ExpiresAt  time.Time
+	UserAgent  string
+	Ip         string
+	FamilyID   uuid.UUID
+	LoginAt    time.Time
+	LastUsedAt sql.NullTime
 }
 
 func (q *Queries) ListActiveTokensForUser(ctx context.Context, userID uuid.UUID) ([]ListActiveTokensForUserRow, error) {
@@ -155,6 +197,9 @@ func (q *Queries) ListActiveTokensForUser(ctx context.Context, userID uuid.UUID)
 			&i.ExpiresAt,
 			&i.UserAgent,
 			&i.Ip,
+			&i.FamilyID,
+			&i.LoginAt,
+			&i.LastUsedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -169,6 +214,22 @@ func (q *Queries) ListActiveTokensForUser(ctx context.Context, userID uuid.UUID)
 	return items, nil
 }
 
+const replaceRefreshToken = `-- name: ReplaceRefreshToken :exec
+UPDATE refresh_token
+SET revoked_at = NOW(), replaced_by_id = $2
+WHERE id = $1 AND revoked_at IS NULL
+`
+
+type ReplaceRefreshTokenParams struct {
+	ID           uuid.UUID
+	ReplacedByID uuid.NullUUID
+}
+
+func (q *Queries) ReplaceRefreshToken(ctx context.Context, arg ReplaceRefreshTokenParams) error {
+	_, err := q.db.ExecContext(ctx, replaceRefreshToken, arg.ID, arg.ReplacedByID)
+	return err
+}
+
 const revokeAllRefreshTokensForUser = `-- name: RevokeAllRefreshTokensForUser :exec
 UPDATE refresh_token
 SET revoked_at = NOW()
@@ -190,3 +251,36 @@ func (q *Queries) RevokeRefreshTokenByID(ctx context.Context, id uuid.UUID) erro
 	_, err := q.db.ExecContext(ctx, revokeRefreshTokenByID, id)
 	return err
 }
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_token
+SET revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeUserRefreshTokenFamily = `-- name: RevokeUserRefreshTokenFamily :execrows
+UPDATE refresh_token
+SET revoked_at = NOW()
+WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeUserRefreshTokenFamilyParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeUserRefreshTokenFamily(ctx context.Context, arg RevokeUserRefreshTokenFamilyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeUserRefreshTokenFamily, arg.UserID, arg.FamilyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
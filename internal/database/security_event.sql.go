@@ -0,0 +1,90 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: security_event.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createSecurityEvent = `-- name: CreateSecurityEvent :one
+INSERT INTO security_event (user_id, event_type, family_id, user_agent, ip)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, user_id, event_type, family_id, user_agent, ip, created_at
+`
+
+type CreateSecurityEventParams struct {
+	UserID    uuid.UUID
+	EventType string
+	FamilyID  uuid.NullUUID
+	UserAgent string
+	Ip        string
+}
+
+func (q *Queries) CreateSecurityEvent(ctx context.Context, arg CreateSecurityEventParams) (SecurityEvent, error) {
+	row := q.db.QueryRowContext(ctx, createSecurityEvent,
+		arg.UserID,
+		arg.EventType,
+		arg.FamilyID,
+		arg.UserAgent,
+		arg.Ip,
+	)
+	var i SecurityEvent
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.EventType,
+		&i.FamilyID,
+		&i.UserAgent,
+		&i.Ip,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listSecurityEventsForUser = `-- name: ListSecurityEventsForUser :many
+SELECT id, user_id, event_type, family_id, user_agent, ip, created_at FROM security_event
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2
+`
+
+type ListSecurityEventsForUserParams struct {
+	UserID uuid.UUID
+	Limit  int32
+}
+
+func (q *Queries) ListSecurityEventsForUser(ctx context.Context, arg ListSecurityEventsForUserParams) ([]SecurityEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listSecurityEventsForUser, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SecurityEvent
+	for rows.Next() {
+		var i SecurityEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.EventType,
+			&i.FamilyID,
+			&i.UserAgent,
+			&i.Ip,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
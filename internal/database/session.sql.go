@@ -8,28 +8,99 @@ package database
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const claimDueSession = `-- name: ClaimDueSession :one
+SELECT id, session_code, session_name, creator_user_id, created_at, updated_at, status, voting_method, mode, match_threshold, winning_item_id, decided_at, collect_until, vote_until, open_join, require_verified
+FROM session
+WHERE ((status IN ('pending', 'collecting') AND collect_until <= $1::timestamptz)
+   OR (status = 'voting' AND vote_until <= $1::timestamptz))
+  AND NOT (id = ANY(COALESCE($2::uuid[], '{}')))
+LIMIT 1
+FOR UPDATE SKIP LOCKED
+`
+
+type ClaimDueSessionParams struct {
+	Now  time.Time
+	Skip []uuid.UUID
+}
+
+// Locks one session whose deadline has passed. Rows another replica holds
+// are skipped rather than waited on, as are the sessions listed in skip.
+func (q *Queries) ClaimDueSession(ctx context.Context, arg ClaimDueSessionParams) (Session, error) {
+	row := q.db.QueryRowContext(ctx, claimDueSession, arg.Now, pq.Array(arg.Skip))
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.SessionCode,
+		&i.SessionName,
+		&i.CreatorUserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.VotingMethod,
+		&i.Mode,
+		&i.MatchThreshold,
+		&i.WinningItemID,
+		&i.DecidedAt,
+		&i.CollectUntil,
+		&i.VoteUntil,
+		&i.OpenJoin,
+		&i.RequireVerified,
+	)
+	return i, err
+}
+
 const createSession = `-- name: CreateSession :one
-INSERT INTO session (session_code, session_name, creator_user_id)
+INSERT INTO session (session_code, session_name, creator_user_id, voting_method, mode, match_threshold, collect_until, vote_until, open_join, require_verified)
 VALUES (
     $1,
     $2,
-    $3
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10
 )
-RETURNING id, session_code, session_name, creator_user_id, created_at, updated_at, status
+ON CONFLICT (lower(session_code)) WHERE status <> 'archived' DO NOTHING
+RETURNING id, session_code, session_name, creator_user_id, created_at, updated_at, status, voting_method, mode, match_threshold, winning_item_id, decided_at, collect_until, vote_until, open_join, require_verified
 `
 
 type CreateSessionParams struct {
-	SessionCode   string
-	SessionName   string
-	CreatorUserID uuid.UUID
+	SessionCode     string
+	SessionName     string
+	CreatorUserID   uuid.UUID
+	VotingMethod    string
+	Mode            string
+	MatchThreshold  sql.NullInt32
+	CollectUntil    sql.NullTime
+	VoteUntil       sql.NullTime
+	OpenJoin        bool
+	RequireVerified bool
 }
 
+// A code still in use by a live session makes this return no rows, and the
+// caller tries another.
 func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error) {
-	row := q.db.QueryRowContext(ctx, createSession, arg.SessionCode, arg.SessionName, arg.CreatorUserID)
+	row := q.db.QueryRowContext(ctx, createSession,
+		arg.SessionCode,
+		arg.SessionName,
+		arg.CreatorUserID,
+		arg.VotingMethod,
+		arg.Mode,
+		arg.MatchThreshold,
+		arg.CollectUntil,
+		arg.VoteUntil,
+		arg.OpenJoin,
+		arg.RequireVerified,
+	)
 	var i Session
 	err := row.Scan(
 		&i.ID,
@@ -39,6 +110,15 @@ func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (S
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Status,
+		&i.VotingMethod,
+		&i.Mode,
+		&i.MatchThreshold,
+		&i.WinningItemID,
+		&i.DecidedAt,
+		&i.CollectUntil,
+		&i.VoteUntil,
+		&i.OpenJoin,
+		&i.RequireVerified,
 	)
 	return i, err
 }
@@ -54,13 +134,13 @@ func (q *Queries) DeleteSession(ctx context.Context, id uuid.UUID) error {
 }
 
 const getActiveSessionByCode = `-- name: GetActiveSessionByCode :one
-SELECT id, session_code, session_name, creator_user_id, created_at, updated_at, status 
+SELECT id, session_code, session_name, creator_user_id, created_at, updated_at, status, voting_method, mode, match_threshold, winning_item_id, decided_at, collect_until, vote_until, open_join, require_verified 
 FROM session
-WHERE session_code = $1
+WHERE lower(session_code) = lower($1) AND status <> 'archived'
 `
 
-func (q *Queries) GetActiveSessionByCode(ctx context.Context, sessionCode string) (Session, error) {
-	row := q.db.QueryRowContext(ctx, getActiveSessionByCode, sessionCode)
+func (q *Queries) GetActiveSessionByCode(ctx context.Context, code string) (Session, error) {
+	row := q.db.QueryRowContext(ctx, getActiveSessionByCode, code)
 	var i Session
 	err := row.Scan(
 		&i.ID,
@@ -70,12 +150,21 @@ func (q *Queries) GetActiveSessionByCode(ctx context.Context, sessionCode string
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Status,
+		&i.VotingMethod,
+		&i.Mode,
+		&i.MatchThreshold,
+		&i.WinningItemID,
+		&i.DecidedAt,
+		&i.CollectUntil,
+		&i.VoteUntil,
+		&i.OpenJoin,
+		&i.RequireVerified,
 	)
 	return i, err
 }
 
 const getActiveSessionByID = `-- name: GetActiveSessionByID :one
-SELECT id, session_code, session_name, creator_user_id, created_at, updated_at, status 
+SELECT id, session_code, session_name, creator_user_id, created_at, updated_at, status, voting_method, mode, match_threshold, winning_item_id, decided_at, collect_until, vote_until, open_join, require_verified 
 FROM session
 WHERE id = $1
 `
@@ -91,12 +180,21 @@ func (q *Queries) GetActiveSessionByID(ctx context.Context, id uuid.UUID) (Sessi
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Status,
+		&i.VotingMethod,
+		&i.Mode,
+		&i.MatchThreshold,
+		&i.WinningItemID,
+		&i.DecidedAt,
+		&i.CollectUntil,
+		&i.VoteUntil,
+		&i.OpenJoin,
+		&i.RequireVerified,
 	)
 	return i, err
 }
 
 const getUserSessions = `-- name: GetUserSessions :many
-SELECT id, session_code, session_name, creator_user_id, created_at, updated_at, status
+SELECT id, session_code, session_name, creator_user_id, created_at, updated_at, status, voting_method, mode, match_threshold, winning_item_id, decided_at, collect_until, vote_until, open_join, require_verified
 FROM session
 WHERE creator_user_id = $1
 ORDER BY created_at DESC, id DESC
@@ -126,6 +224,15 @@ func (q *Queries) GetUserSessions(ctx context.Context, arg GetUserSessionsParams
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Status,
+			&i.VotingMethod,
+			&i.Mode,
+			&i.MatchThreshold,
+			&i.WinningItemID,
+			&i.DecidedAt,
+			&i.CollectUntil,
+			&i.VoteUntil,
+			&i.OpenJoin,
+			&i.RequireVerified,
 		); err != nil {
 			return nil, err
 		}
@@ -140,6 +247,79 @@ func (q *Queries) GetUserSessions(ctx context.Context, arg GetUserSessionsParams
 	return items, nil
 }
 
+const recordSessionDecision = `-- name: RecordSessionDecision :one
+UPDATE session
+SET status = 'decided', winning_item_id = $2, decided_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'voting'
+RETURNING id, session_code, session_name, creator_user_id, created_at, updated_at, status, voting_method, mode, match_threshold, winning_item_id, decided_at, collect_until, vote_until, open_join, require_verified
+`
+
+type RecordSessionDecisionParams struct {
+	ID            uuid.UUID
+	WinningItemID uuid.NullUUID
+}
+
+func (q *Queries) RecordSessionDecision(ctx context.Context, arg RecordSessionDecisionParams) (Session, error) {
+	row := q.db.QueryRowContext(ctx, recordSessionDecision, arg.ID, arg.WinningItemID)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.SessionCode,
+		&i.SessionName,
+		&i.CreatorUserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.VotingMethod,
+		&i.Mode,
+		&i.MatchThreshold,
+		&i.WinningItemID,
+		&i.DecidedAt,
+		&i.CollectUntil,
+		&i.VoteUntil,
+		&i.OpenJoin,
+		&i.RequireVerified,
+	)
+	return i, err
+}
+
+const transitionSessionStatus = `-- name: TransitionSessionStatus :one
+UPDATE session
+SET status = $1, updated_at = NOW()
+WHERE id = $2 AND status = $3
+RETURNING id, session_code, session_name, creator_user_id, created_at, updated_at, status, voting_method, mode, match_threshold, winning_item_id, decided_at, collect_until, vote_until, open_join, require_verified
+`
+
+type TransitionSessionStatusParams struct {
+	ToStatus   string
+	ID         uuid.UUID
+	FromStatus string
+}
+
+func (q *Queries) TransitionSessionStatus(ctx context.Context, arg TransitionSessionStatusParams) (Session, error) {
+	row := q.db.QueryRowContext(ctx, transitionSessionStatus, arg.ToStatus, arg.ID, arg.FromStatus)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.SessionCode,
+		&i.SessionName,
+		&i.CreatorUserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.VotingMethod,
+		&i.Mode,
+		&i.MatchThreshold,
+		&i.WinningItemID,
+		&i.DecidedAt,
+		&i.CollectUntil,
+		&i.VoteUntil,
+		&i.OpenJoin,
+		&i.RequireVerified,
+	)
+	return i, err
+}
+
 const updateSessionName = `-- name: UpdateSessionName :exec
 UPDATE session
 SET session_name = $2, updated_at = NOW()
@@ -156,18 +336,53 @@ func (q *Queries) UpdateSessionName(ctx context.Context, arg UpdateSessionNamePa
 	return err
 }
 
-const updateSessionStatus = `-- name: UpdateSessionStatus :exec
+const updateSessionSettings = `-- name: UpdateSessionSettings :one
 UPDATE session
-SET status = $2, updated_at = NOW()
+SET session_name = $2, voting_method = $3, match_threshold = $4, collect_until = $5, vote_until = $6, open_join = $7, require_verified = $8, updated_at = NOW()
 WHERE id = $1
+RETURNING id, session_code, session_name, creator_user_id, created_at, updated_at, status, voting_method, mode, match_threshold, winning_item_id, decided_at, collect_until, vote_until, open_join, require_verified
 `
 
-type UpdateSessionStatusParams struct {
-	ID     uuid.UUID
-	Status sql.NullString
+type UpdateSessionSettingsParams struct {
+	ID              uuid.UUID
+	SessionName     string
+	VotingMethod    string
+	MatchThreshold  sql.NullInt32
+	CollectUntil    sql.NullTime
+	VoteUntil       sql.NullTime
+	OpenJoin        bool
+	RequireVerified bool
 }
 
-func (q *Queries) UpdateSessionStatus(ctx context.Context, arg UpdateSessionStatusParams) error {
-	_, err := q.db.ExecContext(ctx, updateSessionStatus, arg.ID, arg.Status)
-	return err
+func (q *Queries) UpdateSessionSettings(ctx context.Context, arg UpdateSessionSettingsParams) (Session, error) {
+	row := q.db.QueryRowContext(ctx, updateSessionSettings,
+		arg.ID,
+		arg.SessionName,
+		arg.VotingMethod,
+		arg.MatchThreshold,
+		arg.CollectUntil,
+		arg.VoteUntil,
+		arg.OpenJoin,
+		arg.RequireVerified,
+	)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.SessionCode,
+		&i.SessionName,
+		&i.CreatorUserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.VotingMethod,
+		&i.Mode,
+		&i.MatchThreshold,
+		&i.WinningItemID,
+		&i.DecidedAt,
+		&i.CollectUntil,
+		&i.VoteUntil,
+		&i.OpenJoin,
+		&i.RequireVerified,
+	)
+	return i, err
 }
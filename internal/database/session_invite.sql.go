@@ -0,0 +1,185 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: session_invite.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+const consumeSessionInvite = `-- name: ConsumeSessionInvite :one
+UPDATE session_invite
+SET use_count = use_count + 1
+WHERE id = $1
+  AND revoked_at IS NULL
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND (max_uses IS NULL OR use_count < max_uses)
+RETURNING id, session_id, token_hash, role, max_uses, use_count, expires_at, revoked_at, created_by_user_id, created_at
+`
+
+// Takes one use from the invite, but only while it is still valid, so two
+// people racing for the last use cannot both get in.
+func (q *Queries) ConsumeSessionInvite(ctx context.Context, id uuid.UUID) (SessionInvite, error) {
+	row := q.db.QueryRowContext(ctx, consumeSessionInvite, id)
+	var i SessionInvite
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.TokenHash,
+		&i.Role,
+		&i.MaxUses,
+		&i.UseCount,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.CreatedByUserID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createSessionInvite = `-- name: CreateSessionInvite :one
+INSERT INTO session_invite (session_id, token_hash, role, max_uses, expires_at, created_by_user_id)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING id, session_id, token_hash, role, max_uses, use_count, expires_at, revoked_at, created_by_user_id, created_at
+`
+
+type CreateSessionInviteParams struct {
+	SessionID       uuid.UUID
+	TokenHash       string
+	Role            string
+	MaxUses         sql.NullInt32
+	ExpiresAt       sql.NullTime
+	CreatedByUserID uuid.NullUUID
+}
+
+func (q *Queries) CreateSessionInvite(ctx context.Context, arg CreateSessionInviteParams) (SessionInvite, error) {
+	row := q.db.QueryRowContext(ctx, createSessionInvite,
+		arg.SessionID,
+		arg.TokenHash,
+		arg.Role,
+		arg.MaxUses,
+		arg.ExpiresAt,
+		arg.CreatedByUserID,
+	)
+	var i SessionInvite
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.TokenHash,
+		&i.Role,
+		&i.MaxUses,
+		&i.UseCount,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.CreatedByUserID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getSessionInviteByHash = `-- name: GetSessionInviteByHash :one
+SELECT id, session_id, token_hash, role, max_uses, use_count, expires_at, revoked_at, created_by_user_id, created_at
+FROM session_invite
+WHERE token_hash = $1
+`
+
+func (q *Queries) GetSessionInviteByHash(ctx context.Context, tokenHash string) (SessionInvite, error) {
+	row := q.db.QueryRowContext(ctx, getSessionInviteByHash, tokenHash)
+	var i SessionInvite
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.TokenHash,
+		&i.Role,
+		&i.MaxUses,
+		&i.UseCount,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.CreatedByUserID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listSessionInvites = `-- name: ListSessionInvites :many
+SELECT id, session_id, token_hash, role, max_uses, use_count, expires_at, revoked_at, created_by_user_id, created_at
+FROM session_invite
+WHERE session_id = $1
+ORDER BY created_at DESC, id DESC
+`
+
+func (q *Queries) ListSessionInvites(ctx context.Context, sessionID uuid.UUID) ([]SessionInvite, error) {
+	rows, err := q.db.QueryContext(ctx, listSessionInvites, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SessionInvite
+	for rows.Next() {
+		var i SessionInvite
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.TokenHash,
+			&i.Role,
+			&i.MaxUses,
+			&i.UseCount,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.CreatedByUserID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeSessionInvite = `-- name: RevokeSessionInvite :one
+UPDATE session_invite
+SET revoked_at = NOW()
+WHERE id = $1 AND session_id = $2 AND revoked_at IS NULL
+RETURNING id, session_id, token_hash, role, max_uses, use_count, expires_at, revoked_at, created_by_user_id, created_at
+`
+
+type RevokeSessionInviteParams struct {
+	ID        uuid.UUID
+	SessionID uuid.UUID
+}
+
+func (q *Queries) RevokeSessionInvite(ctx context.Context, arg RevokeSessionInviteParams) (SessionInvite, error) {
+	row := q.db.QueryRowContext(ctx, revokeSessionInvite, arg.ID, arg.SessionID)
+	var i SessionInvite
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.TokenHash,
+		&i.Role,
+		&i.MaxUses,
+		&i.UseCount,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.CreatedByUserID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
@@ -13,6 +13,19 @@ import (
 	"github.com/sqlc-dev/pqtype"
 )
 
+const countSessionItems = `-- name: CountSessionItems :one
+SELECT COUNT(*)
+FROM session_item
+WHERE session_id = $1
+`
+
+func (q *Queries) CountSessionItems(ctx context.Context, sessionID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countSessionItems, sessionID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createSessionItem = `-- name: CreateSessionItem :one
 INSERT INTO session_item (
     session_id, 
@@ -111,6 +124,79 @@ func (q *Queries) GetSessionItemByID(ctx context.Context, id uuid.UUID) (Session
 	return i, err
 }
 
+const getSessionItemBySource = `-- name: GetSessionItemBySource :one
+SELECT id, session_id, item_title, item_description, image_url, source_type, source_id, metadata, created_at, updated_at, added_by_user_id
+FROM session_item
+WHERE session_id = $1 AND source_type = $2 AND source_id = $3
+`
+
+type GetSessionItemBySourceParams struct {
+	SessionID  uuid.UUID
+	SourceType string
+	SourceID   sql.NullString
+}
+
+func (q *Queries) GetSessionItemBySource(ctx context.Context, arg GetSessionItemBySourceParams) (SessionItem, error) {
+	row := q.db.QueryRowContext(ctx, getSessionItemBySource, arg.SessionID, arg.SourceType, arg.SourceID)
+	var i SessionItem
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.ItemTitle,
+		&i.ItemDescription,
+		&i.ImageUrl,
+		&i.SourceType,
+		&i.SourceID,
+		&i.Metadata,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.AddedByUserID,
+	)
+	return i, err
+}
+
+const listAllSessionItems = `-- name: ListAllSessionItems :many
+SELECT id, session_id, item_title, item_description, image_url, source_type, source_id, metadata, created_at, updated_at, added_by_user_id
+FROM session_item
+WHERE session_id = $1
+ORDER BY created_at ASC, id ASC
+`
+
+func (q *Queries) ListAllSessionItems(ctx context.Context, sessionID uuid.UUID) ([]SessionItem, error) {
+	rows, err := q.db.QueryContext(ctx, listAllSessionItems, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SessionItem
+	for rows.Next() {
+		var i SessionItem
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.ItemTitle,
+			&i.ItemDescription,
+			&i.ImageUrl,
+			&i.SourceType,
+			&i.SourceID,
+			&i.Metadata,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.AddedByUserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listSessionItems = `-- name: ListSessionItems :many
 SELECT id, session_id, item_title, item_description, image_url, source_type, source_id, metadata, created_at, updated_at, added_by_user_id
 FROM session_item
@@ -160,6 +246,28 @@ func (q *Queries) ListSessionItems(ctx context.Context, arg ListSessionItemsPara
 	return items, nil
 }
 
+const sessionItemTitleExists = `-- name: SessionItemTitleExists :one
+SELECT EXISTS (
+    SELECT 1
+    FROM session_item
+    WHERE session_id = $1 AND source_type = 'custom' AND LOWER(item_title) = LOWER($2::text) AND id <> $3
+)
+`
+
+type SessionItemTitleExistsParams struct {
+	SessionID uuid.UUID
+	ItemTitle string
+	ExcludeID uuid.UUID
+}
+
+// Only custom items are unique by title; items from a source may share one.
+func (q *Queries) SessionItemTitleExists(ctx context.Context, arg SessionItemTitleExistsParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, sessionItemTitleExists, arg.SessionID, arg.ItemTitle, arg.ExcludeID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
 const updateItemDescription = `-- name: UpdateItemDescription :exec
 UPDATE session_item
 SET item_description = $2, updated_at = NOW()
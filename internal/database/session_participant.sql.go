@@ -7,32 +7,44 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
 const createSessionParticipant = `-- name: CreateSessionParticipant :one
-INSERT INTO session_participant (user_id, session_id)
+INSERT INTO session_participant (user_id, session_id, status, role)
 VALUES(
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
-RETURNING user_id, session_id, joined_at, status
+ON CONFLICT (user_id, session_id) DO NOTHING
+RETURNING user_id, session_id, joined_at, status, role
 `
 
 type CreateSessionParticipantParams struct {
 	UserID    uuid.UUID
 	SessionID uuid.UUID
+	Status    sql.NullString
+	Role      string
 }
 
 func (q *Queries) CreateSessionParticipant(ctx context.Context, arg CreateSessionParticipantParams) (SessionParticipant, error) {
-	row := q.db.QueryRowContext(ctx, createSessionParticipant, arg.UserID, arg.SessionID)
+	row := q.db.QueryRowContext(ctx, createSessionParticipant,
+		arg.UserID,
+		arg.SessionID,
+		arg.Status,
+		arg.Role,
+	)
 	var i SessionParticipant
 	err := row.Scan(
 		&i.UserID,
 		&i.SessionID,
 		&i.JoinedAt,
 		&i.Status,
+		&i.Role,
 	)
 	return i, err
 }
@@ -53,7 +65,7 @@ func (q *Queries) DeleteSessionParticipant(ctx context.Context, arg DeleteSessio
 }
 
 const getAllSessionParticipants = `-- name: GetAllSessionParticipants :many
-SELECT user_id, session_id, joined_at, status
+SELECT user_id, session_id, joined_at, status, role
 FROM session_participant
 WHERE session_id = $1
 ORDER BY joined_at DESC
@@ -80,6 +92,7 @@ func (q *Queries) GetAllSessionParticipants(ctx context.Context, arg GetAllSessi
 			&i.SessionID,
 			&i.JoinedAt,
 			&i.Status,
+			&i.Role,
 		); err != nil {
 			return nil, err
 		}
@@ -95,7 +108,7 @@ func (q *Queries) GetAllSessionParticipants(ctx context.Context, arg GetAllSessi
 }
 
 const getSessionParticipant = `-- name: GetSessionParticipant :one
-SELECT user_id, session_id, joined_at, status
+SELECT user_id, session_id, joined_at, status, role
 FROM session_participant
 WHERE user_id = $1 AND session_id = $2
 `
@@ -113,6 +126,94 @@ func (q *Queries) GetSessionParticipant(ctx context.Context, arg GetSessionParti
 		&i.SessionID,
 		&i.JoinedAt,
 		&i.Status,
+		&i.Role,
 	)
 	return i, err
 }
+
+const listSessionParticipants = `-- name: ListSessionParticipants :many
+SELECT user_id, session_id, joined_at, status, role
+FROM session_participant
+WHERE session_id = $1
+ORDER BY joined_at ASC, user_id ASC
+`
+
+func (q *Queries) ListSessionParticipants(ctx context.Context, sessionID uuid.UUID) ([]SessionParticipant, error) {
+	rows, err := q.db.QueryContext(ctx, listSessionParticipants, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SessionParticipant
+	for rows.Next() {
+		var i SessionParticipant
+		if err := rows.Scan(
+			&i.UserID,
+			&i.SessionID,
+			&i.JoinedAt,
+			&i.Status,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const rejoinSessionParticipant = `-- name: RejoinSessionParticipant :exec
+UPDATE session_participant
+SET status = 'active', role = $3, joined_at = NOW()
+WHERE user_id = $1 AND session_id = $2
+`
+
+type RejoinSessionParticipantParams struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	Role      string
+}
+
+func (q *Queries) RejoinSessionParticipant(ctx context.Context, arg RejoinSessionParticipantParams) error {
+	_, err := q.db.ExecContext(ctx, rejoinSessionParticipant, arg.UserID, arg.SessionID, arg.Role)
+	return err
+}
+
+const updateSessionParticipantRole = `-- name: UpdateSessionParticipantRole :exec
+UPDATE session_participant
+SET role = $3
+WHERE user_id = $1 AND session_id = $2
+`
+
+type UpdateSessionParticipantRoleParams struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	Role      string
+}
+
+func (q *Queries) UpdateSessionParticipantRole(ctx context.Context, arg UpdateSessionParticipantRoleParams) error {
+	_, err := q.db.ExecContext(ctx, updateSessionParticipantRole, arg.UserID, arg.SessionID, arg.Role)
+	return err
+}
+
+const updateSessionParticipantStatus = `-- name: UpdateSessionParticipantStatus :exec
+UPDATE session_participant
+SET status = $3
+WHERE user_id = $1 AND session_id = $2
+`
+
+type UpdateSessionParticipantStatusParams struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	Status    sql.NullString
+}
+
+func (q *Queries) UpdateSessionParticipantStatus(ctx context.Context, arg UpdateSessionParticipantStatusParams) error {
+	_, err := q.db.ExecContext(ctx, updateSessionParticipantStatus, arg.UserID, arg.SessionID, arg.Status)
+	return err
+}
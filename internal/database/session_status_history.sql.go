@@ -0,0 +1,86 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: session_status_history.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createSessionStatusHistory = `-- name: CreateSessionStatusHistory :one
+INSERT INTO session_status_history (session_id, from_status, to_status, changed_by_user_id)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING id, session_id, from_status, to_status, changed_by_user_id, changed_at
+`
+
+type CreateSessionStatusHistoryParams struct {
+	SessionID       uuid.UUID
+	FromStatus      string
+	ToStatus        string
+	ChangedByUserID uuid.NullUUID
+}
+
+func (q *Queries) CreateSessionStatusHistory(ctx context.Context, arg CreateSessionStatusHistoryParams) (SessionStatusHistory, error) {
+	row := q.db.QueryRowContext(ctx, createSessionStatusHistory,
+		arg.SessionID,
+		arg.FromStatus,
+		arg.ToStatus,
+		arg.ChangedByUserID,
+	)
+	var i SessionStatusHistory
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.FromStatus,
+		&i.ToStatus,
+		&i.ChangedByUserID,
+		&i.ChangedAt,
+	)
+	return i, err
+}
+
+const listSessionStatusHistory = `-- name: ListSessionStatusHistory :many
+SELECT id, session_id, from_status, to_status, changed_by_user_id, changed_at
+FROM session_status_history
+WHERE session_id = $1
+ORDER BY changed_at ASC, id ASC
+`
+
+func (q *Queries) ListSessionStatusHistory(ctx context.Context, sessionID uuid.UUID) ([]SessionStatusHistory, error) {
+	rows, err := q.db.QueryContext(ctx, listSessionStatusHistory, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SessionStatusHistory
+	for rows.Next() {
+		var i SessionStatusHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.FromStatus,
+			&i.ToStatus,
+			&i.ChangedByUserID,
+			&i.ChangedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,143 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: swipe.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const countActiveSessionParticipants = `-- name: CountActiveSessionParticipants :one
+SELECT COUNT(*)
+FROM session_participant
+WHERE session_id = $1 AND status = 'active' AND role <> 'spectator'
+`
+
+// Spectators cannot swipe, so they do not count towards a match.
+func (q *Queries) CountActiveSessionParticipants(ctx context.Context, sessionID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countActiveSessionParticipants, sessionID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countItemLikes = `-- name: CountItemLikes :one
+SELECT COUNT(*)
+FROM swipe
+JOIN session_participant ON session_participant.user_id = swipe.user_id
+    AND session_participant.session_id = swipe.session_id
+WHERE swipe.item_id = $1
+AND swipe.liked
+AND session_participant.status = 'active'
+AND session_participant.role <> 'spectator'
+`
+
+func (q *Queries) CountItemLikes(ctx context.Context, itemID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countItemLikes, itemID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const listSwipedItemIDs = `-- name: ListSwipedItemIDs :many
+SELECT item_id
+FROM swipe
+WHERE session_id = $1 AND user_id = $2
+`
+
+type ListSwipedItemIDsParams struct {
+	SessionID uuid.UUID
+	UserID    uuid.UUID
+}
+
+func (q *Queries) ListSwipedItemIDs(ctx context.Context, arg ListSwipedItemIDsParams) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listSwipedItemIDs, arg.SessionID, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var item_id uuid.UUID
+		if err := rows.Scan(&item_id); err != nil {
+			return nil, err
+		}
+		items = append(items, item_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const mostLikedSessionItem = `-- name: MostLikedSessionItem :one
+SELECT swipe.item_id, COUNT(*) AS likes
+FROM swipe
+JOIN session_participant ON session_participant.user_id = swipe.user_id
+    AND session_participant.session_id = swipe.session_id
+JOIN session_item ON session_item.id = swipe.item_id
+WHERE swipe.session_id = $1
+AND swipe.liked
+AND session_participant.status = 'active'
+AND session_participant.role <> 'spectator'
+GROUP BY swipe.item_id, session_item.created_at
+ORDER BY likes DESC, session_item.created_at, swipe.item_id
+LIMIT 1
+`
+
+type MostLikedSessionItemRow struct {
+	ItemID uuid.UUID
+	Likes  int64
+}
+
+// The item the most active participants like, the earliest added on a tie.
+func (q *Queries) MostLikedSessionItem(ctx context.Context, sessionID uuid.UUID) (MostLikedSessionItemRow, error) {
+	row := q.db.QueryRowContext(ctx, mostLikedSessionItem, sessionID)
+	var i MostLikedSessionItemRow
+	err := row.Scan(&i.ItemID, &i.Likes)
+	return i, err
+}
+
+const upsertSwipe = `-- name: UpsertSwipe :one
+INSERT INTO swipe (session_id, item_id, user_id, liked)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (item_id, user_id) DO UPDATE SET liked = EXCLUDED.liked, created_at = NOW()
+RETURNING session_id, item_id, user_id, liked, created_at
+`
+
+type UpsertSwipeParams struct {
+	SessionID uuid.UUID
+	ItemID    uuid.UUID
+	UserID    uuid.UUID
+	Liked     bool
+}
+
+func (q *Queries) UpsertSwipe(ctx context.Context, arg UpsertSwipeParams) (Swipe, error) {
+	row := q.db.QueryRowContext(ctx, upsertSwipe,
+		arg.SessionID,
+		arg.ItemID,
+		arg.UserID,
+		arg.Liked,
+	)
+	var i Swipe
+	err := row.Scan(
+		&i.SessionID,
+		&i.ItemID,
+		&i.UserID,
+		&i.Liked,
+		&i.CreatedAt,
+	)
+	return i, err
+}
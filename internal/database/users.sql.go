@@ -13,25 +13,87 @@ import (
 	"github.com/google/uuid"
 )
 
+const createGuestUser = `-- name: CreateGuestUser :one
+INSERT INTO users (username, is_guest)
+VALUES ($1, TRUE)
+RETURNING id, username, created_at
+`
+
+type CreateGuestUserRow struct {
+	ID        uuid.UUID
+	Username  string
+	CreatedAt time.Time
+}
+
+func (q *Queries) CreateGuestUser(ctx context.Context, username string) (CreateGuestUserRow, error) {
+	row := q.db.QueryRowContext(ctx, createGuestUser, username)
+	var i CreateGuestUserRow
+	err := row.Scan(&i.ID, &i.Username, &i.CreatedAt)
+	return i, err
+}
+
+const createOIDCUser = `-- name: CreateOIDCUser :one
+INSERT INTO users (username, email, email_verified_at)
+VALUES ($1, $2, $3)
+RETURNING id, username, email, email_verified_at, token_version, created_at, updated_at, deleted_at
+`
+
+type CreateOIDCUserParams struct {
+	Username        string
+	Email           sql.NullString
+	EmailVerifiedAt sql.NullTime
+}
+
+type CreateOIDCUserRow struct {
+	ID              uuid.UUID
+	Username        string
+	Email           sql.NullString
+	EmailVerifiedAt sql.NullTime
+	TokenVersion    int32
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	DeletedAt       sql.NullTime
+}
+
+// Users who sign up with a provider have no password. Their email counts as
+// verified if the provider says it is.
+func (q *Queries) CreateOIDCUser(ctx context.Context, arg CreateOIDCUserParams) (CreateOIDCUserRow, error) {
+	row := q.db.QueryRowContext(ctx, createOIDCUser, arg.Username, arg.Email, arg.EmailVerifiedAt)
+	var i CreateOIDCUserRow
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.EmailVerifiedAt,
+		&i.TokenVersion,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (username, email, password_hash)
 VALUES ($1, $2, $3)
-RETURNING id, username, email, created_at, updated_at, deleted_at
+RETURNING id, username, email, email_verified_at, token_version, created_at, updated_at, deleted_at
 `
 
 type CreateUserParams struct {
 	Username     string
-	Email        string
-	PasswordHash string
+	Email        sql.NullString
+	PasswordHash sql.NullString
 }
 
 type CreateUserRow struct {
-	ID        uuid.UUID
-	Username  string
-	Email     string
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt sql.NullTime
+	ID              uuid.UUID
+	Username        string
+	Email           sql.NullString
+	EmailVerifiedAt sql.NullTime
+	TokenVersion    int32
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	DeletedAt       sql.NullTime
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
@@ -41,6 +103,8 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 		&i.ID,
 		&i.Username,
 		&i.Email,
+		&i.EmailVerifiedAt,
+		&i.TokenVersion,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
@@ -68,14 +132,14 @@ WHERE email = $1 AND deleted_at IS NULL
 type GetUserByEmailRow struct {
 	ID                uuid.UUID
 	Username          string
-	Email             string
+	Email             sql.NullString
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
 	PasswordChangedAt sql.NullTime
 	DeletedAt         sql.NullTime
 }
 
-func (q *Queries) GetUserByEmail(ctx context.Context, email string) (GetUserByEmailRow, error) {
+func (q *Queries) GetUserByEmail(ctx context.Context, email sql.NullString) (GetUserByEmailRow, error) {
 	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
 	var i GetUserByEmailRow
 	err := row.Scan(
@@ -91,7 +155,7 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (GetUserByEm
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, username, email, created_at, updated_at, password_changed_at, deleted_at
+SELECT id, username, email, email_verified_at, is_guest, token_version, created_at, updated_at, password_changed_at, deleted_at
 FROM users
 WHERE id = $1 AND deleted_at IS NULL
 `
@@ -99,7 +163,10 @@ WHERE id = $1 AND deleted_at IS NULL
 type GetUserByIDRow struct {
 	ID                uuid.UUID
 	Username          string
-	Email             string
+	Email             sql.NullString
+	EmailVerifiedAt   sql.NullTime
+	IsGuest           bool
+	TokenVersion      int32
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
 	PasswordChangedAt sql.NullTime
@@ -113,6 +180,9 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (GetUserByIDRow
 		&i.ID,
 		&i.Username,
 		&i.Email,
+		&i.EmailVerifiedAt,
+		&i.IsGuest,
+		&i.TokenVersion,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.PasswordChangedAt,
@@ -130,7 +200,7 @@ WHERE username = $1 AND deleted_at IS NULL
 type GetUserByUsernameRow struct {
 	ID                uuid.UUID
 	Username          string
-	Email             string
+	Email             sql.NullString
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
 	PasswordChangedAt sql.NullTime
@@ -153,17 +223,19 @@ func (q *Queries) GetUserByUsername(ctx context.Context, username string) (GetUs
 }
 
 const getUserForLogin = `-- name: GetUserForLogin :one
-SELECT id, username, email, password_hash, password_changed_at, deleted_at
+SELECT id, username, email, email_verified_at, password_hash, password_changed_at, token_version, deleted_at
 FROM users
-WHERE (username = $1 OR email = $1) AND deleted_at IS NULL
+WHERE (username = $1 OR email = $1) AND NOT is_guest AND deleted_at IS NULL
 `
 
 type GetUserForLoginRow struct {
 	ID                uuid.UUID
 	Username          string
-	Email             string
-	PasswordHash      string
+	Email             sql.NullString
+	EmailVerifiedAt   sql.NullTime
+	PasswordHash      sql.NullString
 	PasswordChangedAt sql.NullTime
+	TokenVersion      int32
 	DeletedAt         sql.NullTime
 }
 
@@ -174,13 +246,41 @@ func (q *Queries) GetUserForLogin(ctx context.Context, username string) (GetUser
 		&i.ID,
 		&i.Username,
 		&i.Email,
+		&i.EmailVerifiedAt,
 		&i.PasswordHash,
 		&i.PasswordChangedAt,
+		&i.TokenVersion,
 		&i.DeletedAt,
 	)
 	return i, err
 }
 
+const getUserPasswordHash = `-- name: GetUserPasswordHash :one
+SELECT password_hash
+FROM users
+WHERE id = $1 AND NOT is_guest AND deleted_at IS NULL
+`
+
+func (q *Queries) GetUserPasswordHash(ctx context.Context, id uuid.UUID) (sql.NullString, error) {
+	row := q.db.QueryRowContext(ctx, getUserPasswordHash, id)
+	var password_hash sql.NullString
+	err := row.Scan(&password_hash)
+	return password_hash, err
+}
+
+const getUserTokenVersion = `-- name: GetUserTokenVersion :one
+SELECT token_version
+FROM users
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) GetUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, getUserTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
 const listUsers = `-- name: ListUsers :many
 SELECT id, username, email, created_at, updated_at 
 FROM users 
@@ -197,7 +297,7 @@ type ListUsersParams struct {
 type ListUsersRow struct {
 	ID        uuid.UUID
 	Username  string
-	Email     string
+	Email     sql.NullString
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -233,15 +333,16 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]ListUse
 
 const updateEmail = `-- name: UpdateEmail :exec
 UPDATE users
-SET email = $2, updated_at = NOW()
+SET email = $2, email_verified_at = NULL, updated_at = NOW()
 WHERE id = $1 AND deleted_at IS NULL
 `
 
 type UpdateEmailParams struct {
 	ID    uuid.UUID
-	Email string
+	Email sql.NullString
 }
 
+// A new address has not been verified yet.
 func (q *Queries) UpdateEmail(ctx context.Context, arg UpdateEmailParams) error {
 	_, err := q.db.ExecContext(ctx, updateEmail, arg.ID, arg.Email)
 	return err
@@ -249,17 +350,21 @@ func (q *Queries) UpdateEmail(ctx context.Context, arg UpdateEmailParams) error
 
 const updateUserPassword = `-- name: UpdateUserPassword :exec
 UPDATE users
-SET password_hash = $2, password_changed_at= NOW(), updated_at = NOW()
+SET password_hash = $2, password_changed_at = $3, token_version = token_version + 1, updated_at = NOW()
 WHERE id = $1 AND deleted_at IS NULL
 `
 
 type UpdateUserPasswordParams struct {
-	ID           uuid.UUID
-	PasswordHash string
+	ID                uuid.UUID
+	PasswordHash      sql.NullString
+	PasswordChangedAt sql.NullTime
 }
 
+// Bumping token_version ends every access token issued with the old password.
+// password_changed_at comes from the caller, whose clock also stamps the
+// refresh tokens it is compared with.
 func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
-	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.PasswordHash)
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.PasswordHash, arg.PasswordChangedAt)
 	return err
 }
 
@@ -279,13 +384,60 @@ func (q *Queries) UpdateUsername(ctx context.Context, arg UpdateUsernameParams)
 	return err
 }
 
+const upgradeGuestUser = `-- name: UpgradeGuestUser :one
+UPDATE users
+SET username = $2, email = $3, password_hash = $4, is_guest = FALSE,
+    password_changed_at = $5, updated_at = NOW()
+WHERE id = $1 AND is_guest AND deleted_at IS NULL
+RETURNING id, username, email, email_verified_at, token_version, created_at, updated_at
+`
+
+type UpgradeGuestUserParams struct {
+	ID                uuid.UUID
+	Username          string
+	Email             sql.NullString
+	PasswordHash      sql.NullString
+	PasswordChangedAt sql.NullTime
+}
+
+type UpgradeGuestUserRow struct {
+	ID              uuid.UUID
+	Username        string
+	Email           sql.NullString
+	EmailVerifiedAt sql.NullTime
+	TokenVersion    int32
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func (q *Queries) UpgradeGuestUser(ctx context.Context, arg UpgradeGuestUserParams) (UpgradeGuestUserRow, error) {
+	row := q.db.QueryRowContext(ctx, upgradeGuestUser,
+		arg.ID,
+		arg.Username,
+		arg.Email,
+		arg.PasswordHash,
+		arg.PasswordChangedAt,
+	)
+	var i UpgradeGuestUserRow
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.EmailVerifiedAt,
+		&i.TokenVersion,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const userExistsByUsernameOrEmail = `-- name: UserExistsByUsernameOrEmail :one
 SELECT EXISTS(SELECT 1 FROM users WHERE (username = $1 OR email = $2) AND deleted_at IS NULL)
 `
 
 type UserExistsByUsernameOrEmailParams struct {
 	Username string
-	Email    string
+	Email    sql.NullString
 }
 
 func (q *Queries) UserExistsByUsernameOrEmail(ctx context.Context, arg UserExistsByUsernameOrEmailParams) (bool, error) {
@@ -294,3 +446,14 @@ func (q *Queries) UserExistsByUsernameOrEmail(ctx context.Context, arg UserExist
 	err := row.Scan(&exists)
 	return exists, err
 }
+
+const usernameExists = `-- name: UsernameExists :one
+SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)
+`
+
+func (q *Queries) UsernameExists(ctx context.Context, username string) (bool, error) {
+	row := q.db.QueryRowContext(ctx, usernameExists, username)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
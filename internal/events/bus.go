@@ -0,0 +1,95 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Bus carries session events between the services that publish them and the
+// hubs that deliver them to connected clients, which may live on other
+// instances of the server.
+type Bus interface {
+	Publisher
+	Subscribe(sessionID uuid.UUID, handler func(Event)) (unsubscribe func(), err error)
+}
+
+// subscribers keeps the handlers registered for each session.
+type subscribers struct {
+	mu       sync.Mutex
+	nextID   int
+	handlers map[uuid.UUID]map[int]func(Event)
+}
+
+// add registers handler and reports whether it is the first for the session.
+func (s *subscribers) add(sessionID uuid.UUID, handler func(Event)) (id int, first bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handlers == nil {
+		s.handlers = make(map[uuid.UUID]map[int]func(Event))
+	}
+	room, ok := s.handlers[sessionID]
+	if !ok {
+		room = make(map[int]func(Event))
+		s.handlers[sessionID] = room
+	}
+	s.nextID++
+	room[s.nextID] = handler
+	return s.nextID, len(room) == 1
+}
+
+// remove drops a handler and reports whether it was the last for the session.
+func (s *subscribers) remove(sessionID uuid.UUID, id int) (last bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	room, ok := s.handlers[sessionID]
+	if !ok {
+		return false
+	}
+	if _, ok := room[id]; !ok {
+		return false
+	}
+	delete(room, id)
+	if len(room) == 0 {
+		delete(s.handlers, sessionID)
+		return true
+	}
+	return false
+}
+
+func (s *subscribers) dispatch(event Event) {
+	s.mu.Lock()
+	handlers := make([]func(Event), 0, len(s.handlers[event.SessionID]))
+	for _, h := range s.handlers[event.SessionID] {
+		handlers = append(handlers, h)
+	}
+	s.mu.Unlock()
+
+	for _, h := range handlers {
+		h(event)
+	}
+}
+
+// MemoryBus delivers events to subscribers in the same process. It is enough
+// when a single instance of the server is running.
+type MemoryBus struct {
+	subs subscribers
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+func (b *MemoryBus) Publish(_ context.Context, event Event) error {
+	b.subs.dispatch(event)
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(sessionID uuid.UUID, handler func(Event)) (func(), error) {
+	id, _ := b.subs.add(sessionID, handler)
+	var once sync.Once
+	return func() {
+		once.Do(func() { b.subs.remove(sessionID, id) })
+	}, nil
+}
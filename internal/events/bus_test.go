@@ -0,0 +1,151 @@
+package events
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMemoryBusDeliversToSessionSubscribers(t *testing.T) {
+	bus := NewMemoryBus()
+	sessionA, sessionB := uuid.New(), uuid.New()
+
+	var gotA, gotB []Event
+	unsubscribeA, err := bus.Subscribe(sessionA, func(e Event) { gotA = append(gotA, e) })
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if _, err := bus.Subscribe(sessionB, func(e Event) { gotB = append(gotB, e) }); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	event, _ := New(ItemAdded, sessionA, ItemData{ItemID: uuid.New()})
+	if err := bus.Publish(context.Background(), event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if len(gotA) != 1 || gotA[0].Type != ItemAdded {
+		t.Fatalf("session A subscriber got %+v", gotA)
+	}
+	if len(gotB) != 0 {
+		t.Fatalf("session B subscriber got %+v", gotB)
+	}
+
+	unsubscribeA()
+	unsubscribeA()
+	if err := bus.Publish(context.Background(), event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if len(gotA) != 1 {
+		t.Fatalf("unsubscribed handler still called: %d events", len(gotA))
+	}
+}
+
+func TestSubscribersReportFirstAndLast(t *testing.T) {
+	var subs subscribers
+	sessionID := uuid.New()
+
+	id1, first := subs.add(sessionID, func(Event) {})
+	if !first {
+		t.Fatalf("first handler not reported as first")
+	}
+	id2, first := subs.add(sessionID, func(Event) {})
+	if first {
+		t.Fatalf("second handler reported as first")
+	}
+
+	if subs.remove(sessionID, id1) {
+		t.Fatalf("removing one of two handlers reported as last")
+	}
+	if subs.remove(sessionID, id1) {
+		t.Fatalf("removing a handler twice reported as last")
+	}
+	if !subs.remove(sessionID, id2) {
+		t.Fatalf("removing the final handler not reported as last")
+	}
+}
+
+func TestChannelName(t *testing.T) {
+	sessionID := uuid.MustParse("3f1c2a9e-7b4d-4e8a-9c61-0d5e2f7a8b90")
+
+	name := ChannelName(sessionID)
+	if name != "optio_session_3f1c2a9e7b4d4e8a9c610d5e2f7a8b90" {
+		t.Fatalf("unexpected channel name %q", name)
+	}
+	// Postgres truncates identifiers longer than 63 bytes.
+	if len(name) > 63 {
+		t.Fatalf("channel name is %d bytes, longer than a Postgres identifier", len(name))
+	}
+
+	got, err := sessionFromChannel(name)
+	if err != nil || got != sessionID {
+		t.Fatalf("sessionFromChannel(%q) = %s, %v", name, got, err)
+	}
+}
+
+func TestHubRelaysBusEvents(t *testing.T) {
+	bus := NewMemoryBus()
+	// Two hubs on one bus stand in for two server instances.
+	publisher := NewHub(HubConfig{}, bus)
+	hub := NewHub(HubConfig{}, bus)
+	server := startHubServer(t, hub)
+
+	sessionID := uuid.New()
+	conn := dial(t, server, sessionID)
+	waitForClients(t, hub, sessionID, 1)
+
+	event, _ := New(VoteCast, sessionID, VoteData{UserID: uuid.New()})
+	if err := publisher.Publish(context.Background(), event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if got := readEvent(t, conn); got.Type != VoteCast || got.SessionID != sessionID {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+
+	conn.Close()
+	waitForClients(t, hub, sessionID, 0)
+	waitForSubscriptions(t, hub, 0)
+}
+
+func TestHubRejectsStreamWhenBusFails(t *testing.T) {
+	hub := NewHub(HubConfig{}, failingBus{})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := hub.Serve(w, r, uuid.New(), Viewer{}); err == nil {
+		t.Fatalf("expected an error when the bus cannot subscribe")
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want 503, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "unavailable") {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+}
+
+type failingBus struct{}
+
+func (failingBus) Publish(context.Context, Event) error { return nil }
+
+func (failingBus) Subscribe(uuid.UUID, func(Event)) (func(), error) {
+	return nil, context.DeadlineExceeded
+}
+
+func waitForSubscriptions(t *testing.T, hub *Hub, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		hub.subMu.Lock()
+		n := len(hub.subs)
+		hub.subMu.Unlock()
+		if n == want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("want %d bus subscriptions, got %d", want, len(hub.subs))
+}
@@ -0,0 +1,88 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Type string
+
+const (
+	ParticipantJoined Type = "participant_joined"
+	ParticipantLeft   Type = "participant_left"
+	// ParticipantRoleChanged carries the participant's new role.
+	ParticipantRoleChanged Type = "participant_role_changed"
+	SessionUpdated         Type = "session_updated"
+	ItemAdded              Type = "item_added"
+	ItemUpdated            Type = "item_updated"
+	ItemRemoved            Type = "item_removed"
+	VoteCast               Type = "vote_cast"
+	StatusChanged          Type = "status_changed"
+	ResultDecided          Type = "result_decided"
+)
+
+type Event struct {
+	Type       Type            `json:"type"`
+	SessionID  uuid.UUID       `json:"session_id"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+func New(eventType Type, sessionID uuid.UUID, data any) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		Type:       eventType,
+		SessionID:  sessionID,
+		Data:       raw,
+		OccurredAt: time.Now().UTC(),
+	}, nil
+}
+
+type ParticipantData struct {
+	UserID uuid.UUID `json:"user_id"`
+	Role   string    `json:"role,omitempty"`
+	// Reason is set when a participant was removed rather than leaving.
+	Reason string `json:"reason,omitempty"`
+}
+
+type SessionData struct {
+	Name            string     `json:"session_name"`
+	VotingMethod    string     `json:"voting_method"`
+	MatchThreshold  int        `json:"match_threshold,omitempty"`
+	CollectUntil    *time.Time `json:"collect_until,omitempty"`
+	VoteUntil       *time.Time `json:"vote_until,omitempty"`
+	OpenJoin        bool       `json:"open_join"`
+	RequireVerified bool       `json:"require_verified"`
+}
+
+type ItemData struct {
+	ItemID        uuid.UUID `json:"item_id"`
+	Title         string    `json:"title,omitempty"`
+	Description   string    `json:"description,omitempty"`
+	ImageURL      string    `json:"image_url,omitempty"`
+	SourceType    string    `json:"source_type,omitempty"`
+	AddedByUserID uuid.UUID `json:"added_by_user_id"`
+}
+
+type VoteData struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+type StatusData struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type ResultData struct {
+	WinningItemID *uuid.UUID `json:"winning_item_id"`
+}
@@ -0,0 +1,341 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+type HubConfig struct {
+	// SendBuffer is how many events may queue for a client before it is
+	// considered too slow and disconnected.
+	SendBuffer   int
+	PingInterval time.Duration
+	PongWait     time.Duration
+	WriteWait    time.Duration
+}
+
+func (c HubConfig) withDefaults() HubConfig {
+	if c.SendBuffer <= 0 {
+		c.SendBuffer = 64
+	}
+	if c.PongWait <= 0 {
+		c.PongWait = 60 * time.Second
+	}
+	if c.PingInterval <= 0 || c.PingInterval >= c.PongWait {
+		c.PingInterval = c.PongWait * 9 / 10
+	}
+	if c.WriteWait <= 0 {
+		c.WriteWait = 10 * time.Second
+	}
+	return c
+}
+
+// Hub fans session events out to the WebSocket clients connected to that
+// session on this instance. With a bus, the hub listens for a session's
+// events for as long as it has clients in that session, so events published
+// on any instance reach them.
+type Hub struct {
+	cfg      HubConfig
+	upgrader websocket.Upgrader
+	bus      Bus
+
+	mu    sync.Mutex
+	rooms map[uuid.UUID]map[*client]struct{}
+
+	// subMu guards subs and is never held together with mu, because bus
+	// handlers take mu while the bus may be waiting on an unsubscribe.
+	subMu sync.Mutex
+	subs  map[uuid.UUID]*subscription
+}
+
+type subscription struct {
+	refs        int
+	unsubscribe func()
+}
+
+// Viewer is who a connection streams events to. The hub keeps them only as
+// long as they may see the session: it closes the connection when they leave
+// or are removed, and when the token they connected with expires.
+type Viewer struct {
+	UserID uuid.UUID
+	// ExpiresAt is when the viewer's token expires. Zero means never.
+	ExpiresAt time.Time
+}
+
+// Reasons the hub gives when it closes a connection.
+const (
+	closeSlow    = "client too slow"
+	closeLeft    = "no longer a participant"
+	closeExpired = "token expired"
+)
+
+type client struct {
+	hub       *Hub
+	sessionID uuid.UUID
+	viewer    Viewer
+	conn      *websocket.Conn
+	send      chan []byte
+	closeOnce sync.Once
+	// closeReason is set under the hub lock before send is closed when the
+	// hub drops the client, rather than the client going away.
+	closeReason string
+}
+
+// NewHub creates a hub. A nil bus keeps events within this instance.
+func NewHub(cfg HubConfig, bus Bus) *Hub {
+	return &Hub{
+		cfg: cfg.withDefaults(),
+		bus: bus,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			// Clients authenticate with a bearer token rather than cookies,
+			// so cross-origin connections are safe to accept, matching the
+			// CORS policy of the REST API.
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		rooms: make(map[uuid.UUID]map[*client]struct{}),
+		subs:  make(map[uuid.UUID]*subscription),
+	}
+}
+
+// Publish sends the event to the bus, or straight to this instance's clients
+// when the hub has no bus.
+func (h *Hub) Publish(ctx context.Context, event Event) error {
+	if h.bus != nil {
+		return h.bus.Publish(ctx, event)
+	}
+	return h.deliver(event)
+}
+
+// deliver sends the event to every local client in the event's session.
+// Clients whose send buffer is full are dropped instead of blocking. When a
+// participant leaves or is removed, their own clients get the event and are
+// then closed.
+func (h *Hub) deliver(event Event) error {
+	msg, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var left uuid.UUID
+	if event.Type == ParticipantLeft {
+		var data ParticipantData
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return fmt.Errorf("decode participant data: %w", err)
+		}
+		left = data.UserID
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.rooms[event.SessionID] {
+		select {
+		case c.send <- msg:
+		default:
+			log.Printf("events: dropping slow client in session %s", event.SessionID)
+			h.dropLocked(c, closeSlow)
+			continue
+		}
+		if left != uuid.Nil && c.viewer.UserID == left {
+			h.dropLocked(c, closeLeft)
+		}
+	}
+	return nil
+}
+
+// Serve upgrades the request to a WebSocket and streams the session's events
+// to the viewer until the client disconnects, the viewer leaves the session or
+// their token expires. Callers must authorise the request before calling
+// Serve.
+func (h *Hub) Serve(w http.ResponseWriter, r *http.Request, sessionID uuid.UUID, viewer Viewer) error {
+	if err := h.retain(sessionID); err != nil {
+		http.Error(w, "Event stream unavailable", http.StatusServiceUnavailable)
+		return err
+	}
+	defer h.release(sessionID)
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+
+	c := &client{
+		hub:       h,
+		sessionID: sessionID,
+		viewer:    viewer,
+		conn:      conn,
+		send:      make(chan []byte, h.cfg.SendBuffer),
+	}
+	h.add(c)
+
+	go c.writePump()
+	c.readPump()
+	return nil
+}
+
+// retain subscribes the hub to the session's events on the bus, unless a
+// client in that session already holds a subscription.
+func (h *Hub) retain(sessionID uuid.UUID) error {
+	if h.bus == nil {
+		return nil
+	}
+	h.subMu.Lock()
+	defer h.subMu.Unlock()
+
+	sub, ok := h.subs[sessionID]
+	if !ok {
+		unsubscribe, err := h.bus.Subscribe(sessionID, func(event Event) {
+			if err := h.deliver(event); err != nil {
+				log.Printf("events: deliver %s event for session %s: %v", event.Type, event.SessionID, err)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("subscribe to session %s: %w", sessionID, err)
+		}
+		sub = &subscription{unsubscribe: unsubscribe}
+		h.subs[sessionID] = sub
+	}
+	sub.refs++
+	return nil
+}
+
+func (h *Hub) release(sessionID uuid.UUID) {
+	if h.bus == nil {
+		return
+	}
+	h.subMu.Lock()
+	defer h.subMu.Unlock()
+
+	sub, ok := h.subs[sessionID]
+	if !ok {
+		return
+	}
+	sub.refs--
+	if sub.refs == 0 {
+		delete(h.subs, sessionID)
+		sub.unsubscribe()
+	}
+}
+
+func (h *Hub) ClientCount(sessionID uuid.UUID) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.rooms[sessionID])
+}
+
+func (h *Hub) add(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	room, ok := h.rooms[c.sessionID]
+	if !ok {
+		room = make(map[*client]struct{})
+		h.rooms[c.sessionID] = room
+	}
+	room[c] = struct{}{}
+}
+
+func (h *Hub) remove(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(c)
+}
+
+// drop closes the client on the hub's side, telling it why.
+func (h *Hub) drop(c *client, reason string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dropLocked(c, reason)
+}
+
+func (h *Hub) dropLocked(c *client, reason string) {
+	if _, ok := h.rooms[c.sessionID][c]; !ok {
+		return
+	}
+	c.closeReason = reason
+	h.removeLocked(c)
+}
+
+func (h *Hub) removeLocked(c *client) {
+	room, ok := h.rooms[c.sessionID]
+	if !ok {
+		return
+	}
+	if _, ok := room[c]; !ok {
+		return
+	}
+	delete(room, c)
+	if len(room) == 0 {
+		delete(h.rooms, c.sessionID)
+	}
+	c.closeOnce.Do(func() { close(c.send) })
+}
+
+// readPump discards anything the client sends; it exists to process control
+// frames and to notice when the connection goes away.
+func (c *client) readPump() {
+	defer func() {
+		c.hub.remove(c)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(512)
+	c.conn.SetReadDeadline(time.Now().Add(c.hub.cfg.PongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(c.hub.cfg.PongWait))
+	})
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (c *client) writePump() {
+	ticker := time.NewTicker(c.hub.cfg.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	// A nil channel never fires, so viewers without an expiry stay.
+	var expired <-chan time.Time
+	if !c.viewer.ExpiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(c.viewer.ExpiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteWait))
+			if !ok {
+				if c.closeReason != "" {
+					c.conn.WriteMessage(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.ClosePolicyViolation, c.closeReason))
+				}
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-expired:
+			// Dropping closes send, so the close frame goes out above once
+			// whatever is queued has been written.
+			c.hub.drop(c, closeExpired)
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// startHubServer serves the hub, taking the session and viewer from the query
+// string: session, user and expires, a Unix time in nanoseconds.
+func startHubServer(t *testing.T, hub *Hub) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		sessionID, err := uuid.Parse(query.Get("session"))
+		if err != nil {
+			http.Error(w, "bad session", http.StatusBadRequest)
+			return
+		}
+		var viewer Viewer
+		if user := query.Get("user"); user != "" {
+			viewer.UserID = uuid.MustParse(user)
+		}
+		if expires := query.Get("expires"); expires != "" {
+			nanos, err := strconv.ParseInt(expires, 10, 64)
+			if err != nil {
+				http.Error(w, "bad expiry", http.StatusBadRequest)
+				return
+			}
+			viewer.ExpiresAt = time.Unix(0, nanos)
+		}
+		hub.Serve(w, r, sessionID, viewer)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dial(t *testing.T, server *httptest.Server, sessionID uuid.UUID) *websocket.Conn {
+	t.Helper()
+	return dialAs(t, server, sessionID, Viewer{})
+}
+
+func dialAs(t *testing.T, server *httptest.Server, sessionID uuid.UUID, viewer Viewer) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?session=" + sessionID.String()
+	if viewer.UserID != uuid.Nil {
+		url += "&user=" + viewer.UserID.String()
+	}
+	if !viewer.ExpiresAt.IsZero() {
+		url += "&expires=" + strconv.FormatInt(viewer.ExpiresAt.UnixNano(), 10)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func waitForClients(t *testing.T, hub *Hub, sessionID uuid.UUID, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if hub.ClientCount(sessionID) == want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("session %s: want %d clients, got %d", sessionID, want, hub.ClientCount(sessionID))
+}
+
+func readEvent(t *testing.T, conn *websocket.Conn) Event {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+	var event Event
+	if err := json.Unmarshal(msg, &event); err != nil {
+		t.Fatalf("unmarshal event: %v; msg=%s", err, msg)
+	}
+	return event
+}
+
+// readClose expects the server to close the connection next and returns the
+// close frame it sent.
+func readClose(t *testing.T, conn *websocket.Conn) *websocket.CloseError {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, msg, err := conn.ReadMessage()
+	if err == nil {
+		t.Fatalf("want the stream to close, got %s", msg)
+	}
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("want a close frame, got %v", err)
+	}
+	return closeErr
+}
+
+func TestHubBroadcastsToSessionClients(t *testing.T) {
+	hub := NewHub(HubConfig{}, nil)
+	server := startHubServer(t, hub)
+
+	sessionA, sessionB := uuid.New(), uuid.New()
+	a1 := dial(t, server, sessionA)
+	a2 := dial(t, server, sessionA)
+	b1 := dial(t, server, sessionB)
+	waitForClients(t, hub, sessionA, 2)
+	waitForClients(t, hub, sessionB, 1)
+
+	userID := uuid.New()
+	event, err := New(ParticipantJoined, sessionA, ParticipantData{UserID: userID})
+	if err != nil {
+		t.Fatalf("new event: %v", err)
+	}
+	if err := hub.Publish(context.Background(), event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	for _, conn := range []*websocket.Conn{a1, a2} {
+		got := readEvent(t, conn)
+		if got.Type != ParticipantJoined || got.SessionID != sessionA {
+			t.Fatalf("unexpected event: %+v", got)
+		}
+		var data ParticipantData
+		if err := json.Unmarshal(got.Data, &data); err != nil || data.UserID != userID {
+			t.Fatalf("unexpected event data: %s (%v)", got.Data, err)
+		}
+	}
+
+	b1.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, msg, err := b1.ReadMessage(); err == nil {
+		t.Fatalf("client in another session received %s", msg)
+	}
+}
+
+func TestHubRemovesDisconnectedClients(t *testing.T) {
+	hub := NewHub(HubConfig{}, nil)
+	server := startHubServer(t, hub)
+
+	sessionID := uuid.New()
+	conn := dial(t, server, sessionID)
+	waitForClients(t, hub, sessionID, 1)
+
+	conn.Close()
+	waitForClients(t, hub, sessionID, 0)
+}
+
+func TestHubSendsHeartbeatPings(t *testing.T) {
+	hub := NewHub(HubConfig{PingInterval: 20 * time.Millisecond, PongWait: time.Second}, nil)
+	server := startHubServer(t, hub)
+
+	sessionID := uuid.New()
+	conn := dial(t, server, sessionID)
+
+	pinged := make(chan struct{}, 1)
+	conn.SetPingHandler(func(appData string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+	})
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-pinged:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no heartbeat ping received")
+	}
+}
+
+func TestHubDropsSlowClients(t *testing.T) {
+	hub := NewHub(HubConfig{SendBuffer: 1}, nil)
+	sessionID := uuid.New()
+
+	// A client whose pumps are not running never drains its buffer.
+	slow := &client{hub: hub, sessionID: sessionID, send: make(chan []byte, 1)}
+	hub.add(slow)
+
+	event, _ := New(StatusChanged, sessionID, StatusData{From: "voting", To: "decided"})
+	for range 2 {
+		if err := hub.Publish(context.Background(), event); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+
+	if n := hub.ClientCount(sessionID); n != 0 {
+		t.Fatalf("slow client still registered: %d clients", n)
+	}
+	if slow.closeReason != closeSlow {
+		t.Fatalf("client not marked as slow: %q", slow.closeReason)
+	}
+	<-slow.send
+	if _, open := <-slow.send; open {
+		t.Fatalf("send channel should be closed after dropping the client")
+	}
+}
+
+func TestHubClosesStreamsOfRemovedParticipants(t *testing.T) {
+	hub := NewHub(HubConfig{}, nil)
+	server := startHubServer(t, hub)
+
+	sessionID := uuid.New()
+	kicked, staying := Viewer{UserID: uuid.New()}, Viewer{UserID: uuid.New()}
+	kickedConn := dialAs(t, server, sessionID, kicked)
+	stayingConn := dialAs(t, server, sessionID, staying)
+	waitForClients(t, hub, sessionID, 2)
+
+	event, _ := New(ParticipantLeft, sessionID, ParticipantData{UserID: kicked.UserID, Reason: "kicked"})
+	if err := hub.Publish(context.Background(), event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	// The kicked participant is told, and then hears nothing more.
+	if got := readEvent(t, kickedConn); got.Type != ParticipantLeft {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+	if closeErr := readClose(t, kickedConn); closeErr.Code != websocket.ClosePolicyViolation {
+		t.Fatalf("want a policy violation close, got %v", closeErr)
+	}
+	waitForClients(t, hub, sessionID, 1)
+
+	if got := readEvent(t, stayingConn); got.Type != ParticipantLeft {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+	next, _ := New(ItemAdded, sessionID, ItemData{ItemID: uuid.New()})
+	if err := hub.Publish(context.Background(), next); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if got := readEvent(t, stayingConn); got.Type != ItemAdded {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+}
+
+func TestHubClosesStreamsWhenTokenExpires(t *testing.T) {
+	hub := NewHub(HubConfig{}, nil)
+	server := startHubServer(t, hub)
+
+	sessionID := uuid.New()
+	conn := dialAs(t, server, sessionID, Viewer{UserID: uuid.New(), ExpiresAt: time.Now().Add(100 * time.Millisecond)})
+	waitForClients(t, hub, sessionID, 1)
+
+	closeErr := readClose(t, conn)
+	if closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != closeExpired {
+		t.Fatalf("want the stream closed for an expired token, got %v", closeErr)
+	}
+	waitForClients(t, hub, sessionID, 0)
+}
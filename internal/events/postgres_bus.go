@@ -0,0 +1,234 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const channelPrefix = "optio_session_"
+
+// maxPayload is the largest NOTIFY payload Postgres accepts by default.
+const maxPayload = 8000
+
+const (
+	// payloadRefPrefix marks a notification that carries the key of a parked
+	// payload rather than the event itself, which always starts with "{".
+	payloadRefPrefix = "ref:"
+	// payloadRetention is how long parked payloads are kept for listeners to
+	// read.
+	payloadRetention = 10 * time.Minute
+	// payloadFetchTimeout bounds reading a parked payload.
+	payloadFetchTimeout = 5 * time.Second
+)
+
+type PostgresBusConfig struct {
+	MinReconnectInterval time.Duration
+	MaxReconnectInterval time.Duration
+}
+
+func (c PostgresBusConfig) withDefaults() PostgresBusConfig {
+	if c.MinReconnectInterval <= 0 {
+		c.MinReconnectInterval = time.Second
+	}
+	if c.MaxReconnectInterval < c.MinReconnectInterval {
+		c.MaxReconnectInterval = time.Minute
+	}
+	return c
+}
+
+// PostgresBus shares events between server instances with LISTEN/NOTIFY. Each
+// session has its own channel, and an instance only listens on the channels
+// of sessions it has subscribers for. The underlying listener reconnects on
+// its own and re-issues LISTEN for every open channel; events sent while it
+// was disconnected are lost. Events too big for a notification are parked in
+// the event_payload table and only their key is sent. Listeners read parked
+// events back off the notification loop, so they may arrive after events
+// published later.
+type PostgresBus struct {
+	db       *sql.DB
+	listener *pq.Listener
+	subs     subscribers
+	// listenMu serialises LISTEN/UNLISTEN so a session's channel is never
+	// opened and closed concurrently.
+	listenMu sync.Mutex
+	// fetches tracks reads of parked payloads, which Close waits for.
+	fetches sync.WaitGroup
+	done    chan struct{}
+}
+
+func NewPostgresBus(db *sql.DB, dsn string, cfg PostgresBusConfig) (*PostgresBus, error) {
+	cfg = cfg.withDefaults()
+	b := &PostgresBus{db: db, done: make(chan struct{})}
+
+	connected := make(chan error, 1)
+	b.listener = pq.NewListener(dsn, cfg.MinReconnectInterval, cfg.MaxReconnectInterval, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventConnected:
+			select {
+			case connected <- nil:
+			default:
+			}
+		case pq.ListenerEventConnectionAttemptFailed:
+			select {
+			case connected <- err:
+			default:
+			}
+			log.Printf("events: listener connection attempt failed: %v", err)
+		case pq.ListenerEventDisconnected:
+			log.Printf("events: listener disconnected: %v", err)
+		case pq.ListenerEventReconnected:
+			log.Printf("events: listener reconnected")
+		}
+	})
+
+	if err := <-connected; err != nil {
+		b.listener.Close()
+		return nil, fmt.Errorf("connect listener: %w", err)
+	}
+
+	go b.run()
+	return b, nil
+}
+
+func ChannelName(sessionID uuid.UUID) string {
+	return channelPrefix + strings.ReplaceAll(sessionID.String(), "-", "")
+}
+
+func sessionFromChannel(channel string) (uuid.UUID, error) {
+	return uuid.Parse(strings.TrimPrefix(channel, channelPrefix))
+}
+
+func (b *PostgresBus) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	notification := string(payload)
+	if len(payload) > maxPayload {
+		if notification, err = b.park(ctx, event.SessionID, payload); err != nil {
+			return err
+		}
+	}
+
+	if _, err := b.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, ChannelName(event.SessionID), notification); err != nil {
+		return fmt.Errorf("notify: %w", err)
+	}
+	return nil
+}
+
+// park stores a payload too big to notify and returns the notification that
+// points at it.
+func (b *PostgresBus) park(ctx context.Context, sessionID uuid.UUID, payload []byte) (string, error) {
+	if _, err := b.db.ExecContext(ctx, `DELETE FROM event_payload WHERE created_at < $1`, time.Now().Add(-payloadRetention)); err != nil {
+		return "", fmt.Errorf("delete old event payloads: %w", err)
+	}
+	var id uuid.UUID
+	if err := b.db.QueryRowContext(ctx,
+		`INSERT INTO event_payload (session_id, payload) VALUES ($1, $2) RETURNING id`,
+		sessionID, string(payload)).Scan(&id); err != nil {
+		return "", fmt.Errorf("park event payload: %w", err)
+	}
+	return payloadRefPrefix + id.String(), nil
+}
+
+// fetchParked reads back a parked payload and delivers its event.
+func (b *PostgresBus) fetchParked(sessionID uuid.UUID, ref string) {
+	id, err := uuid.Parse(ref)
+	if err != nil {
+		log.Printf("events: notification for session %s: parse payload key: %v", sessionID, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), payloadFetchTimeout)
+	defer cancel()
+	var payload string
+	if err := b.db.QueryRowContext(ctx, `SELECT payload FROM event_payload WHERE id = $1`, id).Scan(&payload); err != nil {
+		log.Printf("events: notification for session %s: read event payload %s: %v", sessionID, id, err)
+		return
+	}
+	b.dispatch(sessionID, []byte(payload))
+}
+
+func (b *PostgresBus) dispatch(sessionID uuid.UUID, payload []byte) {
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		log.Printf("events: decode notification for session %s: %v", sessionID, err)
+		return
+	}
+	event.SessionID = sessionID
+	b.subs.dispatch(event)
+}
+
+func (b *PostgresBus) Subscribe(sessionID uuid.UUID, handler func(Event)) (func(), error) {
+	b.listenMu.Lock()
+	defer b.listenMu.Unlock()
+
+	id, first := b.subs.add(sessionID, handler)
+	if first {
+		if err := b.listener.Listen(ChannelName(sessionID)); err != nil && !errors.Is(err, pq.ErrChannelAlreadyOpen) {
+			b.subs.remove(sessionID, id)
+			return nil, fmt.Errorf("listen: %w", err)
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { b.unsubscribe(sessionID, id) })
+	}, nil
+}
+
+func (b *PostgresBus) unsubscribe(sessionID uuid.UUID, id int) {
+	b.listenMu.Lock()
+	defer b.listenMu.Unlock()
+
+	if !b.subs.remove(sessionID, id) {
+		return
+	}
+	if err := b.listener.Unlisten(ChannelName(sessionID)); err != nil && !errors.Is(err, pq.ErrChannelNotOpen) {
+		log.Printf("events: unlisten session %s: %v", sessionID, err)
+	}
+}
+
+func (b *PostgresBus) run() {
+	defer close(b.done)
+	for n := range b.listener.Notify {
+		if n == nil {
+			// Sent after a reconnect; anything published in the gap is gone.
+			continue
+		}
+		sessionID, err := sessionFromChannel(n.Channel)
+		if err != nil {
+			log.Printf("events: notification on unexpected channel %q", n.Channel)
+			continue
+		}
+		ref, parked := strings.CutPrefix(n.Extra, payloadRefPrefix)
+		if !parked {
+			b.dispatch(sessionID, []byte(n.Extra))
+			continue
+		}
+		// Reading a parked payload is a query; a slow one must not hold up
+		// every other session's events.
+		b.fetches.Add(1)
+		go func() {
+			defer b.fetches.Done()
+			b.fetchParked(sessionID, ref)
+		}()
+	}
+}
+
+func (b *PostgresBus) Close() error {
+	err := b.listener.Close()
+	<-b.done
+	b.fetches.Wait()
+	return err
+}
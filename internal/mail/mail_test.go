@@ -0,0 +1,76 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMessage(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	body := "Hi Zoë,\n\nOpen https://optio.test/reset?token=" + strings.Repeat("x", 90) + "\n"
+	raw := string(buildMessage("Optio <no-reply@optio.test>", Message{
+		To:      "zoe@example.com",
+		Subject: "Réinitialiser",
+		Body:    body,
+	}, now))
+
+	headers, encoded, ok := strings.Cut(raw, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("no blank line between headers and body:\n%s", raw)
+	}
+	for _, want := range []string{
+		"From: Optio <no-reply@optio.test>",
+		"To: zoe@example.com",
+		"Subject: =?utf-8?q?R=C3=A9initialiser?=",
+		"Date: Fri, 01 May 2026 12:00:00 +0000",
+		"Content-Transfer-Encoding: quoted-printable",
+	} {
+		if !strings.Contains(headers+"\r\n", want+"\r\n") {
+			t.Errorf("headers missing %q:\n%s", want, headers)
+		}
+	}
+	for _, line := range strings.Split(encoded, "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("encoded line longer than 76 characters: %q", line)
+		}
+	}
+
+	decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(encoded)))
+	if err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if got := strings.ReplaceAll(string(decoded), "\r\n", "\n"); got != body {
+		t.Fatalf("body round trip:\ngot  %q\nwant %q", got, body)
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer()
+	ctx := context.Background()
+	m.Send(ctx, Message{To: "a@example.com", Subject: "first"})
+	m.Send(ctx, Message{To: "b@example.com", Subject: "other"})
+	m.Send(ctx, Message{To: "A@example.com", Subject: "second"})
+
+	got := m.Sent("a@example.com")
+	if len(got) != 2 || got[0].Subject != "first" || got[1].Subject != "second" {
+		t.Fatalf("Sent(a@example.com) = %+v", got)
+	}
+	if got := m.Sent("nobody@example.com"); len(got) != 0 {
+		t.Fatalf("Sent(nobody) = %+v", got)
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewLogMailer(&buf).Send(context.Background(), Message{To: "a@example.com", Subject: "Reset", Body: "link"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, `to=a@example.com subject="Reset"`) || !strings.Contains(out, "link") {
+		t.Fatalf("unexpected log output: %q", out)
+	}
+}
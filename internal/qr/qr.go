@@ -0,0 +1,89 @@
+// Package qr renders short strings, such as invite links, as QR codes in PNG
+// or SVG form.
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	DefaultSize = 256
+	MinSize     = 64
+	MaxSize     = 1024
+)
+
+var ErrInvalidOptions = errors.New("invalid qr options")
+
+// Options controls how a code is drawn. Size is the width and height of the
+// image in pixels.
+type Options struct {
+	Size  int
+	Level qrcode.RecoveryLevel
+}
+
+// ParseOptions reads the size and error-correction level as given in a
+// request. Empty values take the defaults: 256 pixels and level M.
+func ParseOptions(size int, level string) (Options, error) {
+	opts := Options{Size: size, Level: qrcode.Medium}
+	if opts.Size == 0 {
+		opts.Size = DefaultSize
+	}
+	if opts.Size < MinSize || opts.Size > MaxSize {
+		return Options{}, fmt.Errorf("%w: size must be between %d and %d", ErrInvalidOptions, MinSize, MaxSize)
+	}
+
+	switch strings.ToUpper(level) {
+	case "L":
+		opts.Level = qrcode.Low
+	case "", "M":
+		opts.Level = qrcode.Medium
+	case "Q":
+		opts.Level = qrcode.High
+	case "H":
+		opts.Level = qrcode.Highest
+	default:
+		return Options{}, fmt.Errorf("%w: level must be one of L, M, Q or H", ErrInvalidOptions)
+	}
+	return opts, nil
+}
+
+func PNG(content string, opts Options) ([]byte, error) {
+	code, err := qrcode.New(content, opts.Level)
+	if err != nil {
+		return nil, fmt.Errorf("encode qr: %w", err)
+	}
+	png, err := code.PNG(opts.Size)
+	if err != nil {
+		return nil, fmt.Errorf("render qr png: %w", err)
+	}
+	return png, nil
+}
+
+// SVG draws one unit square per dark module and lets the viewBox scale them
+// up to the requested size, so the output stays small and sharp at any zoom.
+func SVG(content string, opts Options) ([]byte, error) {
+	code, err := qrcode.New(content, opts.Level)
+	if err != nil {
+		return nil, fmt.Errorf("encode qr: %w", err)
+	}
+	bitmap := code.Bitmap()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, len(bitmap), len(bitmap))
+	b.WriteString(`<rect width="100%" height="100%" fill="#fff"/><path fill="#000" d="`)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	b.WriteByte('\n')
+	return []byte(b.String()), nil
+}
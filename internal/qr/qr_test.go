@@ -0,0 +1,153 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	zxingqr "github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/skip2/go-qrcode"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+const inviteLink = "https://optio.example/join?invite=Hk3Qx9vL2mPzR7tYw4NcB8dFj6GsA1eU5oKiVbXyZq0"
+
+func decode(t *testing.T, img image.Image) string {
+	t.Helper()
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		t.Fatalf("binarize: %v", err)
+	}
+	result, err := zxingqr.NewQRCodeReader().Decode(bmp, nil)
+	if err != nil {
+		t.Fatalf("decode qr: %v", err)
+	}
+	return result.GetText()
+}
+
+// rasterizeSVG paints the modules of an SVG made by SVG onto an image so it
+// can be decoded like a PNG.
+func rasterizeSVG(t *testing.T, svg []byte) image.Image {
+	t.Helper()
+	viewBox := regexp.MustCompile(`viewBox="0 0 (\d+) (\d+)"`).FindSubmatch(svg)
+	if viewBox == nil {
+		t.Fatalf("svg has no viewBox: %s", svg)
+	}
+	modules, _ := strconv.Atoi(string(viewBox[1]))
+	const scale = 8
+	img := image.NewGray(image.Rect(0, 0, modules*scale, modules*scale))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	for _, m := range regexp.MustCompile(`M(\d+) (\d+)h1v1h-1z`).FindAllSubmatch(svg, -1) {
+		x, _ := strconv.Atoi(string(m[1]))
+		y, _ := strconv.Atoi(string(m[2]))
+		for dy := range scale {
+			for dx := range scale {
+				img.SetGray(x*scale+dx, y*scale+dy, color.Gray{})
+			}
+		}
+	}
+	return img
+}
+
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("write golden: %v", err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s differs from golden file; run with -update if the change is intended", name)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	for _, level := range []string{"L", "H"} {
+		t.Run(level, func(t *testing.T) {
+			opts, err := ParseOptions(256, level)
+			if err != nil {
+				t.Fatalf("options: %v", err)
+			}
+			data, err := PNG(inviteLink, opts)
+			if err != nil {
+				t.Fatalf("png: %v", err)
+			}
+			golden(t, "invite_"+level+".png", data)
+
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("decode png: %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != 256 || b.Dy() != 256 {
+				t.Fatalf("want 256x256, got %v", b)
+			}
+			if got := decode(t, img); got != inviteLink {
+				t.Fatalf("decoded %q, want %q", got, inviteLink)
+			}
+		})
+	}
+}
+
+func TestSVG(t *testing.T) {
+	opts, err := ParseOptions(320, "Q")
+	if err != nil {
+		t.Fatalf("options: %v", err)
+	}
+	data, err := SVG(inviteLink, opts)
+	if err != nil {
+		t.Fatalf("svg: %v", err)
+	}
+	golden(t, "invite_Q.svg", data)
+
+	if !bytes.Contains(data, []byte(`width="320" height="320"`)) {
+		t.Fatalf("svg does not have the requested size: %.120s", data)
+	}
+	if got := decode(t, rasterizeSVG(t, data)); got != inviteLink {
+		t.Fatalf("decoded %q, want %q", got, inviteLink)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		size    int
+		level   string
+		want    Options
+		wantErr bool
+	}{
+		{want: Options{Size: DefaultSize, Level: qrcode.Medium}},
+		{size: 512, level: "h", want: Options{Size: 512, Level: qrcode.Highest}},
+		{size: 128, level: "Q", want: Options{Size: 128, Level: qrcode.High}},
+		{size: 32, wantErr: true},
+		{size: 4096, wantErr: true},
+		{level: "X", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseOptions(tt.size, tt.level)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("ParseOptions(%d, %q): want ErrInvalidOptions, got %v", tt.size, tt.level, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseOptions(%d, %q) = %+v, %v; want %+v", tt.size, tt.level, got, err, tt.want)
+		}
+	}
+}
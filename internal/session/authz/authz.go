@@ -0,0 +1,113 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Kam1217/optio/app"
+	"github.com/Kam1217/optio/internal/auth/middleware"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// MembershipLookup resolves a user's membership of a session, either directly
+// or through one of the session's items.
+type MembershipLookup interface {
+	Membership(ctx context.Context, sessionID, userID uuid.UUID) (*app.Membership, error)
+	ItemMembership(ctx context.Context, itemID, userID uuid.UUID) (*app.Membership, error)
+}
+
+// Authorizer guards session-scoped routes. It must run after the JWT
+// middleware, since it relies on the authenticated user in the context. Guests
+// are only let into the session their token is for.
+type Authorizer struct {
+	lookup MembershipLookup
+}
+
+func NewAuthorizer(lookup MembershipLookup) *Authorizer {
+	return &Authorizer{lookup: lookup}
+}
+
+type ctxKey int
+
+const ctxMembershipKey ctxKey = iota
+
+func MembershipFromCtx(ctx context.Context) (*app.Membership, bool) {
+	m, ok := ctx.Value(ctxMembershipKey).(*app.Membership)
+	return m, ok
+}
+
+func contextWithMembership(ctx context.Context, m *app.Membership) context.Context {
+	return context.WithValue(ctx, ctxMembershipKey, m)
+}
+
+// RequireSessionMember lets the request through only if the caller is an
+// active participant of the session named by the {id} route variable.
+func (a *Authorizer) RequireSessionMember(next http.HandlerFunc) http.HandlerFunc {
+	return a.require(a.lookup.Membership, "Invalid session ID", next)
+}
+
+// RequireItemMember is RequireSessionMember for routes whose {id} is an item;
+// the caller must be an active participant of the item's session.
+func (a *Authorizer) RequireItemMember(next http.HandlerFunc) http.HandlerFunc {
+	return a.require(a.lookup.ItemMembership, "Invalid item ID", next)
+}
+
+// RequirePermission is RequireSessionMember for routes that also need the
+// caller's role to grant the permission.
+func (a *Authorizer) RequirePermission(p app.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return a.RequireSessionMember(func(w http.ResponseWriter, r *http.Request) {
+		m, _ := MembershipFromCtx(r.Context())
+		if !m.Can(p) {
+			http.Error(w, "Forbidden: your role in this session does not allow this", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+type resolveFunc func(ctx context.Context, id, userID uuid.UUID) (*app.Membership, error)
+
+func (a *Authorizer) require(resolve resolveFunc, invalidID string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := middleware.UserIDFromCtx(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, invalidID, http.StatusBadRequest)
+			return
+		}
+
+		m, err := resolve(r.Context(), id, userID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if guestSession, ok := middleware.GuestSessionFromCtx(r.Context()); ok && guestSession != m.Session.ID {
+			http.Error(w, "Forbidden: guests can only access their own session", http.StatusForbidden)
+			return
+		}
+
+		next(w, r.WithContext(contextWithMembership(r.Context(), m)))
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, app.ErrSessionNotFound):
+		http.Error(w, "Session not found", http.StatusNotFound)
+	case errors.Is(err, app.ErrItemNotFound):
+		http.Error(w, "Item not found", http.StatusNotFound)
+	case errors.Is(err, app.ErrNotParticipant):
+		http.Error(w, "Forbidden: not a participant of this session", http.StatusForbidden)
+	default:
+		log.Printf("authorize session access: %v", err)
+		http.Error(w, "Failed to authorize request", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,183 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/optio/app"
+	"github.com/Kam1217/optio/internal/auth/middleware"
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// fakeLookup knows which users have joined which sessions and which session
+// each item belongs to.
+type fakeLookup struct {
+	members map[uuid.UUID][]uuid.UUID
+	items   map[uuid.UUID]uuid.UUID
+	roles   map[uuid.UUID]app.Role
+}
+
+func (f fakeLookup) Membership(_ context.Context, sessionID, userID uuid.UUID) (*app.Membership, error) {
+	users, ok := f.members[sessionID]
+	if !ok {
+		return nil, app.ErrSessionNotFound
+	}
+	for _, u := range users {
+		if u == userID {
+			return &app.Membership{
+				Session:     database.Session{ID: sessionID},
+				Participant: database.SessionParticipant{UserID: userID, SessionID: sessionID, Role: string(f.roles[userID])},
+			}, nil
+		}
+	}
+	return nil, app.ErrNotParticipant
+}
+
+func (f fakeLookup) ItemMembership(ctx context.Context, itemID, userID uuid.UUID) (*app.Membership, error) {
+	sessionID, ok := f.items[itemID]
+	if !ok {
+		return nil, app.ErrItemNotFound
+	}
+	return f.Membership(ctx, sessionID, userID)
+}
+
+type brokenLookup struct{ fakeLookup }
+
+func (brokenLookup) Membership(context.Context, uuid.UUID, uuid.UUID) (*app.Membership, error) {
+	return nil, errors.New("connection reset")
+}
+
+func TestAuthorizer(t *testing.T) {
+	jwtMgr := middleware.NewJWTManager("secret", "optio", "optio-api", time.Minute)
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	sessionA, sessionB := uuid.New(), uuid.New()
+	itemA, itemB := uuid.New(), uuid.New()
+	lookup := fakeLookup{
+		members: map[uuid.UUID][]uuid.UUID{sessionA: {alice, carol}, sessionB: {bob, carol}},
+		items:   map[uuid.UUID]uuid.UUID{itemA: sessionA, itemB: sessionB},
+	}
+
+	tests := []struct {
+		name       string
+		lookup     MembershipLookup
+		item       bool
+		user       uuid.UUID
+		guestOf    uuid.UUID
+		id         string
+		wantStatus int
+		wantID     uuid.UUID
+	}{
+		{name: "member of session", user: alice, id: sessionA.String(), wantStatus: http.StatusOK, wantID: sessionA},
+		{name: "other session", user: alice, id: sessionB.String(), wantStatus: http.StatusForbidden},
+		{name: "other user's session", user: bob, id: sessionA.String(), wantStatus: http.StatusForbidden},
+		{name: "unknown session", user: alice, id: uuid.NewString(), wantStatus: http.StatusNotFound},
+		{name: "bad session id", user: alice, id: "nope", wantStatus: http.StatusBadRequest},
+		{name: "no token", id: sessionA.String(), wantStatus: http.StatusUnauthorized},
+		{name: "item in own session", item: true, user: alice, id: itemA.String(), wantStatus: http.StatusOK, wantID: sessionA},
+		{name: "item in other session", item: true, user: alice, id: itemB.String(), wantStatus: http.StatusForbidden},
+		{name: "unknown item", item: true, user: alice, id: uuid.NewString(), wantStatus: http.StatusNotFound},
+		{name: "lookup failure", lookup: brokenLookup{lookup}, user: alice, id: sessionA.String(), wantStatus: http.StatusInternalServerError},
+		{name: "guest in own session", user: carol, guestOf: sessionA, id: sessionA.String(), wantStatus: http.StatusOK, wantID: sessionA},
+		{name: "guest in another joined session", user: carol, guestOf: sessionA, id: sessionB.String(), wantStatus: http.StatusForbidden},
+		{name: "guest item in own session", item: true, user: carol, guestOf: sessionA, id: itemA.String(), wantStatus: http.StatusOK, wantID: sessionA},
+		{name: "guest item in another session", item: true, user: carol, guestOf: sessionA, id: itemB.String(), wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := tt.lookup
+			if l == nil {
+				l = lookup
+			}
+			a := NewAuthorizer(l)
+
+			var got *app.Membership
+			next := func(w http.ResponseWriter, r *http.Request) {
+				got, _ = MembershipFromCtx(r.Context())
+			}
+			guard := a.RequireSessionMember
+			if tt.item {
+				guard = a.RequireItemMember
+			}
+			handler := jwtMgr.GuestJWTMiddleware(guard(next))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = mux.SetURLVars(r, map[string]string{"id": tt.id})
+			if tt.user != uuid.Nil {
+				token, err := jwtMgr.GenerateJWT(tt.user, "user")
+				if tt.guestOf != uuid.Nil {
+					token, err = jwtMgr.GenerateGuestJWT(tt.user, "guest", tt.guestOf)
+				}
+				if err != nil {
+					t.Fatalf("generate token: %v", err)
+				}
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("want %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if got != nil {
+					t.Fatalf("handler ran for a refused request")
+				}
+				return
+			}
+			if got == nil || got.Session.ID != tt.wantID || got.Participant.UserID != tt.user {
+				t.Fatalf("unexpected membership in context: %+v", got)
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	jwtMgr := middleware.NewJWTManager("secret", "optio", "optio-api", time.Minute)
+	host, spectator, outsider := uuid.New(), uuid.New(), uuid.New()
+	sessionID := uuid.New()
+	a := NewAuthorizer(fakeLookup{
+		members: map[uuid.UUID][]uuid.UUID{sessionID: {host, spectator}},
+		roles:   map[uuid.UUID]app.Role{host: app.RoleHost, spectator: app.RoleSpectator},
+	})
+
+	tests := []struct {
+		name       string
+		user       uuid.UUID
+		perm       app.Permission
+		wantStatus int
+	}{
+		{name: "host changes settings", user: host, perm: app.PermChangeSettings, wantStatus: http.StatusOK},
+		{name: "spectator views", user: spectator, perm: app.PermView, wantStatus: http.StatusOK},
+		{name: "spectator votes", user: spectator, perm: app.PermVote, wantStatus: http.StatusForbidden},
+		{name: "spectator changes settings", user: spectator, perm: app.PermChangeSettings, wantStatus: http.StatusForbidden},
+		{name: "outsider", user: outsider, perm: app.PermView, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran := false
+			handler := jwtMgr.JWTMiddleware(a.RequirePermission(tt.perm, func(w http.ResponseWriter, r *http.Request) {
+				ran = true
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r = mux.SetURLVars(r, map[string]string{"id": sessionID.String()})
+			token, _ := jwtMgr.GenerateJWT(tt.user, "user")
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("want %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if ran != (tt.wantStatus == http.StatusOK) {
+				t.Fatalf("handler ran = %v for status %d", ran, w.Code)
+			}
+		})
+	}
+}
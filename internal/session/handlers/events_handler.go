@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Kam1217/optio/internal/auth/middleware"
+	"github.com/Kam1217/optio/internal/events"
+	"github.com/Kam1217/optio/internal/session/authz"
+)
+
+type EventsHandler struct {
+	hub *events.Hub
+}
+
+func NewEventsHandler(hub *events.Hub) *EventsHandler {
+	return &EventsHandler{hub: hub}
+}
+
+// Stream must be wrapped in authz.RequireSessionMember, which has already
+// confirmed the caller belongs to the session.
+func (eh *EventsHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	m, ok := authz.MembershipFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// The stream ends when the token it was opened with does.
+	expiresAt, _ := middleware.TokenExpiryFromCtx(r.Context())
+	viewer := events.Viewer{UserID: m.Participant.UserID, ExpiresAt: expiresAt}
+	if err := eh.hub.Serve(w, r, m.Session.ID, viewer); err != nil {
+		log.Printf("websocket upgrade for session %s: %v", m.Session.ID, err)
+	}
+}
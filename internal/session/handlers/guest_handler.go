@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Kam1217/optio/app"
+	"github.com/google/uuid"
+)
+
+type GuestJoinRequest struct {
+	JoinSessionRequest
+	DisplayName string `json:"display_name"`
+}
+
+type GuestJoinResponse struct {
+	Token       string          `json:"token"`
+	UserID      uuid.UUID       `json:"user_id"`
+	Username    string          `json:"username"`
+	DisplayName string          `json:"display_name"`
+	Session     SessionResponse `json:"session"`
+}
+
+// GuestJoin lets someone without an account into a session. They get a token
+// that only works for that session and can later upgrade to a full account.
+func (sh *SessionHandler) GuestJoin(w http.ResponseWriter, r *http.Request) {
+	var req GuestJoinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	creds, err := joinCredentials(req.JoinSessionRequest, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, guest, err := sh.sessionService.JoinAsGuest(r.Context(), app.GuestJoin{
+		Code:        creds.code,
+		Invite:      creds.invite,
+		DisplayName: req.DisplayName,
+	})
+	if err != nil {
+		if errors.Is(err, app.ErrInvalidDisplayName) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJoinError(w, err)
+		return
+	}
+
+	token, err := sh.JWT.GenerateGuestJWT(guest.UserID, guest.Username, session.ID)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	sessionResponse, err := sh.sessionResponse(r.Context(), session)
+	if err != nil {
+		http.Error(w, "Failed to load participants", http.StatusInternalServerError)
+		return
+	}
+
+	sh.respondWithJSON(w, GuestJoinResponse{
+		Token:       token,
+		UserID:      guest.UserID,
+		Username:    guest.Username,
+		DisplayName: guest.DisplayName,
+		Session:     *sessionResponse,
+	}, http.StatusCreated)
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Kam1217/optio/app"
+	"github.com/Kam1217/optio/internal/auth/middleware"
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/Kam1217/optio/internal/qr"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type CreateInviteRequest struct {
+	Role      string    `json:"role"`
+	MaxUses   int       `json:"max_uses"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type InviteResponse struct {
+	InviteID  uuid.UUID  `json:"invite_id"`
+	Role      string     `json:"role"`
+	MaxUses   *int32     `json:"max_uses,omitempty"`
+	UseCount  int32      `json:"use_count"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	// Token and InviteLink are only returned when the invite is created.
+	Token      string `json:"token,omitempty"`
+	InviteLink string `json:"invite_link,omitempty"`
+}
+
+func toInviteResponse(invite database.SessionInvite) InviteResponse {
+	response := InviteResponse{
+		InviteID:  invite.ID,
+		Role:      invite.Role,
+		UseCount:  invite.UseCount,
+		CreatedAt: invite.CreatedAt,
+	}
+	if invite.MaxUses.Valid {
+		response.MaxUses = &invite.MaxUses.Int32
+	}
+	if invite.ExpiresAt.Valid {
+		response.ExpiresAt = &invite.ExpiresAt.Time
+	}
+	if invite.RevokedAt.Valid {
+		response.RevokedAt = &invite.RevokedAt.Time
+	}
+	return response
+}
+
+func (sh *SessionHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	var req CreateInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	minted, err := sh.sessionService.CreateInvite(r.Context(), sessionID, userID, app.InviteOptions{
+		Role:      app.Role(req.Role),
+		MaxUses:   req.MaxUses,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		sh.writeSessionError(w, err, "Failed to create invite")
+		return
+	}
+
+	response := toInviteResponse(minted.Invite)
+	response.Token = minted.Token
+	response.InviteLink = minted.Link
+	sh.respondWithJSON(w, response, http.StatusCreated)
+}
+
+func (sh *SessionHandler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	invites, err := sh.sessionService.ListInvites(r.Context(), sessionID, userID)
+	if err != nil {
+		sh.writeSessionError(w, err, "Failed to list invites")
+		return
+	}
+
+	response := make([]InviteResponse, len(invites))
+	for i, invite := range invites {
+		response[i] = toInviteResponse(invite)
+	}
+	sh.respondWithJSON(w, response, http.StatusOK)
+}
+
+func (sh *SessionHandler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	sessionID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+	inviteID, err := uuid.Parse(vars["invite_id"])
+	if err != nil {
+		http.Error(w, "Invalid invite ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := sh.sessionService.RevokeInvite(r.Context(), sessionID, userID, inviteID); err != nil {
+		sh.writeSessionError(w, err, "Failed to revoke invite")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sh *SessionHandler) InviteQRPNG(w http.ResponseWriter, r *http.Request) {
+	sh.inviteQR(w, r, "image/png", qr.PNG)
+}
+
+func (sh *SessionHandler) InviteQRSVG(w http.ResponseWriter, r *http.Request) {
+	sh.inviteQR(w, r, "image/svg+xml", qr.SVG)
+}
+
+// inviteQR renders a join link as a QR code for people in the room to scan.
+// The invite query parameter picks the invite; without it the code link of an
+// open session is used. size and level tune the image.
+func (sh *SessionHandler) inviteQR(w http.ResponseWriter, r *http.Request, contentType string, render func(string, qr.Options) ([]byte, error)) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	size, err := queryInt32(r, "size")
+	if err != nil {
+		http.Error(w, "Invalid size", http.StatusBadRequest)
+		return
+	}
+	opts, err := qr.ParseOptions(int(size), r.URL.Query().Get("level"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	link, err := sh.sessionService.InviteLink(r.Context(), sessionID, userID, r.URL.Query().Get("invite"))
+	if err != nil {
+		sh.writeSessionError(w, err, "Failed to build invite link")
+		return
+	}
+
+	data, err := render(link, opts)
+	if err != nil {
+		log.Printf("render invite qr: %v", err)
+		http.Error(w, "Failed to render QR code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	// The image carries a live invite, so keep it out of shared caches.
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -2,12 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/Kam1217/optio/app"
 	"github.com/Kam1217/optio/internal/auth/middleware"
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/Kam1217/optio/internal/session/authz"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
 type ItemHandler struct {
@@ -23,16 +28,25 @@ type CreateItemRequest struct {
 }
 
 type CreateItemResponse struct {
-	ItemID          uuid.UUID `json:"item_id"`
-	SessionID       uuid.UUID `json:"session_id"`
-	ItemTitle       string    `json:"title"`
-	ItemDescription string    `json:"description"`
-	ImageURL        string    `json:"image_url"`
-	SourceType      string    `json:"source_type"`
+	ItemID          uuid.UUID    `json:"item_id"`
+	SessionID       uuid.UUID    `json:"session_id"`
+	ItemTitle       string       `json:"title"`
+	ItemDescription string       `json:"description"`
+	ImageURL        string       `json:"image_url"`
+	SourceType      string       `json:"source_type"`
+	SourceID        string       `json:"source_id,omitempty"`
+	Metadata        app.Metadata `json:"metadata,omitempty"`
+}
+
+type ListItemsResponse struct {
+	Items  []CreateItemResponse `json:"items"`
+	Total  int64                `json:"total"`
+	Limit  int32                `json:"limit"`
+	Offset int32                `json:"offset"`
 }
 
 func (ih *ItemHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
-	_, ok := middleware.UserIDFromCtx(r.Context())
+	userID, ok := middleware.UserIDFromCtx(r.Context())
 	if !ok {
 		http.Error(w, "Unauthrised: Creator ID not found", http.StatusUnauthorized)
 		return
@@ -44,27 +58,196 @@ func (ih *ItemHandler) CreateItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.ItemInput.Title == "" {
+	isCustom := req.ItemInput.SourceType == "" || req.ItemInput.SourceType == app.SourceCustom
+	if isCustom && req.ItemInput.Title == "" {
 		http.Error(w, "Item title required", http.StatusBadRequest)
 		return
 	}
 
+	// Items are always added by the caller, whatever the payload says, and
+	// go to the session in the route when there is one.
+	req.ItemInput.AddedByUserID = userID
+	if m, ok := authz.MembershipFromCtx(r.Context()); ok {
+		req.ItemInput.SessionId = m.Session.ID
+	}
+
 	item, err := ih.itemService.CreateNewSessionItem(r.Context(), req.ItemInput)
 	if err != nil {
-		fmt.Print(err)
-		http.Error(w, "Failed to create item", http.StatusInternalServerError)
+		ih.writeItemError(w, err, "Failed to create item")
+		return
+	}
+
+	ih.respondWithJSON(w, toItemResponse(item), http.StatusCreated)
+}
+
+func (ih *ItemHandler) ListItems(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := queryInt32(r, "limit")
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt32(r, "offset")
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	page, err := ih.itemService.ListItems(r.Context(), sessionID, userID, limit, offset)
+	if err != nil {
+		ih.writeItemError(w, err, "Failed to list items")
+		return
+	}
+
+	res := ListItemsResponse{
+		Items:  make([]CreateItemResponse, len(page.Items)),
+		Total:  page.Total,
+		Limit:  page.Limit,
+		Offset: page.Offset,
+	}
+	for i := range page.Items {
+		res.Items[i] = toItemResponse(&page.Items[i])
+	}
+	ih.respondWithJSON(w, res, http.StatusOK)
+}
+
+func (ih *ItemHandler) GetItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	itemID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	item, err := ih.itemService.GetItem(r.Context(), itemID, userID)
+	if err != nil {
+		ih.writeItemError(w, err, "Failed to load item")
+		return
+	}
+
+	ih.respondWithJSON(w, toItemResponse(item), http.StatusOK)
+}
+
+func (ih *ItemHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	itemID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
 		return
 	}
 
-	response := CreateItemResponse{
+	var req app.SessionItemUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	item, err := ih.itemService.UpdateItem(r.Context(), itemID, userID, req)
+	if err != nil {
+		ih.writeItemError(w, err, "Failed to update item")
+		return
+	}
+
+	ih.respondWithJSON(w, toItemResponse(item), http.StatusOK)
+}
+
+func (ih *ItemHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	itemID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := ih.itemService.DeleteItem(r.Context(), itemID, userID); err != nil {
+		ih.writeItemError(w, err, "Failed to delete item")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ih *ItemHandler) writeItemError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, app.ErrUnsupportedSource), errors.Is(err, app.ErrInvalidSourceID),
+		errors.Is(err, app.ErrInvalidMetadata), errors.Is(err, app.ErrInvalidItem):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, app.ErrSessionNotFound):
+		http.Error(w, "Session not found", http.StatusNotFound)
+	case errors.Is(err, app.ErrItemNotFound):
+		http.Error(w, "Item not found", http.StatusNotFound)
+	case errors.Is(err, app.ErrSourceItemNotFound):
+		http.Error(w, "Item not found at source", http.StatusNotFound)
+	case errors.Is(err, app.ErrNotParticipant):
+		http.Error(w, "Forbidden: not a participant of this session", http.StatusForbidden)
+	case errors.Is(err, app.ErrPermissionDenied):
+		http.Error(w, "Forbidden: your role in this session does not allow this", http.StatusForbidden)
+	case errors.Is(err, app.ErrNotItemOwner):
+		http.Error(w, "Forbidden: only the item's adder or the session host can change it", http.StatusForbidden)
+	case errors.Is(err, app.ErrDuplicateItem):
+		http.Error(w, "Item already exists in this session", http.StatusConflict)
+	case errors.Is(err, app.ErrItemsClosed):
+		http.Error(w, "Session is no longer accepting items", http.StatusConflict)
+	case errors.Is(err, app.ErrSourceUnavailable):
+		http.Error(w, "Item source unavailable", http.StatusBadGateway)
+	default:
+		log.Printf("%s: %v", fallback, err)
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
+
+// queryInt32 reads an optional integer query parameter, returning 0 when it
+// is absent.
+func queryInt32(r *http.Request, key string) (int32, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 32)
+	return int32(n), err
+}
+
+func toItemResponse(item *database.SessionItem) CreateItemResponse {
+	metadata, err := app.DecodeMetadata(app.SourceType(item.SourceType), item.Metadata.RawMessage)
+	if err != nil {
+		log.Printf("decode metadata of item %s: %v", item.ID, err)
+	}
+	return CreateItemResponse{
 		ItemID:          item.ID,
 		SessionID:       item.SessionID,
 		ItemTitle:       item.ItemTitle,
 		ItemDescription: item.ItemDescription.String,
 		ImageURL:        item.ImageUrl.String,
 		SourceType:      item.SourceType,
+		SourceID:        item.SourceID.String,
+		Metadata:        metadata,
 	}
-	ih.respondWithJSON(w, response, http.StatusCreated)
 }
 
 func (ih *ItemHandler) respondWithJSON(w http.ResponseWriter, data any, statusCode int) {
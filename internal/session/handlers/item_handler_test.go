@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQueryInt32(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    int32
+		wantErr bool
+	}{
+		{name: "absent", query: "", want: 0},
+		{name: "number", query: "?limit=25", want: 25},
+		{name: "negative", query: "?limit=-1", want: -1},
+		{name: "not a number", query: "?limit=ten", wantErr: true},
+		{name: "too large", query: "?limit=4294967296", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/session/x/items"+tt.query, nil)
+			got, err := queryInt32(r, "limit")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Fatalf("want %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -1,16 +1,26 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/Kam1217/optio/app"
 	"github.com/Kam1217/optio/internal/auth/middleware"
+	"github.com/Kam1217/optio/internal/database"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
 type SessionHandler struct {
 	sessionService *app.SessionService
+	// JWT issues the session-scoped tokens guests get when they join.
+	JWT *middleware.JWTManager
 }
 
 func NewSessionHandler(s *app.SessionService) *SessionHandler {
@@ -18,14 +28,23 @@ func NewSessionHandler(s *app.SessionService) *SessionHandler {
 }
 
 type CreateSessionRequest struct {
-	SessionName string `json:"session_name"`
+	SessionName     string    `json:"session_name"`
+	VotingMethod    string    `json:"voting_method"`
+	Mode            string    `json:"mode"`
+	MatchThreshold  int       `json:"match_threshold"`
+	CollectUntil    time.Time `json:"collect_until"`
+	VoteUntil       time.Time `json:"vote_until"`
+	OpenJoin        bool      `json:"open_join"`
+	RequireVerified bool      `json:"require_verified"`
 }
 
 type CreateSessionResponse struct {
-	SessionID   uuid.UUID `json:"session_id"`
-	SessionCode string    `json:"session_code"`
-	SessionName string    `json:"session_name"`
-	InviteLink  string    `json:"invite_link"`
+	SessionID    uuid.UUID `json:"session_id"`
+	SessionCode  string    `json:"session_code"`
+	SessionName  string    `json:"session_name"`
+	VotingMethod string    `json:"voting_method"`
+	Mode         string    `json:"mode"`
+	InviteLink   string    `json:"invite_link"`
 }
 
 func (sh *SessionHandler) CreateSession(w http.ResponseWriter, r *http.Request) {
@@ -44,23 +63,544 @@ func (sh *SessionHandler) CreateSession(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Session name is required", http.StatusBadRequest)
 		return
 	}
+	if req.MatchThreshold < 0 {
+		http.Error(w, "Match threshold cannot be negative", http.StatusBadRequest)
+		return
+	}
 
-	session, inviteLink, err := sh.sessionService.CreateNewSession(r.Context(), req.SessionName, creatorID)
+	opts := app.SessionOptions{
+		VotingMethod:    app.VotingMethod(req.VotingMethod),
+		Mode:            app.SessionMode(req.Mode),
+		MatchThreshold:  req.MatchThreshold,
+		CollectUntil:    req.CollectUntil,
+		VoteUntil:       req.VoteUntil,
+		OpenJoin:        req.OpenJoin,
+		RequireVerified: req.RequireVerified,
+	}
+	session, inviteLink, err := sh.sessionService.CreateNewSession(r.Context(), req.SessionName, creatorID, opts)
 	if err != nil {
+		if errors.Is(err, app.ErrUnknownVotingMethod) {
+			http.Error(w, "Unknown voting method", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, app.ErrUnknownSessionMode) {
+			http.Error(w, "Unknown session mode", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, app.ErrInvalidSettings) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, app.ErrEmailNotVerified) {
+			http.Error(w, "Forbidden: verify your email to create sessions", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, app.ErrCodesExhausted) {
+			http.Error(w, "No free session code, please try again", http.StatusServiceUnavailable)
+			return
+		}
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
 
 	response := CreateSessionResponse{
-		SessionID:   session.ID,
-		SessionCode: session.SessionCode,
-		SessionName: session.SessionName,
-		InviteLink:  inviteLink,
+		SessionID:    session.ID,
+		SessionCode:  session.SessionCode,
+		SessionName:  session.SessionName,
+		VotingMethod: session.VotingMethod,
+		Mode:         session.Mode,
+		InviteLink:   inviteLink,
 	}
 
 	sh.respondWithJSON(w, response, http.StatusCreated)
 }
 
+type JoinSessionRequest struct {
+	Code       string `json:"code"`
+	Invite     string `json:"invite"`
+	InviteLink string `json:"invite_link"`
+}
+
+type ParticipantResponse struct {
+	UserID   uuid.UUID `json:"user_id"`
+	JoinedAt time.Time `json:"joined_at"`
+	Status   string    `json:"status"`
+	Role     string    `json:"role"`
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type TransferHostRequest struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+type TransitionRequest struct {
+	Status string `json:"status"`
+}
+
+type StatusChangeResponse struct {
+	FromStatus      string     `json:"from_status"`
+	ToStatus        string     `json:"to_status"`
+	ChangedByUserID *uuid.UUID `json:"changed_by_user_id"`
+	ChangedAt       time.Time  `json:"changed_at"`
+}
+
+type SessionResponse struct {
+	SessionID       uuid.UUID             `json:"session_id"`
+	SessionCode     string                `json:"session_code"`
+	SessionName     string                `json:"session_name"`
+	CreatorUserID   uuid.UUID             `json:"creator_user_id"`
+	Status          string                `json:"status"`
+	VotingMethod    string                `json:"voting_method"`
+	Mode            string                `json:"mode"`
+	MatchThreshold  *int32                `json:"match_threshold,omitempty"`
+	WinningItemID   *uuid.UUID            `json:"winning_item_id,omitempty"`
+	DecidedAt       *time.Time            `json:"decided_at,omitempty"`
+	CollectUntil    *time.Time            `json:"collect_until,omitempty"`
+	VoteUntil       *time.Time            `json:"vote_until,omitempty"`
+	OpenJoin        bool                  `json:"open_join"`
+	RequireVerified bool                  `json:"require_verified"`
+	CreatedAt       time.Time             `json:"created_at"`
+	Participants    []ParticipantResponse `json:"participants"`
+}
+
+func (sh *SessionHandler) JoinSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req JoinSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	creds, err := joinCredentials(req, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var session *database.Session
+	if creds.invite != "" {
+		session, err = sh.sessionService.JoinWithInvite(r.Context(), creds.invite, userID)
+	} else {
+		session, err = sh.sessionService.JoinSession(r.Context(), creds.code, userID)
+	}
+	if err != nil {
+		writeJoinError(w, err)
+		return
+	}
+
+	response, err := sh.sessionResponse(r.Context(), session)
+	if err != nil {
+		http.Error(w, "Failed to load participants", http.StatusInternalServerError)
+		return
+	}
+
+	sh.respondWithJSON(w, response, http.StatusOK)
+}
+
+// writeJoinError explains why someone could not join a session.
+func writeJoinError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, app.ErrSessionNotFound):
+		http.Error(w, "Session not found", http.StatusNotFound)
+	case errors.Is(err, app.ErrInviteNotFound):
+		http.Error(w, "Invite not found", http.StatusNotFound)
+	case errors.Is(err, app.ErrInviteExpired), errors.Is(err, app.ErrInviteRevoked),
+		errors.Is(err, app.ErrInviteUsedUp):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, app.ErrOpenJoinDisabled):
+		http.Error(w, "Forbidden: this session can only be joined with an invite", http.StatusForbidden)
+	case errors.Is(err, app.ErrSessionNotJoinable):
+		http.Error(w, "Session is not open for joining", http.StatusConflict)
+	case errors.Is(err, app.ErrBannedFromSession):
+		http.Error(w, "Forbidden: you are banned from this session", http.StatusForbidden)
+	case errors.Is(err, app.ErrEmailNotVerified):
+		http.Error(w, "Forbidden: this session only admits people with a verified email", http.StatusForbidden)
+	default:
+		http.Error(w, "Failed to join session", http.StatusInternalServerError)
+	}
+}
+
+func (sh *SessionHandler) GetSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	session, err := sh.sessionService.GetSession(r.Context(), sessionID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrSessionNotFound):
+			http.Error(w, "Session not found", http.StatusNotFound)
+		case errors.Is(err, app.ErrNotParticipant):
+			http.Error(w, "Forbidden: not a participant of this session", http.StatusForbidden)
+		default:
+			http.Error(w, "Failed to load session", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response, err := sh.sessionResponse(r.Context(), session)
+	if err != nil {
+		http.Error(w, "Failed to load participants", http.StatusInternalServerError)
+		return
+	}
+
+	sh.respondWithJSON(w, response, http.StatusOK)
+}
+
+func (sh *SessionHandler) LeaveSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := sh.sessionService.LeaveSession(r.Context(), sessionID, userID); err != nil {
+		switch {
+		case errors.Is(err, app.ErrSessionNotFound):
+			http.Error(w, "Session not found", http.StatusNotFound)
+		case errors.Is(err, app.ErrNotParticipant):
+			http.Error(w, "Forbidden: not a participant of this session", http.StatusForbidden)
+		case errors.Is(err, app.ErrHostMustTransfer):
+			http.Error(w, "The host must transfer the session before leaving", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to leave session", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sh *SessionHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	var req app.SessionSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	session, err := sh.sessionService.UpdateSettings(r.Context(), sessionID, userID, req)
+	if err != nil {
+		sh.writeSessionError(w, err, "Failed to update session")
+		return
+	}
+
+	response, err := sh.sessionResponse(r.Context(), session)
+	if err != nil {
+		http.Error(w, "Failed to load participants", http.StatusInternalServerError)
+		return
+	}
+
+	sh.respondWithJSON(w, response, http.StatusOK)
+}
+
+// TransitionSession moves the session to the requested status, e.g. from
+// collecting to voting.
+func (sh *SessionHandler) TransitionSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	var req TransitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	session, err := sh.sessionService.TransitionSession(r.Context(), sessionID, userID, app.SessionStatus(req.Status))
+	if err != nil {
+		sh.writeSessionError(w, err, "Failed to change session status")
+		return
+	}
+
+	response, err := sh.sessionResponse(r.Context(), session)
+	if err != nil {
+		http.Error(w, "Failed to load participants", http.StatusInternalServerError)
+		return
+	}
+
+	sh.respondWithJSON(w, response, http.StatusOK)
+}
+
+func (sh *SessionHandler) StatusHistory(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	history, err := sh.sessionService.StatusHistory(r.Context(), sessionID)
+	if err != nil {
+		sh.writeSessionError(w, err, "Failed to load status history")
+		return
+	}
+
+	response := make([]StatusChangeResponse, len(history))
+	for i, change := range history {
+		response[i] = StatusChangeResponse{
+			FromStatus: change.FromStatus,
+			ToStatus:   change.ToStatus,
+			ChangedAt:  change.ChangedAt,
+		}
+		if change.ChangedByUserID.Valid {
+			response[i].ChangedByUserID = &change.ChangedByUserID.UUID
+		}
+	}
+
+	sh.respondWithJSON(w, response, http.StatusOK)
+}
+
+func (sh *SessionHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	actorID, sessionID, targetID, ok := sh.participantRoute(w, r)
+	if !ok {
+		return
+	}
+
+	var req SetRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := sh.sessionService.SetRole(r.Context(), sessionID, actorID, targetID, app.Role(req.Role)); err != nil {
+		sh.writeSessionError(w, err, "Failed to change role")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sh *SessionHandler) TransferHost(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	var req TransferHostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == uuid.Nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := sh.sessionService.TransferHost(r.Context(), sessionID, userID, req.UserID); err != nil {
+		sh.writeSessionError(w, err, "Failed to transfer host")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sh *SessionHandler) KickParticipant(w http.ResponseWriter, r *http.Request) {
+	sh.removeParticipant(w, r, false)
+}
+
+func (sh *SessionHandler) BanParticipant(w http.ResponseWriter, r *http.Request) {
+	sh.removeParticipant(w, r, true)
+}
+
+func (sh *SessionHandler) removeParticipant(w http.ResponseWriter, r *http.Request, ban bool) {
+	actorID, sessionID, targetID, ok := sh.participantRoute(w, r)
+	if !ok {
+		return
+	}
+
+	if err := sh.sessionService.RemoveParticipant(r.Context(), sessionID, actorID, targetID, ban); err != nil {
+		sh.writeSessionError(w, err, "Failed to remove participant")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// participantRoute reads the caller, the session and the targeted user from
+// a /api/session/{id}/participants/{user_id} route.
+func (sh *SessionHandler) participantRoute(w http.ResponseWriter, r *http.Request) (actorID, sessionID, targetID uuid.UUID, ok bool) {
+	actorID, ok = middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	sessionID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return actorID, sessionID, targetID, false
+	}
+	targetID, err = uuid.Parse(vars["user_id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return actorID, sessionID, targetID, false
+	}
+
+	return actorID, sessionID, targetID, true
+}
+
+func (sh *SessionHandler) writeSessionError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, app.ErrSessionNotFound):
+		http.Error(w, "Session not found", http.StatusNotFound)
+	case errors.Is(err, app.ErrNotParticipant):
+		http.Error(w, "Forbidden: not a participant of this session", http.StatusForbidden)
+	case errors.Is(err, app.ErrPermissionDenied):
+		http.Error(w, "Forbidden: your role in this session does not allow this", http.StatusForbidden)
+	case errors.Is(err, app.ErrParticipantMissing):
+		http.Error(w, "User is not an active participant of this session", http.StatusNotFound)
+	case errors.Is(err, app.ErrInvalidRole), errors.Is(err, app.ErrInvalidSettings),
+		errors.Is(err, app.ErrCannotTargetSelf):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, app.ErrUnknownVotingMethod):
+		http.Error(w, "Unknown voting method", http.StatusBadRequest)
+	case errors.Is(err, app.ErrInvalidStatus), errors.Is(err, app.ErrInvalidInvite):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, app.ErrInviteNotFound):
+		http.Error(w, "Invite not found", http.StatusNotFound)
+	case errors.Is(err, app.ErrInviteExpired), errors.Is(err, app.ErrInviteRevoked),
+		errors.Is(err, app.ErrInviteUsedUp):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, app.ErrSettingsLocked), errors.Is(err, app.ErrIllegalTransition),
+		errors.Is(err, app.ErrSessionDecided):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
+
+func (sh *SessionHandler) sessionResponse(ctx context.Context, session *database.Session) (*SessionResponse, error) {
+	participants, err := sh.sessionService.ListParticipants(ctx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SessionResponse{
+		SessionID:       session.ID,
+		SessionCode:     session.SessionCode,
+		SessionName:     session.SessionName,
+		CreatorUserID:   session.CreatorUserID,
+		Status:          session.Status,
+		VotingMethod:    session.VotingMethod,
+		Mode:            session.Mode,
+		OpenJoin:        session.OpenJoin,
+		RequireVerified: session.RequireVerified,
+		CreatedAt:       session.CreatedAt,
+		Participants:    make([]ParticipantResponse, 0, len(participants)),
+	}
+	if session.MatchThreshold.Valid {
+		response.MatchThreshold = &session.MatchThreshold.Int32
+	}
+	if session.WinningItemID.Valid {
+		response.WinningItemID = &session.WinningItemID.UUID
+	}
+	if session.DecidedAt.Valid {
+		response.DecidedAt = &session.DecidedAt.Time
+	}
+	if session.CollectUntil.Valid {
+		response.CollectUntil = &session.CollectUntil.Time
+	}
+	if session.VoteUntil.Valid {
+		response.VoteUntil = &session.VoteUntil.Time
+	}
+	for _, p := range participants {
+		response.Participants = append(response.Participants, ParticipantResponse{
+			UserID:   p.UserID,
+			JoinedAt: p.JoinedAt,
+			Status:   p.Status.String,
+			Role:     p.Role,
+		})
+	}
+
+	return response, nil
+}
+
+type joinCreds struct {
+	code   string
+	invite string
+}
+
+// joinCredentials picks the invite token or session code out of a join
+// request. Explicit fields win over an invite link, which wins over the query
+// parameters; at each level an invite wins over a code.
+func joinCredentials(req JoinSessionRequest, query url.Values) (joinCreds, error) {
+	if invite := strings.TrimSpace(req.Invite); invite != "" {
+		return joinCreds{invite: invite}, nil
+	}
+	if code := strings.TrimSpace(req.Code); code != "" {
+		return joinCreds{code: code}, nil
+	}
+	if req.InviteLink != "" {
+		link, err := url.Parse(req.InviteLink)
+		if err != nil {
+			return joinCreds{}, errors.New("invalid invite link")
+		}
+		if creds, ok := credsFromQuery(link.Query()); ok {
+			return creds, nil
+		}
+		return joinCreds{}, errors.New("invite link has no invite or session code")
+	}
+	if creds, ok := credsFromQuery(query); ok {
+		return creds, nil
+	}
+	return joinCreds{}, errors.New("invite or session code is required")
+}
+
+func credsFromQuery(query url.Values) (joinCreds, bool) {
+	if invite := strings.TrimSpace(query.Get("invite")); invite != "" {
+		return joinCreds{invite: invite}, true
+	}
+	if code := strings.TrimSpace(query.Get("code")); code != "" {
+		return joinCreds{code: code}, true
+	}
+	return joinCreds{}, false
+}
+
 func (sh *SessionHandler) respondWithJSON(w http.ResponseWriter, data any, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestJoinCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     JoinSessionRequest
+		query   string
+		want    joinCreds
+		wantErr bool
+	}{
+		{
+			name: "explicit code",
+			req:  JoinSessionRequest{Code: " ABC123 "},
+			want: joinCreds{code: "ABC123"},
+		},
+		{
+			name: "explicit invite",
+			req:  JoinSessionRequest{Invite: " tok3n "},
+			want: joinCreds{invite: "tok3n"},
+		},
+		{
+			name: "invite from invite link",
+			req:  JoinSessionRequest{InviteLink: "https://optio.example/join?invite=tok3n"},
+			want: joinCreds{invite: "tok3n"},
+		},
+		{
+			name: "code from invite link",
+			req:  JoinSessionRequest{InviteLink: "https://optio.example/join?code=XYZ789"},
+			want: joinCreds{code: "XYZ789"},
+		},
+		{
+			name:  "code from query parameter",
+			query: "code=QRS456",
+			want:  joinCreds{code: "QRS456"},
+		},
+		{
+			name:  "invite wins over code in query",
+			query: "code=QRS456&invite=tok3n",
+			want:  joinCreds{invite: "tok3n"},
+		},
+		{
+			name:  "explicit code wins over link and query",
+			req:   JoinSessionRequest{Code: "ABC123", InviteLink: "https://optio.example/join?invite=tok3n"},
+			query: "invite=other",
+			want:  joinCreds{code: "ABC123"},
+		},
+		{
+			name:    "invite link without invite or code",
+			req:     JoinSessionRequest{InviteLink: "https://optio.example/join"},
+			wantErr: true,
+		},
+		{
+			name:    "malformed invite link",
+			req:     JoinSessionRequest{InviteLink: "://bad"},
+			wantErr: true,
+		},
+		{
+			name:    "nothing supplied",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatalf("parse query: %v", err)
+			}
+			got, err := joinCredentials(test.req, query)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.want {
+				t.Fatalf("joinCredentials() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
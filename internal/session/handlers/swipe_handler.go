@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Kam1217/optio/app"
+	"github.com/Kam1217/optio/internal/auth/middleware"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type SwipeHandler struct {
+	swipeService *app.SwipeService
+}
+
+func NewSwipeHandler(s *app.SwipeService) *SwipeHandler {
+	return &SwipeHandler{swipeService: s}
+}
+
+type SwipeRequest struct {
+	ItemID uuid.UUID `json:"item_id"`
+	Liked  bool      `json:"liked"`
+}
+
+type SwipeResponse struct {
+	Matched       bool       `json:"matched"`
+	Status        string     `json:"status"`
+	WinningItemID *uuid.UUID `json:"winning_item_id,omitempty"`
+}
+
+func (sh *SwipeHandler) NextItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	item, err := sh.swipeService.NextItem(r.Context(), sessionID, userID)
+	if err != nil {
+		if errors.Is(err, app.ErrNoMoreItems) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		sh.writeSwipeError(w, err, "Failed to load next item")
+		return
+	}
+
+	sh.respondWithJSON(w, toItemResponse(item), http.StatusOK)
+}
+
+func (sh *SwipeHandler) Swipe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	var req SwipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.ItemID == uuid.Nil {
+		http.Error(w, "Item ID is required", http.StatusBadRequest)
+		return
+	}
+
+	result, err := sh.swipeService.Swipe(r.Context(), sessionID, userID, req.ItemID, req.Liked)
+	if err != nil {
+		sh.writeSwipeError(w, err, "Failed to record swipe")
+		return
+	}
+
+	response := SwipeResponse{
+		Matched: result.Matched,
+		Status:  result.Session.Status,
+	}
+	if result.Session.WinningItemID.Valid {
+		response.WinningItemID = &result.Session.WinningItemID.UUID
+	}
+	sh.respondWithJSON(w, response, http.StatusOK)
+}
+
+func (sh *SwipeHandler) writeSwipeError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, app.ErrSessionNotFound):
+		http.Error(w, "Session not found", http.StatusNotFound)
+	case errors.Is(err, app.ErrItemNotFound):
+		http.Error(w, "Item not found", http.StatusNotFound)
+	case errors.Is(err, app.ErrNotParticipant):
+		http.Error(w, "Forbidden: not a participant of this session", http.StatusForbidden)
+	case errors.Is(err, app.ErrPermissionDenied):
+		http.Error(w, "Forbidden: your role in this session does not allow this", http.StatusForbidden)
+	case errors.Is(err, app.ErrWrongSessionMode):
+		http.Error(w, "Session is not in swipe mode", http.StatusConflict)
+	case errors.Is(err, app.ErrSessionDecided):
+		http.Error(w, "Session has already been decided", http.StatusConflict)
+	case errors.Is(err, app.ErrVotingClosed):
+		http.Error(w, "Session is not open for voting", http.StatusConflict)
+	default:
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
+
+func (sh *SwipeHandler) respondWithJSON(w http.ResponseWriter, data any, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Kam1217/optio/app"
+	"github.com/Kam1217/optio/internal/auth/middleware"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type VoteHandler struct {
+	votingService *app.VotingService
+}
+
+func NewVoteHandler(v *app.VotingService) *VoteHandler {
+	return &VoteHandler{votingService: v}
+}
+
+type CastVotesRequest struct {
+	Votes []app.Vote `json:"votes"`
+}
+
+func (vh *VoteHandler) CastVotes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	var req CastVotesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := vh.votingService.CastBallot(r.Context(), sessionID, userID, req.Votes); err != nil {
+		vh.writeVotingError(w, err, "Failed to cast votes")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (vh *VoteHandler) GetResults(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := vh.votingService.Results(r.Context(), sessionID, userID)
+	if err != nil {
+		vh.writeVotingError(w, err, "Failed to compute results")
+		return
+	}
+
+	vh.respondWithJSON(w, result, http.StatusOK)
+}
+
+func (vh *VoteHandler) writeVotingError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, app.ErrSessionNotFound):
+		http.Error(w, "Session not found", http.StatusNotFound)
+	case errors.Is(err, app.ErrNotParticipant):
+		http.Error(w, "Forbidden: not a participant of this session", http.StatusForbidden)
+	case errors.Is(err, app.ErrPermissionDenied):
+		http.Error(w, "Forbidden: your role in this session does not allow this", http.StatusForbidden)
+	case errors.Is(err, app.ErrInvalidBallot):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, app.ErrWrongSessionMode):
+		http.Error(w, "Session is not in ballot mode", http.StatusConflict)
+	case errors.Is(err, app.ErrVotingClosed):
+		http.Error(w, "Session is not open for voting", http.StatusConflict)
+	default:
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
+
+func (vh *VoteHandler) respondWithJSON(w http.ResponseWriter, data any, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/Kam1217/optio/app"
@@ -13,6 +18,10 @@ import (
 	authhandlers "github.com/Kam1217/optio/internal/auth/handlers"
 	"github.com/Kam1217/optio/internal/auth/middleware"
 	"github.com/Kam1217/optio/internal/auth/models"
+	"github.com/Kam1217/optio/internal/auth/oidc"
+	"github.com/Kam1217/optio/internal/events"
+	"github.com/Kam1217/optio/internal/mail"
+	"github.com/Kam1217/optio/internal/session/authz"
 	sessionhandlers "github.com/Kam1217/optio/internal/session/handlers"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -27,11 +36,14 @@ func main() {
 
 	port := os.Getenv("PORT")
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET is required")
+	keys, err := newKeyring()
+	if err != nil {
+		log.Fatalf("JWT keys: %v", err)
+	}
+	jwtMgr := middleware.NewJWTManagerWithKeys(keys, "optio", "optio-api", 15*time.Minute)
+	if ttl := durEnv("GUEST_TOKEN_TTL", "4h"); ttl > 0 {
+		jwtMgr.GuestExpiresIn = ttl
 	}
-	jwtMgr := middleware.NewJWTManager(jwtSecret, "optio", "optio-api", 15*time.Minute)
 
 	dbConfig := db.Config{
 		DBName:          os.Getenv("DB_NAME"),
@@ -54,42 +66,175 @@ func main() {
 	defer dbConn.Close()
 	log.Printf("Succesfully connected to the database")
 
-	userService := models.NewUserService(dbConn.Queries)
+	userService := models.NewUserService(dbConn.DB, dbConn.Queries)
+	versionTTL := durEnv("TOKEN_VERSION_CACHE_TTL", "30s")
+	if versionTTL <= 0 {
+		versionTTL = middleware.DefaultTokenVersionTTL
+	}
+	jwtMgr.Versions = middleware.NewTokenVersionCache(userService, versionTTL)
 	authHandler := authhandlers.NewAuthHandler(dbConn.DB, userService, jwtMgr)
 	refreshTTL := 30 * 24 * time.Hour
-	refreshSvc := models.NewRefreshService(dbConn.Queries, refreshTTL)
+	refreshSvc := models.NewRefreshService(dbConn.DB, dbConn.Queries, refreshTTL)
 	authHandler.Refresh = refreshSvc
 	authHandler.RefreshTTL = refreshTTL
 	authHandler.CookieDomain = ""
 
+	mailer, err := newMailer()
+	if err != nil {
+		log.Fatalf("Mailer: %v", err)
+	}
+	resetURL := os.Getenv("PASSWORD_RESET_URL")
+	if resetURL == "" {
+		log.Fatalf("PASSWORD_RESET_URL is required for password resets")
+	}
+	authHandler.Resets = models.NewPasswordResetService(dbConn.DB, dbConn.Queries, mailer, resetURL)
+	verifyURL := os.Getenv("EMAIL_VERIFY_URL")
+	if verifyURL == "" {
+		log.Fatalf("EMAIL_VERIFY_URL is required for email verification")
+	}
+	authHandler.Verification = models.NewEmailVerificationService(dbConn.DB, dbConn.Queries, mailer, verifyURL)
+	authHandler.MFA = models.NewMFAService(dbConn.DB, dbConn.Queries, "Optio")
+	authHandler.Identities = models.NewIdentityService(dbConn.DB, dbConn.Queries)
+	authHandler.PATs = models.NewPATService(dbConn.DB, dbConn.Queries)
+	jwtMgr.PATs = authHandler.PATs
+	authHandler.OIDC, err = oidcProviders()
+	if err != nil {
+		log.Fatalf("OIDC providers: %v", err)
+	}
+
 	inviteURL := os.Getenv("INVITE_BASE_URL")
 	if inviteURL == "" {
 		log.Fatalf("INVITE_BASE_URL is required for session invites")
 	}
-	sessionService := app.NewSessionService(dbConn.Queries, inviteURL)
-	sessionItem := app.NewSessionItemService(dbConn.Queries)
+	sessionService := app.NewSessionService(dbConn.DB, dbConn.Queries, inviteURL)
+	codes, err := app.NewCodeGenerator(os.Getenv("SESSION_CODE_STYLE"), atoiEnv("SESSION_CODE_LENGTH", 0))
+	if err != nil {
+		log.Fatalf("Session codes: %v", err)
+	}
+	sessionService.Codes = codes
+	sessionService.CodeAttempts = atoiEnv("SESSION_CODE_ATTEMPTS", app.DefaultCodeAttempts)
+	sessionService.RequireVerifiedCreators = boolEnv("REQUIRE_VERIFIED_EMAIL_TO_CREATE_SESSIONS", false)
+	sessionItem := app.NewSessionItemService(dbConn.DB, dbConn.Queries)
+	sessionItem.RegisterProvider(app.NewSteamProvider(os.Getenv("STEAM_STORE_URL"), os.Getenv("STEAM_API_URL")))
+	votingService := app.NewVotingService(dbConn.DB, dbConn.Queries)
+	swipeService := app.NewSwipeService(dbConn.DB, dbConn.Queries)
+
+	bus, closeBus, err := newEventBus(dbConn)
+	if err != nil {
+		log.Fatalf("Event bus: %v", err)
+	}
+	defer closeBus()
 
-	router := setUpRouts(authHandler, jwtMgr, sessionService, sessionItem)
+	hub := events.NewHub(events.HubConfig{}, bus)
+	sessionService.Events = hub
+	sessionItem.Events = hub
+	votingService.Events = hub
+	swipeService.Events = hub
 
-	if err := http.ListenAndServe(":"+port, router); err != nil {
+	scheduler := app.NewScheduler(dbConn.DB, dbConn.Queries)
+	scheduler.Events = hub
+	scheduler.Interval = durEnv("SCHEDULER_INTERVAL", "15s")
+
+	// Background work stops, and the server drains, on SIGINT or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go scheduler.Run(ctx)
+
+	router := setUpRouts(authHandler, jwtMgr, sessionService, sessionItem, votingService, swipeService, hub)
+
+	server := &http.Server{Addr: ":" + port, Handler: router}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Shut down server: %v", err)
+		}
+	}()
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Listen and serve: %v", err)
 	}
 }
 
-func setUpRouts(authHandler *authhandlers.AuthHandler, jwtMgr *middleware.JWTManager, sessionService *app.SessionService, sessionItem *app.SessionItemService) *mux.Router {
+func setUpRouts(authHandler *authhandlers.AuthHandler, jwtMgr *middleware.JWTManager, sessionService *app.SessionService, sessionItem *app.SessionItemService, votingService *app.VotingService, swipeService *app.SwipeService, hub *events.Hub) *mux.Router {
 	router := mux.NewRouter()
 	router.Use(corsMiddleware)
 
+	router.HandleFunc("/.well-known/jwks.json", authHandler.JWKS).Methods("GET")
 	router.HandleFunc("/api/auth/register", authHandler.RegisterUser).Methods("POST")
 	router.HandleFunc("/api/auth/login", authHandler.LoginUser).Methods("POST")
+	router.HandleFunc("/api/auth/login/mfa", authHandler.LoginMFA).Methods("POST")
 	router.Handle("/api/auth/profile", jwtMgr.JWTMiddleware(http.HandlerFunc(authHandler.Profile))).Methods("GET")
 	router.HandleFunc("/api/auth/refresh", authHandler.RefreshSession).Methods("POST")
 	router.HandleFunc("/api/auth/logout", authHandler.Logout).Methods("POST")
+	router.HandleFunc("/api/auth/password/forgot", authHandler.ForgotPassword).Methods("POST")
+	router.HandleFunc("/api/auth/password/reset", authHandler.ResetPassword).Methods("POST")
+	router.HandleFunc("/api/auth/password", jwtMgr.JWTMiddleware(authHandler.ChangePassword)).Methods("POST")
+	router.HandleFunc("/api/auth/mfa/totp", jwtMgr.JWTMiddleware(authHandler.BeginTOTP)).Methods("POST")
+	router.HandleFunc("/api/auth/mfa/totp/confirm", jwtMgr.JWTMiddleware(authHandler.ConfirmTOTP)).Methods("POST")
+	router.HandleFunc("/api/auth/mfa/totp/disable", jwtMgr.JWTMiddleware(authHandler.DisableTOTP)).Methods("POST")
+	router.HandleFunc("/api/auth/mfa/recovery-codes", jwtMgr.JWTMiddleware(authHandler.RegenerateRecoveryCodes)).Methods("POST")
+	router.HandleFunc("/api/auth/email", jwtMgr.JWTMiddleware(authHandler.UpdateEmail)).Methods("PUT")
+	router.HandleFunc("/api/auth/email/verify", authHandler.VerifyEmail).Methods("POST")
+	router.HandleFunc("/api/auth/email/verification", jwtMgr.JWTMiddleware(authHandler.ResendVerification)).Methods("POST")
+	router.HandleFunc("/api/auth/guest/upgrade", jwtMgr.GuestJWTMiddleware(authHandler.UpgradeGuest)).Methods("POST")
+	router.HandleFunc("/api/auth/sessions", jwtMgr.JWTMiddleware(authHandler.ListSessions)).Methods("GET")
+	router.HandleFunc("/api/auth/sessions/{id}", jwtMgr.JWTMiddleware(authHandler.RevokeSession)).Methods("DELETE")
+	router.HandleFunc("/api/auth/logout-all", jwtMgr.JWTMiddleware(authHandler.LogoutAll)).Methods("POST")
+	router.HandleFunc("/api/auth/oidc/{provider}/start", authHandler.StartOIDCLogin).Methods("GET")
+	router.HandleFunc("/api/auth/oidc/{provider}/callback", authHandler.OIDCCallback).Methods("GET")
+	router.HandleFunc("/api/auth/oidc/{provider}/link", jwtMgr.JWTMiddleware(authHandler.StartOIDCLink)).Methods("POST")
+	router.HandleFunc("/api/auth/identities", jwtMgr.JWTMiddleware(authHandler.ListIdentities)).Methods("GET")
+	router.HandleFunc("/api/auth/identities/{id}", jwtMgr.JWTMiddleware(authHandler.UnlinkIdentity)).Methods("DELETE")
+	router.HandleFunc("/api/auth/tokens", jwtMgr.JWTMiddleware(authHandler.CreatePAT)).Methods("POST")
+	router.HandleFunc("/api/auth/tokens", jwtMgr.JWTMiddleware(authHandler.ListPATs)).Methods("GET")
+	router.HandleFunc("/api/auth/tokens/{id}", jwtMgr.JWTMiddleware(authHandler.RevokePAT)).Methods("DELETE")
 
 	sessionHandler := sessionhandlers.NewSessionHandler(sessionService)
+	sessionHandler.JWT = jwtMgr
 	itemHandler := sessionhandlers.NewItemHandler(sessionItem)
-	router.HandleFunc("/api/session", jwtMgr.JWTMiddleware(http.HandlerFunc(sessionHandler.CreateSession))).Methods("POST")
-	router.HandleFunc("/api/item", jwtMgr.JWTMiddleware(http.HandlerFunc(itemHandler.CreateItem))).Methods("POST")
+	voteHandler := sessionhandlers.NewVoteHandler(votingService)
+	swipeHandler := sessionhandlers.NewSwipeHandler(swipeService)
+	eventsHandler := sessionhandlers.NewEventsHandler(hub)
+	access := authz.NewAuthorizer(sessionService)
+	member := func(scope string, h http.HandlerFunc) http.HandlerFunc {
+		return jwtMgr.ScopedGuestJWTMiddleware(scope, access.RequireSessionMember(h))
+	}
+	itemMember := func(scope string, h http.HandlerFunc) http.HandlerFunc {
+		return jwtMgr.ScopedGuestJWTMiddleware(scope, access.RequireItemMember(h))
+	}
+	permitted := func(p app.Permission, scope string, h http.HandlerFunc) http.HandlerFunc {
+		return jwtMgr.ScopedGuestJWTMiddleware(scope, access.RequirePermission(p, h))
+	}
+
+	router.HandleFunc("/api/session", jwtMgr.ScopedJWTMiddleware(models.ScopeSessionsWrite, sessionHandler.CreateSession)).Methods("POST")
+	router.HandleFunc("/api/session/join", jwtMgr.ScopedJWTMiddleware(models.ScopeSessionsWrite, sessionHandler.JoinSession)).Methods("POST")
+	router.HandleFunc("/api/session/guest", sessionHandler.GuestJoin).Methods("POST")
+	router.HandleFunc("/api/session/{id}", member(models.ScopeSessionsRead, sessionHandler.GetSession)).Methods("GET")
+	router.HandleFunc("/api/session/{id}", permitted(app.PermChangeSettings, models.ScopeSessionsWrite, sessionHandler.UpdateSettings)).Methods("PATCH")
+	router.HandleFunc("/api/session/{id}/leave", member(models.ScopeSessionsWrite, sessionHandler.LeaveSession)).Methods("POST")
+	router.HandleFunc("/api/session/{id}/status", permitted(app.PermManageVoting, models.ScopeSessionsWrite, sessionHandler.TransitionSession)).Methods("POST")
+	router.HandleFunc("/api/session/{id}/history", member(models.ScopeSessionsRead, sessionHandler.StatusHistory)).Methods("GET")
+	router.HandleFunc("/api/session/{id}/invites", permitted(app.PermManageParticipants, models.ScopeSessionsWrite, sessionHandler.CreateInvite)).Methods("POST")
+	router.HandleFunc("/api/session/{id}/invites", permitted(app.PermManageParticipants, models.ScopeSessionsRead, sessionHandler.ListInvites)).Methods("GET")
+	router.HandleFunc("/api/session/{id}/invites/{invite_id}", permitted(app.PermManageParticipants, models.ScopeSessionsWrite, sessionHandler.RevokeInvite)).Methods("DELETE")
+	router.HandleFunc("/api/session/{id}/invite.png", permitted(app.PermManageParticipants, models.ScopeSessionsRead, sessionHandler.InviteQRPNG)).Methods("GET")
+	router.HandleFunc("/api/session/{id}/invite.svg", permitted(app.PermManageParticipants, models.ScopeSessionsRead, sessionHandler.InviteQRSVG)).Methods("GET")
+	router.HandleFunc("/api/session/{id}/host", permitted(app.PermManageCoHosts, models.ScopeSessionsWrite, sessionHandler.TransferHost)).Methods("POST")
+	router.HandleFunc("/api/session/{id}/participants/{user_id}/role", permitted(app.PermManageParticipants, models.ScopeSessionsWrite, sessionHandler.SetRole)).Methods("PUT")
+	router.HandleFunc("/api/session/{id}/participants/{user_id}/kick", permitted(app.PermManageParticipants, models.ScopeSessionsWrite, sessionHandler.KickParticipant)).Methods("POST")
+	router.HandleFunc("/api/session/{id}/participants/{user_id}/ban", permitted(app.PermManageParticipants, models.ScopeSessionsWrite, sessionHandler.BanParticipant)).Methods("POST")
+	router.HandleFunc("/api/session/{id}/ws", jwtMgr.WebSocketMiddleware(access.RequireSessionMember(eventsHandler.Stream))).Methods("GET")
+	router.HandleFunc("/api/session/{id}/votes", member(models.ScopeVotesWrite, voteHandler.CastVotes)).Methods("POST")
+	router.HandleFunc("/api/session/{id}/results", member(models.ScopeSessionsRead, voteHandler.GetResults)).Methods("GET")
+	router.HandleFunc("/api/session/{id}/next-item", member(models.ScopeItemsRead, swipeHandler.NextItem)).Methods("GET")
+	router.HandleFunc("/api/session/{id}/swipes", member(models.ScopeVotesWrite, swipeHandler.Swipe)).Methods("POST")
+	router.HandleFunc("/api/session/{id}/items", member(models.ScopeItemsRead, itemHandler.ListItems)).Methods("GET")
+	router.HandleFunc("/api/session/{id}/items", member(models.ScopeItemsWrite, itemHandler.CreateItem)).Methods("POST")
+	router.HandleFunc("/api/item", jwtMgr.ScopedJWTMiddleware(models.ScopeItemsWrite, itemHandler.CreateItem)).Methods("POST")
+	router.HandleFunc("/api/item/{id}", itemMember(models.ScopeItemsRead, itemHandler.GetItem)).Methods("GET")
+	router.HandleFunc("/api/item/{id}", itemMember(models.ScopeItemsWrite, itemHandler.UpdateItem)).Methods("PATCH")
+	router.HandleFunc("/api/item/{id}", itemMember(models.ScopeItemsWrite, itemHandler.DeleteItem)).Methods("DELETE")
 
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -107,10 +252,125 @@ func setUpRouts(authHandler *authhandlers.AuthHandler, jwtMgr *middleware.JWTMan
 	return router
 }
 
+// newEventBus picks the bus session events travel over. Postgres is the
+// default so that every replica sees every event; EVENT_BUS=memory keeps them
+// in-process for single-instance deployments.
+func newEventBus(dbConn *db.DB) (events.Bus, func(), error) {
+	switch kind := os.Getenv("EVENT_BUS"); kind {
+	case "", "postgres":
+		bus, err := dbConn.NewEventBus(events.PostgresBusConfig{
+			MinReconnectInterval: durEnv("EVENT_BUS_MIN_RECONNECT", "1s"),
+			MaxReconnectInterval: durEnv("EVENT_BUS_MAX_RECONNECT", "1m"),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return bus, func() { _ = bus.Close() }, nil
+	case "memory":
+		return events.NewMemoryBus(), func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown EVENT_BUS %q", kind)
+	}
+}
+
+// newMailer picks how emails are sent. MAILER=log, the default, prints them
+// instead, which suits development; MAILER=smtp sends them through SMTP_ADDR.
+func newMailer() (mail.Mailer, error) {
+	switch kind := os.Getenv("MAILER"); kind {
+	case "", "log":
+		return mail.NewLogMailer(os.Stdout), nil
+	case "smtp":
+		m := &mail.SMTPMailer{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+		if m.Addr == "" || m.From == "" {
+			return nil, fmt.Errorf("SMTP_ADDR and MAIL_FROM are required for MAILER=smtp")
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", kind)
+	}
+}
+
+// newKeyring loads the keys tokens are signed with. JWT_KEYS_DIR holds Ed25519
+// or RSA keys as <key ID>.pem files, and JWT_ACTIVE_KEY picks the one new
+// tokens are signed with. Keys listed in JWT_RETIRED_KEYS are no longer
+// accepted. JWT_SECRET adds the HS256 secret tokens used to be signed with;
+// without JWT_ACTIVE_KEY it signs new tokens too.
+func newKeyring() (*middleware.Keyring, error) {
+	keys := middleware.NewKeyring()
+	secret := os.Getenv("JWT_SECRET")
+	if secret != "" {
+		if err := keys.Add(middleware.NewHMACKey("", []byte(secret))); err != nil {
+			return nil, err
+		}
+	}
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		if err := keys.LoadDir(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	active := os.Getenv("JWT_ACTIVE_KEY")
+	if active == "" && secret == "" {
+		return nil, fmt.Errorf("JWT_SECRET or JWT_KEYS_DIR and JWT_ACTIVE_KEY are required")
+	}
+	if err := keys.SetActive(active); err != nil {
+		return nil, err
+	}
+	for _, id := range strings.Split(os.Getenv("JWT_RETIRED_KEYS"), ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		if err := keys.Retire(id); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// oidcProviders reads the sign-in providers from the environment.
+// OIDC_PROVIDERS lists their names, e.g. "google,microsoft", and each has
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET, and
+// optionally OIDC_<NAME>_SCOPES. Providers call back to
+// OIDC_REDIRECT_BASE_URL/api/auth/oidc/<name>/callback.
+func oidcProviders() (map[string]*oidc.Provider, error) {
+	providers := map[string]*oidc.Provider{}
+	names := strings.TrimSpace(os.Getenv("OIDC_PROVIDERS"))
+	if names == "" {
+		return providers, nil
+	}
+	base := strings.TrimSuffix(os.Getenv("OIDC_REDIRECT_BASE_URL"), "/")
+	if base == "" {
+		return nil, fmt.Errorf("OIDC_REDIRECT_BASE_URL is required with OIDC_PROVIDERS")
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		cfg := oidc.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  base + "/api/auth/oidc/" + name + "/callback",
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" || cfg.ClientSecret == "" {
+			return nil, fmt.Errorf("%sISSUER, %[1]sCLIENT_ID and %[1]sCLIENT_SECRET are required", prefix)
+		}
+		providers[name] = oidc.NewProvider(cfg, nil)
+	}
+	return providers, nil
+}
+
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		if r.Method == "OPTIONS" {
@@ -134,6 +394,14 @@ func atoiEnv(key string, def int) int {
 	return valueInt
 }
 
+func boolEnv(key string, def bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
 func durEnv(key, _ string) time.Duration {
 	value := os.Getenv(key)
 	if value == "" {
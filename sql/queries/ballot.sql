@@ -0,0 +1,32 @@
+-- name: UpsertBallot :one
+INSERT INTO ballot (session_id, user_id)
+VALUES (
+    $1,
+    $2
+)
+ON CONFLICT (session_id, user_id) DO UPDATE SET updated_at = NOW()
+RETURNING *;
+
+-- name: DeleteBallotVotes :exec
+DELETE FROM vote
+WHERE ballot_id = $1;
+
+-- name: CreateVote :exec
+INSERT INTO vote (ballot_id, item_id, value)
+VALUES (
+    $1,
+    $2,
+    $3
+);
+
+-- name: ListSessionVotes :many
+SELECT ballot.user_id, vote.item_id, vote.value
+FROM vote
+JOIN ballot ON ballot.id = vote.ballot_id
+WHERE ballot.session_id = $1
+ORDER BY ballot.user_id, vote.value, vote.item_id;
+
+-- name: CountSessionBallots :one
+SELECT COUNT(*)
+FROM ballot
+WHERE session_id = $1;
@@ -0,0 +1,24 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_token (user_id, email, token_hash, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: ConsumeEmailVerificationToken :one
+-- Marks the token used if it still works, so that only one request can
+-- redeem it.
+UPDATE email_verification_token
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: InvalidateEmailVerificationTokensForUser :exec
+UPDATE email_verification_token
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: MarkEmailVerified :execrows
+-- Only verifies the address the token was sent to; nothing happens if the
+-- user has changed their email since.
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2 AND deleted_at IS NULL;
@@ -0,0 +1,95 @@
+-- name: StartTOTPEnrollment :one
+-- Starts or restarts an enrolment. Nothing happens once two-factor is on;
+-- it has to be disabled first.
+INSERT INTO user_totp (user_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_used_step = NULL, created_at = NOW()
+WHERE user_totp.confirmed_at IS NULL
+RETURNING *;
+
+-- name: GetUserTOTP :one
+SELECT *
+FROM user_totp
+WHERE user_id = $1;
+
+-- name: GetUserTOTPForUpdate :one
+SELECT *
+FROM user_totp
+WHERE user_id = $1
+FOR UPDATE;
+
+-- name: ConfirmTOTPEnrollment :exec
+UPDATE user_totp
+SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1;
+
+-- name: SetTOTPLastUsedStep :exec
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1;
+
+-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO mfa_recovery_code (user_id, code_hash)
+VALUES ($1, $2);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM mfa_recovery_code
+WHERE user_id = $1;
+
+-- name: ConsumeRecoveryCode :execrows
+UPDATE mfa_recovery_code
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*)
+FROM mfa_recovery_code
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: RecordTOTPFailure :one
+UPDATE user_totp
+SET failed_attempts = failed_attempts + 1
+WHERE user_id = $1
+RETURNING failed_attempts;
+
+-- name: LockTOTP :exec
+UPDATE user_totp
+SET failed_attempts = 0, locked_until = $2
+WHERE user_id = $1;
+
+-- name: ResetTOTPFailures :exec
+UPDATE user_totp
+SET failed_attempts = 0, locked_until = NULL
+WHERE user_id = $1;
+
+-- name: DeleteExpiredMFAChallenges :exec
+-- Kept a little past expiry, as tokens are accepted with some leeway.
+DELETE FROM mfa_challenge
+WHERE expires_at < NOW() - INTERVAL '5 minutes';
+
+-- name: ClaimMFAChallenge :exec
+INSERT INTO mfa_challenge (challenge_id, user_id, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (challenge_id) DO NOTHING;
+
+-- name: GetMFAChallengeForUpdate :one
+SELECT *
+FROM mfa_challenge
+WHERE challenge_id = $1 AND user_id = $2
+FOR UPDATE;
+
+-- name: RecordMFAChallengeFailure :one
+UPDATE mfa_challenge
+SET failed_attempts = failed_attempts + 1
+WHERE challenge_id = $1
+RETURNING failed_attempts;
+
+-- name: SpendMFAChallenge :exec
+UPDATE mfa_challenge
+SET spent_at = NOW()
+WHERE challenge_id = $1;
@@ -0,0 +1,17 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_token (user_id, token_hash, expires_at)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: ConsumePasswordResetToken :one
+-- Marks the token used if it still works, so that only one request can
+-- redeem it.
+UPDATE password_reset_token
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: InvalidatePasswordResetTokensForUser :exec
+UPDATE password_reset_token
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
@@ -0,0 +1,35 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_token (user_id, name, token_hash, token_hint, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: ListPersonalAccessTokens :many
+-- Expired tokens are still listed, so people can see why a script stopped.
+SELECT *
+FROM personal_access_token
+WHERE user_id = $1 AND revoked_at IS NULL
+ORDER BY created_at DESC, id DESC;
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_token
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllPersonalAccessTokensForUser :exec
+UPDATE personal_access_token
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: AuthenticatePersonalAccessToken :one
+SELECT t.id, t.user_id, u.username, t.scopes, t.last_used_at
+FROM personal_access_token t
+JOIN users u ON u.id = t.user_id
+WHERE t.token_hash = $1
+  AND t.revoked_at IS NULL
+  AND (t.expires_at IS NULL OR t.expires_at > NOW())
+  AND u.deleted_at IS NULL;
+
+-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_token
+SET last_used_at = NOW()
+WHERE id = $1;
@@ -1,25 +1,49 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_token(user_id, token_hash, issued_at, expires_at, user_agent, ip)
+INSERT INTO refresh_token(user_id, token_hash, issued_at, expires_at, user_agent, ip, family_id, login_at, last_used_at)
 VALUES(
      $1,
      $2,
      $3,
      $4,
      $5,
-     $6
+     $6,
+     $7,
+     $8,
+     $9
 )
-RETURNING user_id, token_hash, issued_at, expires_at, revoked_at, user_agent, ip;
+RETURNING id, user_id, token_hash, issued_at, expires_at, revoked_at, user_agent, ip, family_id, replaced_by_id, login_at, last_used_at;
 
 -- name: GetRefreshTokenByHash :one
-SELECT id, user_id, token_hash, issued_at, expires_at, revoked_at, user_agent, ip
+SELECT id, user_id, token_hash, issued_at, expires_at, revoked_at, user_agent, ip, family_id, replaced_by_id, login_at, last_used_at
 FROM refresh_token
 WHERE token_hash = $1;
 
+-- name: GetRefreshTokenByHashForUpdate :one
+SELECT id, user_id, token_hash, issued_at, expires_at, revoked_at, user_agent, ip, family_id, replaced_by_id, login_at, last_used_at
+FROM refresh_token
+WHERE token_hash = $1
+FOR UPDATE;
+
 -- name: RevokeRefreshTokenByID :exec
 UPDATE refresh_token 
 SET revoked_at = NOW()
 WHERE id=$1 AND revoked_at IS NULL;
 
+-- name: ReplaceRefreshToken :exec
+UPDATE refresh_token
+SET revoked_at = NOW(), replaced_by_id = $2
+WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_token
+SET revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokenFamily :execrows
+UPDATE refresh_token
+SET revoked_at = NOW()
+WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL;
+
 -- name: RevokeAllRefreshTokensForUser :exec
 UPDATE refresh_token
 SET revoked_at = NOW()
@@ -30,14 +54,14 @@ DELETE FROM refresh_token
 WHERE expires_at < NOW();
 
 -- name: GetActiveRefreshTokenByHash :one
-SELECT id, user_id, token_hash, issued_at, expires_at, revoked_at, user_agent, ip
+SELECT id, user_id, token_hash, issued_at, expires_at, revoked_at, user_agent, ip, family_id, replaced_by_id, login_at, last_used_at
 FROM refresh_token
 WHERE token_hash = $1
 AND revoked_at IS NULL
 AND expires_at > NOW();
 
 -- name: ListActiveTokensForUser :many
-SELECT id, user_id, issued_at, expires_at, user_agent, ip
+SELECT id, user_id, issued_at, expires_at, user_agent, ip, family_id, login_at, last_used_at
 FROM refresh_token
 WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
-ORDER BY issued_at DESC;
\ No newline at end of file
+ORDER BY COALESCE(last_used_at, login_at) DESC;
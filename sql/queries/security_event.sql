@@ -0,0 +1,10 @@
+-- name: CreateSecurityEvent :one
+INSERT INTO security_event (user_id, event_type, family_id, user_agent, ip)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: ListSecurityEventsForUser :many
+SELECT * FROM security_event
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
@@ -1,10 +1,20 @@
 -- name: CreateSession :one
-INSERT INTO session (session_code, session_name, creator_user_id)
+INSERT INTO session (session_code, session_name, creator_user_id, voting_method, mode, match_threshold, collect_until, vote_until, open_join, require_verified)
 VALUES (
     $1,
     $2,
-    $3
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10
 )
+-- A code still in use by a live session makes this return no rows, and the
+-- caller tries another.
+ON CONFLICT (lower(session_code)) WHERE status <> 'archived' DO NOTHING
 RETURNING *;
 
 -- name: DeleteSession :exec
@@ -28,12 +38,36 @@ UPDATE session
 SET session_name = $2, updated_at = NOW()
 WHERE id = $1;
 
--- name: UpdateSessionStatus :exec
+-- name: TransitionSessionStatus :one
 UPDATE session
-SET status = $2, updated_at = NOW()
-WHERE id = $1;
+SET status = @to_status, updated_at = NOW()
+WHERE id = @id AND status = @from_status
+RETURNING *;
 
 -- name: GetActiveSessionByCode :one
 SELECT * 
 FROM session
-WHERE session_code = $1;
\ No newline at end of file
+WHERE lower(session_code) = lower(@code) AND status <> 'archived';
+
+-- name: RecordSessionDecision :one
+UPDATE session
+SET status = 'decided', winning_item_id = $2, decided_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'voting'
+RETURNING *;
+
+-- name: UpdateSessionSettings :one
+UPDATE session
+SET session_name = $2, voting_method = $3, match_threshold = $4, collect_until = $5, vote_until = $6, open_join = $7, require_verified = $8, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: ClaimDueSession :one
+-- Locks one session whose deadline has passed. Rows another replica holds
+-- are skipped rather than waited on, as are the sessions listed in skip.
+SELECT *
+FROM session
+WHERE ((status IN ('pending', 'collecting') AND collect_until <= @now::timestamptz)
+   OR (status = 'voting' AND vote_until <= @now::timestamptz))
+  AND NOT (id = ANY(COALESCE(@skip::uuid[], '{}')))
+LIMIT 1
+FOR UPDATE SKIP LOCKED;
@@ -0,0 +1,39 @@
+-- name: CreateSessionInvite :one
+INSERT INTO session_invite (session_id, token_hash, role, max_uses, expires_at, created_by_user_id)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetSessionInviteByHash :one
+SELECT *
+FROM session_invite
+WHERE token_hash = $1;
+
+-- name: ListSessionInvites :many
+SELECT *
+FROM session_invite
+WHERE session_id = $1
+ORDER BY created_at DESC, id DESC;
+
+-- name: RevokeSessionInvite :one
+UPDATE session_invite
+SET revoked_at = NOW()
+WHERE id = $1 AND session_id = $2 AND revoked_at IS NULL
+RETURNING *;
+
+-- name: ConsumeSessionInvite :one
+-- Takes one use from the invite, but only while it is still valid, so two
+-- people racing for the last use cannot both get in.
+UPDATE session_invite
+SET use_count = use_count + 1
+WHERE id = $1
+  AND revoked_at IS NULL
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND (max_uses IS NULL OR use_count < max_uses)
+RETURNING *;
@@ -37,6 +37,12 @@ WHERE session_id = $1
 ORDER BY created_at DESC, id DESC
 LIMIT $2 OFFSET $3;
 
+-- name: ListAllSessionItems :many
+SELECT *
+FROM session_item
+WHERE session_id = $1
+ORDER BY created_at ASC, id ASC;
+
 -- name: UpdateItemTitle :exec
 UPDATE session_item
 SET item_title = $2, updated_at = NOW()
@@ -50,4 +56,22 @@ WHERE id = $1;
 -- name: UpdateItemImage :exec
 UPDATE session_item
 SET image_url = $2, updated_at = NOW()
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: GetSessionItemBySource :one
+SELECT *
+FROM session_item
+WHERE session_id = $1 AND source_type = $2 AND source_id = $3;
+
+-- name: CountSessionItems :one
+SELECT COUNT(*)
+FROM session_item
+WHERE session_id = $1;
+
+-- name: SessionItemTitleExists :one
+-- Only custom items are unique by title; items from a source may share one.
+SELECT EXISTS (
+    SELECT 1
+    FROM session_item
+    WHERE session_id = $1 AND source_type = 'custom' AND LOWER(item_title) = LOWER(@item_title::text) AND id <> @exclude_id
+);
@@ -1,9 +1,12 @@
 -- name: CreateSessionParticipant :one
-INSERT INTO session_participant (user_id, session_id)
+INSERT INTO session_participant (user_id, session_id, status, role)
 VALUES(
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
+ON CONFLICT (user_id, session_id) DO NOTHING
 RETURNING *;
 
 -- name: DeleteSessionParticipant :exec
@@ -22,3 +25,23 @@ WHERE session_id = $1
 ORDER BY joined_at DESC
 LIMIT $2 OFFSET $3;
 
+-- name: ListSessionParticipants :many
+SELECT *
+FROM session_participant
+WHERE session_id = $1
+ORDER BY joined_at ASC, user_id ASC;
+
+-- name: UpdateSessionParticipantStatus :exec
+UPDATE session_participant
+SET status = $3
+WHERE user_id = $1 AND session_id = $2;
+
+-- name: UpdateSessionParticipantRole :exec
+UPDATE session_participant
+SET role = $3
+WHERE user_id = $1 AND session_id = $2;
+
+-- name: RejoinSessionParticipant :exec
+UPDATE session_participant
+SET status = 'active', role = $3, joined_at = NOW()
+WHERE user_id = $1 AND session_id = $2;
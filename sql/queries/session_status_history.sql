@@ -0,0 +1,15 @@
+-- name: CreateSessionStatusHistory :one
+INSERT INTO session_status_history (session_id, from_status, to_status, changed_by_user_id)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: ListSessionStatusHistory :many
+SELECT *
+FROM session_status_history
+WHERE session_id = $1
+ORDER BY changed_at ASC, id ASC;
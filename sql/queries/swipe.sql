@@ -0,0 +1,46 @@
+-- name: UpsertSwipe :one
+INSERT INTO swipe (session_id, item_id, user_id, liked)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (item_id, user_id) DO UPDATE SET liked = EXCLUDED.liked, created_at = NOW()
+RETURNING *;
+
+-- name: ListSwipedItemIDs :many
+SELECT item_id
+FROM swipe
+WHERE session_id = $1 AND user_id = $2;
+
+-- name: CountItemLikes :one
+SELECT COUNT(*)
+FROM swipe
+JOIN session_participant ON session_participant.user_id = swipe.user_id
+    AND session_participant.session_id = swipe.session_id
+WHERE swipe.item_id = $1
+AND swipe.liked
+AND session_participant.status = 'active'
+AND session_participant.role <> 'spectator';
+
+-- name: CountActiveSessionParticipants :one
+-- Spectators cannot swipe, so they do not count towards a match.
+SELECT COUNT(*)
+FROM session_participant
+WHERE session_id = $1 AND status = 'active' AND role <> 'spectator';
+
+-- name: MostLikedSessionItem :one
+-- The item the most active participants like, the earliest added on a tie.
+SELECT swipe.item_id, COUNT(*) AS likes
+FROM swipe
+JOIN session_participant ON session_participant.user_id = swipe.user_id
+    AND session_participant.session_id = swipe.session_id
+JOIN session_item ON session_item.id = swipe.item_id
+WHERE swipe.session_id = $1
+AND swipe.liked
+AND session_participant.status = 'active'
+AND session_participant.role <> 'spectator'
+GROUP BY swipe.item_id, session_item.created_at
+ORDER BY likes DESC, session_item.created_at, swipe.item_id
+LIMIT 1;
@@ -0,0 +1,51 @@
+-- name: CreateOIDCLoginState :exec
+INSERT INTO oidc_login_state (state_hash, provider, nonce, code_verifier, link_user_id, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: ConsumeOIDCLoginState :one
+-- Deletes the state as it is read, so each works once.
+DELETE FROM oidc_login_state
+WHERE state_hash = $1 AND provider = $2 AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLoginStates :exec
+DELETE FROM oidc_login_state
+WHERE expires_at <= NOW();
+
+-- name: GetUserIdentity :one
+SELECT *
+FROM user_identity
+WHERE provider = $1 AND subject = $2;
+
+-- name: CreateUserIdentity :one
+INSERT INTO user_identity (user_id, provider, subject, email)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identity
+SET email = $2, last_login_at = NOW()
+WHERE id = $1;
+
+-- name: ListUserIdentities :many
+SELECT *
+FROM user_identity
+WHERE user_id = $1
+ORDER BY created_at, id;
+
+-- name: CountUserIdentities :one
+SELECT COUNT(*)
+FROM user_identity
+WHERE user_id = $1;
+
+-- name: DeleteUserIdentity :execrows
+DELETE FROM user_identity
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetUserSignInMethodsForUpdate :one
+-- Locks the user while an identity is removed, so two removals at once
+-- cannot leave them with no way in.
+SELECT (password_hash IS NOT NULL)::boolean AS has_password
+FROM users
+WHERE id = $1 AND deleted_at IS NULL
+FOR UPDATE;
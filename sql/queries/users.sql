@@ -1,7 +1,19 @@
 -- name: CreateUser :one
 INSERT INTO users (username, email, password_hash)
 VALUES ($1, $2, $3)
-RETURNING id, username, email, created_at, updated_at, deleted_at;
+RETURNING id, username, email, email_verified_at, token_version, created_at, updated_at, deleted_at;
+
+-- name: CreateGuestUser :one
+INSERT INTO users (username, is_guest)
+VALUES ($1, TRUE)
+RETURNING id, username, created_at;
+
+-- name: UpgradeGuestUser :one
+UPDATE users
+SET username = $2, email = $3, password_hash = $4, is_guest = FALSE,
+    password_changed_at = $5, updated_at = NOW()
+WHERE id = $1 AND is_guest AND deleted_at IS NULL
+RETURNING id, username, email, email_verified_at, token_version, created_at, updated_at;
 
 -- name: GetUserByUsername :one
 SELECT id, username, email, created_at, updated_at, password_changed_at, deleted_at
@@ -14,7 +26,17 @@ FROM users
 WHERE email = $1 AND deleted_at IS NULL;
 
 -- name: GetUserByID :one
-SELECT id, username, email, created_at, updated_at, password_changed_at, deleted_at
+SELECT id, username, email, email_verified_at, is_guest, token_version, created_at, updated_at, password_changed_at, deleted_at
+FROM users
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: GetUserPasswordHash :one
+SELECT password_hash
+FROM users
+WHERE id = $1 AND NOT is_guest AND deleted_at IS NULL;
+
+-- name: GetUserTokenVersion :one
+SELECT token_version
 FROM users
 WHERE id = $1 AND deleted_at IS NULL;
 
@@ -22,9 +44,9 @@ WHERE id = $1 AND deleted_at IS NULL;
 SELECT EXISTS(SELECT 1 FROM users WHERE (username = $1 OR email = $2) AND deleted_at IS NULL);
 
 -- name: GetUserForLogin :one
-SELECT id, username, email, password_hash, password_changed_at, deleted_at
+SELECT id, username, email, email_verified_at, password_hash, password_changed_at, token_version, deleted_at
 FROM users
-WHERE (username = $1 OR email = $1) AND deleted_at IS NULL;
+WHERE (username = $1 OR email = $1) AND NOT is_guest AND deleted_at IS NULL;
 
 -- name: ListUsers :many
 SELECT id, username, email, created_at, updated_at 
@@ -34,8 +56,11 @@ ORDER BY created_at DESC, id DESC
 LIMIT $1 OFFSET $2;
 
 -- name: UpdateUserPassword :exec
+-- Bumping token_version ends every access token issued with the old password.
+-- password_changed_at comes from the caller, whose clock also stamps the
+-- refresh tokens it is compared with.
 UPDATE users
-SET password_hash = $2, password_changed_at= NOW(), updated_at = NOW()
+SET password_hash = $2, password_changed_at = $3, token_version = token_version + 1, updated_at = NOW()
 WHERE id = $1 AND deleted_at IS NULL;
 
 -- name: UpdateUsername :exec
@@ -44,11 +69,22 @@ SET username = $2, updated_at = NOW()
 WHERE id = $1 AND deleted_at IS NULL;
 
 -- name: UpdateEmail :exec
+-- A new address has not been verified yet.
 UPDATE users
-SET email = $2, updated_at = NOW()
+SET email = $2, email_verified_at = NULL, updated_at = NOW()
 WHERE id = $1 AND deleted_at IS NULL;
 
 -- name: DeleteUser :exec
 UPDATE users
 SET deleted_at = NOW(), updated_at = NOW()
-WHERE id = $1 AND deleted_at IS NULL;
\ No newline at end of file
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: CreateOIDCUser :one
+-- Users who sign up with a provider have no password. Their email counts as
+-- verified if the provider says it is.
+INSERT INTO users (username, email, email_verified_at)
+VALUES ($1, $2, $3)
+RETURNING id, username, email, email_verified_at, token_version, created_at, updated_at, deleted_at;
+
+-- name: UsernameExists :one
+SELECT EXISTS(SELECT 1 FROM users WHERE username = $1);
@@ -0,0 +1,7 @@
+-- +goose Up
+INSERT INTO session_participant (user_id, session_id, joined_at, status)
+SELECT creator_user_id, id, created_at, 'active'
+FROM session
+ON CONFLICT (user_id, session_id) DO NOTHING;
+
+-- +goose Down
@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE session ADD COLUMN voting_method VARCHAR(50) NOT NULL DEFAULT 'plurality';
+
+CREATE TABLE ballot (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    session_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    UNIQUE (session_id, user_id),
+    FOREIGN KEY (session_id) REFERENCES session(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE vote (
+    ballot_id UUID NOT NULL,
+    item_id UUID NOT NULL,
+    value INTEGER NOT NULL,
+    PRIMARY KEY (ballot_id, item_id),
+    FOREIGN KEY (ballot_id) REFERENCES ballot(id) ON DELETE CASCADE,
+    FOREIGN KEY (item_id) REFERENCES session_item(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS vote;
+DROP TABLE IF EXISTS ballot;
+ALTER TABLE session DROP COLUMN IF EXISTS voting_method;
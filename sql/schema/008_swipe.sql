@@ -0,0 +1,28 @@
+-- +goose Up
+ALTER TABLE session
+    ADD COLUMN mode VARCHAR(20) NOT NULL DEFAULT 'ballot',
+    ADD COLUMN match_threshold INTEGER CHECK (match_threshold > 0),
+    ADD COLUMN winning_item_id UUID REFERENCES session_item(id) ON DELETE SET NULL,
+    ADD COLUMN decided_at TIMESTAMPTZ;
+
+CREATE TABLE swipe (
+    session_id UUID NOT NULL,
+    item_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    liked BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    PRIMARY KEY (item_id, user_id),
+    FOREIGN KEY (session_id) REFERENCES session(id) ON DELETE CASCADE,
+    FOREIGN KEY (item_id) REFERENCES session_item(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX swipe_session_user_idx ON swipe (session_id, user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS swipe;
+ALTER TABLE session
+    DROP COLUMN IF EXISTS decided_at,
+    DROP COLUMN IF EXISTS winning_item_id,
+    DROP COLUMN IF EXISTS match_threshold,
+    DROP COLUMN IF EXISTS mode;
@@ -0,0 +1,7 @@
+-- +goose Up
+CREATE UNIQUE INDEX session_item_source_idx
+    ON session_item (session_id, source_type, source_id)
+    WHERE source_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS session_item_source_idx;
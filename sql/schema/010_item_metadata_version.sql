@@ -0,0 +1,9 @@
+-- +goose Up
+UPDATE session_item
+SET metadata = metadata || '{"schema_version": 1}'::jsonb
+WHERE jsonb_typeof(metadata) = 'object' AND NOT metadata ? 'schema_version';
+
+-- +goose Down
+UPDATE session_item
+SET metadata = metadata - 'schema_version'
+WHERE jsonb_typeof(metadata) = 'object';
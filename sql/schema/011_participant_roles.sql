@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE session_participant
+    ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'participant'
+    CHECK (role IN ('host', 'co_host', 'participant', 'spectator'));
+
+UPDATE session_participant sp
+SET role = 'host'
+FROM session s
+WHERE s.id = sp.session_id AND s.creator_user_id = sp.user_id;
+
+CREATE UNIQUE INDEX session_participant_one_host_idx
+    ON session_participant (session_id)
+    WHERE role = 'host';
+
+-- +goose Down
+DROP INDEX IF EXISTS session_participant_one_host_idx;
+ALTER TABLE session_participant DROP COLUMN IF EXISTS role;
@@ -0,0 +1,29 @@
+-- +goose Up
+UPDATE session SET status = 'decided' WHERE status = 'matched';
+UPDATE session SET status = 'pending'
+WHERE status IS NULL
+   OR status NOT IN ('pending', 'collecting', 'voting', 'decided', 'archived', 'cancelled');
+
+ALTER TABLE session
+    ALTER COLUMN status SET NOT NULL,
+    ADD CONSTRAINT session_status_check
+        CHECK (status IN ('pending', 'collecting', 'voting', 'decided', 'archived', 'cancelled'));
+
+CREATE TABLE session_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES session(id) ON DELETE CASCADE,
+    from_status VARCHAR(50) NOT NULL,
+    to_status VARCHAR(50) NOT NULL,
+    -- NULL when the server moved the session on its own.
+    changed_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    changed_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX session_status_history_session_idx ON session_status_history (session_id, changed_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS session_status_history;
+ALTER TABLE session
+    DROP CONSTRAINT IF EXISTS session_status_check,
+    ALTER COLUMN status DROP NOT NULL;
+UPDATE session SET status = 'matched' WHERE status = 'decided';
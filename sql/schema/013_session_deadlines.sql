@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE session
+    ADD COLUMN collect_until TIMESTAMPTZ,
+    ADD COLUMN vote_until TIMESTAMPTZ;
+
+-- The scheduler only ever looks for open sessions with a deadline set.
+CREATE INDEX session_collect_until_idx ON session (collect_until)
+    WHERE status IN ('pending', 'collecting') AND collect_until IS NOT NULL;
+CREATE INDEX session_vote_until_idx ON session (vote_until)
+    WHERE status = 'voting' AND vote_until IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS session_vote_until_idx;
+DROP INDEX IF EXISTS session_collect_until_idx;
+ALTER TABLE session
+    DROP COLUMN IF EXISTS vote_until,
+    DROP COLUMN IF EXISTS collect_until;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- Sessions that already exist keep accepting their code; new ones are joined
+-- through invites unless the host opens them up.
+ALTER TABLE session ADD COLUMN open_join BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE session ALTER COLUMN open_join SET DEFAULT FALSE;
+
+CREATE TABLE session_invite (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    session_id UUID NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    role VARCHAR(20) NOT NULL DEFAULT 'participant'
+        CHECK (role IN ('co_host', 'participant', 'spectator')),
+    max_uses INTEGER CHECK (max_uses > 0),
+    use_count INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_by_user_id UUID,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    FOREIGN KEY (session_id) REFERENCES session(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by_user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX session_invite_session_idx ON session_invite (session_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS session_invite;
+ALTER TABLE session DROP COLUMN IF EXISTS open_join;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Codes only need to be unique among sessions people can still reach, so an
+-- archived session's code can be handed out again. Matching ignores case so
+-- codes can be typed however they were heard.
+ALTER TABLE session DROP CONSTRAINT IF EXISTS session_session_code_key;
+CREATE UNIQUE INDEX session_code_live_idx ON session (lower(session_code))
+    WHERE status <> 'archived';
+
+-- +goose Down
+-- Archived sessions may share a code with a live one by now. Keep the code on
+-- the live session and give every other holder its own by appending its id.
+UPDATE session
+SET session_code = left(session.session_code, 63) || '-' || session.id::text
+FROM (
+    SELECT id, row_number() OVER (
+        PARTITION BY session_code
+        ORDER BY status = 'archived', id
+    ) AS rank
+    FROM session
+) ranked
+WHERE ranked.id = session.id AND ranked.rank > 1;
+DROP INDEX IF EXISTS session_code_live_idx;
+ALTER TABLE session ADD CONSTRAINT session_session_code_key UNIQUE (session_code);
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Guests join a single session with just a display name, so they have no
+-- email or password until they upgrade to a full account.
+ALTER TABLE users
+    ALTER COLUMN email DROP NOT NULL,
+    ALTER COLUMN password_hash DROP NOT NULL,
+    ADD COLUMN is_guest BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD CONSTRAINT users_credentials_check
+        CHECK (is_guest OR (email IS NOT NULL AND password_hash IS NOT NULL));
+
+-- +goose Down
+DELETE FROM users WHERE is_guest;
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_credentials_check,
+    DROP COLUMN IF EXISTS is_guest,
+    ALTER COLUMN email SET NOT NULL,
+    ALTER COLUMN password_hash SET NOT NULL;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- Every login starts a family of refresh tokens; each rotation revokes the
+-- token and points it at its replacement. Presenting a token that was already
+-- replaced revokes the whole family.
+ALTER TABLE refresh_token
+    ADD COLUMN family_id UUID,
+    ADD COLUMN replaced_by_id UUID REFERENCES refresh_token(id) ON DELETE SET NULL;
+UPDATE refresh_token SET family_id = id;
+ALTER TABLE refresh_token ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX refresh_token_family_idx ON refresh_token (family_id);
+
+CREATE TABLE security_event (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_type VARCHAR(50) NOT NULL,
+    family_id UUID,
+    user_agent TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX security_event_user_idx ON security_event (user_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS security_event;
+DROP INDEX IF EXISTS refresh_token_family_idx;
+ALTER TABLE refresh_token
+    DROP COLUMN IF EXISTS replaced_by_id,
+    DROP COLUMN IF EXISTS family_id;
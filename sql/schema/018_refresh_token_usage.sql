@@ -0,0 +1,18 @@
+-- +goose Up
+-- login_at is when the family's first token was issued and is carried along
+-- on rotation; last_used_at is when the token's parent was rotated into it.
+ALTER TABLE refresh_token
+    ADD COLUMN login_at TIMESTAMPTZ,
+    ADD COLUMN last_used_at TIMESTAMPTZ;
+UPDATE refresh_token SET login_at = issued_at;
+ALTER TABLE refresh_token
+    ALTER COLUMN login_at SET DEFAULT NOW(),
+    ALTER COLUMN login_at SET NOT NULL;
+
+CREATE INDEX refresh_token_user_active_idx ON refresh_token (user_id) WHERE revoked_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS refresh_token_user_active_idx;
+ALTER TABLE refresh_token
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS login_at;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- Accounts start unverified; following the link sent to their email sets
+-- email_verified_at. Changing the email clears it again.
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+-- Accounts made before verification existed keep working as they did, so
+-- sessions that require it do not lock out everyone already signed up.
+UPDATE users SET email_verified_at = NOW() WHERE NOT is_guest AND email IS NOT NULL;
+
+-- Each token verifies the address it was sent to, so a link mailed before an
+-- email change cannot verify the new address.
+CREATE TABLE email_verification_token (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email CITEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX email_verification_token_user_idx ON email_verification_token (user_id) WHERE used_at IS NULL;
+
+ALTER TABLE session ADD COLUMN require_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE session DROP COLUMN IF EXISTS require_verified;
+DROP TABLE IF EXISTS email_verification_token;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Access tokens carry the version they were issued under. Changing the
+-- password bumps it, so tokens issued before stop working straight away
+-- rather than when they expire.
+ALTER TABLE users ADD COLUMN token_version INT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS token_version;
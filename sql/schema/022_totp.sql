@@ -0,0 +1,26 @@
+-- +goose Up
+-- A row with no confirmed_at is an enrolment the user has not finished;
+-- two-factor login only kicks in once they prove their app has the secret.
+-- last_used_step stops a code being used twice.
+CREATE TABLE user_totp (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    confirmed_at TIMESTAMPTZ,
+    last_used_step BIGINT,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+-- Recovery codes get people in when they lose their authenticator. Like
+-- refresh tokens they are stored hashed, and each works once.
+CREATE TABLE mfa_recovery_code (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    UNIQUE (user_id, code_hash)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS mfa_recovery_code;
+DROP TABLE IF EXISTS user_totp;
@@ -0,0 +1,44 @@
+-- +goose Up
+-- An identity is an account at an OpenID provider that can sign a user in.
+-- The provider's subject is what identifies the account; the email is kept
+-- only to show the user which account is linked.
+CREATE TABLE user_identity (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email CITEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    last_login_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider)
+);
+
+-- A login started with a provider, waiting for it to redirect back. Only the
+-- hash of the state is stored, like other tokens; link_user_id is set when a
+-- signed-in user is adding the identity to their account.
+CREATE TABLE oidc_login_state (
+    state_hash TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    link_user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX oidc_login_state_expires_at_idx ON oidc_login_state (expires_at);
+
+-- People who sign up with a provider have no password.
+ALTER TABLE users
+    DROP CONSTRAINT users_credentials_check,
+    ADD CONSTRAINT users_credentials_check CHECK (is_guest OR email IS NOT NULL);
+
+-- +goose Down
+DELETE FROM users WHERE NOT is_guest AND password_hash IS NULL;
+ALTER TABLE users
+    DROP CONSTRAINT users_credentials_check,
+    ADD CONSTRAINT users_credentials_check
+        CHECK (is_guest OR (email IS NOT NULL AND password_hash IS NOT NULL));
+DROP TABLE IF EXISTS oidc_login_state;
+DROP TABLE IF EXISTS user_identity;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- Personal access tokens let scripts act for a user without logging in. Like
+-- refresh tokens they are stored hashed; token_hint keeps the last characters
+-- so people can tell their tokens apart. A token can only do what its scopes
+-- allow, and lasts until it expires, if ever, or is revoked.
+CREATE TABLE personal_access_token (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    token_hint TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    CHECK (length(name) BETWEEN 1 AND 100),
+    CHECK (cardinality(scopes) > 0)
+);
+
+CREATE INDEX personal_access_token_user_id_idx ON personal_access_token (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS personal_access_token;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- failed_attempts counts wrong two-factor codes in a row. Enough of them lock
+-- two-factor until locked_until, so codes cannot be guessed at speed.
+ALTER TABLE user_totp
+    ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until TIMESTAMPTZ;
+
+-- Each two-factor challenge token finishes one login and allows only a few
+-- wrong codes. challenge_id is the token's jti; the row is made the first
+-- time the challenge is used.
+CREATE TABLE mfa_challenge (
+    challenge_id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    spent_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX mfa_challenge_expires_at_idx ON mfa_challenge (expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS mfa_challenge;
+ALTER TABLE user_totp
+    DROP COLUMN IF EXISTS locked_until,
+    DROP COLUMN IF EXISTS failed_attempts;
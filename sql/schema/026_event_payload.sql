@@ -0,0 +1,15 @@
+-- +goose Up
+-- Events too big for a NOTIFY payload are parked here, and only their key is
+-- sent. Every instance reads them, so rows are not removed on delivery; the
+-- publisher clears out old ones instead.
+CREATE TABLE event_payload (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    session_id UUID NOT NULL,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX event_payload_created_at_idx ON event_payload (created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS event_payload;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Custom items are unique by title within a session, ignoring case. Items
+-- from a source are unique by source_id instead, since two films can share a
+-- title. Titles that already clash keep the oldest item's title and mark the
+-- rest with the start of their id.
+UPDATE session_item
+SET item_title = left(session_item.item_title, 238) || ' (' || left(session_item.id::text, 8) || ')'
+FROM (
+    SELECT id, row_number() OVER (
+        PARTITION BY session_id, lower(item_title)
+        ORDER BY created_at, id
+    ) AS rank
+    FROM session_item
+    WHERE source_type = 'custom'
+) ranked
+WHERE ranked.id = session_item.id AND ranked.rank > 1;
+
+CREATE UNIQUE INDEX session_item_title_idx
+    ON session_item (session_id, lower(item_title))
+    WHERE source_type = 'custom';
+
+-- +goose Down
+DROP INDEX IF EXISTS session_item_title_idx;
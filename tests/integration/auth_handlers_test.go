@@ -2,6 +2,8 @@ package integration
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,10 +16,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Kam1217/optio/app"
 	"github.com/Kam1217/optio/db"
 	"github.com/Kam1217/optio/internal/auth/handlers"
 	"github.com/Kam1217/optio/internal/auth/middleware"
 	"github.com/Kam1217/optio/internal/auth/models"
+	"github.com/Kam1217/optio/internal/auth/oidc"
+	"github.com/Kam1217/optio/internal/auth/oidc/oidctest"
+	"github.com/Kam1217/optio/internal/mail"
+	"github.com/Kam1217/optio/internal/session/authz"
+	sessionhandlers "github.com/Kam1217/optio/internal/session/handlers"
 	"github.com/docker/go-connections/nat"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -28,7 +36,9 @@ import (
 
 func TestMain(m *testing.M) {
 	_ = godotenv.Load("../../.env")
-	os.Exit(m.Run())
+	code := m.Run()
+	testOIDC.Close()
+	os.Exit(code)
 }
 
 type postgresContainer struct {
@@ -123,25 +133,128 @@ func startTestServer(t *testing.T, dbContainer *postgresContainer) (*httptest.Se
 	if secretJWT == "" {
 		secretJWT = "testsecret"
 	}
-	jwtMgr := middleware.NewJWTManager(secretJWT, "optio", "optio-api", 15*time.Minute)
+	// Test servers sign with an Ed25519 key, as deployments with JWT_KEYS_DIR
+	// do, and still accept tokens signed with the old shared secret.
+	keys := middleware.NewKeyring()
+	_, signingKey, _ := ed25519.GenerateKey(rand.Reader)
+	edKey, err := middleware.NewAsymmetricKey("test-ed25519", signingKey)
+	if err != nil {
+		t.Fatalf("signing key: %v", err)
+	}
+	for _, key := range []*middleware.SigningKey{edKey, middleware.NewHMACKey("", []byte(secretJWT))} {
+		if err := keys.Add(key); err != nil {
+			t.Fatalf("add signing key: %v", err)
+		}
+	}
+	if err := keys.SetActive("test-ed25519"); err != nil {
+		t.Fatalf("activate signing key: %v", err)
+	}
+	jwtMgr := middleware.NewJWTManagerWithKeys(keys, "optio", "optio-api", 15*time.Minute)
 
-	user := models.NewUserService(dbConn.Queries)
+	user := models.NewUserService(dbConn.DB, dbConn.Queries)
+	jwtMgr.Versions = middleware.NewTokenVersionCache(user, time.Minute)
 	auth := handlers.NewAuthHandler(dbConn.DB, user, jwtMgr)
 	refreshTTL := 30 * 24 * time.Hour
-	refreshSvc := models.NewRefreshService(dbConn.Queries, refreshTTL)
+	refreshSvc := models.NewRefreshService(dbConn.DB, dbConn.Queries, refreshTTL)
 	auth.Refresh = refreshSvc
 	auth.RefreshTTL = refreshTTL
 	auth.CookieDomain = ""
+	auth.Resets = models.NewPasswordResetService(dbConn.DB, dbConn.Queries, testMailer, "https://optio.test/reset")
+	auth.Verification = models.NewEmailVerificationService(dbConn.DB, dbConn.Queries, testMailer, "https://optio.test/verify")
+	auth.MFA = models.NewMFAService(dbConn.DB, dbConn.Queries, "Optio")
+	auth.Identities = models.NewIdentityService(dbConn.DB, dbConn.Queries)
+	auth.PATs = models.NewPATService(dbConn.DB, dbConn.Queries)
+	jwtMgr.PATs = auth.PATs
+	fakeProvider := oidc.NewProvider(oidc.Config{
+		Name:         "fake",
+		Issuer:       testOIDC.Issuer(),
+		ClientID:     testOIDC.ClientID,
+		ClientSecret: testOIDC.ClientSecret,
+	}, testOIDC.Client())
+	auth.OIDC = map[string]*oidc.Provider{"fake": fakeProvider}
 
 	router := mux.NewRouter()
+	router.HandleFunc("/.well-known/jwks.json", auth.JWKS).Methods("GET")
 	router.HandleFunc("/api/auth/register", auth.RegisterUser).Methods("POST")
 	router.HandleFunc("/api/auth/login", auth.LoginUser).Methods("POST")
+	router.HandleFunc("/api/auth/login/mfa", auth.LoginMFA).Methods("POST")
+	router.HandleFunc("/api/auth/profile", jwtMgr.JWTMiddleware(auth.Profile)).Methods("GET")
+	router.HandleFunc("/api/auth/password/forgot", auth.ForgotPassword).Methods("POST")
+	router.HandleFunc("/api/auth/password/reset", auth.ResetPassword).Methods("POST")
+	router.HandleFunc("/api/auth/password", jwtMgr.JWTMiddleware(auth.ChangePassword)).Methods("POST")
+	router.HandleFunc("/api/auth/mfa/totp", jwtMgr.JWTMiddleware(auth.BeginTOTP)).Methods("POST")
+	router.HandleFunc("/api/auth/mfa/totp/confirm", jwtMgr.JWTMiddleware(auth.ConfirmTOTP)).Methods("POST")
+	router.HandleFunc("/api/auth/mfa/totp/disable", jwtMgr.JWTMiddleware(auth.DisableTOTP)).Methods("POST")
+	router.HandleFunc("/api/auth/mfa/recovery-codes", jwtMgr.JWTMiddleware(auth.RegenerateRecoveryCodes)).Methods("POST")
+	router.HandleFunc("/api/auth/email", jwtMgr.JWTMiddleware(auth.UpdateEmail)).Methods("PUT")
+	router.HandleFunc("/api/auth/email/verify", auth.VerifyEmail).Methods("POST")
+	router.HandleFunc("/api/auth/email/verification", jwtMgr.JWTMiddleware(auth.ResendVerification)).Methods("POST")
+	router.HandleFunc("/api/auth/guest/upgrade", jwtMgr.GuestJWTMiddleware(auth.UpgradeGuest)).Methods("POST")
+	router.HandleFunc("/api/auth/refresh", auth.RefreshSession).Methods("POST")
+	router.HandleFunc("/api/auth/sessions", jwtMgr.JWTMiddleware(auth.ListSessions)).Methods("GET")
+	router.HandleFunc("/api/auth/sessions/{id}", jwtMgr.JWTMiddleware(auth.RevokeSession)).Methods("DELETE")
+	router.HandleFunc("/api/auth/logout-all", jwtMgr.JWTMiddleware(auth.LogoutAll)).Methods("POST")
+	router.HandleFunc("/api/auth/oidc/{provider}/start", auth.StartOIDCLogin).Methods("GET")
+	router.HandleFunc("/api/auth/oidc/{provider}/callback", auth.OIDCCallback).Methods("GET")
+	router.HandleFunc("/api/auth/oidc/{provider}/link", jwtMgr.JWTMiddleware(auth.StartOIDCLink)).Methods("POST")
+	router.HandleFunc("/api/auth/identities", jwtMgr.JWTMiddleware(auth.ListIdentities)).Methods("GET")
+	router.HandleFunc("/api/auth/identities/{id}", jwtMgr.JWTMiddleware(auth.UnlinkIdentity)).Methods("DELETE")
+	router.HandleFunc("/api/auth/tokens", jwtMgr.JWTMiddleware(auth.CreatePAT)).Methods("POST")
+	router.HandleFunc("/api/auth/tokens", jwtMgr.JWTMiddleware(auth.ListPATs)).Methods("GET")
+	router.HandleFunc("/api/auth/tokens/{id}", jwtMgr.JWTMiddleware(auth.RevokePAT)).Methods("DELETE")
+
+	sessionService := app.NewSessionService(dbConn.DB, dbConn.Queries, "https://optio.test/join")
+	sessionHandler := sessionhandlers.NewSessionHandler(sessionService)
+	sessionHandler.JWT = jwtMgr
+	router.HandleFunc("/api/session", jwtMgr.ScopedJWTMiddleware(models.ScopeSessionsWrite, sessionHandler.CreateSession)).Methods("POST")
+	router.HandleFunc("/api/session/join", jwtMgr.ScopedJWTMiddleware(models.ScopeSessionsWrite, sessionHandler.JoinSession)).Methods("POST")
+	router.HandleFunc("/api/session/guest", sessionHandler.GuestJoin).Methods("POST")
+
+	access := authz.NewAuthorizer(sessionService)
+	member := func(scope string, h http.HandlerFunc) http.HandlerFunc {
+		return jwtMgr.ScopedGuestJWTMiddleware(scope, access.RequireSessionMember(h))
+	}
+	itemMember := func(scope string, h http.HandlerFunc) http.HandlerFunc {
+		return jwtMgr.ScopedGuestJWTMiddleware(scope, access.RequireItemMember(h))
+	}
+	permitted := func(p app.Permission, scope string, h http.HandlerFunc) http.HandlerFunc {
+		return jwtMgr.ScopedGuestJWTMiddleware(scope, access.RequirePermission(p, h))
+	}
+	router.HandleFunc("/api/session/{id}", member(models.ScopeSessionsRead, sessionHandler.GetSession)).Methods("GET")
+	router.HandleFunc("/api/session/{id}", permitted(app.PermChangeSettings, models.ScopeSessionsWrite, sessionHandler.UpdateSettings)).Methods("PATCH")
+	router.HandleFunc("/api/session/{id}/leave", member(models.ScopeSessionsWrite, sessionHandler.LeaveSession)).Methods("POST")
+	router.HandleFunc("/api/session/{id}/status", permitted(app.PermManageVoting, models.ScopeSessionsWrite, sessionHandler.TransitionSession)).Methods("POST")
+	router.HandleFunc("/api/session/{id}/history", member(models.ScopeSessionsRead, sessionHandler.StatusHistory)).Methods("GET")
+	router.HandleFunc("/api/session/{id}/invites", permitted(app.PermManageParticipants, models.ScopeSessionsWrite, sessionHandler.CreateInvite)).Methods("POST")
+	router.HandleFunc("/api/session/{id}/invites", permitted(app.PermManageParticipants, models.ScopeSessionsRead, sessionHandler.ListInvites)).Methods("GET")
+	router.HandleFunc("/api/session/{id}/invites/{invite_id}", permitted(app.PermManageParticipants, models.ScopeSessionsWrite, sessionHandler.RevokeInvite)).Methods("DELETE")
+	router.HandleFunc("/api/session/{id}/invite.png", permitted(app.PermManageParticipants, models.ScopeSessionsRead, sessionHandler.InviteQRPNG)).Methods("GET")
+	router.HandleFunc("/api/session/{id}/invite.svg", permitted(app.PermManageParticipants, models.ScopeSessionsRead, sessionHandler.InviteQRSVG)).Methods("GET")
+	router.HandleFunc("/api/session/{id}/host", permitted(app.PermManageCoHosts, models.ScopeSessionsWrite, sessionHandler.TransferHost)).Methods("POST")
+	router.HandleFunc("/api/session/{id}/participants/{user_id}/role", permitted(app.PermManageParticipants, models.ScopeSessionsWrite, sessionHandler.SetRole)).Methods("PUT")
+	router.HandleFunc("/api/session/{id}/participants/{user_id}/kick", permitted(app.PermManageParticipants, models.ScopeSessionsWrite, sessionHandler.KickParticipant)).Methods("POST")
+	router.HandleFunc("/api/session/{id}/participants/{user_id}/ban", permitted(app.PermManageParticipants, models.ScopeSessionsWrite, sessionHandler.BanParticipant)).Methods("POST")
+
+	itemService := app.NewSessionItemService(dbConn.DB, dbConn.Queries)
+	itemHandler := sessionhandlers.NewItemHandler(itemService)
+	router.HandleFunc("/api/session/{id}/items", member(models.ScopeItemsRead, itemHandler.ListItems)).Methods("GET")
+	router.HandleFunc("/api/session/{id}/items", member(models.ScopeItemsWrite, itemHandler.CreateItem)).Methods("POST")
+	router.HandleFunc("/api/item", jwtMgr.ScopedJWTMiddleware(models.ScopeItemsWrite, itemHandler.CreateItem)).Methods("POST")
+	router.HandleFunc("/api/item/{id}", itemMember(models.ScopeItemsRead, itemHandler.GetItem)).Methods("GET")
+	router.HandleFunc("/api/item/{id}", itemMember(models.ScopeItemsWrite, itemHandler.UpdateItem)).Methods("PATCH")
+	router.HandleFunc("/api/item/{id}", itemMember(models.ScopeItemsWrite, itemHandler.DeleteItem)).Methods("DELETE")
+
+	voteHandler := sessionhandlers.NewVoteHandler(app.NewVotingService(dbConn.DB, dbConn.Queries))
+	router.HandleFunc("/api/session/{id}/votes", member(models.ScopeVotesWrite, voteHandler.CastVotes)).Methods("POST")
+	router.HandleFunc("/api/session/{id}/results", member(models.ScopeSessionsRead, voteHandler.GetResults)).Methods("GET")
 
 	server := httptest.NewUnstartedServer(router)
 	listener, _ := net.Listen("tcp", "127.0.0.1:0")
 	server.Listener = listener
 	server.Start()
 	t.Cleanup(server.Close)
+	// The callback URL is only known once the server is listening.
+	fakeProvider.RedirectURL = server.URL + "/api/auth/oidc/fake/callback"
 
 	return server, dbConn
 }
@@ -237,6 +350,14 @@ func TestLogin(t *testing.T) {
 	}
 }
 
+// testMailer catches the emails every test server sends. Tests tell their
+// messages apart by recipient.
+var testMailer = mail.NewMemoryMailer()
+
+// testOIDC is the OpenID provider every test server offers as "fake". Tests
+// choose who it signs in with SetUser.
+var testOIDC = oidctest.NewServer()
+
 type httpRes struct {
 	Code int
 	Body string
@@ -246,16 +367,27 @@ func postJSON(t *testing.T, url, body string) httpRes {
 	return postRaw(t, url, body, "application/json")
 }
 
+func postAuthJSON(t *testing.T, url, token, body string) httpRes {
+	return doRequest(t, "POST", url, token, body, "application/json")
+}
+
 func postRaw(t *testing.T, url, body, contentType string) httpRes {
+	return doRequest(t, "POST", url, "", body, contentType)
+}
+
+func doRequest(t *testing.T, method, url, token, body, contentType string) httpRes {
 	t.Helper()
-	req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
 	if contentType != "" {
 		req.Header.Set("Content-Type", contentType)
 	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 	c := &http.Client{Timeout: 5 * time.Second}
 	resp, err := c.Do(req)
 	if err != nil {
-		t.Fatalf("POST %s: %v", url, err)
+		t.Fatalf("%s %s: %v", method, url, err)
 	}
 	defer resp.Body.Close()
 	b, _ := io.ReadAll(resp.Body)
@@ -0,0 +1,136 @@
+package integration
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/handlers"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// authCall posts to an auth endpoint from a given user agent, optionally with
+// a refresh cookie, and returns the response and any new refresh cookie.
+func authCall(t *testing.T, url, body, userAgent, refreshCookie string) (httpRes, string) {
+	t.Helper()
+	req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	if refreshCookie != "" {
+		req.AddCookie(&http.Cookie{Name: "refresh_token", Value: refreshCookie})
+	}
+	c := &http.Client{Timeout: 5 * time.Second}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	var cookie string
+	for _, c := range resp.Cookies() {
+		if c.Name == "refresh_token" {
+			cookie = c.Value
+		}
+	}
+	return httpRes{Code: resp.StatusCode, Body: string(b)}, cookie
+}
+
+func listDeviceSessions(t *testing.T, base, token string) []handlers.DeviceSessionResponse {
+	t.Helper()
+	res := doRequest(t, "GET", base+"/api/auth/sessions", token, "", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("list sessions: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var sessions []handlers.DeviceSessionResponse
+	mustJSON(t, res.Body, &sessions)
+	return sessions
+}
+
+func TestDeviceSessions(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	registerUser(t, base, "traveller")
+	const (
+		laptopUA = "Mozilla/5.0 (Macintosh; Intel Mac OS X 14.5; rv:127.0) Gecko/20100101 Firefox/127.0"
+		phoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+		login    = `{"identifier":"traveller","password":"test123"}`
+	)
+
+	res, laptopCookie := authCall(t, base+"/api/auth/login", login, laptopUA, "")
+	if res.Code != http.StatusOK || laptopCookie == "" {
+		t.Fatalf("laptop login: want 200 with cookie, got %d body:%s", res.Code, res.Body)
+	}
+	var laptop handlers.AuthResponse
+	mustJSON(t, res.Body, &laptop)
+	res, phoneCookie := authCall(t, base+"/api/auth/login", login, phoneUA, "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("phone login: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var phone handlers.AuthResponse
+	mustJSON(t, res.Body, &phone)
+
+	sessions := listDeviceSessions(t, base, laptop.Token)
+	devices := map[string]handlers.DeviceSessionResponse{}
+	for _, s := range sessions {
+		devices[s.Device] = s
+	}
+	laptopSession, phoneSession := devices["Firefox on macOS"], devices["Safari on iPhone"]
+	if !laptopSession.Current || phoneSession.Device == "" || phoneSession.Current {
+		t.Fatalf("want the laptop marked current among the registration, laptop and phone sessions: %+v", sessions)
+	}
+
+	res, laptopCookie = authCall(t, base+"/api/auth/refresh", "", laptopUA, laptopCookie)
+	if res.Code != http.StatusOK {
+		t.Fatalf("refresh: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	mustJSON(t, res.Body, &laptop)
+	for _, s := range listDeviceSessions(t, base, laptop.Token) {
+		if s.ID == laptopSession.ID && (!s.Current || s.LastUsedAt == nil || !s.IssuedAt.Equal(laptopSession.IssuedAt)) {
+			t.Fatalf("rotation should keep the session and mark its use: %+v", s)
+		}
+	}
+
+	res = doRequest(t, "DELETE", base+"/api/auth/sessions/"+phoneSession.ID.String(), laptop.Token, "", "")
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("revoke phone: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	res = doRequest(t, "DELETE", base+"/api/auth/sessions/"+phoneSession.ID.String(), laptop.Token, "", "")
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("revoke phone twice: want 404, got %d body:%s", res.Code, res.Body)
+	}
+	if res, _ := authCall(t, base+"/api/auth/refresh", "", phoneUA, phoneCookie); res.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh on revoked phone: want 401, got %d body:%s", res.Code, res.Body)
+	}
+	for _, s := range listDeviceSessions(t, base, phone.Token) {
+		if s.ID == phoneSession.ID {
+			t.Fatalf("revoked session still listed: %+v", s)
+		}
+	}
+
+	other := registerUser(t, base, "stranger")
+	res = doRequest(t, "DELETE", base+"/api/auth/sessions/"+laptopSession.ID.String(), other.Token, "", "")
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("revoking someone else's session: want 404, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = postAuthJSON(t, base+"/api/auth/logout-all", laptop.Token, "")
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("logout all: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	if res, _ := authCall(t, base+"/api/auth/refresh", "", laptopUA, laptopCookie); res.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh after logout-all: want 401, got %d body:%s", res.Code, res.Body)
+	}
+	if sessions := listDeviceSessions(t, base, laptop.Token); len(sessions) != 0 {
+		t.Fatalf("sessions left after logout-all: %+v", sessions)
+	}
+}
@@ -0,0 +1,205 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/handlers"
+	"github.com/Kam1217/optio/internal/auth/totp"
+	sessionhandlers "github.com/Kam1217/optio/internal/session/handlers"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+var verifyLinkPattern = regexp.MustCompile(`https://optio\.test/verify\?token=\S+`)
+
+func TestEmailVerification(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	host := registerUser(t, base, "verifyhost")
+	if host.User.Verified {
+		t.Fatalf("new accounts should start unverified: %+v", host.User)
+	}
+	tokens := mailedTokens(t, "verifyhost@example.com", verifyLinkPattern)
+	if len(tokens) != 1 {
+		t.Fatalf("want one verification email on registration, got %+v", testMailer.Sent("verifyhost@example.com"))
+	}
+
+	res := postJSON(t, base+"/api/auth/email/verify", `{"token":"not-a-token"}`)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("bogus token: want 400, got %d body:%s", res.Code, res.Body)
+	}
+	res = postJSON(t, base+"/api/auth/email/verify", fmt.Sprintf(`{"token":%q}`, tokens[0]))
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("verify: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	res = postJSON(t, base+"/api/auth/email/verify", fmt.Sprintf(`{"token":%q}`, tokens[0]))
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("reusing token: want 400, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = doRequest(t, "GET", base+"/api/auth/profile", host.Token, "", "")
+	var profile handlers.UserResponse
+	mustJSON(t, res.Body, &profile)
+	if !profile.Verified {
+		t.Fatalf("profile after verifying: want verified, got %+v", profile)
+	}
+	if res := postAuthJSON(t, base+"/api/auth/email/verification", host.Token, ""); res.Code != http.StatusConflict {
+		t.Fatalf("resend when verified: want 409, got %d body:%s", res.Code, res.Body)
+	}
+
+	// Unverified accounts can still log in and say so.
+	registerUser(t, base, "unverified")
+	res = postJSON(t, base+"/api/auth/login", `{"identifier":"unverified","password":"test123"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("unverified login: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var unverified handlers.AuthResponse
+	mustJSON(t, res.Body, &unverified)
+	if unverified.User.Verified {
+		t.Fatalf("login response: want unverified, got %+v", unverified.User)
+	}
+
+	res = postAuthJSON(t, base+"/api/session", host.Token, `{"session_name":"Verified only","open_join":true,"require_verified":true}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("create session: want 201, got %d body:%s", res.Code, res.Body)
+	}
+	var session sessionhandlers.CreateSessionResponse
+	mustJSON(t, res.Body, &session)
+	if !getSession(t, base, host.Token, session.SessionID.String()).RequireVerified {
+		t.Fatalf("session should require verified participants")
+	}
+
+	res = postAuthJSON(t, base+"/api/session/join", unverified.Token, fmt.Sprintf(`{"code":%q}`, session.SessionCode))
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("unverified join: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	res = postJSON(t, base+"/api/session/guest", fmt.Sprintf(`{"code":%q,"display_name":"Sam"}`, session.SessionCode))
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("guest join: want 403, got %d body:%s", res.Code, res.Body)
+	}
+
+	// A link sent to the old address stops working once the email changes,
+	// and the new address gets a link of its own.
+	if res := postAuthJSON(t, base+"/api/auth/email/verification", unverified.Token, ""); res.Code != http.StatusAccepted {
+		t.Fatalf("resend: want 202, got %d body:%s", res.Code, res.Body)
+	}
+	oldTokens := mailedTokens(t, "unverified@example.com", verifyLinkPattern)
+	if len(oldTokens) != 2 {
+		t.Fatalf("want two verification emails, got %d", len(oldTokens))
+	}
+
+	res = doRequest(t, "PUT", base+"/api/auth/email", unverified.Token, `{"email":"verifyhost@example.com","current_password":"test123"}`, "application/json")
+	if res.Code != http.StatusConflict {
+		t.Fatalf("taken email: want 409, got %d body:%s", res.Code, res.Body)
+	}
+	res = doRequest(t, "PUT", base+"/api/auth/email", unverified.Token, `{"email":"moved@example.com","current_password":"test123"}`, "application/json")
+	if res.Code != http.StatusOK {
+		t.Fatalf("update email: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var moved handlers.UserResponse
+	mustJSON(t, res.Body, &moved)
+	if moved.Email != "moved@example.com" || moved.Verified {
+		t.Fatalf("unexpected user after email change: %+v", moved)
+	}
+
+	res = postJSON(t, base+"/api/auth/email/verify", fmt.Sprintf(`{"token":%q}`, oldTokens[1]))
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("token for old address: want 400, got %d body:%s", res.Code, res.Body)
+	}
+	newTokens := mailedTokens(t, "moved@example.com", verifyLinkPattern)
+	if len(newTokens) != 1 {
+		t.Fatalf("want one verification email to the new address, got %d", len(newTokens))
+	}
+	res = postJSON(t, base+"/api/auth/email/verify", fmt.Sprintf(`{"token":%q}`, newTokens[0]))
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("verify new address: want 204, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = postAuthJSON(t, base+"/api/session/join", unverified.Token, fmt.Sprintf(`{"code":%q}`, session.SessionCode))
+	if res.Code != http.StatusOK {
+		t.Fatalf("verified join: want 200, got %d body:%s", res.Code, res.Body)
+	}
+}
+
+func TestEmailChangeNeedsMoreThanAToken(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	user := registerUser(t, base, "emailowner")
+	change := func(body string) httpRes {
+		t.Helper()
+		return doRequest(t, "PUT", base+"/api/auth/email", user.Token, body, "application/json")
+	}
+
+	// Whoever holds a stolen access token cannot move the account to an
+	// address they control.
+	if res := change(`{"email":"thief@example.com"}`); res.Code != http.StatusForbidden {
+		t.Fatalf("token alone: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	if res := change(`{"email":"thief@example.com","current_password":"wrong"}`); res.Code != http.StatusForbidden {
+		t.Fatalf("wrong password: want 403, got %d body:%s", res.Code, res.Body)
+	}
+
+	res := postAuthJSON(t, base+"/api/auth/mfa/totp", user.Token, "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("begin enrolment: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var enrollment handlers.TOTPEnrollmentResponse
+	mustJSON(t, res.Body, &enrollment)
+	key, err := totp.DecodeSecret(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("decode secret %q: %v", enrollment.Secret, err)
+	}
+	now := time.Now()
+	res = postAuthJSON(t, base+"/api/auth/mfa/totp/confirm", user.Token, fmt.Sprintf(`{"code":%q}`, totp.Default.Code(key, now)))
+	if res.Code != http.StatusOK {
+		t.Fatalf("confirm: want 200, got %d body:%s", res.Code, res.Body)
+	}
+
+	// With two-factor on, the password is not enough either.
+	if res := change(`{"email":"thief@example.com","current_password":"test123"}`); res.Code != http.StatusForbidden {
+		t.Fatalf("password without code: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	if got := testMailer.Sent("thief@example.com"); len(got) != 0 {
+		t.Fatalf("nothing should be mailed to an address that was never set, got %+v", got)
+	}
+
+	code := totp.Default.Code(key, now.Add(totp.Default.Period))
+	res = change(fmt.Sprintf(`{"email":"new-owner@example.com","current_password":"test123","code":%q}`, code))
+	if res.Code != http.StatusOK {
+		t.Fatalf("update email: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var updated handlers.UserResponse
+	mustJSON(t, res.Body, &updated)
+	if updated.Email != "new-owner@example.com" {
+		t.Fatalf("unexpected user after email change: %+v", updated)
+	}
+
+	var notices int
+	for _, msg := range testMailer.Sent("emailowner@example.com") {
+		if strings.Contains(msg.Body, "new-owner@example.com") {
+			notices++
+		}
+	}
+	if notices != 1 {
+		t.Fatalf("want one change notice to the old address, got %d", notices)
+	}
+}
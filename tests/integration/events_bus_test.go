@@ -0,0 +1,179 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/optio/db"
+	"github.com/Kam1217/optio/internal/events"
+	"github.com/google/uuid"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func connectEventBus(t *testing.T, dbContainer *postgresContainer) (*db.DB, *events.PostgresBus) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dbConn, err := db.Connect(ctx, db.Config{
+		Host:     "localhost",
+		Password: dbContainer.Password,
+		Port:     dbContainer.Port,
+		DBName:   dbContainer.DbName,
+		User:     "postgres",
+	})
+	if err != nil {
+		t.Fatalf("db connection: %v", err)
+	}
+	t.Cleanup(func() { _ = dbConn.Close() })
+
+	bus, err := dbConn.NewEventBus(events.PostgresBusConfig{
+		MinReconnectInterval: 50 * time.Millisecond,
+		MaxReconnectInterval: 500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("event bus: %v", err)
+	}
+	t.Cleanup(func() { _ = bus.Close() })
+
+	return dbConn, bus
+}
+
+func waitForEvent(t *testing.T, received <-chan events.Event, timeout time.Duration) (events.Event, bool) {
+	t.Helper()
+	select {
+	case event := <-received:
+		return event, true
+	case <-time.After(timeout):
+		return events.Event{}, false
+	}
+}
+
+func TestPostgresBusFansOutAcrossInstances(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	_, busA := connectEventBus(t, dbContainer)
+	_, busB := connectEventBus(t, dbContainer)
+
+	sessionID, otherSession := uuid.New(), uuid.New()
+	received := make(chan events.Event, 10)
+	unsubscribe, err := busB.Subscribe(sessionID, func(e events.Event) { received <- e })
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	userID := uuid.New()
+	event, _ := events.New(events.ParticipantJoined, sessionID, events.ParticipantData{UserID: userID})
+	if err := busA.Publish(context.Background(), event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	got, ok := waitForEvent(t, received, 5*time.Second)
+	if !ok {
+		t.Fatalf("event published on one instance never reached the other")
+	}
+	if got.Type != events.ParticipantJoined || got.SessionID != sessionID {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+
+	other, _ := events.New(events.ParticipantJoined, otherSession, events.ParticipantData{UserID: userID})
+	if err := busA.Publish(context.Background(), other); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if got, ok := waitForEvent(t, received, 300*time.Millisecond); ok {
+		t.Fatalf("received event for a session that was not subscribed: %+v", got)
+	}
+
+	unsubscribe()
+	if err := busA.Publish(context.Background(), event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if got, ok := waitForEvent(t, received, 300*time.Millisecond); ok {
+		t.Fatalf("received event after unsubscribing: %+v", got)
+	}
+}
+
+func TestPostgresBusReconnects(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	dbConn, bus := connectEventBus(t, dbContainer)
+
+	sessionID := uuid.New()
+	received := make(chan events.Event, 10)
+	if _, err := bus.Subscribe(sessionID, func(e events.Event) { received <- e }); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	var terminated bool
+	err = dbConn.QueryRowContext(context.Background(), `
+		SELECT pg_terminate_backend(pid) FROM pg_stat_activity
+		WHERE pid <> pg_backend_pid() AND query LIKE 'LISTEN %'
+		LIMIT 1`).Scan(&terminated)
+	if err != nil || !terminated {
+		t.Fatalf("terminate listener backend: terminated=%v err=%v", terminated, err)
+	}
+
+	// Events sent while the listener is down are lost, so keep publishing
+	// until one arrives on the re-established connection.
+	event, _ := events.New(events.StatusChanged, sessionID, events.StatusData{From: "voting", To: "decided"})
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if err := bus.Publish(context.Background(), event); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		if got, ok := waitForEvent(t, received, 200*time.Millisecond); ok {
+			if got.Type != events.StatusChanged || got.SessionID != sessionID {
+				t.Fatalf("unexpected event: %+v", got)
+			}
+			return
+		}
+	}
+	t.Fatalf("no events received after the listener connection was terminated")
+}
+
+func TestPostgresBusCarriesLargeEvents(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+	gooseUp(t, migrationDir, dbContainer.DbUrl)
+
+	_, busA := connectEventBus(t, dbContainer)
+	_, busB := connectEventBus(t, dbContainer)
+
+	sessionID := uuid.New()
+	received := make(chan events.Event, 10)
+	if _, err := busB.Subscribe(sessionID, func(e events.Event) { received <- e }); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	// Far past what fits in a notification.
+	description := strings.Repeat("A long description. ", 1000)
+	event, _ := events.New(events.ItemAdded, sessionID, events.ItemData{ItemID: uuid.New(), Title: "Epic", Description: description})
+	if err := busA.Publish(context.Background(), event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	got, ok := waitForEvent(t, received, 5*time.Second)
+	if !ok {
+		t.Fatalf("large event never reached the other instance")
+	}
+	var data events.ItemData
+	if err := json.Unmarshal(got.Data, &data); err != nil {
+		t.Fatalf("decode item data: %v", err)
+	}
+	if got.Type != events.ItemAdded || data.Description != description {
+		t.Fatalf("large event arrived changed: type %s, %d byte description", got.Type, len(data.Description))
+	}
+}
@@ -0,0 +1,105 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Kam1217/optio/internal/auth/handlers"
+	sessionhandlers "github.com/Kam1217/optio/internal/session/handlers"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestGuestParticipants(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	host := registerUser(t, base, "guesthost")
+	session := createSession(t, base, host.Token, "Board games")
+	sessionID := session.SessionID.String()
+	other := createSession(t, base, host.Token, "Other night")
+
+	res := postJSON(t, base+"/api/session/guest", fmt.Sprintf(`{"code":%q,"display_name":"   "}`, session.SessionCode))
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("blank display name: want 400, got %d body:%s", res.Code, res.Body)
+	}
+	res = postJSON(t, base+"/api/session/guest", `{"code":"NOPE42","display_name":"Sam"}`)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("unknown code: want 404, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = postJSON(t, base+"/api/session/guest", fmt.Sprintf(`{"code":%q,"display_name":"Sam"}`, session.SessionCode))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("guest join: want 201, got %d body:%s", res.Code, res.Body)
+	}
+	var guest sessionhandlers.GuestJoinResponse
+	mustJSON(t, res.Body, &guest)
+	if guest.Token == "" || guest.DisplayName != "Sam" || guest.Session.SessionID != session.SessionID {
+		t.Fatalf("unexpected guest join response: %+v", guest)
+	}
+
+	res = doRequest(t, "GET", base+"/api/session/"+sessionID, guest.Token, "", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("guest viewing own session: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	res = postAuthJSON(t, base+"/api/session/"+sessionID+"/items", guest.Token, `{"item":{"title":"Catan"}}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("guest adding item: want 201, got %d body:%s", res.Code, res.Body)
+	}
+	var item sessionhandlers.CreateItemResponse
+	mustJSON(t, res.Body, &item)
+
+	blocked := []struct {
+		name, method, url, body string
+	}{
+		{"profile", "GET", base + "/api/auth/profile", ""},
+		{"create session", "POST", base + "/api/session", `{"session_name":"Mine"}`},
+		{"join another session", "POST", base + "/api/session/join", fmt.Sprintf(`{"code":%q}`, other.SessionCode)},
+		{"create item outside session routes", "POST", base + "/api/item", fmt.Sprintf(`{"item":{"session_id":%q,"title":"Risk"}}`, sessionID)},
+		{"another session", "GET", base + "/api/session/" + other.SessionID.String(), ""},
+	}
+	for _, b := range blocked {
+		res = doRequest(t, b.method, b.url, guest.Token, b.body, "application/json")
+		if res.Code != http.StatusForbidden {
+			t.Fatalf("guest %s: want 403, got %d body:%s", b.name, res.Code, res.Body)
+		}
+	}
+
+	res = postAuthJSON(t, base+"/api/auth/guest/upgrade", guest.Token, `{"username":"guesthost","email":"sam@example.com","password":"secret-pass"}`)
+	if res.Code != http.StatusConflict {
+		t.Fatalf("upgrade to a taken username: want 409, got %d body:%s", res.Code, res.Body)
+	}
+	res = postAuthJSON(t, base+"/api/auth/guest/upgrade", guest.Token, `{"username":"sam","email":"sam@example.com","password":"secret-pass"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("upgrade: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var upgraded handlers.AuthResponse
+	mustJSON(t, res.Body, &upgraded)
+	if upgraded.User.ID != guest.UserID || upgraded.User.Username != "sam" {
+		t.Fatalf("upgrade should keep the guest's ID: %+v", upgraded.User)
+	}
+
+	res = doRequest(t, "GET", base+"/api/auth/profile", upgraded.Token, "", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("profile after upgrade: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	res = doRequest(t, "PATCH", base+"/api/item/"+item.ItemID.String(), upgraded.Token, `{"title":"Catan: Seafarers"}`, "application/json")
+	if res.Code != http.StatusOK {
+		t.Fatalf("editing the item added as a guest: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	res = postJSON(t, base+"/api/auth/login", `{"identifier":"sam","password":"secret-pass"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("login after upgrade: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	res = postAuthJSON(t, base+"/api/auth/guest/upgrade", upgraded.Token, `{"username":"sam2","email":"sam2@example.com","password":"secret-pass"}`)
+	if res.Code != http.StatusConflict {
+		t.Fatalf("upgrading a full account: want 409, got %d body:%s", res.Code, res.Body)
+	}
+}
@@ -0,0 +1,81 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestInviteQRCode(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	host := registerUser(t, base, "qrhost")
+	guest := registerUser(t, base, "qrguest")
+	session := createSession(t, base, host.Token, "QR")
+	sessionID := session.SessionID.String()
+	joinSession(t, base, guest.Token, session.SessionCode)
+
+	link, err := url.Parse(session.InviteLink)
+	if err != nil {
+		t.Fatalf("parse invite link: %v", err)
+	}
+	token := link.Query().Get("invite")
+	qrURL := base + "/api/session/" + sessionID + "/invite.png?size=300&level=H&invite=" + url.QueryEscape(token)
+
+	res := doRequest(t, "GET", qrURL, guest.Token, "", "")
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("participant fetching qr: want 403, got %d", res.Code)
+	}
+
+	res = doRequest(t, "GET", qrURL, host.Token, "", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("png qr: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	img, err := png.Decode(bytes.NewReader([]byte(res.Body)))
+	if err != nil {
+		t.Fatalf("decode png: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 300 {
+		t.Fatalf("png qr: want 300px wide, got %v", b)
+	}
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		t.Fatalf("binarize: %v", err)
+	}
+	decoded, err := qrcode.NewQRCodeReader().Decode(bmp, nil)
+	if err != nil {
+		t.Fatalf("decode qr: %v", err)
+	}
+	if decoded.GetText() != session.InviteLink {
+		t.Fatalf("qr decodes to %q, want %q", decoded.GetText(), session.InviteLink)
+	}
+
+	res = doRequest(t, "GET", base+"/api/session/"+sessionID+"/invite.svg", host.Token, "", "")
+	if res.Code != http.StatusOK || !strings.HasPrefix(res.Body, "<svg") {
+		t.Fatalf("svg qr for open session: want 200 svg, got %d body:%.80s", res.Code, res.Body)
+	}
+
+	res = doRequest(t, "GET", base+"/api/session/"+sessionID+"/invite.png?invite=bogus", host.Token, "", "")
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("unknown invite: want 404, got %d", res.Code)
+	}
+	res = doRequest(t, "GET", base+"/api/session/"+sessionID+"/invite.png?size=5000", host.Token, "", "")
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("oversized qr: want 400, got %d", res.Code)
+	}
+}
@@ -0,0 +1,120 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	sessionhandlers "github.com/Kam1217/optio/internal/session/handlers"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestSessionInvites(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	host := registerUser(t, base, "invitehost")
+	first := registerUser(t, base, "invitefirst")
+	second := registerUser(t, base, "invitesecond")
+	third := registerUser(t, base, "invitethird")
+
+	res := postAuthJSON(t, base+"/api/session", host.Token, `{"session_name":"Closed"}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("create session: want 201, got %d body:%s", res.Code, res.Body)
+	}
+	var session sessionhandlers.CreateSessionResponse
+	mustJSON(t, res.Body, &session)
+	sessionID := session.SessionID.String()
+	invitesURL := base + "/api/session/" + sessionID + "/invites"
+
+	res = postAuthJSON(t, base+"/api/session/join", first.Token, fmt.Sprintf(`{"code":%q}`, session.SessionCode))
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("join by code without open join: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	res = postAuthJSON(t, base+"/api/session/join", first.Token, fmt.Sprintf(`{"invite_link":%q}`, session.InviteLink))
+	if res.Code != http.StatusOK {
+		t.Fatalf("join with the session's invite link: want 200, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = postAuthJSON(t, invitesURL, first.Token, `{}`)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("participant creating invite: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	res = postAuthJSON(t, invitesURL, host.Token, `{"role":"host"}`)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("host invite: want 400, got %d body:%s", res.Code, res.Body)
+	}
+
+	expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	res = postAuthJSON(t, invitesURL, host.Token, fmt.Sprintf(`{"role":"spectator","max_uses":1,"expires_at":%q}`, expires))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("create invite: want 201, got %d body:%s", res.Code, res.Body)
+	}
+	var single sessionhandlers.InviteResponse
+	mustJSON(t, res.Body, &single)
+	if single.Token == "" || single.InviteLink == "" || single.Role != "spectator" {
+		t.Fatalf("create invite: unexpected response %+v", single)
+	}
+
+	join := func(token, invite string) httpRes {
+		return postAuthJSON(t, base+"/api/session/join", token, fmt.Sprintf(`{"invite":%q}`, invite))
+	}
+	if res = join(second.Token, single.Token); res.Code != http.StatusOK {
+		t.Fatalf("join with single-use invite: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	if role := participantRole(t, base, host.Token, sessionID, second); role != "spectator" {
+		t.Fatalf("role bound to invite: want spectator, got %q", role)
+	}
+	if res = join(second.Token, single.Token); res.Code != http.StatusOK {
+		t.Fatalf("rejoin as member should not need a use: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	if res = join(third.Token, single.Token); res.Code != http.StatusGone {
+		t.Fatalf("used-up invite: want 410, got %d body:%s", res.Code, res.Body)
+	}
+	if res = join(third.Token, "not-a-real-invite"); res.Code != http.StatusNotFound {
+		t.Fatalf("unknown invite: want 404, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = postAuthJSON(t, invitesURL, host.Token, `{}`)
+	var open sessionhandlers.InviteResponse
+	mustJSON(t, res.Body, &open)
+	res = doRequest(t, "DELETE", invitesURL+"/"+open.InviteID.String(), host.Token, "", "")
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("revoke invite: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	if res = join(third.Token, open.Token); res.Code != http.StatusGone {
+		t.Fatalf("revoked invite: want 410, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = doRequest(t, "GET", invitesURL, host.Token, "", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("list invites: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var invites []sessionhandlers.InviteResponse
+	mustJSON(t, res.Body, &invites)
+	if len(invites) != 3 {
+		t.Fatalf("list invites: want 3, got %+v", invites)
+	}
+	for _, invite := range invites {
+		if invite.Token != "" {
+			t.Fatalf("listed invites must not include tokens: %+v", invite)
+		}
+		if invite.InviteID == single.InviteID && invite.UseCount != 1 {
+			t.Fatalf("single-use invite: want 1 use, got %+v", invite)
+		}
+	}
+
+	res = doRequest(t, "PATCH", base+"/api/session/"+sessionID, host.Token, `{"open_join":true}`, "application/json")
+	if res.Code != http.StatusOK {
+		t.Fatalf("enable open join: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	joinSession(t, base, third.Token, session.SessionCode)
+}
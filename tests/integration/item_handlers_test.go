@@ -0,0 +1,166 @@
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Kam1217/optio/internal/database"
+	sessionhandlers "github.com/Kam1217/optio/internal/session/handlers"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func createItem(t *testing.T, base, token, sessionID, title string) sessionhandlers.CreateItemResponse {
+	t.Helper()
+	body := fmt.Sprintf(`{"item":{"session_id":%q,"title":%q}}`, sessionID, title)
+	res := postAuthJSON(t, base+"/api/item", token, body)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("create item %q: want 201, got %d body:%s", title, res.Code, res.Body)
+	}
+	var item sessionhandlers.CreateItemResponse
+	mustJSON(t, res.Body, &item)
+	return item
+}
+
+func TestSessionItemCRUD(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	host := registerUser(t, base, "itemhost")
+	member := registerUser(t, base, "itemmember")
+	outsider := registerUser(t, base, "itemoutsider")
+	session := createSession(t, base, host.Token, "Movie night")
+	sessionID := session.SessionID.String()
+
+	res := postAuthJSON(t, base+"/api/session/join", member.Token, fmt.Sprintf(`{"code":%q}`, session.SessionCode))
+	if res.Code != http.StatusOK {
+		t.Fatalf("join: want 200, got %d body:%s", res.Code, res.Body)
+	}
+
+	first := createItem(t, base, host.Token, sessionID, "Alien")
+	second := createItem(t, base, member.Token, sessionID, "Heat")
+	createItem(t, base, member.Token, sessionID, "Ran")
+
+	res = postAuthJSON(t, base+"/api/item", member.Token, fmt.Sprintf(`{"item":{"session_id":%q,"title":"alien"}}`, sessionID))
+	if res.Code != http.StatusConflict {
+		t.Fatalf("duplicate title: want 409, got %d body:%s", res.Code, res.Body)
+	}
+	res = postAuthJSON(t, base+"/api/item", outsider.Token, fmt.Sprintf(`{"item":{"session_id":%q,"title":"Jaws"}}`, sessionID))
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("outsider adding item: want 403, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = doRequest(t, "GET", base+"/api/session/"+sessionID+"/items?limit=2", member.Token, "", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("list items: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var page sessionhandlers.ListItemsResponse
+	mustJSON(t, res.Body, &page)
+	if page.Total != 3 || len(page.Items) != 2 || page.Items[0].ItemTitle != "Ran" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	res = doRequest(t, "GET", base+"/api/session/"+sessionID+"/items?limit=2&offset=2", member.Token, "", "")
+	mustJSON(t, res.Body, &page)
+	if len(page.Items) != 1 || page.Items[0].ItemID != first.ItemID {
+		t.Fatalf("unexpected second page: %+v", page)
+	}
+	res = doRequest(t, "GET", base+"/api/session/"+sessionID+"/items", outsider.Token, "", "")
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("outsider listing items: want 403, got %d body:%s", res.Code, res.Body)
+	}
+
+	itemURL := base + "/api/item/" + second.ItemID.String()
+	res = doRequest(t, "GET", itemURL, member.Token, "", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("get item: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	res = doRequest(t, "GET", itemURL, outsider.Token, "", "")
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("outsider getting item: want 403, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = doRequest(t, "PATCH", itemURL, member.Token, `{"title":"Heat (1995)","description":"Mann"}`, "application/json")
+	if res.Code != http.StatusOK {
+		t.Fatalf("adder editing item: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var updated sessionhandlers.CreateItemResponse
+	mustJSON(t, res.Body, &updated)
+	if updated.ItemTitle != "Heat (1995)" || updated.ItemDescription != "Mann" {
+		t.Fatalf("unexpected updated item: %+v", updated)
+	}
+	res = doRequest(t, "PATCH", itemURL, member.Token, `{"title":"ALIEN"}`, "application/json")
+	if res.Code != http.StatusConflict {
+		t.Fatalf("renaming to a taken title: want 409, got %d body:%s", res.Code, res.Body)
+	}
+	res = doRequest(t, "PATCH", itemURL, member.Token, `{"title":""}`, "application/json")
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("empty title: want 400, got %d body:%s", res.Code, res.Body)
+	}
+
+	firstURL := base + "/api/item/" + first.ItemID.String()
+	res = doRequest(t, "PATCH", firstURL, member.Token, `{"title":"Aliens"}`, "application/json")
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("editing someone else's item: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	res = doRequest(t, "DELETE", firstURL, member.Token, "", "")
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("deleting someone else's item: want 403, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = doRequest(t, "DELETE", itemURL, host.Token, "", "")
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("host deleting item: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	res = doRequest(t, "GET", itemURL, member.Token, "", "")
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("deleted item: want 404, got %d body:%s", res.Code, res.Body)
+	}
+}
+
+func TestCustomItemTitlesOnlyClashWithCustomItems(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, dbConn := startTestServer(t, dbContainer)
+	base := server.URL
+
+	host := registerUser(t, base, "titlehost")
+	session := createSession(t, base, host.Token, "Game night")
+	sessionID := session.SessionID.String()
+
+	// The test server has no Steam provider, so the Steam item goes straight
+	// into the database.
+	steam, err := dbConn.Queries.CreateSessionItem(context.Background(), database.CreateSessionItemParams{
+		SessionID:     session.SessionID,
+		ItemTitle:     "Portal 2",
+		SourceType:    "steam",
+		SourceID:      sql.NullString{String: "620", Valid: true},
+		AddedByUserID: host.User.ID,
+	})
+	if err != nil {
+		t.Fatalf("create steam item: %v", err)
+	}
+
+	createItem(t, base, host.Token, sessionID, "portal 2")
+	res := postAuthJSON(t, base+"/api/item", host.Token, fmt.Sprintf(`{"item":{"session_id":%q,"title":"PORTAL 2"}}`, sessionID))
+	if res.Code != http.StatusConflict {
+		t.Fatalf("duplicate custom title: want 409, got %d body:%s", res.Code, res.Body)
+	}
+
+	createItem(t, base, host.Token, sessionID, "Portal")
+	res = doRequest(t, "PATCH", base+"/api/item/"+steam.ID.String(), host.Token, `{"title":"Portal"}`, "application/json")
+	if res.Code != http.StatusOK {
+		t.Fatalf("renaming a steam item to a custom item's title: want 200, got %d body:%s", res.Code, res.Body)
+	}
+}
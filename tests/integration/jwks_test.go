@@ -0,0 +1,79 @@
+package integration
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/jwks"
+	"github.com/Kam1217/optio/internal/auth/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestJWKSVerifiesAccessTokens(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	user := registerUser(t, base, "jwksuser")
+
+	// Another service checks the access token with nothing but the published
+	// keys.
+	set := &jwks.Set{}
+	res := doRequest(t, "GET", base+"/.well-known/jwks.json", "", "", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("jwks: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	mustJSON(t, res.Body, set)
+	if len(set.Keys) != 1 || set.Keys[0].Kid != "test-ed25519" || set.Keys[0].Alg != "EdDSA" {
+		t.Fatalf("want only the Ed25519 key published, got %s", res.Body)
+	}
+
+	claims := &middleware.Claims{}
+	_, err = jwt.ParseWithClaims(user.Token, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := set.Lookup(kid)
+		if !ok {
+			return nil, jwks.ErrKeyNotFound
+		}
+		return key.PublicKey()
+	}, jwt.WithValidMethods([]string{"EdDSA"}), jwt.WithIssuer("optio"), jwt.WithAudience("optio-api"))
+	if err != nil {
+		t.Fatalf("verify access token with the JWKS: %v", err)
+	}
+	if claims.UserID != user.User.ID {
+		t.Fatalf("token is for %s, want %s", claims.UserID, user.User.ID)
+	}
+
+	// Tokens signed with the shared secret before the move to keys still work.
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		secret = "testsecret"
+	}
+	legacy, err := middleware.NewJWTManager(secret, "optio", "optio-api", 15*time.Minute).GenerateJWT(user.User.ID, user.User.Username)
+	if err != nil {
+		t.Fatalf("legacy token: %v", err)
+	}
+	if res := doRequest(t, "GET", base+"/api/auth/profile", legacy, "", ""); res.Code != http.StatusOK {
+		t.Fatalf("HS256 token: want 200, got %d body:%s", res.Code, res.Body)
+	}
+
+	resp, err := http.Get(base + "/.well-known/jwks.json")
+	if err != nil {
+		t.Fatalf("get jwks: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Cache-Control") == "" {
+		t.Fatalf("want the key set to be cacheable")
+	}
+}
@@ -0,0 +1,109 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	sessionhandlers "github.com/Kam1217/optio/internal/session/handlers"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func transitionSession(t *testing.T, base, token, sessionID, status string) httpRes {
+	t.Helper()
+	return doRequest(t, "POST", base+"/api/session/"+sessionID+"/status", token, fmt.Sprintf(`{"status":%q}`, status), "application/json")
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	host := registerUser(t, base, "lifehost")
+	guest := registerUser(t, base, "lifeguest")
+	session := createSession(t, base, host.Token, "Lifecycle")
+	sessionID := session.SessionID.String()
+	joinSession(t, base, guest.Token, session.SessionCode)
+
+	res := transitionSession(t, base, host.Token, sessionID, "voting")
+	if res.Code != http.StatusConflict {
+		t.Fatalf("pending to voting: want 409, got %d body:%s", res.Code, res.Body)
+	}
+	res = transitionSession(t, base, guest.Token, sessionID, "collecting")
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("participant moving session: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	res = transitionSession(t, base, host.Token, sessionID, "paused")
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("unknown status: want 400, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = transitionSession(t, base, host.Token, sessionID, "collecting")
+	if res.Code != http.StatusOK {
+		t.Fatalf("pending to collecting: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	pizza := createItem(t, base, guest.Token, sessionID, "Pizza")
+	createItem(t, base, host.Token, sessionID, "Sushi")
+
+	vote := fmt.Sprintf(`{"votes":[{"item_id":%q,"value":1}]}`, pizza.ItemID)
+	res = postAuthJSON(t, base+"/api/session/"+sessionID+"/votes", guest.Token, vote)
+	if res.Code != http.StatusConflict {
+		t.Fatalf("vote while collecting: want 409, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = transitionSession(t, base, host.Token, sessionID, "voting")
+	if res.Code != http.StatusOK {
+		t.Fatalf("collecting to voting: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	body := fmt.Sprintf(`{"item":{"session_id":%q,"title":"Tacos"}}`, sessionID)
+	res = postAuthJSON(t, base+"/api/item", guest.Token, body)
+	if res.Code != http.StatusConflict {
+		t.Fatalf("add item while voting: want 409, got %d body:%s", res.Code, res.Body)
+	}
+	for _, token := range []string{guest.Token, host.Token} {
+		res = postAuthJSON(t, base+"/api/session/"+sessionID+"/votes", token, vote)
+		if res.Code != http.StatusNoContent {
+			t.Fatalf("vote while voting: want 204, got %d body:%s", res.Code, res.Body)
+		}
+	}
+
+	res = transitionSession(t, base, host.Token, sessionID, "decided")
+	if res.Code != http.StatusOK {
+		t.Fatalf("voting to decided: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var decided sessionhandlers.SessionResponse
+	mustJSON(t, res.Body, &decided)
+	if decided.Status != "decided" || decided.WinningItemID == nil || *decided.WinningItemID != pizza.ItemID {
+		t.Fatalf("decided session: want pizza to win, got %+v", decided)
+	}
+	res = transitionSession(t, base, host.Token, sessionID, "collecting")
+	if res.Code != http.StatusConflict {
+		t.Fatalf("decided to collecting: want 409, got %d body:%s", res.Code, res.Body)
+	}
+	res = transitionSession(t, base, host.Token, sessionID, "archived")
+	if res.Code != http.StatusOK {
+		t.Fatalf("decided to archived: want 200, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = doRequest(t, "GET", base+"/api/session/"+sessionID+"/history", guest.Token, "", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("history: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var history []sessionhandlers.StatusChangeResponse
+	mustJSON(t, res.Body, &history)
+	want := []string{"collecting", "voting", "decided", "archived"}
+	if len(history) != len(want) {
+		t.Fatalf("history: want %d changes, got %+v", len(want), history)
+	}
+	for i, change := range history {
+		if change.ToStatus != want[i] || change.ChangedByUserID == nil || *change.ChangedByUserID != host.User.ID {
+			t.Fatalf("history[%d]: want %s by host, got %+v", i, want[i], change)
+		}
+	}
+}
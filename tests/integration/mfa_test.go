@@ -0,0 +1,221 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/handlers"
+	"github.com/Kam1217/optio/internal/auth/totp"
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestTOTPLogin(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	user := registerUser(t, base, "twofactor")
+	login := `{"identifier":"twofactor","password":"test123"}`
+
+	res := postAuthJSON(t, base+"/api/auth/mfa/totp", user.Token, "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("begin enrolment: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var enrollment handlers.TOTPEnrollmentResponse
+	mustJSON(t, res.Body, &enrollment)
+	key, err := totp.DecodeSecret(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("decode secret %q: %v", enrollment.Secret, err)
+	}
+
+	// Until the enrolment is confirmed, login works as before.
+	if res := postJSON(t, base+"/api/auth/login", login); res.Code != http.StatusOK {
+		t.Fatalf("login before confirming: want 200, got %d body:%s", res.Code, res.Body)
+	} else {
+		var auth handlers.AuthResponse
+		mustJSON(t, res.Body, &auth)
+		if auth.Token == "" {
+			t.Fatalf("want tokens before two-factor is confirmed, got %s", res.Body)
+		}
+	}
+
+	res = postAuthJSON(t, base+"/api/auth/mfa/totp/confirm", user.Token, `{"code":"000000"}`)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("confirm with a wrong code: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	now := time.Now()
+	res = postAuthJSON(t, base+"/api/auth/mfa/totp/confirm", user.Token, fmt.Sprintf(`{"code":%q}`, totp.Default.Code(key, now)))
+	if res.Code != http.StatusOK {
+		t.Fatalf("confirm: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var recovery handlers.RecoveryCodesResponse
+	mustJSON(t, res.Body, &recovery)
+	if len(recovery.RecoveryCodes) != 10 {
+		t.Fatalf("want 10 recovery codes, got %v", recovery.RecoveryCodes)
+	}
+
+	challenge := func() string {
+		t.Helper()
+		res := postJSON(t, base+"/api/auth/login", login)
+		if res.Code != http.StatusOK {
+			t.Fatalf("login: want 200, got %d body:%s", res.Code, res.Body)
+		}
+		var c handlers.MFAChallengeResponse
+		mustJSON(t, res.Body, &c)
+		if !c.MFARequired || c.MFAToken == "" {
+			t.Fatalf("want a two-factor challenge, got %s", res.Body)
+		}
+		return c.MFAToken
+	}
+	finish := func(token, code string) httpRes {
+		t.Helper()
+		return postJSON(t, base+"/api/auth/login/mfa", fmt.Sprintf(`{"mfa_token":%q,"code":%q}`, token, code))
+	}
+
+	mfaToken := challenge()
+	if res := doRequest(t, "GET", base+"/api/auth/profile", mfaToken, "", ""); res.Code != http.StatusUnauthorized {
+		t.Fatalf("challenge as access token: want 401, got %d body:%s", res.Code, res.Body)
+	}
+	if res := finish(mfaToken, "000000"); res.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong code: want 401, got %d body:%s", res.Code, res.Body)
+	}
+
+	// The code used to confirm cannot be used again; the next one can, once.
+	if res := finish(mfaToken, totp.Default.Code(key, now)); res.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed confirmation code: want 401, got %d body:%s", res.Code, res.Body)
+	}
+	next := totp.Default.Code(key, now.Add(totp.Default.Period))
+	res = finish(mfaToken, next)
+	if res.Code != http.StatusOK {
+		t.Fatalf("second step: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var auth handlers.AuthResponse
+	mustJSON(t, res.Body, &auth)
+	if res := doRequest(t, "GET", base+"/api/auth/profile", auth.Token, "", ""); res.Code != http.StatusOK {
+		t.Fatalf("access token after two-factor login: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	if res := finish(challenge(), next); res.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed code: want 401, got %d body:%s", res.Code, res.Body)
+	}
+
+	code := recovery.RecoveryCodes[0]
+	if res := finish(challenge(), code); res.Code != http.StatusOK {
+		t.Fatalf("recovery code: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	if res := finish(challenge(), code); res.Code != http.StatusUnauthorized {
+		t.Fatalf("reused recovery code: want 401, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = postAuthJSON(t, base+"/api/auth/mfa/totp/disable", auth.Token, `{"code":"000000"}`)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("disable with a wrong code: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	res = postAuthJSON(t, base+"/api/auth/mfa/totp/disable", auth.Token, fmt.Sprintf(`{"code":%q}`, recovery.RecoveryCodes[1]))
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("disable: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	if res := postJSON(t, base+"/api/auth/login", login); res.Code != http.StatusOK {
+		t.Fatalf("login after disabling: want 200, got %d body:%s", res.Code, res.Body)
+	} else {
+		var plain handlers.AuthResponse
+		mustJSON(t, res.Body, &plain)
+		if plain.Token == "" {
+			t.Fatalf("want tokens once two-factor is off, got %s", res.Body)
+		}
+	}
+}
+
+func TestTOTPAttemptLimits(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, dbConn := startTestServer(t, dbContainer)
+	base := server.URL
+
+	user := registerUser(t, base, "guessedat")
+	res := postAuthJSON(t, base+"/api/auth/mfa/totp", user.Token, "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("begin enrolment: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var enrollment handlers.TOTPEnrollmentResponse
+	mustJSON(t, res.Body, &enrollment)
+	key, err := totp.DecodeSecret(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("decode secret %q: %v", enrollment.Secret, err)
+	}
+	res = postAuthJSON(t, base+"/api/auth/mfa/totp/confirm", user.Token, fmt.Sprintf(`{"code":%q}`, totp.Default.Code(key, time.Now())))
+	if res.Code != http.StatusOK {
+		t.Fatalf("confirm: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var recovery handlers.RecoveryCodesResponse
+	mustJSON(t, res.Body, &recovery)
+
+	challenge := func() string {
+		t.Helper()
+		res := postJSON(t, base+"/api/auth/login", `{"identifier":"guessedat","password":"test123"}`)
+		var c handlers.MFAChallengeResponse
+		mustJSON(t, res.Body, &c)
+		if !c.MFARequired {
+			t.Fatalf("want a two-factor challenge, got %s", res.Body)
+		}
+		return c.MFAToken
+	}
+	finish := func(token, code string) httpRes {
+		t.Helper()
+		return postJSON(t, base+"/api/auth/login/mfa", fmt.Sprintf(`{"mfa_token":%q,"code":%q}`, token, code))
+	}
+
+	// A challenge finishes one login.
+	used := challenge()
+	if res := finish(used, recovery.RecoveryCodes[0]); res.Code != http.StatusOK {
+		t.Fatalf("recovery code: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	if res := finish(used, recovery.RecoveryCodes[1]); res.Code != http.StatusUnauthorized {
+		t.Fatalf("reused challenge: want 401, got %d body:%s", res.Code, res.Body)
+	}
+
+	// And takes only a few wrong codes.
+	guessed := challenge()
+	for i := 0; i < 5; i++ {
+		if res := finish(guessed, fmt.Sprintf("%06d", i)); res.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: want 401, got %d body:%s", i, res.Code, res.Body)
+		}
+	}
+	if res := finish(guessed, recovery.RecoveryCodes[1]); res.Code != http.StatusUnauthorized {
+		t.Fatalf("challenge after five wrong codes: want 401, got %d body:%s", res.Code, res.Body)
+	}
+
+	// Fresh challenges do not reset the count: ten wrong codes in a row lock
+	// two-factor, even for the right code.
+	guessed = challenge()
+	for i := 0; i < 5; i++ {
+		finish(guessed, fmt.Sprintf("%06d", i))
+	}
+	if res := finish(challenge(), recovery.RecoveryCodes[1]); res.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked two-factor: want 429, got %d body:%s", res.Code, res.Body)
+	}
+
+	events, err := dbConn.Queries.ListSecurityEventsForUser(context.Background(), database.ListSecurityEventsForUserParams{UserID: user.User.ID, Limit: 20})
+	if err != nil {
+		t.Fatalf("list security events: %v", err)
+	}
+	counts := map[string]int{}
+	for _, e := range events {
+		counts[e.EventType]++
+	}
+	if counts["mfa_failure"] != 10 || counts["mfa_lockout"] != 1 {
+		t.Fatalf("want 10 failures and a lockout recorded, got %v", counts)
+	}
+}
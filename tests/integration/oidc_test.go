@@ -0,0 +1,249 @@
+package integration
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/handlers"
+	"github.com/Kam1217/optio/internal/auth/oidc/oidctest"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// oidcClient follows the OpenID redirects one at a time, so the tests can
+// look at each hop, and carries the state cookie by hand: the cookie is
+// Secure, and the test servers speak plain HTTP.
+type oidcClient struct {
+	t     *testing.T
+	http  *http.Client
+	state string
+}
+
+func newOIDCClient(t *testing.T) *oidcClient {
+	return &oidcClient{t: t, http: &http.Client{
+		Timeout: 5 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+func (c *oidcClient) do(req *http.Request) (*http.Response, string) {
+	c.t.Helper()
+	if c.state != "" {
+		req.AddCookie(&http.Cookie{Name: "oidc_state", Value: c.state})
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+	}
+	defer resp.Body.Close()
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "oidc_state" && cookie.MaxAge > 0 {
+			c.state = cookie.Value
+		}
+	}
+	b, _ := io.ReadAll(resp.Body)
+	return resp, string(b)
+}
+
+func (c *oidcClient) get(url string) (*http.Response, string) {
+	c.t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	return c.do(req)
+}
+
+// authorize sends the browser to the provider and returns where the provider
+// sends it back to.
+func (c *oidcClient) authorize(authURL string) string {
+	c.t.Helper()
+	resp, body := c.get(authURL)
+	if resp.StatusCode != http.StatusFound {
+		c.t.Fatalf("provider: want 302, got %d body:%s", resp.StatusCode, body)
+	}
+	return resp.Header.Get("Location")
+}
+
+// login runs a whole sign-in with the fake provider and returns the
+// callback's response.
+func (c *oidcClient) login(base string) httpRes {
+	c.t.Helper()
+	resp, body := c.get(base + "/api/auth/oidc/fake/start")
+	if resp.StatusCode != http.StatusFound {
+		c.t.Fatalf("start: want 302, got %d body:%s", resp.StatusCode, body)
+	}
+	resp, body = c.get(c.authorize(resp.Header.Get("Location")))
+	return httpRes{Code: resp.StatusCode, Body: body}
+}
+
+// link runs a whole account linking with the fake provider for the user.
+func (c *oidcClient) link(base, token string) httpRes {
+	c.t.Helper()
+	req, _ := http.NewRequest("POST", base+"/api/auth/oidc/fake/link", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, body := c.do(req)
+	if resp.StatusCode != http.StatusOK {
+		c.t.Fatalf("start link: want 200, got %d body:%s", resp.StatusCode, body)
+	}
+	var start handlers.OIDCLinkResponse
+	mustJSON(c.t, body, &start)
+	resp, body = c.get(c.authorize(start.AuthorizationURL))
+	return httpRes{Code: resp.StatusCode, Body: body}
+}
+
+func listIdentities(t *testing.T, base, token string) []handlers.IdentityResponse {
+	t.Helper()
+	res := doRequest(t, "GET", base+"/api/auth/identities", token, "", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("list identities: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var identities []handlers.IdentityResponse
+	mustJSON(t, res.Body, &identities)
+	return identities
+}
+
+func TestOIDCLogin(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	testOIDC.SetUser(oidctest.User{Subject: "sub-ada", Email: "ada.oidc@example.com", EmailVerified: true, Name: "Ada Lovelace"})
+
+	res := newOIDCClient(t).login(base)
+	if res.Code != http.StatusOK {
+		t.Fatalf("first sign-in: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var first handlers.AuthResponse
+	mustJSON(t, res.Body, &first)
+	if first.Token == "" || first.User.Username != "Ada_Lovelace" || first.User.Email != "ada.oidc@example.com" || !first.User.Verified {
+		t.Fatalf("want a new verified account, got %s", res.Body)
+	}
+	if res := doRequest(t, "GET", base+"/api/auth/profile", first.Token, "", ""); res.Code != http.StatusOK {
+		t.Fatalf("profile: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	if ids := listIdentities(t, base, first.Token); len(ids) != 1 || ids[0].Provider != "fake" {
+		t.Fatalf("want one fake identity, got %+v", ids)
+	}
+
+	res = newOIDCClient(t).login(base)
+	if res.Code != http.StatusOK {
+		t.Fatalf("second sign-in: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var second handlers.AuthResponse
+	mustJSON(t, res.Body, &second)
+	if second.User.ID != first.User.ID {
+		t.Fatalf("second sign-in made another account: %s", res.Body)
+	}
+
+	// Without a password, the only identity cannot go.
+	ids := listIdentities(t, base, first.Token)
+	if res := doRequest(t, "DELETE", base+"/api/auth/identities/"+ids[0].ID.String(), first.Token, "", ""); res.Code != http.StatusConflict {
+		t.Fatalf("unlink only sign-in method: want 409, got %d body:%s", res.Code, res.Body)
+	}
+
+	// Someone with a password account cannot be taken over through a
+	// provider that reports their email.
+	registerUser(t, base, "emailowner")
+	testOIDC.SetUser(oidctest.User{Subject: "sub-impostor", Email: "emailowner@example.com", EmailVerified: true})
+	if res := newOIDCClient(t).login(base); res.Code != http.StatusConflict {
+		t.Fatalf("provider email of an existing account: want 409, got %d body:%s", res.Code, res.Body)
+	}
+
+	if resp, body := newOIDCClient(t).get(base + "/api/auth/oidc/unknown/start"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown provider: want 404, got %d body:%s", resp.StatusCode, body)
+	}
+}
+
+func TestOIDCCallbackChecksState(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+	testOIDC.SetUser(oidctest.User{Subject: "sub-state", Email: "state@example.com", EmailVerified: true})
+
+	c := newOIDCClient(t)
+	resp, body := c.get(base + "/api/auth/oidc/fake/start")
+	if resp.StatusCode != http.StatusFound || c.state == "" {
+		t.Fatalf("start: want 302 with a state cookie, got %d body:%s", resp.StatusCode, body)
+	}
+	callback := c.authorize(resp.Header.Get("Location"))
+	if !strings.HasPrefix(callback, base+"/api/auth/oidc/fake/callback?") {
+		t.Fatalf("provider sent the browser to %q", callback)
+	}
+
+	// A browser that did not start the login cannot finish it.
+	if resp, body := newOIDCClient(t).get(callback); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("callback without the state cookie: want 400, got %d body:%s", resp.StatusCode, body)
+	}
+
+	if resp, body := c.get(callback); resp.StatusCode != http.StatusOK {
+		t.Fatalf("callback: want 200, got %d body:%s", resp.StatusCode, body)
+	}
+	if resp, body := c.get(callback); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("replayed callback: want 400, got %d body:%s", resp.StatusCode, body)
+	}
+}
+
+func TestOIDCAccountLinking(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	user := registerUser(t, base, "linker")
+	testOIDC.SetUser(oidctest.User{Subject: "sub-linker", Email: "linker-elsewhere@example.com", EmailVerified: true})
+
+	res := newOIDCClient(t).link(base, user.Token)
+	if res.Code != http.StatusOK {
+		t.Fatalf("link: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var linked handlers.IdentityResponse
+	mustJSON(t, res.Body, &linked)
+	if linked.Provider != "fake" || linked.Email != "linker-elsewhere@example.com" {
+		t.Fatalf("linked identity = %s", res.Body)
+	}
+
+	// The provider account now signs in to the existing user.
+	res = newOIDCClient(t).login(base)
+	if res.Code != http.StatusOK {
+		t.Fatalf("sign-in with linked identity: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var auth handlers.AuthResponse
+	mustJSON(t, res.Body, &auth)
+	if auth.User.ID != user.User.ID {
+		t.Fatalf("want to sign in as linker, got %s", res.Body)
+	}
+
+	// Nobody else can link the same provider account.
+	other := registerUser(t, base, "otherlinker")
+	if res := newOIDCClient(t).link(base, other.Token); res.Code != http.StatusConflict {
+		t.Fatalf("link someone else's identity: want 409, got %d body:%s", res.Code, res.Body)
+	}
+
+	// With a password to fall back on, the identity can be removed.
+	if res := doRequest(t, "DELETE", base+"/api/auth/identities/"+linked.ID.String(), other.Token, "", ""); res.Code != http.StatusNotFound {
+		t.Fatalf("unlink someone else's identity: want 404, got %d body:%s", res.Code, res.Body)
+	}
+	if res := doRequest(t, "DELETE", base+"/api/auth/identities/"+linked.ID.String(), user.Token, "", ""); res.Code != http.StatusNoContent {
+		t.Fatalf("unlink: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	if ids := listIdentities(t, base, user.Token); len(ids) != 0 {
+		t.Fatalf("want no identities after unlinking, got %+v", ids)
+	}
+}
@@ -0,0 +1,75 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Kam1217/optio/internal/auth/handlers"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestChangePasswordSignsOutOtherSessions(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	registerUser(t, base, "changer")
+	login := `{"identifier":"changer","password":"test123"}`
+	res, laptopCookie := authCall(t, base+"/api/auth/login", login, "laptop", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("laptop login: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var laptop handlers.AuthResponse
+	mustJSON(t, res.Body, &laptop)
+	res, phoneCookie := authCall(t, base+"/api/auth/login", login, "phone", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("phone login: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var phone handlers.AuthResponse
+	mustJSON(t, res.Body, &phone)
+
+	res = postAuthJSON(t, base+"/api/auth/password", laptop.Token, `{"current_password":"wrong","new_password":"new-secret"}`)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("wrong current password: want 403, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = postAuthJSON(t, base+"/api/auth/password", laptop.Token, `{"current_password":"test123","new_password":"new-secret"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("change password: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var changed handlers.AuthResponse
+	mustJSON(t, res.Body, &changed)
+
+	for name, token := range map[string]string{"laptop": laptop.Token, "phone": phone.Token} {
+		if res := doRequest(t, "GET", base+"/api/auth/profile", token, "", ""); res.Code != http.StatusUnauthorized {
+			t.Fatalf("%s access token from before the change: want 401, got %d body:%s", name, res.Code, res.Body)
+		}
+	}
+	if res := doRequest(t, "GET", base+"/api/auth/profile", changed.Token, "", ""); res.Code != http.StatusOK {
+		t.Fatalf("new access token: want 200, got %d body:%s", res.Code, res.Body)
+	}
+
+	for name, cookie := range map[string]string{"laptop": laptopCookie, "phone": phoneCookie} {
+		if res, _ := authCall(t, base+"/api/auth/refresh", "", name, cookie); res.Code != http.StatusUnauthorized {
+			t.Fatalf("%s refresh from before the change: want 401, got %d body:%s", name, res.Code, res.Body)
+		}
+	}
+
+	sessions := listDeviceSessions(t, base, changed.Token)
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Fatalf("want only the new device session left, got %+v", sessions)
+	}
+
+	if res := postJSON(t, base+"/api/auth/login", login); res.Code != http.StatusUnauthorized {
+		t.Fatalf("old password: want 401, got %d body:%s", res.Code, res.Body)
+	}
+	if res := postJSON(t, base+"/api/auth/login", `{"identifier":"changer","password":"new-secret"}`); res.Code != http.StatusOK {
+		t.Fatalf("new password: want 200, got %d body:%s", res.Code, res.Body)
+	}
+}
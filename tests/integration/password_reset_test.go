@@ -0,0 +1,102 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+)
+
+var resetLinkPattern = regexp.MustCompile(`https://optio\.test/reset\?token=\S+`)
+
+// mailedTokens returns the tokens from links matching the pattern in the
+// emails sent to the address, oldest first.
+func mailedTokens(t *testing.T, to string, link *regexp.Regexp) []string {
+	t.Helper()
+	var tokens []string
+	for _, msg := range testMailer.Sent(to) {
+		if found := link.FindString(msg.Body); found != "" {
+			parsed, err := url.Parse(found)
+			if err != nil {
+				t.Fatalf("parse link %q: %v", found, err)
+			}
+			tokens = append(tokens, parsed.Query().Get("token"))
+		}
+	}
+	return tokens
+}
+
+// awaitMailedTokens is mailedTokens for mail sent in the background: it waits
+// a little for the want-th token to arrive.
+func awaitMailedTokens(t *testing.T, to string, link *regexp.Regexp, want int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tokens := mailedTokens(t, to, link)
+		if len(tokens) >= want || time.Now().After(deadline) {
+			return tokens
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	registerUser(t, base, "forgetful")
+	const email = "forgetful@example.com"
+	res, refreshCookie := authCall(t, base+"/api/auth/login", `{"identifier":"forgetful","password":"test123"}`, "laptop", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("login: want 200, got %d body:%s", res.Code, res.Body)
+	}
+
+	known := postJSON(t, base+"/api/auth/password/forgot", fmt.Sprintf(`{"email":%q}`, email))
+	unknown := postJSON(t, base+"/api/auth/password/forgot", `{"email":"nobody@example.com"}`)
+	if known.Code != http.StatusAccepted || unknown.Code != known.Code || unknown.Body != known.Body {
+		t.Fatalf("responses should not reveal which email exists: %d %q vs %d %q", known.Code, known.Body, unknown.Code, unknown.Body)
+	}
+
+	tokens := awaitMailedTokens(t, email, resetLinkPattern, 1)
+	if len(tokens) != 1 {
+		t.Fatalf("want one reset email, got %+v", testMailer.Sent(email))
+	}
+	if sent := testMailer.Sent("nobody@example.com"); len(sent) != 0 {
+		t.Fatalf("mail sent to an unknown address: %+v", sent)
+	}
+	token := tokens[0]
+
+	res = postJSON(t, base+"/api/auth/password/reset", `{"token":"not-a-token","password":"new-secret"}`)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("bogus token: want 400, got %d body:%s", res.Code, res.Body)
+	}
+	res = postJSON(t, base+"/api/auth/password/reset", fmt.Sprintf(`{"token":%q,"password":"new-secret"}`, token))
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("reset: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	res = postJSON(t, base+"/api/auth/password/reset", fmt.Sprintf(`{"token":%q,"password":"another"}`, token))
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("reusing reset token: want 400, got %d body:%s", res.Code, res.Body)
+	}
+
+	if res := postJSON(t, base+"/api/auth/login", `{"identifier":"forgetful","password":"test123"}`); res.Code != http.StatusUnauthorized {
+		t.Fatalf("old password: want 401, got %d body:%s", res.Code, res.Body)
+	}
+	if res := postJSON(t, base+"/api/auth/login", `{"identifier":"forgetful","password":"new-secret"}`); res.Code != http.StatusOK {
+		t.Fatalf("new password: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	if res, _ := authCall(t, base+"/api/auth/refresh", "", "laptop", refreshCookie); res.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh from before the reset: want 401, got %d body:%s", res.Code, res.Body)
+	}
+}
@@ -0,0 +1,175 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/handlers"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func createPAT(t *testing.T, base, token, body string) handlers.CreatePATResponse {
+	t.Helper()
+	res := postAuthJSON(t, base+"/api/auth/tokens", token, body)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("create token: want 201, got %d body:%s", res.Code, res.Body)
+	}
+	var pat handlers.CreatePATResponse
+	mustJSON(t, res.Body, &pat)
+	return pat
+}
+
+func TestPersonalAccessTokens(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	user := registerUser(t, base, "scripter")
+	session := createSession(t, base, user.Token, "Bot night")
+	sessionURL := base + "/api/session/" + session.SessionID.String()
+
+	pat := createPAT(t, base, user.Token, `{"name":"ci bot","scopes":["sessions:read","items:write","items:write"]}`)
+	if !strings.HasPrefix(pat.Token, "optio_pat_") || !strings.HasSuffix(pat.Token, pat.Hint) {
+		t.Fatalf("token %q with hint %q", pat.Token, pat.Hint)
+	}
+	if len(pat.Scopes) != 2 || pat.ExpiresAt != nil {
+		t.Fatalf("want two scopes and no expiry, got %+v", pat.PATResponse)
+	}
+
+	// The token does what its scopes allow, as the user.
+	if res := doRequest(t, "GET", sessionURL, pat.Token, "", ""); res.Code != http.StatusOK {
+		t.Fatalf("read session: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	if res := postAuthJSON(t, sessionURL+"/items", pat.Token, `{"item":{"title":"Chess"}}`); res.Code != http.StatusCreated {
+		t.Fatalf("add item: want 201, got %d body:%s", res.Code, res.Body)
+	}
+	// And nothing else.
+	if res := doRequest(t, "GET", sessionURL+"/items", pat.Token, "", ""); res.Code != http.StatusForbidden {
+		t.Fatalf("list items without items:read: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	if res := postAuthJSON(t, sessionURL+"/leave", pat.Token, ""); res.Code != http.StatusForbidden {
+		t.Fatalf("leave without sessions:write: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	for _, res := range []httpRes{
+		doRequest(t, "GET", base+"/api/auth/profile", pat.Token, "", ""),
+		postAuthJSON(t, base+"/api/auth/tokens", pat.Token, `{"name":"more","scopes":["sessions:write"]}`),
+	} {
+		if res.Code != http.StatusForbidden {
+			t.Fatalf("account route with a token: want 403, got %d body:%s", res.Code, res.Body)
+		}
+	}
+
+	res := doRequest(t, "GET", base+"/api/auth/tokens", user.Token, "", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("list tokens: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var listed []handlers.PATResponse
+	mustJSON(t, res.Body, &listed)
+	if len(listed) != 1 || listed[0].ID != pat.ID || listed[0].LastUsedAt == nil {
+		t.Fatalf("want the used token listed, got %s", res.Body)
+	}
+	if strings.Contains(res.Body, pat.Token) {
+		t.Fatalf("listing shows the token itself: %s", res.Body)
+	}
+
+	// Someone else cannot revoke it.
+	other := registerUser(t, base, "otherscripter")
+	if res := doRequest(t, "DELETE", base+"/api/auth/tokens/"+pat.ID.String(), other.Token, "", ""); res.Code != http.StatusNotFound {
+		t.Fatalf("revoke someone else's token: want 404, got %d body:%s", res.Code, res.Body)
+	}
+	if res := doRequest(t, "DELETE", base+"/api/auth/tokens/"+pat.ID.String(), user.Token, "", ""); res.Code != http.StatusNoContent {
+		t.Fatalf("revoke: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	if res := doRequest(t, "GET", sessionURL, pat.Token, "", ""); res.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked token: want 401, got %d body:%s", res.Code, res.Body)
+	}
+}
+
+func TestPersonalAccessTokenRules(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	user := registerUser(t, base, "tokenrules")
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	for name, body := range map[string]string{
+		"no name":        `{"name":"","scopes":["sessions:read"]}`,
+		"no scopes":      `{"name":"bot","scopes":[]}`,
+		"unknown scope":  `{"name":"bot","scopes":["admin"]}`,
+		"expiry in past": fmt.Sprintf(`{"name":"bot","scopes":["sessions:read"],"expires_at":%q}`, past),
+	} {
+		if res := postAuthJSON(t, base+"/api/auth/tokens", user.Token, body); res.Code != http.StatusBadRequest {
+			t.Fatalf("%s: want 400, got %d body:%s", name, res.Code, res.Body)
+		}
+	}
+
+	expiring := createPAT(t, base, user.Token, fmt.Sprintf(`{"name":"short","scopes":["sessions:write"],"expires_at":%q}`,
+		time.Now().Add(2*time.Second).Format(time.RFC3339Nano)))
+	if expiring.ExpiresAt == nil {
+		t.Fatalf("want an expiry, got %+v", expiring.PATResponse)
+	}
+	createSession(t, base, expiring.Token, "Before expiry")
+	time.Sleep(3 * time.Second)
+	if res := postAuthJSON(t, base+"/api/session", expiring.Token, `{"session_name":"After expiry"}`); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expired token: want 401, got %d body:%s", res.Code, res.Body)
+	}
+
+	if res := doRequest(t, "GET", base+"/api/auth/profile", "optio_pat_not-a-real-token", "", ""); res.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown token: want 401, got %d body:%s", res.Code, res.Body)
+	}
+}
+
+func TestSigningOutRevokesPersonalAccessTokens(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	user := registerUser(t, base, "rotator")
+	works := func(pat handlers.CreatePATResponse) int {
+		t.Helper()
+		return postAuthJSON(t, base+"/api/session", pat.Token, `{"session_name":"Bot session"}`).Code
+	}
+
+	// A token minted with a stolen password dies with the password.
+	stolen := createPAT(t, base, user.Token, `{"name":"not mine","scopes":["sessions:write"]}`)
+	if code := works(stolen); code != http.StatusCreated {
+		t.Fatalf("token before the change: want 201, got %d", code)
+	}
+	res := postAuthJSON(t, base+"/api/auth/password", user.Token, `{"current_password":"test123","new_password":"new-secret"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("change password: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	if code := works(stolen); code != http.StatusUnauthorized {
+		t.Fatalf("token from before the password change: want 401, got %d", code)
+	}
+	var changed handlers.AuthResponse
+	mustJSON(t, res.Body, &changed)
+
+	// So do tokens when the user signs out everywhere.
+	bot := createPAT(t, base, changed.Token, `{"name":"bot","scopes":["sessions:write"]}`)
+	if res := postAuthJSON(t, base+"/api/auth/logout-all", changed.Token, ""); res.Code != http.StatusNoContent {
+		t.Fatalf("logout-all: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	if code := works(bot); code != http.StatusUnauthorized {
+		t.Fatalf("token after logout-all: want 401, got %d", code)
+	}
+}
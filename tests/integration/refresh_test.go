@@ -0,0 +1,89 @@
+package integration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/optio/internal/auth/models"
+	"github.com/Kam1217/optio/internal/database"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, dbConn := startTestServer(t, dbContainer)
+	ctx := context.Background()
+	refresh := models.NewRefreshService(dbConn.DB, dbConn.Queries, time.Hour)
+
+	user := registerUser(t, server.URL, "rotator")
+	userID := user.User.ID
+
+	first, _, err := refresh.IssueRefreshToken(ctx, userID, "laptop", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	other, _, err := refresh.IssueRefreshToken(ctx, userID, "phone", "10.0.0.2")
+	if err != nil {
+		t.Fatalf("issue second login: %v", err)
+	}
+
+	second, rotated, err := refresh.RotateRefreshToken(ctx, first, "laptop", "10.0.0.1")
+	if err != nil || rotated.UserID != userID || !rotated.LastUsedAt.Valid {
+		t.Fatalf("rotate: %+v, err %v", rotated, err)
+	}
+	third, _, err := refresh.RotateRefreshToken(ctx, second, "laptop", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("rotate again: %v", err)
+	}
+
+	firstRow, err := dbConn.Queries.GetRefreshTokenByHash(ctx, hashOf(t, first))
+	if err != nil {
+		t.Fatalf("load first token: %v", err)
+	}
+	secondRow, _ := dbConn.Queries.GetRefreshTokenByHash(ctx, hashOf(t, second))
+	thirdRow, _ := dbConn.Queries.GetRefreshTokenByHash(ctx, hashOf(t, third))
+	if firstRow.FamilyID != thirdRow.FamilyID || firstRow.ReplacedByID.UUID != secondRow.ID || secondRow.ReplacedByID.UUID != thirdRow.ID {
+		t.Fatalf("rotation should chain tokens in one family: %+v -> %+v -> %+v", firstRow, secondRow, thirdRow)
+	}
+
+	if _, _, err := refresh.RotateRefreshToken(ctx, first, "attacker", "203.0.113.9"); !errors.Is(err, models.ErrRefreshTokenReused) {
+		t.Fatalf("reusing a rotated token: want ErrRefreshTokenReused, got %v", err)
+	}
+	if _, _, err := refresh.RotateRefreshToken(ctx, third, "laptop", "10.0.0.1"); !errors.Is(err, models.ErrInvalidRefreshToken) {
+		t.Fatalf("latest token after family revocation: want ErrInvalidRefreshToken, got %v", err)
+	}
+	if _, _, err := refresh.RotateRefreshToken(ctx, other, "phone", "10.0.0.2"); err != nil {
+		t.Fatalf("another login's family should be untouched: %v", err)
+	}
+
+	securityEvents, err := dbConn.Queries.ListSecurityEventsForUser(ctx, database.ListSecurityEventsForUserParams{UserID: userID, Limit: 10})
+	if err != nil {
+		t.Fatalf("list security events: %v", err)
+	}
+	if len(securityEvents) != 1 {
+		t.Fatalf("want exactly one security event, got %+v", securityEvents)
+	}
+	got := securityEvents[0]
+	if got.EventType != models.SecurityEventRefreshReuse || got.FamilyID.UUID != firstRow.FamilyID || got.Ip != "203.0.113.9" {
+		t.Fatalf("unexpected security event: %+v", got)
+	}
+
+	if err := refresh.RevokeRefreshToken(ctx, other); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+}
+
+func hashOf(t *testing.T, plain string) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(plain))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
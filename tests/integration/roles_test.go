@@ -0,0 +1,141 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Kam1217/optio/internal/auth/handlers"
+	sessionhandlers "github.com/Kam1217/optio/internal/session/handlers"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func joinSession(t *testing.T, base, token, code string) {
+	t.Helper()
+	res := postAuthJSON(t, base+"/api/session/join", token, fmt.Sprintf(`{"code":%q}`, code))
+	if res.Code != http.StatusOK {
+		t.Fatalf("join: want 200, got %d body:%s", res.Code, res.Body)
+	}
+}
+
+func participantRole(t *testing.T, base, token, sessionID string, user handlers.AuthResponse) string {
+	t.Helper()
+	res := doRequest(t, "GET", base+"/api/session/"+sessionID, token, "", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("get session: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var session sessionhandlers.SessionResponse
+	mustJSON(t, res.Body, &session)
+	for _, p := range session.Participants {
+		if p.UserID == user.User.ID {
+			return p.Role
+		}
+	}
+	return ""
+}
+
+func TestSessionRoles(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	host := registerUser(t, base, "rolehost")
+	cohost := registerUser(t, base, "rolecohost")
+	viewer := registerUser(t, base, "roleviewer")
+	troll := registerUser(t, base, "roletroll")
+	session := createSession(t, base, host.Token, "Roles")
+	sessionID := session.SessionID.String()
+	for _, u := range []handlers.AuthResponse{cohost, viewer, troll} {
+		joinSession(t, base, u.Token, session.SessionCode)
+	}
+	if role := participantRole(t, base, host.Token, sessionID, host); role != "host" {
+		t.Fatalf("creator role: want host, got %q", role)
+	}
+
+	participantURL := func(u handlers.AuthResponse, action string) string {
+		return fmt.Sprintf("%s/api/session/%s/participants/%s/%s", base, sessionID, u.User.ID, action)
+	}
+
+	res := doRequest(t, "PUT", participantURL(viewer, "role"), cohost.Token, `{"role":"spectator"}`, "application/json")
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("participant changing roles: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	res = doRequest(t, "PUT", participantURL(cohost, "role"), host.Token, `{"role":"co_host"}`, "application/json")
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("host appointing co-host: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	res = doRequest(t, "PUT", participantURL(viewer, "role"), cohost.Token, `{"role":"co_host"}`, "application/json")
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("co-host appointing co-host: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	res = doRequest(t, "PUT", participantURL(viewer, "role"), cohost.Token, `{"role":"spectator"}`, "application/json")
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("co-host making spectator: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	res = doRequest(t, "PUT", participantURL(host, "role"), cohost.Token, `{"role":"spectator"}`, "application/json")
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("co-host demoting host: want 403, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = postAuthJSON(t, base+"/api/session/"+sessionID+"/items", viewer.Token, `{"item":{"title":"Spectator pick"}}`)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("spectator adding item: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	item := createItem(t, base, troll.Token, sessionID, "Troll pick")
+	res = doRequest(t, "GET", base+"/api/item/"+item.ItemID.String(), viewer.Token, "", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("spectator viewing item: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	res = doRequest(t, "PATCH", base+"/api/item/"+item.ItemID.String(), cohost.Token, `{"title":"Renamed by co-host"}`, "application/json")
+	if res.Code != http.StatusOK {
+		t.Fatalf("co-host editing any item: want 200, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = doRequest(t, "PATCH", base+"/api/session/"+sessionID, troll.Token, `{"session_name":"Mine now"}`, "application/json")
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("participant changing settings: want 403, got %d body:%s", res.Code, res.Body)
+	}
+	res = doRequest(t, "PATCH", base+"/api/session/"+sessionID, cohost.Token, `{"session_name":"Renamed"}`, "application/json")
+	if res.Code != http.StatusOK {
+		t.Fatalf("co-host changing settings: want 200, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = postAuthJSON(t, participantURL(troll, "ban"), cohost.Token, "")
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("co-host banning: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	res = postAuthJSON(t, base+"/api/session/join", troll.Token, fmt.Sprintf(`{"code":%q}`, session.SessionCode))
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("banned user rejoining: want 403, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = postAuthJSON(t, participantURL(viewer, "kick"), host.Token, "")
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("host kicking: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	joinSession(t, base, viewer.Token, session.SessionCode)
+	if role := participantRole(t, base, host.Token, sessionID, viewer); role != "participant" {
+		t.Fatalf("kicked user rejoins as participant, got %q", role)
+	}
+
+	res = postAuthJSON(t, base+"/api/session/"+sessionID+"/leave", host.Token, "")
+	if res.Code != http.StatusConflict {
+		t.Fatalf("host leaving without transfer: want 409, got %d body:%s", res.Code, res.Body)
+	}
+	res = postAuthJSON(t, base+"/api/session/"+sessionID+"/host", host.Token, fmt.Sprintf(`{"user_id":%q}`, cohost.User.ID))
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("transfer host: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	if role := participantRole(t, base, cohost.Token, sessionID, cohost); role != "host" {
+		t.Fatalf("new host role: got %q", role)
+	}
+	if role := participantRole(t, base, cohost.Token, sessionID, host); role != "co_host" {
+		t.Fatalf("previous host role: got %q", role)
+	}
+}
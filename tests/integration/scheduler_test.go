@@ -0,0 +1,163 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kam1217/optio/app"
+	"github.com/Kam1217/optio/internal/events"
+	sessionhandlers "github.com/Kam1217/optio/internal/session/handlers"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestSchedulerAdvancesDueSessions(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, dbConn := startTestServer(t, dbContainer)
+	base := server.URL
+
+	start := time.Now().UTC().Truncate(time.Second)
+	collectUntil, voteUntil := start.Add(time.Hour), start.Add(2*time.Hour)
+
+	host := registerUser(t, base, "deadlinehost")
+	guest := registerUser(t, base, "deadlineguest")
+	body := fmt.Sprintf(`{"session_name":"Deadlines","open_join":true,"collect_until":%q,"vote_until":%q}`,
+		collectUntil.Format(time.RFC3339), voteUntil.Format(time.RFC3339))
+	res := postAuthJSON(t, base+"/api/session", host.Token, body)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("create session: want 201, got %d body:%s", res.Code, res.Body)
+	}
+	var session sessionhandlers.CreateSessionResponse
+	mustJSON(t, res.Body, &session)
+	sessionID := session.SessionID.String()
+	joinSession(t, base, guest.Token, session.SessionCode)
+
+	late := fmt.Sprintf(`{"vote_until":%q}`, start.Add(-time.Hour).Format(time.RFC3339))
+	res = doRequest(t, "PATCH", base+"/api/session/"+sessionID, host.Token, late, "application/json")
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("deadline in the past: want 400, got %d body:%s", res.Code, res.Body)
+	}
+
+	pizza := createItem(t, base, guest.Token, sessionID, "Pizza")
+	createItem(t, base, host.Token, sessionID, "Sushi")
+
+	bus := events.NewMemoryBus()
+	var mu sync.Mutex
+	var seen []events.Type
+	unsubscribe, _ := bus.Subscribe(session.SessionID, func(e events.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, e.Type)
+	})
+	defer unsubscribe()
+
+	var clockMu sync.Mutex
+	now := start
+	clock := func() time.Time {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		return now
+	}
+	setClock := func(t time.Time) {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		now = t
+	}
+
+	// Several replicas tick at once; each due session must move exactly once.
+	replicas := make([]*app.Scheduler, 4)
+	for i := range replicas {
+		replicas[i] = app.NewScheduler(dbConn.DB, dbConn.Queries)
+		replicas[i].Events = bus
+		replicas[i].Now = clock
+	}
+	tickAll := func() int {
+		var wg sync.WaitGroup
+		advanced := make([]int, len(replicas))
+		for i, s := range replicas {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				n, err := s.Tick(context.Background())
+				if err != nil {
+					t.Errorf("tick: %v", err)
+				}
+				advanced[i] = n
+			}()
+		}
+		wg.Wait()
+		sum := 0
+		for _, n := range advanced {
+			sum += n
+		}
+		return sum
+	}
+
+	if n := tickAll(); n != 0 {
+		t.Fatalf("before any deadline: want 0 sessions advanced, got %d", n)
+	}
+
+	setClock(collectUntil.Add(time.Second))
+	if n := tickAll(); n != 1 {
+		t.Fatalf("after collect_until: want 1 session advanced, got %d", n)
+	}
+	if status := getSession(t, base, host.Token, sessionID).Status; status != "voting" {
+		t.Fatalf("after collect_until: want voting, got %q", status)
+	}
+
+	vote := fmt.Sprintf(`{"votes":[{"item_id":%q,"value":1}]}`, pizza.ItemID)
+	for _, token := range []string{host.Token, guest.Token} {
+		res = postAuthJSON(t, base+"/api/session/"+sessionID+"/votes", token, vote)
+		if res.Code != http.StatusNoContent {
+			t.Fatalf("vote: want 204, got %d body:%s", res.Code, res.Body)
+		}
+	}
+
+	setClock(voteUntil.Add(time.Second))
+	if n := tickAll(); n != 1 {
+		t.Fatalf("after vote_until: want 1 session advanced, got %d", n)
+	}
+	decided := getSession(t, base, host.Token, sessionID)
+	if decided.Status != "decided" || decided.WinningItemID == nil || *decided.WinningItemID != pizza.ItemID {
+		t.Fatalf("after vote_until: want pizza decided, got %+v", decided)
+	}
+
+	res = doRequest(t, "GET", base+"/api/session/"+sessionID+"/history", host.Token, "", "")
+	var history []sessionhandlers.StatusChangeResponse
+	mustJSON(t, res.Body, &history)
+	want := []string{"collecting", "voting", "decided"}
+	if len(history) != len(want) {
+		t.Fatalf("history: want %d changes, got %+v", len(want), history)
+	}
+	for i, change := range history {
+		if change.ToStatus != want[i] || change.ChangedByUserID != nil {
+			t.Fatalf("history[%d]: want %s by the scheduler, got %+v", i, want[i], change)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	wantEvents := []events.Type{events.StatusChanged, events.StatusChanged, events.StatusChanged, events.ResultDecided}
+	if fmt.Sprint(seen) != fmt.Sprint(wantEvents) {
+		t.Fatalf("events: want %v, got %v", wantEvents, seen)
+	}
+}
+
+func getSession(t *testing.T, base, token, sessionID string) sessionhandlers.SessionResponse {
+	t.Helper()
+	res := doRequest(t, "GET", base+"/api/session/"+sessionID, token, "", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("get session: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var session sessionhandlers.SessionResponse
+	mustJSON(t, res.Body, &session)
+	return session
+}
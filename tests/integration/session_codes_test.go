@@ -0,0 +1,72 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Kam1217/optio/app"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// fixedCodes always draws the same code, forcing a collision on the second
+// session that uses it.
+type fixedCodes string
+
+func (c fixedCodes) Generate() (string, error) { return string(c), nil }
+
+func TestSessionCodesReusedOnlyAfterArchive(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, dbConn := startTestServer(t, dbContainer)
+	base := server.URL
+	ctx := context.Background()
+
+	host := registerUser(t, base, "codehost")
+	guest := registerUser(t, base, "codeguest")
+
+	sessions := app.NewSessionService(dbConn.DB, dbConn.Queries, "https://optio.test/join")
+	sessions.Codes = fixedCodes("BRAVE-OTTER-42")
+	sessions.CodeAttempts = 3
+
+	opts := app.SessionOptions{OpenJoin: true}
+	first, _, err := sessions.CreateNewSession(ctx, "First", host.User.ID, opts)
+	if err != nil {
+		t.Fatalf("create first session: %v", err)
+	}
+	if _, _, err := sessions.CreateNewSession(ctx, "Second", host.User.ID, opts); !errors.Is(err, app.ErrCodesExhausted) {
+		t.Fatalf("code held by a live session: want ErrCodesExhausted, got %v", err)
+	}
+
+	// Codes are matched without regard to case.
+	joinSession(t, base, guest.Token, strings.ToLower(first.SessionCode))
+
+	for _, status := range []string{"cancelled", "archived"} {
+		res := transitionSession(t, base, host.Token, first.ID.String(), status)
+		if res.Code != http.StatusOK {
+			t.Fatalf("move first session to %s: want 200, got %d body:%s", status, res.Code, res.Body)
+		}
+	}
+
+	second, _, err := sessions.CreateNewSession(ctx, "Second", host.User.ID, opts)
+	if err != nil {
+		t.Fatalf("reuse archived code: %v", err)
+	}
+	if second.SessionCode != first.SessionCode {
+		t.Fatalf("want code %q reused, got %q", first.SessionCode, second.SessionCode)
+	}
+
+	joined, err := sessions.JoinSession(ctx, first.SessionCode, guest.User.ID)
+	if err != nil {
+		t.Fatalf("join by reused code: %v", err)
+	}
+	if joined.ID != second.ID {
+		t.Fatalf("reused code should lead to the live session %s, got %s", second.ID, joined.ID)
+	}
+}
@@ -0,0 +1,143 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Kam1217/optio/internal/auth/handlers"
+	sessionhandlers "github.com/Kam1217/optio/internal/session/handlers"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func registerUser(t *testing.T, base, username string) handlers.AuthResponse {
+	t.Helper()
+	body := fmt.Sprintf(`{"username":%q, "email":"%s@example.com", "password":"test123"}`, username, username)
+	res := postJSON(t, base+"/api/auth/register", body)
+	if res.Code != http.StatusOK {
+		t.Fatalf("register %s: want 200, got %d body:%s", username, res.Code, res.Body)
+	}
+	var auth handlers.AuthResponse
+	mustJSON(t, res.Body, &auth)
+	return auth
+}
+
+func createSession(t *testing.T, base, token, name string) sessionhandlers.CreateSessionResponse {
+	t.Helper()
+	res := postAuthJSON(t, base+"/api/session", token, fmt.Sprintf(`{"session_name":%q,"open_join":true}`, name))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("create session: want 201, got %d body:%s", res.Code, res.Body)
+	}
+	var session sessionhandlers.CreateSessionResponse
+	mustJSON(t, res.Body, &session)
+	return session
+}
+
+func TestJoinSession(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	host := registerUser(t, base, "host1")
+	guest := registerUser(t, base, "guest1")
+	session := createSession(t, base, host.Token, "Game night")
+
+	res := postAuthJSON(t, base+"/api/session/join", guest.Token, fmt.Sprintf(`{"code":%q}`, session.SessionCode))
+	if res.Code != http.StatusOK {
+		t.Fatalf("join by code: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	var joined sessionhandlers.SessionResponse
+	mustJSON(t, res.Body, &joined)
+	if joined.SessionID != session.SessionID {
+		t.Fatalf("joined wrong session: got %v, want %v", joined.SessionID, session.SessionID)
+	}
+	if len(joined.Participants) != 2 {
+		t.Fatalf("participants: want creator and joiner, got %+v", joined.Participants)
+	}
+	if joined.Participants[0].UserID != host.User.ID {
+		t.Fatalf("creator should be the first participant, got %+v", joined.Participants)
+	}
+
+	res = postAuthJSON(t, base+"/api/session/join", guest.Token, fmt.Sprintf(`{"invite_link":%q}`, session.InviteLink))
+	if res.Code != http.StatusOK {
+		t.Fatalf("join again by invite link: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	mustJSON(t, res.Body, &joined)
+	if len(joined.Participants) != 2 {
+		t.Fatalf("joining twice should be idempotent, got %+v", joined.Participants)
+	}
+
+	res = postAuthJSON(t, base+"/api/session/join?code="+session.SessionCode, guest.Token, "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("join by query code: want 200, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = postAuthJSON(t, base+"/api/session/join", guest.Token, `{"code":"does-not-exist"}`)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("unknown code: want 404, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = postAuthJSON(t, base+"/api/session/join", guest.Token, `{}`)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("missing code: want 400, got %d body:%s", res.Code, res.Body)
+	}
+
+	res = postJSON(t, base+"/api/session/join", fmt.Sprintf(`{"code":%q}`, session.SessionCode))
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("no token: want 401, got %d body:%s", res.Code, res.Body)
+	}
+}
+
+func TestCrossSessionAccessRefused(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	alice := registerUser(t, base, "alice")
+	mallory := registerUser(t, base, "mallory")
+	aliceSession := createSession(t, base, alice.Token, "Alice's session")
+	createSession(t, base, mallory.Token, "Mallory's session")
+	item := createItem(t, base, alice.Token, aliceSession.SessionID.String(), "Secret pick")
+
+	sessionURL := base + "/api/session/" + aliceSession.SessionID.String()
+	itemURL := base + "/api/item/" + item.ItemID.String()
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+	}{
+		{name: "view session", method: "GET", url: sessionURL},
+		{name: "list items", method: "GET", url: sessionURL + "/items"},
+		{name: "add item via route", method: "POST", url: sessionURL + "/items", body: `{"item":{"title":"Intruder"}}`},
+		{name: "view item", method: "GET", url: itemURL},
+		{name: "edit item", method: "PATCH", url: itemURL, body: `{"title":"Hijacked"}`},
+		{name: "delete item", method: "DELETE", url: itemURL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := doRequest(t, tt.method, tt.url, mallory.Token, tt.body, "application/json")
+			if res.Code != http.StatusForbidden {
+				t.Fatalf("want 403, got %d body:%s", res.Code, res.Body)
+			}
+		})
+	}
+
+	// Naming another user and session in the body doesn't help either.
+	body := fmt.Sprintf(`{"item":{"session_id":%q,"added_by_user_id":%q,"title":"Forged"}}`, aliceSession.SessionID, alice.User.ID)
+	res := postAuthJSON(t, base+"/api/item", mallory.Token, body)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("forged item: want 403, got %d body:%s", res.Code, res.Body)
+	}
+}
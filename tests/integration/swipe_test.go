@@ -0,0 +1,133 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Kam1217/optio/internal/auth/handlers"
+	sessionhandlers "github.com/Kam1217/optio/internal/session/handlers"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestSwipeMatchIgnoresSpectators(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	host := registerUser(t, base, "swipehost")
+	player := registerUser(t, base, "swipeplayer")
+	watcher := registerUser(t, base, "swipewatcher")
+
+	res := postAuthJSON(t, base+"/api/session", host.Token, `{"session_name":"Swipes","mode":"swipe","open_join":true}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("create session: want 201, got %d body:%s", res.Code, res.Body)
+	}
+	var session sessionhandlers.CreateSessionResponse
+	mustJSON(t, res.Body, &session)
+	sessionID := session.SessionID.String()
+	for _, u := range []handlers.AuthResponse{player, watcher} {
+		joinSession(t, base, u.Token, session.SessionCode)
+	}
+	res = doRequest(t, "PUT", fmt.Sprintf("%s/api/session/%s/participants/%s/role", base, sessionID, watcher.User.ID), host.Token, `{"role":"spectator"}`, "application/json")
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("make spectator: want 204, got %d body:%s", res.Code, res.Body)
+	}
+
+	if res := transitionSession(t, base, host.Token, sessionID, "collecting"); res.Code != http.StatusOK {
+		t.Fatalf("collecting: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	res = postAuthJSON(t, base+"/api/session/"+sessionID+"/items", host.Token, `{"item":{"title":"Pizza"}}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("add item: want 201, got %d body:%s", res.Code, res.Body)
+	}
+	var item sessionhandlers.CreateItemResponse
+	mustJSON(t, res.Body, &item)
+	if res := transitionSession(t, base, host.Token, sessionID, "voting"); res.Code != http.StatusOK {
+		t.Fatalf("voting: want 200, got %d body:%s", res.Code, res.Body)
+	}
+
+	swipe := fmt.Sprintf(`{"item_id":%q,"liked":true}`, item.ItemID)
+	var result sessionhandlers.SwipeResponse
+	for i, u := range []handlers.AuthResponse{host, player} {
+		res := postAuthJSON(t, base+"/api/session/"+sessionID+"/swipes", u.Token, swipe)
+		if res.Code != http.StatusOK {
+			t.Fatalf("swipe %d: want 200, got %d body:%s", i, res.Code, res.Body)
+		}
+		mustJSON(t, res.Body, &result)
+	}
+	// Everyone who can swipe liked the item; the spectator cannot hold it up.
+	if !result.Matched || result.WinningItemID == nil || *result.WinningItemID != item.ItemID {
+		t.Fatalf("want a match on the item, got %+v", result)
+	}
+}
+
+func TestSwipeMatchWhenHoldoutsGo(t *testing.T) {
+	dbContainer, err := startPostgresContainer(context.Background())
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+	defer testcontainers.CleanupContainer(t, dbContainer)
+
+	server, _ := startTestServer(t, dbContainer)
+	base := server.URL
+
+	host := registerUser(t, base, "holdouthost")
+	liker := registerUser(t, base, "holdoutliker")
+	kicked := registerUser(t, base, "holdoutkicked")
+	quitter := registerUser(t, base, "holdoutquitter")
+
+	res := postAuthJSON(t, base+"/api/session", host.Token, `{"session_name":"Swipes","mode":"swipe","open_join":true}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("create session: want 201, got %d body:%s", res.Code, res.Body)
+	}
+	var session sessionhandlers.CreateSessionResponse
+	mustJSON(t, res.Body, &session)
+	sessionID := session.SessionID.String()
+	for _, u := range []handlers.AuthResponse{liker, kicked, quitter} {
+		joinSession(t, base, u.Token, session.SessionCode)
+	}
+
+	if res := transitionSession(t, base, host.Token, sessionID, "collecting"); res.Code != http.StatusOK {
+		t.Fatalf("collecting: want 200, got %d body:%s", res.Code, res.Body)
+	}
+	res = postAuthJSON(t, base+"/api/session/"+sessionID+"/items", host.Token, `{"item":{"title":"Tacos"}}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("add item: want 201, got %d body:%s", res.Code, res.Body)
+	}
+	var item sessionhandlers.CreateItemResponse
+	mustJSON(t, res.Body, &item)
+	if res := transitionSession(t, base, host.Token, sessionID, "voting"); res.Code != http.StatusOK {
+		t.Fatalf("voting: want 200, got %d body:%s", res.Code, res.Body)
+	}
+
+	swipe := fmt.Sprintf(`{"item_id":%q,"liked":true}`, item.ItemID)
+	for i, u := range []handlers.AuthResponse{host, liker} {
+		if res := postAuthJSON(t, base+"/api/session/"+sessionID+"/swipes", u.Token, swipe); res.Code != http.StatusOK {
+			t.Fatalf("swipe %d: want 200, got %d body:%s", i, res.Code, res.Body)
+		}
+	}
+
+	res = postAuthJSON(t, fmt.Sprintf("%s/api/session/%s/participants/%s/kick", base, sessionID, kicked.User.ID), host.Token, "")
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("kick: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	if got := getSession(t, base, host.Token, sessionID); got.Status != "voting" {
+		t.Fatalf("one participant still to swipe: want voting, got %q", got.Status)
+	}
+
+	// Once the last holdout leaves, everyone left likes the item.
+	if res := postAuthJSON(t, base+"/api/session/"+sessionID+"/leave", quitter.Token, ""); res.Code != http.StatusNoContent {
+		t.Fatalf("leave: want 204, got %d body:%s", res.Code, res.Body)
+	}
+	got := getSession(t, base, host.Token, sessionID)
+	if got.Status != "decided" || got.WinningItemID == nil || *got.WinningItemID != item.ItemID {
+		t.Fatalf("want a match on the item, got %+v", got)
+	}
+}